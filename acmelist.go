@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"9fans.net/go/acme"
+)
+
+// acmeList maintains an acme window with the paths of the marked images.
+// Looking at a path, with the right button, displays its image.
+type acmeList struct {
+	mu    sync.Mutex
+	win   *acme.Win // nil after the window is deleted
+	paths []string  // the marked paths, in the order they were marked
+	gotoC chan<- string
+}
+
+// markedList is the acme window of -acme, or nil.
+var markedList *acmeList
+
+// openAcmeList opens the acme window with the marked icons. The paths
+// looked at in the window are sent to gotoC.
+func openAcmeList(icons []*Icon, gotoC chan<- string) (*acmeList, error) {
+	win, err := acme.New()
+	if err != nil {
+		return nil, err
+	}
+	l := &acmeList{win: win, gotoC: gotoC}
+	for _, icon := range icons {
+		if icon.Marked() {
+			l.paths = append(l.paths, icon.path)
+		}
+	}
+	win.Name("/%s/marked", progName)
+	l.refresh()
+	go func() {
+		win.EventLoop(l)
+		l.mu.Lock()
+		l.win = nil
+		l.mu.Unlock()
+	}()
+	return l, nil
+}
+
+// update adds or removes the path from the window.
+func (l *acmeList) update(path string, marked bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := slices.Index(l.paths, path); i >= 0 {
+		l.paths = slices.Delete(l.paths, i, i+1)
+	}
+	if marked {
+		l.paths = append(l.paths, path)
+	}
+	l.refresh()
+}
+
+// refresh rewrites the body of the window. The caller holds l.mu.
+func (l *acmeList) refresh() {
+	if l.win == nil {
+		return
+	}
+	var b strings.Builder
+	for _, p := range l.paths {
+		b.WriteString(p)
+		b.WriteByte('\n')
+	}
+	if err := l.win.Addr(","); err != nil {
+		log.Printf("acme: %v", err)
+		return
+	}
+	if _, err := l.win.Write("data", []byte(b.String())); err != nil {
+		log.Printf("acme: %v", err)
+		return
+	}
+	l.win.Ctl("clean")
+}
+
+// Execute leaves the commands to acme.
+func (l *acmeList) Execute(cmd string) bool {
+	return false
+}
+
+// Look displays the image of a marked path. Other text is left to acme.
+func (l *acmeList) Look(arg string) bool {
+	path := strings.TrimSpace(arg)
+	l.mu.Lock()
+	found := slices.Contains(l.paths, path)
+	l.mu.Unlock()
+	if !found {
+		return false
+	}
+	select {
+	case l.gotoC <- path:
+	default:
+		// the previous one is not handled yet
+	}
+	return true
+}
+
+// indexOfPath returns the index of the icon of path, or -1.
+func indexOfPath(icons []*Icon, path string) int {
+	return slices.IndexFunc(icons, func(icon *Icon) bool { return icon.path == path })
+}
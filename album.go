@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// album is a saved search: the images under the paths that satisfy the
+// conditions of -only, in the order of -sort. The images are found again
+// when the album is opened, so it follows the files as they change.
+type album struct {
+	Paths []string `json:"paths"`
+	Only  string   `json:"only,omitempty"`
+	Sort  string   `json:"sort,omitempty"`
+}
+
+// albumsFile returns the file of the saved albums.
+func albumsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("albums: %w", err)
+	}
+	return filepath.Join(dir, progName, "albums.json"), nil
+}
+
+// readAlbums returns the saved albums by name.
+func readAlbums() (map[string]album, error) {
+	name, err := albumsFile()
+	if err != nil {
+		return nil, err
+	}
+	albums := make(map[string]album)
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return albums, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("albums: %w", err)
+	}
+	if err := json.Unmarshal(data, &albums); err != nil {
+		return nil, fmt.Errorf("albums: %s: %w", name, err)
+	}
+	return albums, nil
+}
+
+// saveAlbum saves the album a under name, replacing any album with the
+// same name. The paths are saved absolute, to open it from anywhere.
+func saveAlbum(name string, a album) error {
+	albums, err := readAlbums()
+	if err != nil {
+		return err
+	}
+	for i, p := range a.Paths {
+		if _, remote := remoteSourceOf(p); remote {
+			continue
+		}
+		if a.Paths[i], err = filepath.Abs(p); err != nil {
+			return fmt.Errorf("albums: %w", err)
+		}
+	}
+	albums[name] = a
+	data, err := json.MarshalIndent(albums, "", "\t")
+	if err != nil {
+		return fmt.Errorf("albums: %w", err)
+	}
+	file, err := albumsFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("albums: %w", err)
+	}
+	// write a new file and rename it, so that a crash does not lose the albums
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("albums: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("albums: %w", err)
+	}
+	return nil
+}
+
+// openAlbum returns the album saved under name.
+func openAlbum(name string) (album, error) {
+	albums, err := readAlbums()
+	if err != nil {
+		return album{}, err
+	}
+	a, ok := albums[name]
+	if !ok {
+		var names []string
+		for n := range albums {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return album{}, fmt.Errorf("albums: no album %q, the saved albums are: %s", name, strings.Join(names, ", "))
+	}
+	return a, nil
+}
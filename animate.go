@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// animMax is the largest side of the frames of an animation. Animations
+// are for sharing, and GIFs of full size photos are huge.
+const animMax = 800
+
+// animFrames decodes the images of the icons as the frames of an animation.
+// The frames have the size of the first image, scaled down to animMax, and
+// the other images are fitted and centered in it.
+func animFrames(ctx context.Context, icons []*Icon, progress func(batchStatus)) ([]*image.RGBA, error) {
+	first, err := renderIcon(icons[0])
+	if err != nil {
+		return nil, fmt.Errorf("animation: %s: %w", icons[0].path, err)
+	}
+	size := bestFit(image.Rect(0, 0, animMax, animMax), first.Bounds()).Size()
+	canvas := image.Rectangle{Max: size}
+
+	frames := make([]*image.RGBA, len(icons))
+	runBatch(ctx, len(icons), func(i int) batchStatus {
+		st := batchStatus{name: icons[i].path}
+		img, err := renderIcon(icons[i])
+		if err != nil {
+			st.err = err
+			return st
+		}
+		frame := image.NewRGBA(canvas)
+		dimg := scaleToFit(nil, img, canvas)
+		draw.Draw(frame, center(canvas, dimg.Rect), dimg, dimg.Rect.Min, draw.Src)
+		putBytes(dimg.Pix)
+		frames[i] = frame
+		return st
+	}, progress)
+	if ctx.Err() != nil {
+		return nil, errors.New("animation: cancelled")
+	}
+	for i, f := range frames {
+		if f == nil {
+			return nil, fmt.Errorf("animation: %s cannot be decoded", icons[i].path)
+		}
+	}
+	return frames, nil
+}
+
+// encodeGIF encodes the frames as a GIF that loops forever, each shown for
+// delay milliseconds. The colors are dithered to the Plan 9 palette.
+func encodeGIF(frames []*image.RGBA, delay int) ([]byte, error) {
+	g := &gif.GIF{}
+	for _, f := range frames {
+		p := image.NewPaletted(f.Rect, palette.Plan9)
+		draw.FloydSteinberg.Draw(p, f.Rect, f, f.Rect.Min)
+		g.Image = append(g.Image, p)
+		// in hundredths of a second
+		g.Delay = append(g.Delay, max(1, (delay+5)/10))
+	}
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		return nil, fmt.Errorf("animation: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// encodeWebP encodes the frames as an animated WebP with img2webp of
+// libwebp, as Go has no WebP encoder. The frames are passed as PNGs in a
+// temporary directory.
+func encodeWebP(frames []*image.RGBA, delay int) ([]byte, error) {
+	dir, err := os.MkdirTemp("", progName)
+	if err != nil {
+		return nil, fmt.Errorf("animation: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	args := []string{"-loop", "0", "-lossy", "-d", strconv.Itoa(delay)}
+	for i, f := range frames {
+		name := filepath.Join(dir, fmt.Sprintf("frame-%05d.png", i))
+		if err := writePNG(name, f); err != nil {
+			return nil, fmt.Errorf("animation: %w", err)
+		}
+		args = append(args, name)
+	}
+	out := filepath.Join(dir, "anim.webp")
+	cmd := exec.Command("img2webp", append(args, "-o", out)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("animation: img2webp: %w", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		return nil, fmt.Errorf("animation: %w", err)
+	}
+	return data, nil
+}
+
+// writeAnimation assembles the images of the icons, in order, into the
+// animation of -animto, a GIF or, if it ends in .webp, a WebP. It returns
+// the name written.
+func writeAnimation(ctx context.Context, icons []*Icon, delay int, progress func(batchStatus)) (string, error) {
+	frames, err := animFrames(ctx, icons, progress)
+	if err != nil {
+		return "", err
+	}
+	var data []byte
+	if strings.EqualFold(filepath.Ext(*animFile), ".webp") {
+		data, err = encodeWebP(frames, delay)
+	} else {
+		data, err = encodeGIF(frames, delay)
+	}
+	if err != nil {
+		return "", err
+	}
+	name, err := writeExport(*animFile, data)
+	if err != nil {
+		return "", fmt.Errorf("animation: %w", err)
+	}
+	return name, nil
+}
+
+// animateMarked asks for the frame delay and assembles the marked images,
+// in the order of the view, into an animation.
+func (dctl *DisplayControl) animateMarked(marked []*Icon) {
+	answer, ok := dctl.readText("animation, the delay of the frames in milliseconds (100): ", func(string) []string { return nil })
+	if !ok {
+		return
+	}
+	delay := 100
+	if answer != "" {
+		d, err := strconv.Atoi(answer)
+		if err != nil || d <= 0 {
+			log.Printf("animation: bad delay %q", answer)
+			return
+		}
+		delay = d
+	}
+	var name string
+	err := dctl.showBatch("animation "+*animFile, len(marked), func(ctx context.Context, progress func(batchStatus)) error {
+		var err error
+		name, err = writeAnimation(ctx, marked, delay, progress)
+		return err
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	log.Printf("animation: %d frames of %d ms in %s", len(marked), delay, name)
+}
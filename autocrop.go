@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// cropTolerance is how much, per channel in 0-255, the pixels of a border
+// may differ from its color. It absorbs the noise of scans and JPEG.
+const cropTolerance = 24
+
+// borderCrop returns the bounds of the content of img, without the uniform
+// borders around it. The color of the borders is that of the top left corner.
+// It returns the bounds of img if there are no borders or if the image is
+// uniform.
+func borderCrop(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	if b.Dx() < 3 || b.Dy() < 3 {
+		return b
+	}
+	bg := img.At(b.Min.X, b.Min.Y)
+	br, bgg, bb, _ := bg.RGBA()
+	same := func(x, y int) bool {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return absDiff(uint8(r>>8), uint8(br>>8)) <= cropTolerance &&
+			absDiff(uint8(g>>8), uint8(bgg>>8)) <= cropTolerance &&
+			absDiff(uint8(b>>8), uint8(bb>>8)) <= cropTolerance
+	}
+	row := func(y, x0, x1 int) bool {
+		for x := x0; x < x1; x++ {
+			if !same(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	col := func(x, y0, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			if !same(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	r := b
+	for r.Min.Y < r.Max.Y && row(r.Min.Y, r.Min.X, r.Max.X) {
+		r.Min.Y++
+	}
+	if r.Min.Y == r.Max.Y {
+		return b // uniform
+	}
+	for row(r.Max.Y-1, r.Min.X, r.Max.X) {
+		r.Max.Y--
+	}
+	for col(r.Min.X, r.Min.Y, r.Max.Y) {
+		r.Min.X++
+	}
+	for col(r.Max.X-1, r.Min.Y, r.Max.Y) {
+		r.Max.X--
+	}
+	return r
+}
+
+// cropImage returns the part r of img.
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	if r.Eq(img.Bounds()) {
+		return img
+	}
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	dst := image.NewRGBA(r)
+	draw.Draw(dst, r, img, r.Min, draw.Src)
+	return dst
+}
+
+// autoCropped returns img without its uniform borders, if cropping is on.
+func autoCropped(img image.Image, crop bool) image.Image {
+	if !crop {
+		return img
+	}
+	return cropImage(img, borderCrop(img))
+}
+
+// cropInfo describes the crop r of an image with bounds b for the info.
+func cropInfo(r, b image.Rectangle) string {
+	return fmt.Sprintf("Autocrop: %dx%d, trimmed left %d, top %d, right %d, bottom %d",
+		r.Dx(), r.Dy(), r.Min.X-b.Min.X, r.Min.Y-b.Min.Y, b.Max.X-r.Max.X, b.Max.Y-r.Max.Y)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+)
+
+// AVIF images are decoded by the shell command of -avif, as there is no
+// AV1 decoder in Go. The command reads the image from its standard input
+// and prints it as PNG. The dimensions are read from the file, so that
+// image.DecodeConfig does not run the command.
+
+func init() {
+	for _, brand := range []string{"avif", "avis", "mif1"} {
+		image.RegisterFormat("avif", "????ftyp"+brand, decodeAVIF, decodeAVIFConfig)
+	}
+}
+
+var errNotAVIF = errors.New("avif: not an AVIF image")
+
+// contentType returns the MIME type of the image data. It is like
+// http.DetectContentType but it knows AVIF, camera RAW, Netpbm, QOI,
+// farbfeld and Targa.
+func contentType(data []byte) string {
+	switch {
+	case isAVIF(data):
+		return "image/avif"
+	case isRAW(data):
+		return "image/x-raw"
+	case pnmType(data) != "":
+		return pnmType(data)
+	case bytes.HasPrefix(data, []byte("qoif")):
+		return "image/qoi"
+	case bytes.HasPrefix(data, []byte("farbfeld")):
+		return "image/x-farbfeld"
+	}
+	ct := http.DetectContentType(data)
+	// Targa has no magic, only a header that makes sense. True color
+	// images start like cursors.
+	if (ct == "application/octet-stream" || ct == "image/x-icon") && isTGA(data) {
+		return "image/x-tga"
+	}
+	return ct
+}
+
+// isAVIF reports whether data is an AVIF file: an ISO base media file
+// whose brands include avif, or avis for sequences.
+func isAVIF(data []byte) bool {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	n := int(binary.BigEndian.Uint32(data))
+	if n < 16 || n > len(data) {
+		return false
+	}
+	// the major brand, the minor version and the compatible brands
+	brands := append(fourCCs(data[8:12]), fourCCs(data[16:n])...)
+	for _, b := range brands {
+		if b == "avif" || b == "avis" {
+			return true
+		}
+	}
+	return false
+}
+
+// fourCCs splits data into strings of 4 bytes.
+func fourCCs(data []byte) []string {
+	var s []string
+	for ; len(data) >= 4; data = data[4:] {
+		s = append(s, string(data[:4]))
+	}
+	return s
+}
+
+// decodeAVIF decodes the AVIF image of r with the command of -avif.
+func decodeAVIF(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !isAVIF(data) {
+		return nil, errNotAVIF
+	}
+	cmd := exec.Command("sh", "-c", *avifDecoder)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("avif: %s: %w", *avifDecoder, err)
+	}
+	if isAVIF(out) {
+		return nil, fmt.Errorf("avif: %s: the output is not PNG", *avifDecoder)
+	}
+	img, _, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("avif: %s: %w", *avifDecoder, err)
+	}
+	return img, nil
+}
+
+// decodeAVIFConfig reads the dimensions of the AVIF image of r from the
+// spatial extents of its items, the largest being the primary image. The
+// color model is a guess, the command decides it.
+func decodeAVIFConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if !isAVIF(data) {
+		return image.Config{}, errNotAVIF
+	}
+	var cfg image.Config
+	// meta is a full box, its children follow the version and the flags
+	for _, meta := range isoBoxes(data, "meta") {
+		if len(meta) < 4 {
+			continue
+		}
+		for _, iprp := range isoBoxes(meta[4:], "iprp") {
+			for _, ipco := range isoBoxes(iprp, "ipco") {
+				for _, ispe := range isoBoxes(ipco, "ispe") {
+					if len(ispe) < 12 {
+						continue
+					}
+					w, h := int(binary.BigEndian.Uint32(ispe[4:])), int(binary.BigEndian.Uint32(ispe[8:]))
+					if w*h > cfg.Width*cfg.Height {
+						cfg.Width, cfg.Height = w, h
+					}
+				}
+			}
+		}
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return image.Config{}, errors.New("avif: no image dimensions")
+	}
+	cfg.ColorModel = image.NewRGBA(image.Rectangle{}).ColorModel()
+	return cfg, nil
+}
+
+// isoBoxes returns the contents of the boxes of type typ in data, which is
+// a sequence of ISO base media boxes.
+func isoBoxes(data []byte, typ string) [][]byte {
+	var boxes [][]byte
+	for len(data) >= 8 {
+		size, header := uint64(binary.BigEndian.Uint32(data)), 8
+		switch size {
+		case 0: // to the end
+			size = uint64(len(data))
+		case 1: // a 64 bit size follows the type
+			if len(data) < 16 {
+				return boxes
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < uint64(header) || size > uint64(len(data)) {
+			return boxes
+		}
+		if string(data[4:8]) == typ {
+			boxes = append(boxes, data[header:size])
+		}
+		data = data[size:]
+	}
+	return boxes
+}
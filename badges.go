@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"image"
+)
+
+// badges are the states of an icon that are displayed on its thumbnail.
+type badges uint8
+
+const (
+	badgeMarked  badges = 1 << iota // a border
+	badgeGPS                        // a warning label at the top left corner
+	badgeCurrent                    // a tab at the top right corner, for the image last displayed
+	badgeDims                       // the pixel dimensions at the bottom left corner
+)
+
+// badgeTab is the size of the tab of badgeCurrent.
+const badgeTab = 12
+
+// iconBadges returns the badges of the icon. current tells whether
+// it is the image last displayed in the single view.
+func iconBadges(icon *IconImage, current bool) badges {
+	var b badges
+	if icon.Marked() {
+		b |= badgeMarked
+	}
+	if gps, _ := icon.GPS(); gps {
+		b |= badgeGPS
+	}
+	if current {
+		b |= badgeCurrent
+	}
+	if *showDims && !icon.Info().origBounds.Empty() {
+		b |= badgeDims
+	}
+	return b
+}
+
+// paintBadges draws the badges b of the icon, whose thumbnail is at dr, clipped
+// to clip. The labels are drawn only if they fit in the grid area ir, as text
+// is not clipped.
+func paintBadges(dctl *DisplayControl, icon *IconImage, b badges, dr image.Rectangle, w int, clip, ir image.Rectangle) {
+	window := dctl.screen
+	fits := func(y int) bool { return y >= ir.Min.Y && y+window.FontHeight() <= ir.Max.Y }
+	if b&badgeMarked != 0 {
+		borderClipped(window, dr, w, dctl.borderColor, clip)
+	}
+	if b&badgeCurrent != 0 {
+		tab := image.Rect(dr.Max.X-badgeTab, dr.Min.Y, dr.Max.X, dr.Min.Y+badgeTab).Intersect(dr)
+		if tab = tab.Intersect(clip); !tab.Empty() {
+			window.Draw(tab, dctl.currentColor, image.Point{})
+		}
+	}
+	if b&badgeGPS != 0 && fits(dr.Min.Y) {
+		window.StringBg(dr.Min, dctl.fontColor, "GPS", dctl.warnColor)
+	}
+	if y := dr.Max.Y - window.FontHeight(); b&badgeDims != 0 && fits(y) {
+		r := icon.Info().origBounds
+		dims := fmt.Sprintf("%dx%d", r.Dx(), r.Dy())
+		window.StringBg(image.Pt(dr.Min.X, y), dctl.fontColor, dims, dctl.bgColor)
+	}
+}
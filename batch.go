@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+)
+
+// batchStatus is the outcome of an item of a batch job, like an exported image.
+type batchStatus struct {
+	name string
+	err  error
+}
+
+// batchLines is the number of recent statuses the progress shows.
+const batchLines = 10
+
+// runBatch runs fn for the items 0..n-1 on a pool of workers, reporting the
+// outcome of each to progress. When ctx is cancelled the workers finish
+// their current items and take no more. It returns the items done, which
+// are all of them unless it was cancelled.
+func runBatch(ctx context.Context, n int, fn func(i int) batchStatus, progress func(batchStatus)) []bool {
+	done := make([]bool, n)
+	next := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range min(n, runtime.NumCPU()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				st := fn(i)
+				mu.Lock()
+				done[i] = true
+				progress(st)
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range n {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	return done
+}
+
+// showBatch runs job in the background and displays its progress, the counts
+// and the status of the latest items, until it ends. The user can cancel it
+// with esc. It returns the error of job.
+func (dctl *DisplayControl) showBatch(title string, total int, job func(ctx context.Context, progress func(batchStatus)) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statusC := make(chan batchStatus, total)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- job(ctx, func(st batchStatus) { statusC <- st })
+	}()
+
+	var recent []string
+	finished, failed := 0, 0
+	paint := func() {
+		msg := fmt.Sprintf("%s: %d of %d done", title, finished, total)
+		if failed > 0 {
+			msg += fmt.Sprintf(", %d failed", failed)
+		}
+		if ctx.Err() != nil {
+			msg += ". cancelling"
+		} else {
+			msg += ". esc to cancel"
+		}
+		lines := append([]string{msg}, recent...)
+		dctl.post(func() {
+			dctl.cls()
+			p := dctl.screen.Bounds().Min
+			for _, l := range lines {
+				dctl.screen.String(p, dctl.fontColor, l)
+				p.Y += dctl.screen.FontHeight()
+			}
+			if err := dctl.screen.Flush(); err != nil {
+				log.Printf("display: flush: %v", err)
+			}
+		})
+	}
+
+	paint()
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case st := <-statusC:
+			finished++
+			line := "ok " + st.name
+			if st.err != nil {
+				failed++
+				line = fmt.Sprintf("failed %s: %v", st.name, st.err)
+			}
+			recent = append(recent, line)
+			if len(recent) > batchLines {
+				recent = recent[1:]
+			}
+			paint()
+		case err := <-errC:
+			dctl.waitPaint()
+			dctl.painted = nil
+			return err
+		case k := <-dctl.kctl.C:
+			if k == escKey || k == 'q' {
+				cancel()
+				paint()
+			}
+		case <-dctl.mctl.C:
+		case <-dctl.mctl.Resize:
+			dctl.invalidate()
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			paint()
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"runtime"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// benchStage accumulates the statistics of a stage of the image pipeline.
+type benchStage struct {
+	name    string
+	count   int
+	elapsed time.Duration
+	bytes   uint64
+	mallocs uint64
+}
+
+// measure runs fn and adds its time and allocations to the stage.
+func (s *benchStage) measure(fn func()) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	fn()
+	s.elapsed += time.Since(start)
+	runtime.ReadMemStats(&after)
+	s.count++
+	s.bytes += after.TotalAlloc - before.TotalAlloc
+	s.mallocs += after.Mallocs - before.Mallocs
+}
+
+// runBenchmark processes the images of paths like the views do, but without
+// a display, and writes timing and allocation statistics per stage to w.
+// The stages run sequentially for each image, so that they do not interfere.
+func runBenchmark(paths []string, w io.Writer) {
+	scan := &benchStage{name: "scan"}
+	read := &benchStage{name: "read"}
+	decode := &benchStage{name: "decode"}
+	scaleIcon := &benchStage{name: "scale icon"}
+	scaleSingle := &benchStage{name: "scale single"}
+	convert := &benchStage{name: "convert"}
+
+	var icons []*Icon
+	scan.measure(func() {
+		icons = StartScanner(paths).Wait()
+	})
+
+	singleRect := image.Rectangle{Max: windowSize}
+	iconRect := image.Rectangle{Max: iconSize}
+	for _, icon := range icons {
+		var data []byte
+		var err error
+		read.measure(func() {
+			data, err = readImageFile(icon.path)
+		})
+		if err != nil {
+			log.Printf("bench: %v", err)
+			continue
+		}
+
+		var img image.Image
+		decode.measure(func() {
+			img, _, err = decodeFrame(data, 0)
+		})
+		if err != nil {
+			log.Printf("bench: %s: %v", icon.path, err)
+			continue
+		}
+
+		var dimg *image.RGBA
+		scaleIcon.measure(func() {
+			dimg = scaleToFit(fastScaler, img, iconRect)
+		})
+		putBytes(dimg.Pix)
+		scaleSingle.measure(func() {
+			dimg = scaleToFit(bestScaler, img, singleRect)
+		})
+		convert.measure(func() {
+			putBytes(toPlan9Bitmap(dimg))
+		})
+		putBytes(dimg.Pix)
+	}
+
+	fmt.Fprintf(w, "%-14s %8s %12s %12s %12s %12s\n",
+		"stage", "count", "total", "per item", "alloc/item", "mallocs/item")
+	for _, s := range []*benchStage{scan, read, decode, scaleIcon, scaleSingle, convert} {
+		n := max(s.count, 1)
+		fmt.Fprintf(w, "%-14s %8d %12v %12v %11.2fM %12d\n",
+			s.name, s.count, s.elapsed.Round(time.Microsecond),
+			(s.elapsed / time.Duration(n)).Round(time.Microsecond),
+			float64(s.bytes)/float64(n)/(1<<20), s.mallocs/uint64(n))
+	}
+	fmt.Fprintf(w, "images: %d, scalers: icon %s, single %s\n",
+		len(icons), scalerName(fastScaler), scalerName(bestScaler))
+}
+
+// scalerName returns a name for the scaler.
+func scalerName(s xdraw.Scaler) string {
+	switch s {
+	case nil:
+		return "adaptive"
+	case xdraw.NearestNeighbor:
+		return "nearest neighbor"
+	case xdraw.ApproxBiLinear:
+		return "approximate bilinear"
+	case xdraw.BiLinear:
+		return "bilinear"
+	case xdraw.CatmullRom:
+		return "Catmull-Rom"
+	}
+	return fmt.Sprintf("%T", s)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"image"
+	"math/bits"
+	"sync"
+)
+
+// bytePools are pools of byte slices bucketed by capacity. Bucket b holds
+// slices of capacity 1<<b. They are used for the large intermediate buffers
+// of scaling and converting images for display, which are garbage right after
+// the upload to the display and put much pressure on the GC.
+var bytePools [64]sync.Pool
+
+// getBytes returns a slice of length n from the pools. Its contents are undefined.
+func getBytes(n int) []byte {
+	b := bits.Len(uint(max(n, 1) - 1))
+	if v := bytePools[b].Get(); v != nil {
+		return (*v.(*[]byte))[:n]
+	}
+	return make([]byte, n, 1<<b)
+}
+
+// putBytes returns a slice from getBytes to the pools.
+func putBytes(s []byte) {
+	b := bits.Len(uint(cap(s))) - 1
+	if b < 0 || cap(s) != 1<<b {
+		return
+	}
+	s = s[:0]
+	bytePools[b].Put(&s)
+}
+
+// newPooledRGBA returns an RGBA image for r with pixels from the pools. Its
+// contents are undefined. Release it with putBytes(img.Pix) after use.
+func newPooledRGBA(r image.Rectangle) *image.RGBA {
+	return &image.RGBA{
+		Pix:    getBytes(4 * r.Dx() * r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
@@ -1,14 +1,82 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"iter"
 	"log"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+var (
+	// cachePages is the number of pages kept loaded by a CachedSlicePaged.
+	cachePages = 5
+	// prefetchDepth is the number of pages before and after the current one
+	// that are fetched in the background.
+	prefetchDepth = 1
+)
+
+// cacheTuning configures a CachedSlicePaged. It is also a flag.Value,
+// set as "pagesize,prefetch,pages". Negative values and empty fields
+// mean the defaults.
+type cacheTuning struct {
+	pageSize int // the number of items in a page
+	prefetch int // the number of pages fetched before and after the current one
+	pages    int // the number of pages kept loaded
+
+	auto bool // tune the values at runtime, as none is set. See tuneDepth
+}
+
+// defaultTuning is a cacheTuning with all the defaults.
+var defaultTuning = cacheTuning{-1, -1, -1, false}
+
+// withDefaults returns t with the defaults for the unset values.
+// The default page size depends on the view. If no value is set,
+// the cache tunes itself from the loads of the images.
+func (t cacheTuning) withDefaults(pageSize int) cacheTuning {
+	t.auto = t.pageSize <= 0 && t.prefetch < 0 && t.pages <= 0
+	if t.pageSize <= 0 {
+		t.pageSize = pageSize
+	}
+	if t.prefetch < 0 {
+		t.prefetch = prefetchDepth
+	}
+	if t.pages <= 0 {
+		t.pages = cachePages
+	}
+	return t
+}
+
+func (t *cacheTuning) String() string {
+	if *t == defaultTuning || *t == (cacheTuning{}) {
+		return ""
+	}
+	return fmt.Sprintf("%d,%d,%d", t.pageSize, t.prefetch, t.pages)
+}
+
+func (t *cacheTuning) Set(s string) error {
+	fields := strings.Split(s, ",")
+	if len(fields) > 3 {
+		return fmt.Errorf("too many values in %q", s)
+	}
+	vals := []*int{&t.pageSize, &t.prefetch, &t.pages}
+	for i, f := range fields {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return err
+		}
+		*vals[i] = n
+	}
+	return nil
+}
+
 // CachedItem is anything that can be lazily loaded and unloaded.
 type CachedItem interface {
 	// Loads loads the item and prepares it for use.
@@ -18,19 +86,30 @@ type CachedItem interface {
 	Unload()
 }
 
-// CachedSlice is a slice of CachedItems. It maintains a cache of loaded items.
-type CachedSlice[E CachedItem] interface {
+// CachedSlice is a slice of CachedItems, made from a slice of sources.
+// It maintains a cache of loaded items.
+type CachedSlice[S any, E CachedItem] interface {
 	// At returns the ith item and ensures it is loaded. It also returns a bool
 	// saying whether the slice contains the item.
 	At(i int) (E, bool)
+	// Peek returns the ith item without loading it.
+	Peek(i int) (E, bool)
+	// Prefetch loads the items in [from, to) in the background.
+	Prefetch(from, to int)
+	// IdleLoad loads in the background one more page near the ith item, if
+	// nothing else is loading. It returns false when there is nothing more
+	// to load near it.
+	IdleLoad(i int) bool
 	// Len returns the length of the slice.
 	Len() int
+	// Append adds the items of the sources at the end of the slice.
+	Append(srcs ...S)
 	// Free clears the cache and unloads all items. The cache cannot be reused after this.
 	Free()
 }
 
 // Get returns the items in [from, to) as an iterator.
-func Get[E CachedItem](c CachedSlice[E], from, to int) iter.Seq[E] {
+func Get[S any, E CachedItem](c CachedSlice[S, E], from, to int) iter.Seq[E] {
 	return func(yield func(E) bool) {
 		for ; from < to; from++ {
 			i, ok := c.At(from)
@@ -43,57 +122,172 @@ func Get[E CachedItem](c CachedSlice[E], from, to int) iter.Seq[E] {
 
 // CachedSlicePaged is a CachedSlice in which the slice is split into
 // pages and the most frequently used ones are cached. It tries
-// to be a bit proactive and fetch some pages before use.
-type CachedSlicePaged[E CachedItem] struct {
+// to be a bit proactive and fetch some pages before use. The items
+// are made from their sources when their page is loaded and they are
+// dropped when it is evicted, so only the cached pages take memory.
+type CachedSlicePaged[S any, E CachedItem] struct {
 	name     string
-	items    []E
+	mu       sync.RWMutex // guards srcs, items, resident and prefetch
+	srcs     []S
+	items    map[int]E    // the items made, by index
+	resident map[int]bool // the pages in the cache of the fetcher, whose items At returns
+	newItem  func(S) E
 	pageSize int
+	prefetch int // pages fetched before and after the current one
+	pages    int // pages kept loaded
+	tuning   cacheTuning
 	fetchC   chan<- pageRequest
 }
 
-// NewCachedSlicePaged returns a CachedSlicePaged for the items and sets the page size.
-// It starts a goroutine to fetch pages before use. Caller must call Free to release it
-// after use.
-func NewCachedSlicePaged[E CachedItem](name string, items []E, pageSize int) *CachedSlicePaged[E] {
+// NewCachedSlicePaged returns a CachedSlicePaged for the items that newItem makes
+// from srcs, configured by t. It starts a goroutine to fetch pages before use.
+// Caller must call Free to release it after use.
+func NewCachedSlicePaged[S any, E CachedItem](name string, srcs []S, newItem func(S) E, t cacheTuning) *CachedSlicePaged[S, E] {
+	if t.auto {
+		if n := tunePageSize(t.pageSize); n != t.pageSize {
+			if *verbose {
+				fetch, decode, _, _ := loads.snapshot()
+				log.Printf("cache %s: tune page size %d, images load in %v + %v", name, n, fetch, decode)
+			}
+			t.pageSize = n
+		}
+	}
 	if *verbose {
-		log.Printf("cache %s(%d/%d): %d pages",
-			name, len(items), pageSize, intCeil(len(items), pageSize))
+		log.Printf("cache %s(%d/%d): %d pages, prefetch %d, keep %d",
+			name, len(srcs), t.pageSize, intCeil(len(srcs), t.pageSize), t.prefetch, t.pages)
 	}
-	c := new(CachedSlicePaged[E])
+	c := new(CachedSlicePaged[S, E])
 	c.name = name
-	c.items = items
-	c.pageSize = pageSize
+	c.srcs = slices.Clone(srcs)
+	c.items = make(map[int]E)
+	c.resident = make(map[int]bool)
+	c.newItem = newItem
+	c.pageSize = t.pageSize
+	c.prefetch = t.prefetch
+	c.pages = t.pages
+	c.tuning = t
 	c.startPreFetcher()
 	return c
 }
 
-func (c *CachedSlicePaged[E]) At(pos int) (E, bool) {
-	if pos >= len(c.items) {
+func (c *CachedSlicePaged[S, E]) At(pos int) (E, bool) {
+	if pos >= c.Len() {
 		var z E
 		return z, false
 	}
 	page := pos / c.pageSize
-	c.fetchPagesLater(page-1, page+1)
-	c.fetchPageNow(page)
-	return c.items[pos], true
+	c.mu.RLock()
+	prefetch := c.prefetch
+	c.mu.RUnlock()
+	for d := 1; d <= prefetch; d++ {
+		c.fetchPagesLater(page-d, page+d)
+	}
+	// the page may be evicted again before its item is taken, then the
+	// item would be made for no page and never unloaded
+	for {
+		c.fetchPageNow(page)
+		if item, ok := c.residentItem(pos); ok {
+			return item, true
+		}
+	}
 }
 
-func (c *CachedSlicePaged[E]) Len() int {
-	return len(c.items)
+func (c *CachedSlicePaged[S, E]) Peek(pos int) (E, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if pos < 0 || pos >= len(c.srcs) {
+		var z E
+		return z, false
+	}
+	if item, ok := c.items[pos]; ok {
+		return item, true
+	}
+	// the page is not loaded, a new item is as good
+	return c.newItem(c.srcs[pos]), true
+}
+
+func (c *CachedSlicePaged[S, E]) Prefetch(from, to int) {
+	for p := from / c.pageSize; p*c.pageSize < to; p++ {
+		c.fetchPagesLater(p)
+	}
 }
 
-func (c *CachedSlicePaged[E]) Free() {
+func (c *CachedSlicePaged[S, E]) IdleLoad(pos int) bool {
+	if c.fetchC == nil || pos < 0 || pos >= c.Len() {
+		return false
+	}
+	r := pageRequest{pos / c.pageSize, make(chan int, 1), true}
+	c.fetchC <- r
+	return <-r.done != idleDone
+}
+
+func (c *CachedSlicePaged[S, E]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.srcs)
+}
+
+func (c *CachedSlicePaged[S, E]) Append(srcs ...S) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.srcs = append(c.srcs, srcs...)
+}
+
+func (c *CachedSlicePaged[S, E]) Free() {
 	c.stopPreFetcher()
-	for i := 0; i < len(c.items); i++ {
-		go func(j int) {
-			c.items[j].Unload()
-		}(i)
+	c.mu.Lock()
+	items := c.items
+	c.items = make(map[int]E)
+	c.mu.Unlock()
+	for _, item := range items {
+		go item.Unload()
 	}
 }
 
+// item returns the ith item without loading it. The item is made if needed.
+func (c *CachedSlicePaged[S, E]) item(i int) E {
+	c.mu.RLock()
+	item, ok := c.items[i]
+	c.mu.RUnlock()
+	if ok {
+		return item
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok = c.items[i]; !ok {
+		item = c.newItem(c.srcs[i])
+		c.items[i] = item
+	}
+	return item
+}
+
+// residentItem returns the ith item, made if needed, if its page is in the
+// cache. It returns false if not.
+func (c *CachedSlicePaged[S, E]) residentItem(i int) (E, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.resident[i/c.pageSize] {
+		var z E
+		return z, false
+	}
+	item, ok := c.items[i]
+	if !ok {
+		item = c.newItem(c.srcs[i])
+		c.items[i] = item
+	}
+	return item, true
+}
+
+// setResident records that the page is in the cache.
+func (c *CachedSlicePaged[S, E]) setResident(p int) {
+	c.mu.Lock()
+	c.resident[p] = true
+	c.mu.Unlock()
+}
+
 // numPages returns the total number of pages.
-func (c *CachedSlicePaged[E]) numPages() int {
-	return intCeil(len(c.items), c.pageSize)
+func (c *CachedSlicePaged[S, E]) numPages() int {
+	return intCeil(c.Len(), c.pageSize)
 }
 
 // pageRequest is a request to the page fetcher for a page.
@@ -102,33 +296,41 @@ type pageRequest struct {
 	page int
 	// done is an optional channel to notify after load. Should be buffered.
 	done chan int
+	// idle asks for the nearest page to page that is not loaded, if nothing
+	// is loading. The page, idleBusy or idleDone is sent to done at once.
+	idle bool
 }
 
+const (
+	idleBusy = -1 // other pages are loading
+	idleDone = -2 // the pages near are loaded
+)
+
 // fetchPageNow requests a page and waits until is loaded.
-func (c *CachedSlicePaged[E]) fetchPageNow(p int) {
+func (c *CachedSlicePaged[S, E]) fetchPageNow(p int) {
 	if 0 <= p && p < c.numPages() {
-		r := pageRequest{p, make(chan int, 1)}
+		r := pageRequest{p, make(chan int, 1), false}
 		c.fetchC <- r
 		<-r.done
 	}
 }
 
 // fetchPagesLater requests some pages and returns. The pages are loaded in the background.
-func (c *CachedSlicePaged[E]) fetchPagesLater(pages ...int) {
+func (c *CachedSlicePaged[S, E]) fetchPagesLater(pages ...int) {
 	for _, p := range pages {
 		if 0 <= p && p < c.numPages() {
-			c.fetchC <- pageRequest{p, nil}
+			c.fetchC <- pageRequest{p, nil, false}
 		}
 	}
 }
 
 // startPreFetcher launches the goroutine that (pre)fetches pages and maintains the cache.
 // All requests for pages should be handled with messages to c.fetchC
-func (c *CachedSlicePaged[E]) startPreFetcher() {
+func (c *CachedSlicePaged[S, E]) startPreFetcher() {
 	in := make(chan pageRequest)
 	c.fetchC = in
 	go func() {
-		var cache pageCache
+		cache := pageCache{size: c.pages}
 		var inflight loader
 
 		ready := make(chan int)
@@ -138,6 +340,14 @@ func (c *CachedSlicePaged[E]) startPreFetcher() {
 				if !ok {
 					return
 				}
+				if req.idle {
+					p := c.idlePage(req.page, &cache, &inflight)
+					req.done <- p
+					if p < 0 {
+						continue
+					}
+					req = pageRequest{page: p}
+				}
 				if cache.contains(req.page) {
 					if req.done != nil {
 						req.done <- req.page
@@ -146,8 +356,8 @@ func (c *CachedSlicePaged[E]) startPreFetcher() {
 					go func(p int) {
 						if *verbose {
 							defer func(start time.Time) {
-								log.Printf("cache %s(%d/%d): load page %d time %v",
-									c.name, len(c.items), c.pageSize, p, time.Since(start))
+								log.Printf("cache %s(%d/%d): load page %d time %v queues %v, %v",
+									c.name, c.Len(), c.pageSize, p, time.Since(start), fetchPool, decodePool)
 							}(time.Now())
 						}
 						c.loadPage(p)
@@ -158,53 +368,116 @@ func (c *CachedSlicePaged[E]) startPreFetcher() {
 				if !inflight.isActive(page) {
 					panic(fmt.Sprintf("cache: ready page %d not inprogress", page))
 				}
+				c.setResident(page)
 				if ep, evicted := cache.add(page); evicted {
-					go func(p int) {
-						if *verbose {
-							log.Printf("cache %s(%d/%d): evicted page %d",
-								c.name, len(c.items), c.pageSize, p)
-						}
-						c.unloadPage(p)
-					}(ep)
+					if *verbose {
+						log.Printf("cache %s(%d/%d): evicted page %d",
+							c.name, c.Len(), c.pageSize, ep)
+					}
+					c.unloadPage(ep)
 				}
 				if *verbose {
 					log.Printf("cache %s(%d/%d): pages %v",
-						c.name, len(c.items), c.pageSize, cache.pages)
+						c.name, c.Len(), c.pageSize, cache.pages)
 				}
 				inflight.done(page)
+				if c.tuning.auto {
+					c.retune(&cache, page)
+				}
 			}
 		}
 	}()
 }
 
+// idlePage returns the nearest page to page, in both directions, that is
+// neither loaded nor loading. Only the pages that fit in the cache with
+// page in the middle are considered, so that loading them evicts pages
+// far from it. It returns idleBusy if pages are loading, as idle loads
+// must not slow them down.
+func (c *CachedSlicePaged[S, E]) idlePage(page int, cache *pageCache, inflight *loader) int {
+	if len(inflight.loading) > 0 || !poolsIdle() {
+		return idleBusy
+	}
+	for d := 1; d <= (c.pages-1)/2; d++ {
+		for _, p := range []int{page + d, page - d} {
+			if 0 <= p && p < c.numPages() && !cache.contains(p) {
+				return p
+			}
+		}
+	}
+	return idleDone
+}
+
+// retune sets the prefetch depth and the pages kept loaded from the loads
+// of the images so far. If fewer pages are kept, those farthest from page
+// are evicted.
+func (c *CachedSlicePaged[S, E]) retune(cache *pageCache, page int) {
+	prefetch, pages := tuneDepth(c.tuning, c.pageSize)
+	c.mu.RLock()
+	same := prefetch == c.prefetch && pages == c.pages
+	c.mu.RUnlock()
+	if same {
+		return
+	}
+	if *verbose {
+		fetch, decode, size, _ := loads.snapshot()
+		log.Printf("cache %s(%d/%d): tune prefetch %d, keep %d, images load in %v + %v, %dKB",
+			c.name, c.Len(), c.pageSize, prefetch, pages, fetch, decode, int(size)/1024)
+	}
+	c.mu.Lock()
+	c.prefetch = prefetch
+	c.mu.Unlock()
+	c.pages = pages
+	for _, p := range cache.resize(pages, page) {
+		c.unloadPage(p)
+	}
+}
+
 // stopPreFetcher stops the fetcher goroutine. After this the cache is unusable.
-func (c *CachedSlicePaged[E]) stopPreFetcher() {
+func (c *CachedSlicePaged[S, E]) stopPreFetcher() {
 	if c.fetchC != nil {
 		close(c.fetchC)
 	}
 	c.fetchC = nil
 }
 
-// loadPage loads all the items of the page.
-func (c *CachedSlicePaged[E]) loadPage(p int) {
-	c.mapPageItems(p, func(item E) { item.Load() })
+// loadPage makes and loads all the items of the page.
+func (c *CachedSlicePaged[S, E]) loadPage(p int) {
+	c.mapPageItems(p, func(i int) { c.item(i).Load() })
 }
 
-// unloadPage unloads all the items of the page.
-func (c *CachedSlicePaged[E]) unloadPage(p int) {
-	c.mapPageItems(p, func(item E) { item.Unload() })
+// unloadPage drops all the items of the page, evicted from the cache,
+// and unloads them in the background. The items are dropped at once, by
+// the fetcher, so that At makes new items only when the page is back.
+func (c *CachedSlicePaged[S, E]) unloadPage(p int) {
+	begin := p * c.pageSize
+	var items []E
+	c.mu.Lock()
+	delete(c.resident, p)
+	for i := begin; i < min(len(c.srcs), begin+c.pageSize); i++ {
+		if item, ok := c.items[i]; ok {
+			items = append(items, item)
+			delete(c.items, i)
+		}
+	}
+	c.mu.Unlock()
+	go func() {
+		for _, item := range items {
+			item.Unload()
+		}
+	}()
 }
 
 // mapPageItems processes all the items of a page in parallel.
-func (c *CachedSlicePaged[E]) mapPageItems(p int, fn func(item E)) {
+func (c *CachedSlicePaged[S, E]) mapPageItems(p int, fn func(i int)) {
 	begin := p * c.pageSize
-	end := min(len(c.items), begin+c.pageSize)
+	end := min(c.Len(), begin+c.pageSize)
 	var wg sync.WaitGroup
 	wg.Add(end - begin)
 	for i := begin; i < end; i++ {
 		go func(j int) {
 			defer wg.Done()
-			fn(c.items[j])
+			fn(j)
 		}(i)
 	}
 	wg.Wait()
@@ -212,6 +485,7 @@ func (c *CachedSlicePaged[E]) mapPageItems(p int, fn func(item E)) {
 
 // pageCache is cache storage for pages.
 type pageCache struct {
+	size  int // the maximum number of pages
 	pages []int
 }
 
@@ -228,7 +502,7 @@ func (pc *pageCache) add(page int) (int, bool) {
 		return 0, false
 	}
 
-	const cacheSize = 5
+	cacheSize := pc.size
 	if len(pc.pages) < cacheSize {
 		pc.pages = append(pc.pages, page)
 		return 0, false
@@ -236,17 +510,33 @@ func (pc *pageCache) add(page int) (int, bool) {
 
 	pc.pages = append(pc.pages, page)
 	slices.Sort(pc.pages)
+	// evict the end farther from page, never page itself
 	var evicted int
-	if i := slices.Index(pc.pages, page); i >= cacheSize-i-1 {
+	if i := slices.Index(pc.pages, page); i >= cacheSize-i {
 		evicted = pc.pages[0]
 		copy(pc.pages, pc.pages[1:])
 	} else {
-		evicted = pc.pages[cacheSize-1]
+		evicted = pc.pages[cacheSize]
 	}
 	pc.pages = pc.pages[0:cacheSize]
 	return evicted, true
 }
 
+// resize changes the maximum number of pages. If there are more pages,
+// it evicts those farthest from page and returns them.
+func (pc *pageCache) resize(size, page int) []int {
+	pc.size = size
+	if len(pc.pages) <= size {
+		return nil
+	}
+	slices.SortFunc(pc.pages, func(a, b int) int {
+		return cmp.Compare(max(a-page, page-a), max(b-page, page-b))
+	})
+	evicted := slices.Clone(pc.pages[size:])
+	pc.pages = pc.pages[:size]
+	return evicted
+}
+
 // inProgress is an active page request.
 type inProgress struct {
 	p     int        // the page number
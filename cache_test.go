@@ -0,0 +1,104 @@
+package main
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPageCacheAdd(t *testing.T) {
+	tests := []struct {
+		size    int
+		pages   []int
+		add     int
+		evicted int // -1 if none
+	}{
+		{3, []int{1, 2}, 3, -1},
+		{3, []int{1, 2, 3}, 2, -1},
+		{3, []int{1, 2, 3}, 4, 1},
+		{3, []int{1, 2, 3}, 0, 3},
+		{2, []int{1, 5}, 0, 5},
+		{1, []int{5}, 0, 5},
+		{1, []int{0}, 5, 0},
+	}
+	for _, tt := range tests {
+		pc := pageCache{size: tt.size, pages: slices.Clone(tt.pages)}
+		evicted, ok := pc.add(tt.add)
+		if !ok {
+			evicted = -1
+		}
+		want := append(slices.Clone(tt.pages), tt.add)
+		want = slices.DeleteFunc(want, func(p int) bool { return p == tt.evicted })
+		slices.Sort(want)
+		want = slices.Compact(want)
+		slices.Sort(pc.pages)
+		if evicted != tt.evicted || !slices.Equal(pc.pages, want) {
+			t.Errorf("add %d to %v of %d: evicted %d, pages %v, want %d, %v",
+				tt.add, tt.pages, tt.size, evicted, pc.pages, tt.evicted, want)
+		}
+	}
+}
+
+// countedItem is a CachedItem that counts the items loaded.
+type countedItem struct {
+	mu     *sync.Mutex
+	loaded map[*countedItem]bool
+}
+
+func (i *countedItem) Load() error {
+	i.mu.Lock()
+	i.loaded[i] = true
+	i.mu.Unlock()
+	return nil
+}
+
+func (i *countedItem) Unload() {
+	i.mu.Lock()
+	delete(i.loaded, i)
+	i.mu.Unlock()
+}
+
+// TestCachedSlicePagedAt loads the items that At returns, as the views do,
+// while the pages are evicted, and checks that only the items of the pages
+// kept are left loaded.
+func TestCachedSlicePagedAt(t *testing.T) {
+	var mu sync.Mutex
+	loaded := make(map[*countedItem]bool)
+	newItem := func(int) *countedItem { return &countedItem{&mu, loaded} }
+	tuning := cacheTuning{pageSize: 2, prefetch: 0, pages: 3}
+	c := NewCachedSlicePaged("test", make([]int, 40), newItem, tuning)
+	defer c.Free()
+
+	r := rand.New(rand.NewSource(1))
+	for range 500 {
+		if item, ok := c.At(r.Intn(c.Len())); ok {
+			item.Load()
+		}
+	}
+
+	// the unloads of the evicted pages run in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.RLock()
+		cached := slices.Collect(maps.Values(c.items))
+		c.mu.RUnlock()
+		mu.Lock()
+		n, lost := len(loaded), 0
+		for item := range loaded {
+			if !slices.Contains(cached, item) {
+				lost++
+			}
+		}
+		mu.Unlock()
+		if n <= tuning.pages*tuning.pageSize && lost == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d items loaded, %d of them not in the cache", n, lost)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+const (
+	// indexName is the file of the index in the directory of -cachedir.
+	indexName = "index.json"
+	// indexMax is the most images kept in the index. Those used least
+	// recently are dropped.
+	indexMax = 200_000
+	// thumbKind is the kind of the thumbnails of the icons in the persistent cache.
+	thumbKind = "thumb"
+)
+
+// indexEntry is what a session learned about an image file. It is valid
+// while the file has the same size and modification time.
+type indexEntry struct {
+	Size   int64     `json:"size"`
+	Mtime  time.Time `json:"mtime"`
+	Used   time.Time `json:"used"`             // when the entry was last looked up
+	Key    string    `json:"key,omitempty"`    // the content key, once the image is loaded
+	Width  int       `json:"width,omitempty"`  // before the exif orientation
+	Height int       `json:"height,omitempty"` // before the exif orientation
+	Orient int       `json:"orient,omitempty"` // the exif orientation
+	Date   time.Time `json:"date"`             // when the photo was taken, or else the modification time
+	GPS    bool      `json:"gps,omitempty"`
+	Frames int       `json:"frames,omitempty"` // the number of frames, once decoded
+}
+
+// header returns the header of the image, like readImageHeader does.
+func (e indexEntry) header() (imageHeader, bool) {
+	if e.Width == 0 {
+		return imageHeader{}, false
+	}
+	return imageHeader{orientBounds(image.Rect(0, 0, e.Width, e.Height), e.Orient), e.Date}, true
+}
+
+// cacheIndex maps the paths of image files to what previous sessions
+// learned about them, so that a new session on the same directories sorts,
+// filters and paints the icons from the persistent cache, before reading
+// any image file.
+type cacheIndex struct {
+	file    string
+	mu      sync.Mutex
+	entries map[string]indexEntry
+	dirty   bool
+}
+
+// imageIndex is the index of the persistent cache. It is nil if disabled.
+var imageIndex *cacheIndex
+
+// openCacheIndex reads the index of the cache in dir, if there is one.
+func openCacheIndex(dir string) (*cacheIndex, error) {
+	x := &cacheIndex{file: filepath.Join(dir, indexName), entries: make(map[string]indexEntry)}
+	data, err := os.ReadFile(x.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cache index: %w", err)
+	}
+	if err := json.Unmarshal(data, &x.entries); err != nil {
+		// a new index is as good, the cache is filled again
+		x.entries = make(map[string]indexEntry)
+	}
+	return x, nil
+}
+
+// lookup returns the entry of the file of path, if the file did not change
+// since. It stats the file but does not read it.
+func (x *cacheIndex) lookup(path string) (indexEntry, bool) {
+	x.mu.Lock()
+	e, ok := x.entries[path]
+	x.mu.Unlock()
+	if !ok {
+		return e, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != e.Size || !info.ModTime().Equal(e.Mtime) {
+		return e, false
+	}
+	e.Used = time.Now()
+	x.mu.Lock()
+	x.entries[path] = e
+	x.dirty = true
+	x.mu.Unlock()
+	return e, true
+}
+
+// update changes the entry of the file of path with fn. If the file changed,
+// fn gets a new entry.
+func (x *cacheIndex) update(path string, fn func(e *indexEntry)) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	e := x.entries[path]
+	if e.Size != info.Size() || !e.Mtime.Equal(info.ModTime()) {
+		e = indexEntry{Size: info.Size(), Mtime: info.ModTime()}
+	}
+	e.Used = time.Now()
+	fn(&e)
+	x.entries[path] = e
+	x.dirty = true
+}
+
+// save writes the index, if it changed, keeping the indexMax entries used
+// most recently.
+func (x *cacheIndex) save() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.dirty {
+		return nil
+	}
+	if len(x.entries) > indexMax {
+		paths := make([]string, 0, len(x.entries))
+		for p := range x.entries {
+			paths = append(paths, p)
+		}
+		slices.SortFunc(paths, func(a, b string) int {
+			return x.entries[b].Used.Compare(x.entries[a].Used)
+		})
+		for _, p := range paths[indexMax:] {
+			delete(x.entries, p)
+		}
+	}
+	data, err := json.Marshal(x.entries)
+	if err != nil {
+		return fmt.Errorf("cache index: %w", err)
+	}
+	tmp := x.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("cache index: %w", err)
+	}
+	if err := os.Rename(tmp, x.file); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cache index: %w", err)
+	}
+	x.dirty = false
+	return nil
+}
+
+// thumbKey returns the key of the thumbnail of size of the image with the
+// content key, upright if oriented.
+func thumbKey(key string, size image.Point, oriented bool) string {
+	k := fmt.Sprintf("%s-%dx%d", key, size.X, size.Y)
+	if oriented {
+		k += "-o"
+	}
+	return k
+}
+
+// indexImage records the image, just read, in the index.
+func (i *IconImage) indexImage(ex *exif.Exif) {
+	i.key = contentKey(i.data)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(i.data))
+	if err != nil {
+		return
+	}
+	var date time.Time
+	if ex != nil {
+		date, _ = ex.DateTime()
+	}
+	imageIndex.update(i.Path(), func(e *indexEntry) {
+		e.Key = i.key
+		e.Width, e.Height = cfg.Width, cfg.Height
+		e.Orient = exifOrientation(ex)
+		e.GPS, _ = i.GPS()
+		if !date.IsZero() {
+			e.Date = date
+		} else {
+			e.Date = e.Mtime
+		}
+	})
+}
+
+// storeDiskThumb keeps the thumbnail of img in the persistent cache, for the
+// next sessions, and the number of its frames in the index. img is decoded
+// and oriented, but not cropped, inverted or converted to the monitor
+// profile, as these differ by view and session.
+func (i *IconImage) storeDiskThumb(img image.Image, numFrames int) {
+	imageIndex.update(i.Path(), func(e *indexEntry) {
+		e.Frames = numFrames
+	})
+	key := thumbKey(i.key, i.diskThumb, *orientImages)
+	if persistentCache.Has(thumbKind, key) {
+		return
+	}
+	thumb := scaleToFit(fastScaler, img, image.Rectangle{Max: i.diskThumb})
+	defer putBytes(thumb.Pix)
+	var b bytes.Buffer
+	var err error
+	if thumb.Opaque() {
+		err = jpeg.Encode(&b, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&b, thumb)
+	}
+	if err != nil {
+		log.Printf("thumb: encode: %v", err)
+	} else if err := persistentCache.Put(thumbKind, key, b.Bytes()); err != nil {
+		log.Printf("thumb: %v", err)
+	}
+}
+
+// loadDiskThumb sets the thumbnail from the persistent cache, without reading
+// the image file, if a previous session kept it. It returns false if not.
+func (i *IconImage) loadDiskThumb() bool {
+	if imageIndex == nil || i.diskThumb == (image.Point{}) || i.Frame() != 0 {
+		return false
+	}
+	path := i.Path()
+	e, ok := imageIndex.lookup(path)
+	if !ok || e.Key == "" || e.Frames == 0 {
+		return false
+	}
+	data, ok := persistentCache.Get(thumbKind, thumbKey(e.Key, i.diskThumb, *orientImages))
+	if !ok {
+		return false
+	}
+	var err error
+	decodePool.Do(func() {
+		var img image.Image
+		if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+			return
+		}
+		if *orientImages {
+			i.orient = e.Orient
+		}
+		i.key = e.Key
+		i.setGPS(e.GPS)
+		err = i.setThumb(img, e.Frames, orientBounds(image.Rect(0, 0, e.Width, e.Height), i.orient))
+	})
+	if err != nil {
+		log.Printf("thumb: %s: %v", path, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// monitorProfile converts sRGB colors to the colors of a calibrated monitor,
+// described by an ICC profile of the matrix and tone curves kind, which the
+// calibration tools write for displays. The images are assumed to be sRGB.
+type monitorProfile struct {
+	name   string
+	linear [256]float32   // sRGB to linear light
+	matrix [3][3]float32  // linear sRGB to linear monitor RGB
+	out    [3][4096]uint8 // linear monitor RGB to monitor values, per channel
+}
+
+// displayProfile is the profile of the monitor, from -icc or the file
+// monitor.icc of the configuration directory. nil if there is none.
+var displayProfile *monitorProfile
+
+// srgbToXYZ converts linear sRGB to the XYZ of the profile connection space,
+// adapted to its D50 white point.
+var srgbToXYZ = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// loadDisplayProfile reads the profile of -icc, or else monitor.icc in the
+// configuration directory if it exists.
+func loadDisplayProfile(name string) (*monitorProfile, error) {
+	if name == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, nil
+		}
+		name = filepath.Join(dir, progName, "monitor.icc")
+		if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("icc: %w", err)
+	}
+	p, err := parseMonitorProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("icc: %s: %w", name, err)
+	}
+	p.name = filepath.Base(name)
+	return p, nil
+}
+
+// parseMonitorProfile parses an RGB ICC profile with colorant tags and tone
+// reproduction curves. Profiles with lookup tables are not supported.
+func parseMonitorProfile(data []byte) (*monitorProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errors.New("not an ICC profile")
+	}
+	if string(data[16:20]) != "RGB " || string(data[20:24]) != "XYZ " {
+		return nil, errors.New("not an RGB profile with an XYZ connection space")
+	}
+	tags := make(map[string][]byte)
+	n := int(binary.BigEndian.Uint32(data[128:]))
+	for i := range n {
+		e := 132 + 12*i
+		if e+12 > len(data) {
+			return nil, errors.New("truncated tag table")
+		}
+		off := int(binary.BigEndian.Uint32(data[e+4:]))
+		size := int(binary.BigEndian.Uint32(data[e+8:]))
+		if off < 0 || size < 0 || off+size > len(data) {
+			return nil, errors.New("tag out of the profile")
+		}
+		tags[string(data[e:e+4])] = data[off : off+size]
+	}
+
+	var m [3][3]float64 // the columns are the colorants
+	var curves [3]func(float64) float64
+	for c, ch := range []string{"r", "g", "b"} {
+		xyz, ok := tags[ch+"XYZ"]
+		if !ok || len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+			return nil, errors.New("no colorants, only matrix profiles are supported")
+		}
+		for r := range 3 {
+			m[r][c] = s15Fixed16(xyz[8+4*r:])
+		}
+		trc, ok := tags[ch+"TRC"]
+		if !ok {
+			return nil, errors.New("no tone curves, only matrix profiles are supported")
+		}
+		f, err := parseCurve(trc)
+		if err != nil {
+			return nil, err
+		}
+		curves[c] = f
+	}
+	inv, ok := invert3(m)
+	if !ok {
+		return nil, errors.New("singular colorant matrix")
+	}
+
+	p := new(monitorProfile)
+	for v := range 256 {
+		p.linear[v] = float32(srgbLinear(float64(v) / 255))
+	}
+	for r := range 3 {
+		for c := range 3 {
+			var s float64
+			for k := range 3 {
+				s += inv[r][k] * srgbToXYZ[k][c]
+			}
+			p.matrix[r][c] = float32(s)
+		}
+	}
+	// invert the monotonic tone curves by searching their values
+	for c, f := range curves {
+		var values [256]float64
+		for v := range values {
+			values[v] = f(float64(v) / 255)
+		}
+		for i := range p.out[c] {
+			y := float64(i) / float64(len(p.out[c])-1)
+			v := sort.SearchFloat64s(values[:], y)
+			if v == len(values) || (v > 0 && y-values[v-1] < values[v]-y) {
+				v--
+			}
+			p.out[c][i] = uint8(v)
+		}
+	}
+	return p, nil
+}
+
+// parseCurve parses a curv or para tag as a function from device values to
+// linear light, both in 0..1.
+func parseCurve(t []byte) (func(float64) float64, error) {
+	if len(t) < 12 {
+		return nil, errors.New("truncated tone curve")
+	}
+	switch string(t[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(t[8:]))
+		switch {
+		case n == 0:
+			return func(x float64) float64 { return x }, nil
+		case n == 1:
+			g := float64(binary.BigEndian.Uint16(t[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		case len(t) < 12+2*n:
+			return nil, errors.New("truncated tone curve")
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(t[12+2*i:])) / 65535
+		}
+		return func(x float64) float64 {
+			p := x * float64(n-1)
+			i := min(int(p), n-2)
+			return table[i] + (p-float64(i))*(table[i+1]-table[i])
+		}, nil
+	case "para":
+		nparams := []int{1, 3, 4, 5, 7}
+		typ := int(binary.BigEndian.Uint16(t[8:]))
+		if typ >= len(nparams) || len(t) < 12+4*nparams[typ] {
+			return nil, errors.New("bad parametric tone curve")
+		}
+		var a [7]float64
+		for i := range nparams[typ] {
+			a[i] = s15Fixed16(t[12+4*i:])
+		}
+		g := a[0]
+		switch typ {
+		case 0:
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		case 1:
+			return func(x float64) float64 {
+				if x >= -a[2]/a[1] {
+					return math.Pow(a[1]*x+a[2], g)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(x float64) float64 {
+				if x >= -a[2]/a[1] {
+					return math.Pow(a[1]*x+a[2], g) + a[3]
+				}
+				return a[3]
+			}, nil
+		case 3:
+			return func(x float64) float64 {
+				if x >= a[4] {
+					return math.Pow(a[1]*x+a[2], g)
+				}
+				return a[3] * x
+			}, nil
+		default:
+			return func(x float64) float64 {
+				if x >= a[4] {
+					return math.Pow(a[1]*x+a[2], g) + a[5]
+				}
+				return a[3]*x + a[6]
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("tone curve of type %q not supported", t[:4])
+}
+
+// s15Fixed16 decodes the signed fixed point numbers of ICC profiles.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// srgbLinear converts an sRGB value to linear light.
+func srgbLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// invert3 inverts the matrix m.
+func invert3(m [3][3]float64) ([3][3]float64, bool) {
+	var inv [3][3]float64
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return inv, false
+	}
+	for r := range 3 {
+		for c := range 3 {
+			// the cofactor of the transposed position
+			r1, r2 := (c+1)%3, (c+2)%3
+			c1, c2 := (r+1)%3, (r+2)%3
+			inv[r][c] = (m[r1][c1]*m[r2][c2] - m[r1][c2]*m[r2][c1]) / det
+		}
+	}
+	return inv, true
+}
+
+// convert returns a copy of img in the colors of the monitor. The alpha is kept.
+func (p *monitorProfile) convert(img image.Image) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	last := float32(len(p.out[0]) - 1)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		a := dst.Pix[i+3]
+		if a == 0 {
+			continue
+		}
+		var lin [3]float32
+		for c := range 3 {
+			v := dst.Pix[i+c]
+			if a != 255 { // the colors are premultiplied by alpha
+				v = uint8(uint16(v) * 255 / uint16(a))
+			}
+			lin[c] = p.linear[v]
+		}
+		for c := range 3 {
+			m := p.matrix[c]
+			y := min(max(m[0]*lin[0]+m[1]*lin[1]+m[2]*lin[2], 0), 1)
+			v := p.out[c][int(y*last+0.5)]
+			if a != 255 {
+				v = uint8(uint16(v) * uint16(a) / 255)
+			}
+			dst.Pix[i+c] = v
+		}
+	}
+	return dst
+}
+
+// colorManaged returns img in the colors of the monitor, if manage and there
+// is a monitor profile.
+func colorManaged(img image.Image, manage bool) image.Image {
+	if !manage || displayProfile == nil {
+		return img
+	}
+	return displayProfile.convert(img)
+}
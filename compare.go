@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// versionSeparators separate the base name of an image from the version
+// suffix added by editors, like IMG_0001-edited.jpg or IMG_0001_1.jpg.
+const versionSeparators = "-_ .~"
+
+// findCompanion returns the index of an image that is another version of icons[i],
+// for example the original and the edited one. Versions are detected by name: they
+// are in the same directory and the base name of one, without the extension, is a
+// prefix of the other followed by a separator.
+func findCompanion(icons []*Icon, i int) (int, bool) {
+	dir, base := splitVersionName(icons[i].path)
+	for j, icon := range icons {
+		if j == i {
+			continue
+		}
+		odir, obase := splitVersionName(icon.path)
+		if odir != dir {
+			continue
+		}
+		if obase == base || isVersionOf(obase, base) || isVersionOf(base, obase) {
+			return j, true
+		}
+	}
+	return -1, false
+}
+
+// splitVersionName returns the directory and the base name without extension of path.
+func splitVersionName(path string) (string, string) {
+	dir, file := filepath.Split(path)
+	return dir, strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// isVersionOf reports whether name is base with a version suffix.
+func isVersionOf(name, base string) bool {
+	suffix, ok := strings.CutPrefix(name, base)
+	return ok && len(suffix) > 1 && strings.ContainsRune(versionSeparators, rune(suffix[0]))
+}
+
+// companionOf returns the other version of icons[i]: the image it was
+// compared with by -diff, or else the one found by findCompanion.
+func companionOf(icons []*Icon, i int) (*Icon, bool) {
+	if d := icons[i].diff; d != nil {
+		return NewIcon(d.other), true
+	}
+	j, ok := findCompanion(icons, i)
+	if !ok {
+		return nil, false
+	}
+	return icons[j], true
+}
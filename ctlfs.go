@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plan9/client"
+)
+
+// The ctl file server of -ctl serves a directory with a single file, ctl.
+// Reading ctl returns a "mark path" line for each marked image. Writing
+// "mark path" or "unmark path" lines to ctl marks or unmarks the images in
+// the running viewer, so that scripts can pre-mark images for review.
+// The commands are applied by the view on display, which repaints.
+
+const (
+	ctlQidRoot = iota
+	ctlQidCtl
+)
+
+// ctlRequest is a read or a write of ctl, for the view on display.
+type ctlRequest struct {
+	cmds  []string // the lines written, nil for a read
+	reply chan ctlReply
+}
+
+// ctlReply is the result of a ctlRequest.
+type ctlReply struct {
+	data string // the contents of ctl, for a read
+	err  error
+}
+
+// serveCtl posts the ctl file server as the service name in the name space.
+// The requests are sent to ctlC for the views.
+func serveCtl(name string, ctlC chan<- ctlRequest) error {
+	addr := filepath.Join(client.Namespace(), name)
+	os.Remove(addr) // a left over of a previous run
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		return fmt.Errorf("ctl: %w", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Printf("ctl: %v", err)
+				return
+			}
+			go serveCtlConn(conn, ctlC)
+		}
+	}()
+	return nil
+}
+
+// serveCtlConn serves the 9P requests of a connection.
+func serveCtlConn(conn net.Conn, ctlC chan<- ctlRequest) {
+	defer conn.Close()
+	var mu sync.Mutex // serializes the replies
+	fids := make(map[uint32]uint64)
+	var fidsMu sync.Mutex
+	msize := uint32(8192 + plan9.IOHDRSZ)
+
+	respond := func(t, r *plan9.Fcall) {
+		r.Tag = t.Tag
+		mu.Lock()
+		defer mu.Unlock()
+		if err := plan9.WriteFcall(conn, r); err != nil {
+			log.Printf("ctl: %v", err)
+		}
+	}
+	fail := func(t *plan9.Fcall, err error) {
+		respond(t, &plan9.Fcall{Type: plan9.Rerror, Ename: err.Error()})
+	}
+	qidOf := func(fid uint32) (uint64, bool) {
+		fidsMu.Lock()
+		defer fidsMu.Unlock()
+		q, ok := fids[fid]
+		return q, ok
+	}
+	setFid := func(fid uint32, q uint64) {
+		fidsMu.Lock()
+		defer fidsMu.Unlock()
+		fids[fid] = q
+	}
+
+	for {
+		t, err := plan9.ReadFcall(conn)
+		if err != nil {
+			return
+		}
+		switch t.Type {
+		case plan9.Tversion:
+			msize = min(t.Msize, msize)
+			respond(t, &plan9.Fcall{Type: plan9.Rversion, Msize: msize, Version: plan9.VERSION9P})
+		case plan9.Tauth:
+			fail(t, errors.New("no authentication required"))
+		case plan9.Tattach:
+			setFid(t.Fid, ctlQidRoot)
+			respond(t, &plan9.Fcall{Type: plan9.Rattach, Qid: ctlQid(ctlQidRoot)})
+		case plan9.Twalk:
+			q, ok := qidOf(t.Fid)
+			if !ok {
+				fail(t, errors.New("unknown fid"))
+				continue
+			}
+			var wqid []plan9.Qid
+			for _, name := range t.Wname {
+				switch {
+				case name == ".." || name == "." && q == ctlQidRoot:
+					q = ctlQidRoot
+				case name == "ctl" && q == ctlQidRoot:
+					q = ctlQidCtl
+				default:
+					q = ^uint64(0)
+				}
+				if q == ^uint64(0) {
+					break
+				}
+				wqid = append(wqid, ctlQid(q))
+			}
+			if len(wqid) == 0 && len(t.Wname) > 0 {
+				fail(t, errors.New("file does not exist"))
+				continue
+			}
+			if len(wqid) == len(t.Wname) {
+				setFid(t.Newfid, q)
+			}
+			respond(t, &plan9.Fcall{Type: plan9.Rwalk, Wqid: wqid})
+		case plan9.Topen:
+			q, ok := qidOf(t.Fid)
+			if !ok {
+				fail(t, errors.New("unknown fid"))
+				continue
+			}
+			respond(t, &plan9.Fcall{Type: plan9.Ropen, Qid: ctlQid(q)})
+		case plan9.Tread:
+			q, _ := qidOf(t.Fid)
+			var data []byte
+			if q == ctlQidRoot {
+				// the directory has only ctl
+				if t.Offset == 0 {
+					data, _ = ctlDir(ctlQidCtl).Bytes()
+				}
+			} else {
+				// reading waits for the view, so it is done concurrently
+				go func(t *plan9.Fcall) {
+					r := sendCtl(ctlC, nil)
+					if r.err != nil {
+						fail(t, r.err)
+						return
+					}
+					data := []byte(r.data)
+					// the offset is the client's, compared unconverted
+					if t.Offset >= uint64(len(data)) {
+						data = nil
+					} else {
+						data = data[t.Offset:]
+					}
+					data = data[:min(len(data), int(t.Count))]
+					respond(t, &plan9.Fcall{Type: plan9.Rread, Data: data})
+				}(t)
+				continue
+			}
+			respond(t, &plan9.Fcall{Type: plan9.Rread, Data: data})
+		case plan9.Twrite:
+			if q, _ := qidOf(t.Fid); q != ctlQidCtl {
+				fail(t, errors.New("permission denied"))
+				continue
+			}
+			go func(t *plan9.Fcall) {
+				cmds := strings.Split(strings.TrimSpace(string(t.Data)), "\n")
+				if r := sendCtl(ctlC, cmds); r.err != nil {
+					fail(t, r.err)
+					return
+				}
+				respond(t, &plan9.Fcall{Type: plan9.Rwrite, Count: uint32(len(t.Data))})
+			}(t)
+		case plan9.Tclunk:
+			fidsMu.Lock()
+			delete(fids, t.Fid)
+			fidsMu.Unlock()
+			respond(t, &plan9.Fcall{Type: plan9.Rclunk})
+		case plan9.Tstat:
+			q, ok := qidOf(t.Fid)
+			if !ok {
+				fail(t, errors.New("unknown fid"))
+				continue
+			}
+			stat, _ := ctlDir(q).Bytes()
+			respond(t, &plan9.Fcall{Type: plan9.Rstat, Stat: stat})
+		case plan9.Twstat:
+			// truncating ctl is harmless
+			respond(t, &plan9.Fcall{Type: plan9.Rwstat})
+		case plan9.Tflush:
+			respond(t, &plan9.Fcall{Type: plan9.Rflush})
+		default:
+			fail(t, errors.New("operation not supported"))
+		}
+	}
+}
+
+// sendCtl sends a request to the views and waits for the reply.
+func sendCtl(ctlC chan<- ctlRequest, cmds []string) ctlReply {
+	req := ctlRequest{cmds, make(chan ctlReply, 1)}
+	ctlC <- req
+	return <-req.reply
+}
+
+// ctlQid returns the qid of the file.
+func ctlQid(q uint64) plan9.Qid {
+	if q == ctlQidRoot {
+		return plan9.Qid{Path: q, Type: plan9.QTDIR}
+	}
+	return plan9.Qid{Path: q, Type: plan9.QTFILE}
+}
+
+// ctlDir returns the stat of the file.
+func ctlDir(q uint64) *plan9.Dir {
+	d := &plan9.Dir{Qid: ctlQid(q), Uid: progName, Gid: progName, Muid: progName}
+	if q == ctlQidRoot {
+		d.Name, d.Mode = "/", plan9.DMDIR|0555
+	} else {
+		d.Name, d.Mode = "ctl", 0666
+	}
+	return d
+}
+
+// applyCtl applies the request on the icons, in the views goroutine.
+// It returns whether any icon changed.
+func (dctl *DisplayControl) applyCtl(req ctlRequest) bool {
+	if req.cmds == nil {
+		var b strings.Builder
+		for _, icon := range dctl.allIcons() {
+			if icon.Marked() {
+				fmt.Fprintf(&b, "mark %s\n", icon.path)
+			}
+		}
+		req.reply <- ctlReply{data: b.String()}
+		return false
+	}
+
+	changed := false
+	var err error
+	for _, cmd := range req.cmds {
+		verb, path, _ := strings.Cut(strings.TrimSpace(cmd), " ")
+		if verb == "" {
+			continue
+		}
+		var icon *Icon
+		if i := indexOfPath(dctl.allIcons(), path); i >= 0 {
+			icon = dctl.allIcons()[i]
+		}
+		switch {
+		case verb != "mark" && verb != "unmark":
+			err = fmt.Errorf("ctl: unknown command %q", verb)
+		case icon == nil:
+			err = fmt.Errorf("ctl: %s: no such image", path)
+		case icon.Marked() != (verb == "mark"):
+			icon.ToggleMarked()
+			changed = true
+		}
+	}
+	req.reply <- ctlReply{err: err}
+	return changed
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// diffTile is the size of the squares in which changed pixels are grouped
+// into regions.
+const diffTile = 32
+
+// imageDiff is the difference of an image with its other version.
+type imageDiff struct {
+	other   string            // the path of the other version
+	changed int               // the number of pixels that differ
+	total   int               // the number of pixels compared
+	regions []image.Rectangle // the regions with changes, in image coordinates
+	sizes   bool              // true if the images have different dimensions
+}
+
+// String returns a summary of the difference for the info.
+func (d *imageDiff) String() string {
+	if d.sizes {
+		return fmt.Sprintf("Diff: dimensions differ from %s", d.other)
+	}
+	return fmt.Sprintf("Diff: %.2f%% of pixels differ from %s", d.percent(), d.other)
+}
+
+// percent returns the percentage of the pixels that differ.
+func (d *imageDiff) percent() float64 {
+	if d.total == 0 {
+		return 0
+	}
+	return 100 * float64(d.changed) / float64(d.total)
+}
+
+// diffDirs pairs the images of dirB with the images of dirA with the
+// same path relative to the directories and returns the images of dirB
+// that differ from their pair. Files with the same contents are not
+// decoded. Images that decode to the same pixels are the same.
+func diffDirs(dirA, dirB string) ([]*Icon, error) {
+	var rels []string
+	err := filepath.WalkDir(dirB, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && isImageFile(d.Name()) {
+			rel, err := filepath.Rel(dirB, path)
+			if err != nil {
+				return err
+			}
+			rels = append(rels, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("diff: %w", err)
+	}
+
+	diffs := make([]*imageDiff, len(rels))
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, rel := range rels {
+		a, b := filepath.Join(dirA, rel), filepath.Join(dirB, rel)
+		if _, err := os.Stat(a); err != nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			d, err := diffFiles(a, b)
+			if err != nil {
+				log.Printf("diff: %v", err)
+				return
+			}
+			diffs[i] = d
+		}()
+	}
+	wg.Wait()
+
+	var icons []*Icon
+	for i, d := range diffs {
+		if d != nil {
+			icon := NewIcon(filepath.Join(dirB, rels[i]))
+			icon.diff = d
+			icon.note = d.String()
+			icons = append(icons, icon)
+		}
+	}
+	log.Printf("diff: %d of %d images differ", len(icons), len(rels))
+	return icons, nil
+}
+
+// diffFiles returns the difference of the image b with the image a,
+// or nil if they are the same.
+func diffFiles(a, b string) (*imageDiff, error) {
+	dataA, err := os.ReadFile(a)
+	if err != nil {
+		return nil, err
+	}
+	dataB, err := os.ReadFile(b)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(dataA, dataB) {
+		return nil, nil
+	}
+	imgA, _, err := decodeFrame(dataA, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a, err)
+	}
+	imgB, _, err := decodeFrame(dataB, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b, err)
+	}
+	d := pixelDiff(imgA, imgB)
+	if !d.sizes && d.changed == 0 {
+		return nil, nil
+	}
+	d.other = a
+	return d, nil
+}
+
+// pixelDiff compares the pixels of a and b. The regions are in the
+// coordinates of b.
+func pixelDiff(a, b image.Image) *imageDiff {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return &imageDiff{sizes: true, regions: []image.Rectangle{b.Bounds()}}
+	}
+	ra, rb := toRGBA(a), toRGBA(b)
+	size := rb.Bounds().Size()
+	tilesX := (size.X + diffTile - 1) / diffTile
+	tilesY := (size.Y + diffTile - 1) / diffTile
+	tiles := make([]bool, tilesX*tilesY)
+
+	d := &imageDiff{total: size.X * size.Y}
+	for y := 0; y < size.Y; y++ {
+		pa := ra.Pix[y*ra.Stride : y*ra.Stride+4*size.X]
+		pb := rb.Pix[y*rb.Stride : y*rb.Stride+4*size.X]
+		for x := 0; x < size.X; x++ {
+			if !bytes.Equal(pa[4*x:4*x+4], pb[4*x:4*x+4]) {
+				d.changed++
+				tiles[(y/diffTile)*tilesX+x/diffTile] = true
+			}
+		}
+	}
+	for _, r := range tileRegions(tiles, tilesX, tilesY) {
+		r = image.Rect(r.Min.X*diffTile, r.Min.Y*diffTile, r.Max.X*diffTile, r.Max.Y*diffTile)
+		r = r.Add(rb.Bounds().Min).Intersect(b.Bounds())
+		d.regions = append(d.regions, r)
+	}
+	return d
+}
+
+// tileRegions returns the bounding boxes, in tiles, of the connected groups
+// of the set tiles.
+func tileRegions(tiles []bool, w, h int) []image.Rectangle {
+	var regions []image.Rectangle
+	seen := make([]bool, len(tiles))
+	for i, set := range tiles {
+		if !set || seen[i] {
+			continue
+		}
+		r := image.Rect(i%w, i/w, i%w+1, i/w+1)
+		stack := []int{i}
+		seen[i] = true
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := j%w, j/w
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+			for _, n := range [][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n[0] < 0 || n[0] >= w || n[1] < 0 || n[1] >= h {
+					continue
+				}
+				k := n[1]*w + n[0]
+				if tiles[k] && !seen[k] {
+					seen[k] = true
+					stack = append(stack, k)
+				}
+			}
+		}
+		regions = append(regions, r)
+	}
+	return regions
+}
+
+// toRGBA returns img as an *image.RGBA, converting it if needed.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// paintDiffRegions outlines the changed regions of an image with bounds
+// orig that is displayed scaled in r.
+func paintDiffRegions(dctl *DisplayControl, d *imageDiff, orig, r image.Rectangle) {
+	if orig.Empty() {
+		return
+	}
+	for _, dr := range d.regions {
+		sr := scaleRect(dr, orig, r)
+		sr.Max = sr.Max.Add(image.Point{1, 1}) // visible even when tiny
+		borderClipped(dctl.screen, sr.Inset(-1), 1, dctl.warnColor, r)
+	}
+}
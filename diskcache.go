@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// diskCache stores data derived from images, like intermediate resolutions,
+// in a directory. Entries are addressed by the hash of the image contents and
+// a kind, so they remain valid if images are moved or renamed. The time of an
+// entry is when it was last used, so that the garbage collection removes the
+// entries used least recently.
+type diskCache struct {
+	dir string
+}
+
+// persistentCache is the cache of the session. It is nil if disabled.
+var persistentCache *diskCache
+
+// openDiskCache returns a cache that stores entries in dir.
+func openDiskCache(dir string) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("disk cache: %w", err)
+	}
+	return &diskCache{dir: dir}, nil
+}
+
+// contentKey returns the cache key of the image contents.
+func contentKey(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// path returns the file of the entry. The entries are spread
+// in subdirectories to avoid huge directories.
+func (c *diskCache) path(kind, key string) string {
+	return filepath.Join(c.dir, kind, key[:2], key)
+}
+
+// Get returns the entry of kind for the key and marks it as used.
+func (c *diskCache) Get(kind, key string) ([]byte, bool) {
+	name := c.path(kind, key)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(name, now, now)
+	return data, true
+}
+
+// Has reports whether there is an entry of kind for the key.
+func (c *diskCache) Has(kind, key string) bool {
+	_, err := os.Stat(c.path(kind, key))
+	return err == nil
+}
+
+// Put stores the entry of kind for the key. The entry is first written
+// to a temporary file, so that readers never see partial entries.
+func (c *diskCache) Put(kind, key string, data []byte) error {
+	name := c.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("disk cache: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), key+".*")
+	if err != nil {
+		return fmt.Errorf("disk cache: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("disk cache: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("disk cache: %w", err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("disk cache: %w", err)
+	}
+	return nil
+}
+
+// tempMaxAge is the age over which the temporary files of Put are left over
+// from writes that were interrupted.
+const tempMaxAge = time.Hour
+
+// diskEntry is a file of the cache.
+type diskEntry struct {
+	name string
+	size int64
+	used time.Time
+}
+
+// GC removes the entries used least recently, until the cache takes at most
+// limit bytes, and the temporary files left over by interrupted writes. It
+// returns the number of files and the bytes removed.
+func (c *diskCache) GC(limit int64) (int, int64, error) {
+	var entries []diskEntry
+	var total int64
+	files, freed := 0, int64(0)
+	remove := func(e diskEntry) {
+		if err := os.Remove(e.name); err != nil {
+			log.Printf("disk cache: %v", err)
+			return
+		}
+		files++
+		freed += e.size
+	}
+	err := filepath.WalkDir(c.dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Dir(name) == c.dir {
+			return err // the files at the top, like the index, are not entries
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed meanwhile
+		}
+		e := diskEntry{name, info.Size(), info.ModTime()}
+		if strings.Contains(d.Name(), ".") {
+			if time.Since(e.used) > tempMaxAge {
+				remove(e)
+			}
+			return nil
+		}
+		entries = append(entries, e)
+		total += e.size
+		return nil
+	})
+	if err != nil {
+		return files, freed, fmt.Errorf("disk cache: %w", err)
+	}
+	slices.SortFunc(entries, func(a, b diskEntry) int {
+		return a.used.Compare(b.used)
+	})
+	for _, e := range entries {
+		if total <= limit {
+			break
+		}
+		remove(e)
+		total -= e.size
+	}
+	return files, freed, nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"sync"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// ScreenImage is an image allocated on a Screen.
+type ScreenImage interface {
+	Bounds() image.Rectangle
+	Free() error
+}
+
+// Screen is the set of display operations used by the views. It is implemented
+// by drawScreen for a devdraw display and by fakeScreen, which records the
+// operations, so that painting can be tested without a devdraw server.
+type Screen interface {
+	// Bounds returns the bounds of the window.
+	Bounds() image.Rectangle
+	// Attach reattaches the window after a resize.
+	Attach() error
+	// Draw draws src on the window in r, aligning sp with r.Min.
+	Draw(r image.Rectangle, src ScreenImage, sp image.Point)
+	// Copy copies the part of the window at sp to r, for scrolling.
+	Copy(r image.Rectangle, sp image.Point)
+	// Border draws a border of width w inside r.
+	Border(r image.Rectangle, w int, src ScreenImage, sp image.Point)
+	// String draws s at p and returns the point after it.
+	String(p image.Point, src ScreenImage, s string) image.Point
+	// StringBg is like String but draws a background first.
+	StringBg(p image.Point, src ScreenImage, s string, bg ScreenImage) image.Point
+	// FontHeight returns the height of the font.
+	FontHeight() int
+	// StringWidth returns the width of s in the font.
+	StringWidth(s string) int
+	// ReadImage allocates an image from the plan9 bitmap in r.
+	ReadImage(r io.Reader) (ScreenImage, error)
+	// AllocColor allocates a replicated image with a mix of the colors.
+	AllocColor(c1, c3 draw9.Color) ScreenImage
+	// SwitchCursor changes the cursor. nil is the default cursor.
+	SwitchCursor(c *draw9.Cursor) error
+	// MenuHit displays the menu, opened with button but, and returns the selected item or -1.
+	MenuHit(but int, menu *draw9.Menu) int
+	// Flush flushes the pending operations to the window.
+	Flush() error
+	// Snapshot reads back the contents of the window.
+	Snapshot() (*image.RGBA, error)
+	// WriteSnarf writes data to the snarf buffer.
+	WriteSnarf(data []byte) error
+	// ReadSnarf returns the contents of the snarf buffer.
+	ReadSnarf() ([]byte, error)
+	// Resize asks the window system to resize the window to r. The views
+	// see the new size as a resize event.
+	Resize(r image.Rectangle)
+}
+
+// drawScreen is a Screen over a devdraw display.
+type drawScreen struct {
+	display *draw9.Display
+	mctl    *draw9.Mousectl
+}
+
+func (s *drawScreen) Bounds() image.Rectangle {
+	return s.display.Image.Bounds()
+}
+
+func (s *drawScreen) Attach() error {
+	return s.display.Attach(draw9.RefNone)
+}
+
+func (s *drawScreen) Draw(r image.Rectangle, src ScreenImage, sp image.Point) {
+	src, sp = inAtlas(src, sp)
+	s.display.Image.Draw(r, src.(*draw9.Image), nil, sp)
+}
+
+func (s *drawScreen) Copy(r image.Rectangle, sp image.Point) {
+	s.display.Image.Draw(r, s.display.Image, nil, sp)
+}
+
+func (s *drawScreen) Border(r image.Rectangle, w int, src ScreenImage, sp image.Point) {
+	s.display.Image.Border(r, w, src.(*draw9.Image), sp)
+}
+
+func (s *drawScreen) String(p image.Point, src ScreenImage, str string) image.Point {
+	return s.display.Image.String(p, src.(*draw9.Image), image.Point{}, s.display.Font, str)
+}
+
+func (s *drawScreen) StringBg(p image.Point, src ScreenImage, str string, bg ScreenImage) image.Point {
+	return s.display.Image.StringBg(p, src.(*draw9.Image), image.Point{}, s.display.Font, str,
+		bg.(*draw9.Image), image.Point{})
+}
+
+func (s *drawScreen) FontHeight() int {
+	return s.display.Font.Height
+}
+
+func (s *drawScreen) StringWidth(str string) int {
+	return s.display.Font.StringWidth(str)
+}
+
+func (s *drawScreen) ReadImage(r io.Reader) (ScreenImage, error) {
+	img, err := s.display.ReadImage(r)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (s *drawScreen) AllocColor(c1, c3 draw9.Color) ScreenImage {
+	return s.display.AllocImageMix(c1, c3)
+}
+
+func (s *drawScreen) SwitchCursor(c *draw9.Cursor) error {
+	return s.display.SwitchCursor(c)
+}
+
+func (s *drawScreen) MenuHit(but int, menu *draw9.Menu) int {
+	return draw9.MenuHit(but, s.mctl, menu, nil)
+}
+
+func (s *drawScreen) Flush() error {
+	return s.display.Flush()
+}
+
+func (s *drawScreen) Snapshot() (*image.RGBA, error) {
+	r := s.display.Image.R
+	// ABGR32 has the layout of image.RGBA
+	tmp, err := s.display.AllocImage(r, draw9.ABGR32, false, draw9.NoFill)
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Free()
+	tmp.Draw(r, s.display.Image, nil, r.Min)
+	img := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	if _, err := tmp.Unload(r, img.Pix); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (s *drawScreen) WriteSnarf(data []byte) error {
+	return s.display.WriteSnarf(data)
+}
+
+func (s *drawScreen) ReadSnarf() ([]byte, error) {
+	buf := make([]byte, 8192)
+	for {
+		n, actual, err := s.display.ReadSnarf(buf)
+		if err != nil {
+			return nil, err
+		}
+		// the buffer was too short, nothing was read
+		if actual <= len(buf) {
+			return buf[:n], nil
+		}
+		buf = make([]byte, actual)
+	}
+}
+
+func (s *drawScreen) Resize(r image.Rectangle) {
+	s.display.Resize(r)
+}
+
+// fakeImage is a ScreenImage of a fakeScreen.
+type fakeImage struct {
+	name string
+	r    image.Rectangle
+}
+
+func (i *fakeImage) Bounds() image.Rectangle { return i.r }
+func (i *fakeImage) Free() error             { return nil }
+func (i *fakeImage) String() string          { return i.name }
+
+// fakeScreen is a Screen that records the operations as text, one per line,
+// instead of drawing. Menu selections are taken from MenuHits.
+type fakeScreen struct {
+	r        image.Rectangle
+	Ops      []string
+	MenuHits []int
+
+	mu    sync.Mutex // the snarf buffer is polled by -snarf
+	snarf []byte
+}
+
+// newFakeScreen returns a fake screen with a window of size r.
+func newFakeScreen(r image.Rectangle) *fakeScreen {
+	return &fakeScreen{r: r}
+}
+
+func (s *fakeScreen) record(format string, args ...any) {
+	s.Ops = append(s.Ops, fmt.Sprintf(format, args...))
+}
+
+func (s *fakeScreen) Bounds() image.Rectangle { return s.r }
+func (s *fakeScreen) Attach() error           { return nil }
+func (s *fakeScreen) FontHeight() int         { return 16 }
+
+func (s *fakeScreen) Draw(r image.Rectangle, src ScreenImage, sp image.Point) {
+	src, sp = inAtlas(src, sp)
+	s.record("draw %v %v %v", r, src, sp)
+}
+
+func (s *fakeScreen) Copy(r image.Rectangle, sp image.Point) {
+	s.record("copy %v %v", r, sp)
+}
+
+func (s *fakeScreen) Border(r image.Rectangle, w int, src ScreenImage, sp image.Point) {
+	s.record("border %v %d %v", r, w, src)
+}
+
+func (s *fakeScreen) String(p image.Point, src ScreenImage, str string) image.Point {
+	s.record("string %v %v %q", p, src, str)
+	return p.Add(image.Pt(s.StringWidth(str), 0))
+}
+
+func (s *fakeScreen) StringWidth(str string) int {
+	return 8 * len(str)
+}
+
+func (s *fakeScreen) StringBg(p image.Point, src ScreenImage, str string, bg ScreenImage) image.Point {
+	s.record("stringbg %v %v %q %v", p, src, str, bg)
+	return p.Add(image.Pt(8*len(str), 0))
+}
+
+func (s *fakeScreen) ReadImage(r io.Reader) (ScreenImage, error) {
+	var pix string
+	var r0 image.Rectangle
+	if _, err := fmt.Fscanf(r, "%11s %11d %11d %11d %11d ",
+		&pix, &r0.Min.X, &r0.Min.Y, &r0.Max.X, &r0.Max.Y); err != nil {
+		return nil, fmt.Errorf("fake screen: read image: %w", err)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, fmt.Errorf("fake screen: read image: %w", err)
+	}
+	// images are loaded concurrently, name them by size to keep the ops deterministic
+	return &fakeImage{name: fmt.Sprintf("image%dx%d", r0.Dx(), r0.Dy()), r: r0}, nil
+}
+
+func (s *fakeScreen) AllocColor(c1, c3 draw9.Color) ScreenImage {
+	return &fakeImage{name: fmt.Sprintf("color%08x/%08x", uint32(c1), uint32(c3)), r: image.Rect(0, 0, 1, 1)}
+}
+
+func (s *fakeScreen) SwitchCursor(c *draw9.Cursor) error { return nil }
+
+func (s *fakeScreen) MenuHit(but int, menu *draw9.Menu) int {
+	if len(s.MenuHits) == 0 {
+		return -1
+	}
+	hit := s.MenuHits[0]
+	s.MenuHits = s.MenuHits[1:]
+	s.record("menu %d", hit)
+	return hit
+}
+
+func (s *fakeScreen) Flush() error {
+	s.record("flush")
+	return nil
+}
+
+func (s *fakeScreen) Snapshot() (*image.RGBA, error) {
+	s.record("snapshot")
+	return image.NewRGBA(image.Rect(0, 0, s.r.Dx(), s.r.Dy())), nil
+}
+
+func (s *fakeScreen) WriteSnarf(data []byte) error {
+	s.record("snarf %q", data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snarf = append(s.snarf[:0], data...)
+	return nil
+}
+
+func (s *fakeScreen) ReadSnarf() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.snarf...), nil
+}
+
+func (s *fakeScreen) Resize(r image.Rectangle) {
+	s.record("resize %v", r)
+}
+
+// fakeInput feeds input events to a DisplayControl with a fakeScreen.
+type fakeInput struct {
+	Mouse  chan draw9.Mouse
+	Keys   chan rune
+	Resize chan bool
+}
+
+// newFakeDisplayControl returns a DisplayControl with a fake screen of size r.
+// The views are driven by sending events to the returned input.
+func newFakeDisplayControl(r image.Rectangle) (*DisplayControl, *fakeScreen, *fakeInput) {
+	in := &fakeInput{
+		Mouse:  make(chan draw9.Mouse),
+		Keys:   make(chan rune),
+		Resize: make(chan bool),
+	}
+	scr := newFakeScreen(r)
+	mctl := &draw9.Mousectl{C: in.Mouse, Resize: in.Resize}
+	kctl := &draw9.Keyboardctl{C: in.Keys}
+	return newDisplayControl(scr, make(chan error), mctl, kctl), scr, in
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// docImageRes match the references to images in markdown, HTML and troff.
+var docImageRes = []*regexp.Regexp{
+	regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^)\s>]+)>?`),
+	regexp.MustCompile(`(?i)<img\b[^>]*\bsrc\s*=\s*["']([^"']+)["']`),
+	regexp.MustCompile(`^\.(?:PSPIC|BP|PDFPIC|IMAGE)\s+(?:-[LCRI]\s+)?(\S+)`),
+}
+
+// docRef is an image referenced in a document.
+type docRef struct {
+	path  string
+	lines []int // the lines of the references
+}
+
+// readDocImages returns the local images referenced in the markdown, HTML
+// or troff document, in the order of their first reference. Relative
+// paths are relative to the directory of the document.
+func readDocImages(doc string) ([]*docRef, error) {
+	f, err := os.Open(doc)
+	if err != nil {
+		return nil, fmt.Errorf("doc: %w", err)
+	}
+	defer f.Close()
+
+	var refs []*docRef
+	byPath := make(map[string]*docRef)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		for _, re := range docImageRes {
+			for _, m := range re.FindAllStringSubmatch(sc.Text(), -1) {
+				path, ok := docImagePath(doc, m[1])
+				if !ok {
+					continue
+				}
+				r, ok := byPath[path]
+				if !ok {
+					r = &docRef{path: path}
+					byPath[path] = r
+					refs = append(refs, r)
+				}
+				r.lines = append(r.lines, n)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("doc: %w", err)
+	}
+	return refs, nil
+}
+
+// docImagePath returns the path of the image of the reference in doc.
+// It is false for URLs, as only local images are displayed.
+func docImagePath(doc, ref string) (string, bool) {
+	if strings.Contains(ref, "://") || strings.HasPrefix(ref, "data:") {
+		return "", false
+	}
+	ref, _, _ = strings.Cut(ref, "#")
+	ref, _, _ = strings.Cut(ref, "?")
+	if ref == "" {
+		return "", false
+	}
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(filepath.Dir(doc), ref)
+	}
+	return ref, true
+}
+
+// note returns the note of the icon of the reference for the info.
+func (r *docRef) note(doc string) string {
+	lines := make([]string, len(r.lines))
+	for i, n := range r.lines {
+		lines[i] = fmt.Sprint(n)
+	}
+	return fmt.Sprintf("Ref: %s:%s", filepath.Base(doc), strings.Join(lines, ","))
+}
+
+// noteDocRefs notes on the icons the lines of doc that reference them.
+func noteDocRefs(icons []*Icon, refs []*docRef, doc string) {
+	byPath := make(map[string]*docRef, len(refs))
+	for _, r := range refs {
+		byPath[filepath.Clean(r.path)] = r
+	}
+	for _, icon := range icons {
+		if r, ok := byPath[filepath.Clean(icon.path)]; ok {
+			icon.note = r.note(doc)
+		}
+	}
+}
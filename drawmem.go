@@ -0,0 +1,99 @@
+package main
+
+import (
+	"container/list"
+	"log"
+	"sync"
+)
+
+// drawBudget caps the memory of the thumbnails on the draw server. The
+// draw server keeps every image the views upload, independent of the Go heap,
+// and large grids can exhaust it. Over the limit, the thumbnails displayed
+// least recently are freed. Their icons keep the image data, so they are
+// decoded and uploaded again on the next display.
+type drawBudget struct {
+	mu     sync.Mutex
+	limit  int64 // bytes, 0 means no limit
+	used   int64
+	lru    *list.List // of *drawEntry, the most recently displayed at the front
+	byIcon map[*IconImage]*list.Element
+}
+
+// drawEntry is a thumbnail tracked by a drawBudget.
+type drawEntry struct {
+	icon  *IconImage
+	bytes int64
+}
+
+// drawMem is the budget of the thumbnails, set with -drawmem.
+var drawMem = newDrawBudget(0)
+
+func newDrawBudget(limit int64) *drawBudget {
+	return &drawBudget{
+		limit:  limit,
+		lru:    list.New(),
+		byIcon: make(map[*IconImage]*list.Element),
+	}
+}
+
+// add tracks thumb, the thumbnail of the icon just uploaded, and frees
+// the least recently displayed ones if the budget is exceeded. The caller
+// passes thumb because icon.thumb may be freed concurrently.
+func (b *drawBudget) add(icon *IconImage, thumb ScreenImage) {
+	if b.limit <= 0 || thumb == nil {
+		return
+	}
+	r := thumb.Bounds()
+	size := int64(r.Dx()) * int64(r.Dy()) * 4
+
+	var victims []*IconImage
+	b.mu.Lock()
+	if e, ok := b.byIcon[icon]; ok {
+		b.used -= e.Value.(*drawEntry).bytes
+		b.lru.Remove(e)
+	}
+	b.byIcon[icon] = b.lru.PushFront(&drawEntry{icon, size})
+	b.used += size
+	// keep at least the new thumbnail, even if it exceeds the budget
+	for b.used > b.limit && b.lru.Len() > 1 {
+		d := b.lru.Remove(b.lru.Back()).(*drawEntry)
+		delete(b.byIcon, d.icon)
+		b.used -= d.bytes
+		victims = append(victims, d.icon)
+	}
+	used := b.used
+	b.mu.Unlock()
+
+	for _, v := range victims {
+		v.dropThumb()
+	}
+	if *verbose && len(victims) > 0 {
+		log.Printf("drawmem: freed %d thumbnails, %d bytes in use", len(victims), used)
+	}
+}
+
+// touch marks the thumbnail of the icon as displayed.
+func (b *drawBudget) touch(icon *IconImage) {
+	if b.limit <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.byIcon[icon]; ok {
+		b.lru.MoveToFront(e)
+	}
+}
+
+// remove stops tracking the thumbnail of the icon, because it was freed.
+func (b *drawBudget) remove(icon *IconImage) {
+	if b.limit <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.byIcon[icon]; ok {
+		b.used -= e.Value.(*drawEntry).bytes
+		b.lru.Remove(e)
+		delete(b.byIcon, icon)
+	}
+}
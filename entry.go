@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// entryChoices is the number of completions shown below the entry.
+const entryChoices = 8
+
+// readText reads a line of text typed in a bar at the top of the window,
+// after the prompt. complete returns the completions of the last word,
+// which are shown below the bar; tab completes the word to them. Enter
+// accepts the text and esc cancels. The bool is false if cancelled.
+func (dctl *DisplayControl) readText(prompt string, complete func(word string) []string) (string, bool) {
+	var text []rune
+	lastWord := func() (string, string) {
+		s := string(text)
+		i := strings.LastIndexAny(s, " ,") + 1
+		if strings.HasPrefix(s[i:], "-") { // a minus removes the tag, it is not part of it
+			i++
+		}
+		return s[:i], s[i:]
+	}
+	paint := func() {
+		_, word := lastWord()
+		line := prompt + string(text) + "_"
+		var choices []string
+		if word != "" {
+			choices = complete(word)
+		}
+		choices = choices[:min(len(choices), entryChoices)]
+		dctl.post(func() {
+			window := dctl.screen
+			h := window.FontHeight()
+			r := window.Bounds()
+			r.Max.Y = r.Min.Y + 2*h
+			window.Draw(r, dctl.bgColor, image.Point{})
+			window.String(r.Min, dctl.fontColor, line)
+			window.String(r.Min.Add(image.Pt(0, h)), dctl.borderColor, strings.Join(choices, "  "))
+			if err := window.Flush(); err != nil {
+				log.Printf("display: flush: %v", err)
+			}
+		})
+	}
+
+	defer func() {
+		dctl.waitPaint()
+		dctl.painted = nil
+	}()
+	paint()
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case k := <-dctl.kctl.C:
+			switch k {
+			case '\n':
+				return strings.TrimSpace(string(text)), true
+			case escKey:
+				return "", false
+			case backspaceKey:
+				if len(text) > 0 {
+					text = text[:len(text)-1]
+				}
+			case tabKey:
+				head, word := lastWord()
+				if word == "" {
+					break
+				}
+				choices := complete(word)
+				if len(choices) == 1 {
+					text = []rune(head + choices[0] + " ")
+				} else if p := commonPrefix(choices); len(p) > len(word) {
+					text = []rune(head + p)
+				}
+			default:
+				if unicode.IsPrint(k) {
+					text = append(text, k)
+				}
+			}
+			paint()
+		case <-dctl.mctl.C:
+		case <-dctl.mctl.Resize:
+			dctl.invalidate()
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			paint()
+		}
+	}
+}
+
+// commonPrefix returns the longest prefix of all the strings.
+func commonPrefix(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	p := s[0]
+	for _, t := range s[1:] {
+		for !strings.HasPrefix(t, p) {
+			p = p[:len(p)-1]
+		}
+	}
+	return p
+}
+
+// confirm shows the title and the lines, as many as fit in the window, and
+// waits for enter or y to accept them, or esc, q or n to reject them.
+func (dctl *DisplayControl) confirm(title string, lines []string) bool {
+	paint := func() {
+		dctl.post(func() {
+			dctl.cls()
+			window := dctl.screen
+			h := window.FontHeight()
+			area := window.Bounds().Inset(h)
+			window.String(area.Min, dctl.fontColor, title)
+			fit := max(area.Dy()/h-2, 1)
+			p := area.Min.Add(image.Pt(0, 2*h))
+			for i, line := range lines {
+				if i == fit-1 && len(lines) > fit {
+					window.String(p, dctl.borderColor, fmt.Sprintf("and %d more", len(lines)-i))
+					break
+				}
+				window.String(p, dctl.fontColor, line)
+				p.Y += h
+			}
+			if err := window.Flush(); err != nil {
+				log.Printf("display: flush: %v", err)
+			}
+		})
+	}
+
+	defer func() {
+		dctl.waitPaint()
+		dctl.painted = nil
+	}()
+	paint()
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case k := <-dctl.kctl.C:
+			switch k {
+			case '\n', 'y':
+				return true
+			case escKey, 'q', 'n':
+				return false
+			}
+		case <-dctl.mctl.C:
+		case <-dctl.mctl.Resize:
+			dctl.invalidate()
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			paint()
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+
+	"9fans.net/go/plumb"
+)
+
+// sessionEvent reports an event of the review session to the
+// plumber and to the hooks.
+func sessionEvent(event, path string) {
+	plumbEvent(event, path)
+	runHook(event, path)
+}
+
+// plumbEvent plumbs an event of the review session, like "view" or "mark",
+// to the port of -events, so that other tools can follow the session.
+// The data is the path of the image and the attribute event names the event.
+func plumbEvent(event, path string) {
+	if *eventsPort == "" || plumber == nil {
+		return
+	}
+	m := plumb.Message{
+		Src:  progName,
+		Dst:  *eventsPort,
+		Dir:  filepath.Dir(path),
+		Type: "text",
+		Attr: &plumb.Attribute{Name: "event", Value: event},
+		Data: []byte(path),
+	}
+	if err := m.Send(plumber); err != nil {
+		log.Printf("plumber: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exifDateLayout is the layout of the dates of EXIF.
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// The tags of the dates, in IFD0 and in the EXIF IFD.
+const (
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+)
+
+// exifDateField is a date of the EXIF of a JPEG, at its offset in the file.
+type exifDateField struct {
+	tag    uint16
+	offset int
+	date   time.Time
+}
+
+var errNoExifDates = errors.New("no EXIF dates")
+
+// exifDates finds the dates in the EXIF of the JPEG data: the time the
+// photo was taken, digitized and changed. They are fixed length strings,
+// so that they can be changed in place.
+func exifDates(data []byte) ([]exifDateField, error) {
+	tiff, base, ok := jpegExif(data)
+	if !ok {
+		return nil, errNoExifDates
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, errors.New("bad TIFF header")
+	}
+
+	var fields []exifDateField
+	// walk reads the entries of the IFD at off for the dates and the EXIF IFD
+	var walk func(off int, depth int) error
+	walk = func(off int, depth int) error {
+		if off < 8 || off+2 > len(tiff) || depth > 1 {
+			return errors.New("bad IFD offset")
+		}
+		n := int(bo.Uint16(tiff[off:]))
+		for i := range n {
+			e := off + 2 + 12*i
+			if e+12 > len(tiff) {
+				return errors.New("truncated IFD")
+			}
+			tag, typ, count := bo.Uint16(tiff[e:]), bo.Uint16(tiff[e+2:]), bo.Uint32(tiff[e+4:])
+			value := int(bo.Uint32(tiff[e+8:]))
+			switch tag {
+			case tagExifIFD:
+				if err := walk(value, depth+1); err != nil {
+					return err
+				}
+			case tagDateTime, tagDateTimeOriginal, tagDateTimeDigitized:
+				const ascii = 2
+				if typ != ascii || count != 20 || value+19 > len(tiff) {
+					continue
+				}
+				d, err := time.Parse(exifDateLayout, string(tiff[value:value+19]))
+				if err != nil {
+					continue // unknown dates are blank or zeros
+				}
+				fields = append(fields, exifDateField{tag: tag, offset: base + value, date: d})
+			}
+		}
+		return nil
+	}
+	if err := walk(int(bo.Uint32(tiff[4:])), 0); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errNoExifDates
+	}
+	return fields, nil
+}
+
+// jpegExif returns the TIFF structure of the EXIF segment of the JPEG data
+// and its offset in data.
+func jpegExif(data []byte) ([]byte, int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, false
+	}
+	for p := 2; p+4 <= len(data) && data[p] == 0xFF; {
+		marker := data[p+1]
+		if marker == 0xDA || marker == 0xD9 { // the image data starts
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if n < 2 || p+2+n > len(data) {
+			break
+		}
+		seg := data[p+4 : p+2+n]
+		if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+			return seg[6:], p + 10, true
+		}
+		p += 2 + n
+	}
+	return nil, 0, false
+}
+
+// parseShift parses the offset of a date shift, a duration like -1h30m with
+// days too, like +2d3h.
+func parseShift(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	sign := time.Duration(1)
+	rest := strings.TrimPrefix(s, "+")
+	if r, ok := strings.CutPrefix(rest, "-"); ok {
+		sign, rest = -1, r
+	}
+	var d time.Duration
+	if days, after, ok := strings.Cut(rest, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("shift dates: bad offset %q", s)
+		}
+		d, rest = time.Duration(n)*24*time.Hour, after
+	}
+	if rest != "" {
+		hm, err := time.ParseDuration(rest)
+		if err != nil || hm < 0 {
+			return 0, fmt.Errorf("shift dates: bad offset %q", s)
+		}
+		d += hm
+	}
+	return sign * d, nil
+}
+
+// dateShift is the shift of the dates of an image file.
+type dateShift struct {
+	path   string
+	fields []exifDateField
+}
+
+// planDateShifts finds the dates of the images of the icons. Images without
+// EXIF dates are left out and logged.
+func planDateShifts(icons []*Icon) []dateShift {
+	var shifts []dateShift
+	for _, icon := range icons {
+		if _, remote := remoteSourceOf(icon.path); remote {
+			log.Printf("shift dates: %s: remote images cannot be changed", icon.path)
+			continue
+		}
+		data, err := os.ReadFile(icon.path)
+		if err != nil {
+			log.Printf("shift dates: %v", err)
+			continue
+		}
+		fields, err := exifDates(data)
+		if err != nil {
+			log.Printf("shift dates: %s: %v", icon.path, err)
+			continue
+		}
+		shifts = append(shifts, dateShift{path: icon.path, fields: fields})
+	}
+	return shifts
+}
+
+// taken returns the date the photo was taken, or else the first date found.
+func (s dateShift) taken() exifDateField {
+	for _, f := range s.fields {
+		if f.tag == tagDateTimeOriginal {
+			return f
+		}
+	}
+	return s.fields[0]
+}
+
+// apply shifts the dates of the file by d. The file is rewritten with its
+// permissions and modification time.
+func (s dateShift) apply(d time.Duration) error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("shift dates: %w", err)
+	}
+	fields, err := exifDates(data)
+	if err != nil {
+		return fmt.Errorf("shift dates: %s: %w", s.path, err)
+	}
+	for _, f := range fields {
+		copy(data[f.offset:], f.date.Add(d).Format(exifDateLayout))
+	}
+	if err := rewriteFile(s.path, data); err != nil {
+		return fmt.Errorf("shift dates: %w", err)
+	}
+	return nil
+}
+
+// shiftMarkedDates asks for an offset, previews the old and the new dates
+// of the marked images and shifts them if confirmed.
+func (dctl *DisplayControl) shiftMarkedDates(marked []*Icon) {
+	answer, ok := dctl.readText("shift dates by, like +1h or -2d3h30m: ", func(string) []string { return nil })
+	if !ok || answer == "" {
+		return
+	}
+	d, err := parseShift(answer)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	var shifts []dateShift
+	dctl.showWaitingAndCall(func() {
+		shifts = planDateShifts(marked)
+	})
+	if len(shifts) == 0 {
+		log.Printf("shift dates: no marked image has EXIF dates")
+		return
+	}
+
+	var lines []string
+	for _, s := range shifts {
+		f := s.taken()
+		lines = append(lines, fmt.Sprintf("%s  %s -> %s", s.path,
+			f.date.Format(exifDateLayout), f.date.Add(d).Format(exifDateLayout)))
+	}
+	title := fmt.Sprintf("shift the dates of %d images by %v? enter to apply, esc to cancel", len(shifts), d)
+	if !dctl.confirm(title, lines) {
+		return
+	}
+	n := 0
+	for _, s := range shifts {
+		if err := s.apply(d); err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		n++
+	}
+	log.Printf("shift dates: shifted the dates of %d images by %v", n, d)
+}
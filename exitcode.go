@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// The exit codes, so that wrapper scripts can branch on the selection.
+const (
+	exitMarked     = 0 // some images were marked
+	exitNoneMarked = 1 // no image was marked, or there were no images
+	exitError      = 2 // an error stopped iview, or the flags are wrong
+)
+
+// fatal logs like log.Print and exits with exitError.
+func fatal(v ...any) {
+	log.Print(v...)
+	os.Exit(exitError)
+}
+
+// fatalf logs like log.Printf and exits with exitError.
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	os.Exit(exitError)
+}
+
+// exitCode returns the exit code for the icons at exit.
+func exitCode(icons []*Icon) int {
+	for _, icon := range icons {
+		if icon.Marked() {
+			return exitMarked
+		}
+	}
+	return exitNoneMarked
+}
+
+// writeSummary writes the counts of the session for -summary: the images
+// displayed in the display view, marked, rejected by their XMP rating,
+// moved to the trash and failed to decode.
+func writeSummary(w io.Writer, icons []*Icon) {
+	var viewed, marked, rejected, trashed, failed int
+	for _, icon := range icons {
+		if views, _ := icon.ViewStats(); views > 0 {
+			viewed++
+		}
+		if icon.Marked() {
+			marked++
+		}
+		if rating, _ := icon.Rating(); rating < 0 {
+			rejected++
+		}
+		if icon.Trashed() {
+			trashed++
+		}
+		if icon.Failed() {
+			failed++
+		}
+	}
+	fmt.Fprintf(w, "images=%d viewed=%d marked=%d rejected=%d trashed=%d errors=%d\n",
+		len(icons), viewed, marked, rejected, trashed, failed)
+}
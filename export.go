@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// exportPreset are the settings of an export, so that the images of a
+// selection come out alike.
+type exportPreset struct {
+	name    string
+	maxSize int    // fit in maxSize x maxSize pixels, 0 keeps the size
+	format  string // jpeg or png
+	quality int    // of jpeg
+	dpi     int    // the print resolution recorded in the file, 0 for none
+}
+
+// exportPresets are the presets of the menu of the icons view.
+var exportPresets = []exportPreset{
+	{name: "web-2048", maxSize: 2048, format: "jpeg", quality: 85},
+	{name: "print-300dpi", format: "jpeg", quality: 95, dpi: 300},
+	{name: "archive-lossless", format: "png"},
+}
+
+// exportItem is an image moving through the stages of an export.
+type exportItem struct {
+	icon   *Icon
+	img    image.Image
+	pooled bool // img is from the pools, see scaleToFit
+	data   []byte
+	name   string // the file written
+	err    error
+}
+
+// exportImages converts the icons by the preset p to files in dir. The images
+// go through a pipeline of stages, each with its own workers: decode, then
+// transform (trim and scale), encode and write, so that the reads, the CPU
+// work and the writes overlap. An existing file is handled by -oncollision.
+// Each image is reported to progress and appended to manifest.txt in dir.
+// When ctx is cancelled no more images are started, the ones in the pipeline
+// are finished. It returns the number of images exported.
+func exportImages(ctx context.Context, icons []*Icon, dir string, p exportPreset, progress func(batchStatus)) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("export: %w", err)
+	}
+	manifest, err := os.OpenFile(filepath.Join(dir, "manifest.txt"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("export: %w", err)
+	}
+
+	feed := make(chan *exportItem)
+	go func() {
+		defer close(feed)
+		for _, icon := range icons {
+			select {
+			case feed <- &exportItem{icon: icon}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	cpus := runtime.NumCPU()
+	decoded := exportStage(feed, cpus, func(it *exportItem) {
+		it.img, it.err = renderIcon(it.icon)
+	})
+	transformed := exportStage(decoded, cpus, func(it *exportItem) {
+		it.img = autoCropped(it.img, *cropExport)
+		if b := it.img.Bounds(); p.maxSize > 0 && max(b.Dx(), b.Dy()) > p.maxSize {
+			it.img = scaleToFit(nil, it.img, image.Rect(0, 0, p.maxSize, p.maxSize))
+			it.pooled = true
+		}
+	})
+	encoded := exportStage(transformed, cpus, func(it *exportItem) {
+		it.data, it.err = p.encode(it.img)
+		if it.pooled {
+			putBytes(it.img.(*image.RGBA).Pix)
+		}
+		it.img = nil
+	})
+	written := exportStage(encoded, 2, func(it *exportItem) {
+		base := strings.TrimSuffix(filepath.Base(it.icon.path), filepath.Ext(it.icon.path))
+		it.name, it.err = writeExport(filepath.Join(dir, base+p.ext()), it.data)
+		it.data = nil
+	})
+
+	n := 0
+	for it := range written {
+		if it.err != nil {
+			log.Printf("export: %s: %v", it.icon.path, it.err)
+		} else {
+			n++
+			fmt.Fprintf(manifest, "%s\t%s\n", it.icon.path, it.name)
+		}
+		progress(batchStatus{name: it.icon.path, err: it.err})
+	}
+	if err := manifest.Close(); err != nil {
+		return n, fmt.Errorf("export: %w", err)
+	}
+	return n, nil
+}
+
+// exportStage runs fn on the items of in with n workers and sends them on.
+// The items that failed in an earlier stage pass through.
+func exportStage(in <-chan *exportItem, n int, fn func(*exportItem)) <-chan *exportItem {
+	out := make(chan *exportItem)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range in {
+				if it.err == nil {
+					fn(it)
+				}
+				out <- it
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// ext returns the file suffix of the format of the preset.
+func (p exportPreset) ext() string {
+	if p.format == "png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// encode encodes img in the format of the preset.
+func (p exportPreset) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if p.format == "png" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: p.quality}); err != nil {
+		return nil, err
+	}
+	if p.dpi > 0 {
+		return withJFIFDensity(buf.Bytes(), p.dpi), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// withJFIFDensity inserts a JFIF segment with the resolution dpi after the
+// start of the JPEG data, for printing at the intended size. The encoder
+// of the standard library writes none.
+func withJFIFDensity(data []byte, dpi int) []byte {
+	app0 := []byte{0xFF, 0xE0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 2, 1, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(app0[12:], uint16(dpi))
+	binary.BigEndian.PutUint16(app0[14:], uint16(dpi))
+	out := make([]byte, 0, len(data)+len(app0))
+	out = append(out, data[:2]...) // start of image
+	out = append(out, app0...)
+	return append(out, data[2:]...)
+}
+
+// writeExport writes data to the file name, by -oncollision if it exists.
+// It returns the name written.
+func writeExport(name string, data []byte) (string, error) {
+	f, name, err := createFile(name, collides)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	return name, f.Close()
+}
+
+// exportMarked exports the marked icons by the preset p to the directory of
+// -exportdir, displaying the progress.
+func (dctl *DisplayControl) exportMarked(marked []*Icon, p exportPreset) {
+	var n int
+	cancelled := false
+	err := dctl.showBatch("export "+p.name, len(marked), func(ctx context.Context, progress func(batchStatus)) error {
+		var err error
+		n, err = exportImages(ctx, marked, *exportDir, p, progress)
+		cancelled = ctx.Err() != nil
+		return err
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	if cancelled {
+		log.Printf("export: cancelled, exported %d of %d images, listed in %s",
+			n, len(marked), filepath.Join(*exportDir, "manifest.txt"))
+		return
+	}
+	log.Printf("exported %d images as %s to %s", n, p.name, *exportDir)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Farbfeld is the image format of suckless: the magic, the width and the
+// height, then the pixels in rows as RGBA of 16 bit big endian samples, not
+// premultiplied. Its tools, like png2ff and ff2png, and imagemagick convert
+// to and from it in pipelines. See https://tools.suckless.org/farbfeld/.
+
+func init() {
+	image.RegisterFormat("farbfeld", "farbfeld", decodeFarbfeld, decodeFarbfeldConfig)
+}
+
+const (
+	farbfeldHeaderSize = 16
+	// farbfeldMaxPixels limits the size of corrupt images.
+	farbfeldMaxPixels = 400_000_000
+)
+
+var errNotFarbfeld = errors.New("farbfeld: not a farbfeld image")
+
+// farbfeldHeader reads the dimensions of the farbfeld image.
+func farbfeldHeader(header []byte) (w, h int, err error) {
+	if len(header) < farbfeldHeaderSize || string(header[:8]) != "farbfeld" {
+		return 0, 0, errNotFarbfeld
+	}
+	w, h = int(binary.BigEndian.Uint32(header[8:])), int(binary.BigEndian.Uint32(header[12:]))
+	if w == 0 || h == 0 || w > farbfeldMaxPixels/h {
+		return 0, 0, errors.New("farbfeld: bad header")
+	}
+	return w, h, nil
+}
+
+// decodeFarbfeld decodes the farbfeld image of r. The pixels are stored
+// like those of NRGBA64, so they are the pixels of the image. They are
+// read as they come, not allocated by the header, so that a corrupt header
+// fails without allocating for all of its pixels.
+func decodeFarbfeld(r io.Reader) (image.Image, error) {
+	var header [farbfeldHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	w, h, err := farbfeldHeader(header[:])
+	if err != nil {
+		return nil, err
+	}
+	size := int64(w) * int64(h) * 8
+	pix, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(pix)) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &image.NRGBA64{Pix: pix, Stride: 8 * w, Rect: image.Rect(0, 0, w, h)}, nil
+}
+
+// decodeFarbfeldConfig reads the dimensions of the farbfeld image of r.
+func decodeFarbfeldConfig(r io.Reader) (image.Config, error) {
+	var header [farbfeldHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return image.Config{}, err
+	}
+	w, h, err := farbfeldHeader(header[:])
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBA64Model, Width: w, Height: h}, nil
+}
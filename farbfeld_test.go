@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// farbfeldImage returns a farbfeld image of w x h with the pixel data pix.
+func farbfeldImage(w, h uint32, pix ...byte) []byte {
+	data := []byte("farbfeld")
+	data = binary.BigEndian.AppendUint32(data, w)
+	data = binary.BigEndian.AppendUint32(data, h)
+	return append(data, pix...)
+}
+
+func TestDecodeFarbfeld(t *testing.T) {
+	pix := []byte{
+		0xFF, 0xFF, 0, 0, 0, 0, 0xFF, 0xFF,
+		0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0x80, 0x00,
+	}
+	img, format, err := image.Decode(bytes.NewReader(farbfeldImage(1, 2, pix...)))
+	if err != nil || format != "farbfeld" {
+		t.Fatalf("decode: %v, format %q", err, format)
+	}
+	want := []color.NRGBA64{{0xFFFF, 0, 0, 0xFFFF}, {0x1234, 0x5678, 0x9ABC, 0x8000}}
+	for y, c := range want {
+		if got := img.(*image.NRGBA64).NRGBA64At(0, y); got != c {
+			t.Errorf("pixel %d = %v, want %v", y, got, c)
+		}
+	}
+}
+
+func TestDecodeFarbfeldCorrupt(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		truncated bool // fails with io.ErrUnexpectedEOF, or else a bad header
+	}{
+		{"truncated header", []byte("farbfeld\x00\x00"), true},
+		{"no pixels", farbfeldImage(2, 2), true},
+		{"truncated pixels", farbfeldImage(1, 1, 1, 2, 3), true},
+		{"huge", farbfeldImage(20000, 20000, 1, 2, 3, 4, 5, 6, 7, 8), true},
+		{"empty", farbfeldImage(0, 1), false},
+	}
+	for _, tt := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := decodeFarbfeld(bytes.NewReader(tt.data))
+		runtime.ReadMemStats(&after)
+		if err == nil || tt.truncated && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: error %v, want truncated %v", tt.name, err, tt.truncated)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+			t.Errorf("%s: allocated %d bytes", tt.name, n)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The file operations of the batch actions, like exports and moves to the
+// trash, go through copyFile, moveFile and createFile. They handle the
+// destinations that exist by a collision policy, move across file systems
+// by copying, and keep the permissions and the modification time of the
+// files they copy.
+
+// collision is what a file operation does when the destination exists.
+type collision int
+
+const (
+	collisionRename    collision = iota // write to a free name, like photo-2.jpg
+	collisionOverwrite                  // replace the destination
+	collisionSkip                       // leave the destination and fail with errSkipped
+	collisionAsk                        // ask on the terminal whether to overwrite, or else skip
+)
+
+// errSkipped is returned when the destination exists and is left alone.
+var errSkipped = errors.New("destination exists, skipped")
+
+var collisionNames = map[string]collision{
+	"rename":    collisionRename,
+	"overwrite": collisionOverwrite,
+	"skip":      collisionSkip,
+	"ask":       collisionAsk,
+}
+
+// parseCollision parses the policies of -oncollision.
+func parseCollision(s string) (collision, error) {
+	c, ok := collisionNames[s]
+	if !ok {
+		return 0, fmt.Errorf("oncollision: unknown policy %q, use rename, overwrite, skip or ask", s)
+	}
+	return c, nil
+}
+
+// destination returns where to write dst by the policy c.
+func destination(dst string, c collision) (string, error) {
+	if _, err := os.Lstat(dst); errors.Is(err, fs.ErrNotExist) {
+		return dst, nil
+	}
+	switch c {
+	case collisionOverwrite:
+		return dst, nil
+	case collisionAsk:
+		if askYesNo(fmt.Sprintf("%s exists, overwrite it?", dst)) {
+			return dst, nil
+		}
+	case collisionRename:
+		return freeName(dst), nil
+	}
+	return "", fmt.Errorf("%s: %w", dst, errSkipped)
+}
+
+// freeName returns the first of name-2, name-3 and so on, before the
+// suffix, that does not exist.
+func freeName(name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 2; ; n++ {
+		free := fmt.Sprintf("%s-%d%s", stem, n, ext)
+		if _, err := os.Lstat(free); errors.Is(err, fs.ErrNotExist) {
+			return free
+		}
+	}
+}
+
+// createFile creates the file name for writing, by the policy c if it
+// exists. It returns the file and its name, which may differ from name.
+func createFile(name string, c collision) (*os.File, string, error) {
+	for {
+		dst, err := destination(name, c)
+		if err != nil {
+			return nil, "", err
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if dst != name || c == collisionRename {
+			// another writer may take the free name first
+			flags |= os.O_EXCL
+		}
+		f, err := os.OpenFile(dst, flags, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return f, dst, err
+	}
+}
+
+// copyFile copies src to dst, by the policy c if dst exists, with the
+// permissions and the modification time of src. It writes a temporary
+// file next to dst and renames it, so that dst is never half written.
+// It returns the name written.
+func copyFile(src, dst string, c collision) (string, error) {
+	dst, err := destination(dst, c)
+	if err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+progName+"-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, in)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return dst, nil
+}
+
+// rewriteFile replaces the contents of the file with data, keeping its
+// permissions and modification time. Like copyFile it writes a temporary
+// file and renames it.
+func rewriteFile(name string, data []byte) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+progName+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// moveFile moves src to dst, by the policy c if dst exists. Across file
+// systems, where rename fails, it copies src and removes it. It returns
+// the name written.
+func moveFile(src, dst string, c collision) (string, error) {
+	dst, err := destination(dst, c)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(src, dst)
+	if err == nil {
+		return dst, nil
+	}
+	if !crossDevice(err) {
+		return "", err
+	}
+	// dst is free or to be overwritten, as decided above
+	if _, err := copyFile(src, dst, collisionOverwrite); err != nil {
+		return "", err
+	}
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// crossDevice reports whether the rename failed because the destination is
+// on another file system.
+func crossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
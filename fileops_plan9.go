@@ -0,0 +1,14 @@
+//go:build plan9
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// crossDevice reports whether the rename failed because the destination is
+// in another directory, as Plan 9 renames only within a directory.
+func crossDevice(err error) bool {
+	return errors.Is(err, fs.ErrInvalid)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFiles creates the files of contents in dir.
+func writeFiles(t *testing.T, dir string, contents map[string]string) {
+	t.Helper()
+	for name, data := range contents {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFile returns the contents of the file, or "" if it does not exist.
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDestination(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  collision
+		want    string
+		skipped bool
+	}{
+		{"new.jpg", collisionRename, "new.jpg", false},
+		{"new.jpg", collisionSkip, "new.jpg", false},
+		{"a.jpg", collisionRename, "a-3.jpg", false},
+		{"a.jpg", collisionOverwrite, "a.jpg", false},
+		{"a.jpg", collisionSkip, "", true},
+		{"b", collisionRename, "b-2", false},
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.jpg": "a", "a-2.jpg": "a2", "b": "b"})
+	for _, tt := range tests {
+		got, err := destination(filepath.Join(dir, tt.name), tt.policy)
+		if tt.skipped {
+			if !errors.Is(err, errSkipped) {
+				t.Errorf("destination(%s, %d): error %v, want %v", tt.name, tt.policy, err, errSkipped)
+			}
+			continue
+		}
+		if err != nil || got != filepath.Join(dir, tt.want) {
+			t.Errorf("destination(%s, %d) = %s, %v, want %s", tt.name, tt.policy, got, err, tt.want)
+		}
+	}
+}
+
+func TestFreeName(t *testing.T) {
+	tests := []struct {
+		exist []string
+		name  string
+		want  string
+	}{
+		{nil, "a.jpg", "a-2.jpg"},
+		{[]string{"a-2.jpg"}, "a.jpg", "a-3.jpg"},
+		{[]string{"a-2.jpg", "a-3.jpg"}, "a.jpg", "a-4.jpg"},
+		{nil, "a.tar.gz", "a.tar-2.gz"},
+		{nil, "noext", "noext-2"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, name := range tt.exist {
+			writeFiles(t, dir, map[string]string{name: ""})
+		}
+		if got := freeName(filepath.Join(dir, tt.name)); got != filepath.Join(dir, tt.want) {
+			t.Errorf("freeName(%s) with %v = %s, want %s", tt.name, tt.exist, filepath.Base(got), tt.want)
+		}
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	tests := []struct {
+		policy   collision
+		want     string
+		skipped  bool
+		contents string // of a.txt after the write
+	}{
+		{collisionRename, "a-2.txt", false, "old"},
+		{collisionOverwrite, "a.txt", false, "new"},
+		{collisionSkip, "", true, "old"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"a.txt": "old"})
+		f, name, err := createFile(filepath.Join(dir, "a.txt"), tt.policy)
+		if tt.skipped {
+			if !errors.Is(err, errSkipped) {
+				t.Errorf("createFile(%d): error %v, want %v", tt.policy, err, errSkipped)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("createFile(%d): %v", tt.policy, err)
+			}
+			f.WriteString("new")
+			f.Close()
+			if name != filepath.Join(dir, tt.want) {
+				t.Errorf("createFile(%d) wrote %s, want %s", tt.policy, filepath.Base(name), tt.want)
+			}
+		}
+		if got := readFile(t, filepath.Join(dir, "a.txt")); got != tt.contents {
+			t.Errorf("createFile(%d): a.txt is %q, want %q", tt.policy, got, tt.contents)
+		}
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	tests := []struct {
+		dst      string
+		policy   collision
+		want     string
+		skipped  bool
+		contents string // of dst.jpg after the copy
+	}{
+		{"new.jpg", collisionSkip, "new.jpg", false, "dst"},
+		{"dst.jpg", collisionRename, "dst-2.jpg", false, "dst"},
+		{"dst.jpg", collisionOverwrite, "dst.jpg", false, "src"},
+		{"dst.jpg", collisionSkip, "", true, "dst"},
+	}
+	mtime := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"src.jpg": "src", "dst.jpg": "dst"})
+		src := filepath.Join(dir, "src.jpg")
+		if err := os.Chmod(src, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(src, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := copyFile(src, filepath.Join(dir, tt.dst), tt.policy)
+		if tt.skipped {
+			if !errors.Is(err, errSkipped) {
+				t.Errorf("copyFile to %s (%d): error %v, want %v", tt.dst, tt.policy, err, errSkipped)
+			}
+		} else if err != nil || got != filepath.Join(dir, tt.want) {
+			t.Errorf("copyFile to %s (%d) = %s, %v, want %s", tt.dst, tt.policy, got, err, tt.want)
+		} else {
+			info, err := os.Stat(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 || !info.ModTime().Equal(mtime) {
+				t.Errorf("copyFile to %s: mode %v mtime %v, want %v %v", tt.dst, info.Mode().Perm(), info.ModTime(), fs.FileMode(0600), mtime)
+			}
+			if data := readFile(t, got); data != "src" {
+				t.Errorf("copyFile to %s: contents %q, want %q", tt.dst, data, "src")
+			}
+		}
+		if data := readFile(t, filepath.Join(dir, "dst.jpg")); data != tt.contents {
+			t.Errorf("copyFile to %s (%d): dst.jpg is %q, want %q", tt.dst, tt.policy, data, tt.contents)
+		}
+		if data := readFile(t, src); data != "src" {
+			t.Errorf("copyFile changed the source to %q", data)
+		}
+		if tmps, _ := filepath.Glob(filepath.Join(dir, "."+progName+"-*")); len(tmps) > 0 {
+			t.Errorf("copyFile left temporary files %v", tmps)
+		}
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	tests := []struct {
+		src      string
+		dst      string
+		policy   collision
+		want     string
+		err      error
+		contents string // of dst.jpg after the move
+	}{
+		{"src.jpg", "new.jpg", collisionSkip, "new.jpg", nil, "dst"},
+		{"src.jpg", "dst.jpg", collisionRename, "dst-2.jpg", nil, "dst"},
+		{"src.jpg", "dst.jpg", collisionOverwrite, "dst.jpg", nil, "src"},
+		{"src.jpg", "dst.jpg", collisionSkip, "", errSkipped, "dst"},
+		{"missing.jpg", "new.jpg", collisionSkip, "", fs.ErrNotExist, "dst"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{"src.jpg": "src", "dst.jpg": "dst"})
+		got, err := moveFile(filepath.Join(dir, tt.src), filepath.Join(dir, tt.dst), tt.policy)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) || got != "" {
+				t.Errorf("moveFile(%s, %s, %d) = %q, %v, want error %v", tt.src, tt.dst, tt.policy, got, err, tt.err)
+			}
+			if data := readFile(t, filepath.Join(dir, "src.jpg")); data != "src" {
+				t.Errorf("moveFile(%s, %s, %d) failed but changed src.jpg to %q", tt.src, tt.dst, tt.policy, data)
+			}
+		} else {
+			if err != nil || got != filepath.Join(dir, tt.want) {
+				t.Errorf("moveFile(%s, %s, %d) = %s, %v, want %s", tt.src, tt.dst, tt.policy, got, err, tt.want)
+			}
+			if data := readFile(t, got); data != "src" {
+				t.Errorf("moveFile to %s: contents %q, want %q", tt.want, data, "src")
+			}
+			if _, err := os.Lstat(filepath.Join(dir, tt.src)); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("moveFile(%s, %s, %d) left the source", tt.src, tt.dst, tt.policy)
+			}
+		}
+		if data := readFile(t, filepath.Join(dir, "dst.jpg")); data != tt.contents {
+			t.Errorf("moveFile(%s, %s, %d): dst.jpg is %q, want %q", tt.src, tt.dst, tt.policy, data, tt.contents)
+		}
+	}
+}
+
+func TestMoveFileAcrossFileSystems(t *testing.T) {
+	other, err := os.MkdirTemp("/dev/shm", progName+"-test-")
+	if err != nil {
+		t.Skip("no other file system:", err)
+	}
+	defer os.RemoveAll(other)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"probe": "", "src.jpg": "src"})
+	if err := os.Rename(filepath.Join(dir, "probe"), filepath.Join(other, "probe")); !crossDevice(err) {
+		t.Skipf("%s is not on another file system: %v", other, err)
+	}
+	mtime := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	src := filepath.Join(dir, "src.jpg")
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := moveFile(src, filepath.Join(other, "dst.jpg"), collisionSkip)
+	if err != nil || got != filepath.Join(other, "dst.jpg") {
+		t.Fatalf("moveFile across file systems = %s, %v", got, err)
+	}
+	if data := readFile(t, got); data != "src" {
+		t.Errorf("moved contents %q, want %q", data, "src")
+	}
+	if info, err := os.Stat(got); err != nil || !info.ModTime().Equal(mtime) {
+		t.Errorf("moved file: %v, want mtime %v", err, mtime)
+	}
+	if _, err := os.Lstat(src); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("moveFile across file systems left the source")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "sync"
+
+// readFlight shares the reads of a file among the loads that want it at the
+// same time, like those of the icons and the display views, which decode
+// the image at different sizes. The data is shared, so it must not be
+// changed.
+type readFlight struct {
+	mu    sync.Mutex
+	calls map[string]*readCall
+}
+
+// readCall is a read in progress.
+type readCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// reads shares the reads of the images.
+var reads readFlight
+
+// Do calls read for path and returns its result. If a read of path is in
+// progress, it waits for it and returns its result instead.
+func (f *readFlight) Do(path string, read func() ([]byte, error)) ([]byte, error) {
+	f.mu.Lock()
+	if c, ok := f.calls[path]; ok {
+		f.mu.Unlock()
+		<-c.done
+		return c.data, c.err
+	}
+	if f.calls == nil {
+		f.calls = make(map[string]*readCall)
+	}
+	c := &readCall{done: make(chan struct{})}
+	f.calls[path] = c
+	f.mu.Unlock()
+
+	c.data, c.err = read()
+	f.mu.Lock()
+	delete(f.calls, path)
+	f.mu.Unlock()
+	close(c.done)
+	return c.data, c.err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"path/filepath"
+	"strings"
+)
+
+// decodeFrame decodes frame n of the image in data. It also returns the
+// number of frames. Only GIFs are animated, all other formats have 1 frame.
+func decodeFrame(data []byte, n int) (image.Image, int, error) {
+	if !bytes.HasPrefix(data, []byte("GIF8")) {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		return img, 1, err
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(g.Image) <= 1 {
+		if len(g.Image) == 0 {
+			return nil, 0, fmt.Errorf("gif: no frames")
+		}
+		return g.Image[0], 1, nil
+	}
+	n = min(max(n, 0), len(g.Image)-1)
+	return composeGIFFrame(g, n), len(g.Image), nil
+}
+
+// composeGIFFrame paints the frames [0, n] on a canvas honoring the disposal
+// methods, so that the result is what a player displays at frame n.
+func composeGIFFrame(g *gif.GIF, n int) image.Image {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+	var previous *image.RGBA
+	for i := 0; i <= n; i++ {
+		frame := g.Image[i]
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if i == n {
+			break
+		}
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return canvas
+}
+
+// exportFrame saves frame n of the image file as a PNG next to it. If crop,
+// the uniform borders are trimmed and if invert, the colors are inverted.
+// An existing PNG is handled by -oncollision. It returns the path of the PNG.
+func exportFrame(path string, n int, crop, invert bool) (string, error) {
+	data, err := readImageFile(path)
+	if err != nil {
+		return "", fmt.Errorf("export frame: %w", err)
+	}
+	img, _, err := decodeFrame(data, n)
+	if err != nil {
+		return "", fmt.Errorf("export frame: %w", err)
+	}
+	img = inverted(autoCropped(img, crop), invert)
+	name := fmt.Sprintf("%s-frame%03d.png", strings.TrimSuffix(path, filepath.Ext(path)), n+1)
+	f, name, err := createFile(name, collides)
+	if err != nil {
+		return "", fmt.Errorf("export frame: %w", err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return "", fmt.Errorf("export frame: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("export frame: %w", err)
+	}
+	return name, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import "image"
+
+// toggleFullscreen enters or leaves the fullscreen mode, for slideshows. In
+// fullscreen the window covers the monitor of -screen, the background is
+// black and the views hide their overlays. Leaving it restores the window.
+//
+// The window system resizes the window asynchronously, the views repaint
+// on the resize event. Where the window system ignores the request, the
+// mode still changes the presentation.
+func (dctl *DisplayControl) toggleFullscreen() {
+	if dctl.fullscreen {
+		dctl.leaveFullscreen()
+		return
+	}
+	dctl.invalidate()
+	dctl.fullscreen = true
+	dctl.windowed = dctl.screen.Bounds()
+	dctl.windowBg, dctl.bgColor = dctl.bgColor, dctl.blackColor
+	dctl.screen.Resize(image.Rectangle{Max: monitorSize})
+}
+
+// leaveFullscreen restores the window as it was before fullscreen.
+func (dctl *DisplayControl) leaveFullscreen() {
+	if !dctl.fullscreen {
+		return
+	}
+	dctl.invalidate()
+	dctl.fullscreen = false
+	dctl.bgColor = dctl.windowBg
+	dctl.screen.Resize(dctl.windowed)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// galleryIndex is the HTML page of a gallery.
+var galleryIndex = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="background: #666666">
+{{range .Images}}<a href="{{.Image}}"><img src="{{.Thumb}}" title="{{.Name}}" style="margin: 2px"></a>
+{{end}}</body>
+</html>
+`))
+
+// galleryImage is an image of a gallery, with paths relative to the index.
+type galleryImage struct {
+	Name  string
+	Image string
+	Thumb string
+}
+
+// exportGallery writes the icons to dir as an HTML gallery: index.html shows
+// their thumbnails, sized like the icons, which link to copies of the images.
+// If maxSize is positive, the copies are scaled down to fit in maxSize x maxSize.
+// The images are exported in parallel, reporting each to progress, until
+// ctx is cancelled. manifest.txt lists the images exported, with the paths
+// of their copies, so that a cancelled export can be completed. It returns
+// the number of images exported.
+func exportGallery(ctx context.Context, icons []*Icon, dir string, maxSize int, progress func(batchStatus)) (int, error) {
+	for _, d := range []string{"images", "thumbs"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return 0, fmt.Errorf("export gallery: %w", err)
+		}
+	}
+
+	exported := make([]*galleryImage, len(icons))
+	runBatch(ctx, len(icons), func(n int) batchStatus {
+		icon := icons[n]
+		// the number keeps the order and the names unique
+		base := fmt.Sprintf("%04d-%s", n+1, filepath.Base(icon.path))
+		gi, err := exportGalleryImage(icon, dir, base, maxSize)
+		if err != nil {
+			log.Printf("export gallery: %s: %v", icon.path, err)
+		} else {
+			exported[n] = &gi
+		}
+		return batchStatus{name: icon.path, err: err}
+	}, progress)
+
+	var images []galleryImage
+	var manifest strings.Builder
+	for n, gi := range exported {
+		if gi != nil {
+			images = append(images, *gi)
+			fmt.Fprintf(&manifest, "%s\t%s\n", icons[n].path, gi.Image)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.txt"), []byte(manifest.String()), 0644); err != nil {
+		return 0, fmt.Errorf("export gallery: %w", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return 0, fmt.Errorf("export gallery: %w", err)
+	}
+	err = galleryIndex.Execute(f, struct {
+		Title  string
+		Images []galleryImage
+	}{filepath.Base(dir), images})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("export gallery: %w", err)
+	}
+	return len(images), nil
+}
+
+// exportGalleryImage writes the copy and the thumbnail of the icon.
+func exportGalleryImage(icon *Icon, dir, base string, maxSize int) (galleryImage, error) {
+	gi := galleryImage{
+		Name:  filepath.Base(icon.path),
+		Image: "images/" + base,
+		Thumb: "thumbs/" + strings.TrimSuffix(base, filepath.Ext(base)) + ".jpg",
+	}
+	img, err := renderIcon(icon)
+	if err != nil {
+		return gi, err
+	}
+	cropped := autoCropped(img, *cropExport)
+	trimmed := !cropped.Bounds().Eq(img.Bounds())
+	img = cropped
+
+	thumb := scaleToFit(nil, img, image.Rectangle{Max: iconSize})
+	err = writeJPEG(filepath.Join(dir, gi.Thumb), thumb)
+	putBytes(thumb.Pix)
+	if err != nil {
+		return gi, err
+	}
+
+	b := img.Bounds()
+	// the file has the borders, trimmed images are encoded again
+	if !trimmed && (maxSize <= 0 || max(b.Dx(), b.Dy()) <= maxSize) {
+		if _, remote := remoteSourceOf(icon.path); !remote {
+			// the copy keeps the permissions and the time of the file
+			_, err := copyFile(icon.path, filepath.Join(dir, gi.Image), collisionOverwrite)
+			return gi, err
+		}
+		data, err := readImageFile(icon.path)
+		if err != nil {
+			return gi, err
+		}
+		return gi, os.WriteFile(filepath.Join(dir, gi.Image), data, 0644)
+	}
+	gi.Image = "images/" + strings.TrimSuffix(base, filepath.Ext(base)) + ".jpg"
+	if maxSize <= 0 || max(b.Dx(), b.Dy()) < maxSize {
+		maxSize = max(b.Dx(), b.Dy())
+	}
+	scaled := scaleToFit(nil, img, image.Rect(0, 0, maxSize, maxSize))
+	err = writeJPEG(filepath.Join(dir, gi.Image), scaled)
+	putBytes(scaled.Pix)
+	return gi, err
+}
+
+// exportMarkedGallery exports the marked icons to the gallery directory of
+// -gallery, displaying the progress.
+func (dctl *DisplayControl) exportMarkedGallery(marked []*Icon) {
+	var n int
+	cancelled := false
+	err := dctl.showBatch("export gallery", len(marked), func(ctx context.Context, progress func(batchStatus)) error {
+		var err error
+		n, err = exportGallery(ctx, marked, *galleryDir, *gallerySize, progress)
+		cancelled = ctx.Err() != nil
+		return err
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	if cancelled {
+		log.Printf("export gallery: cancelled, exported %d of %d images, listed in %s",
+			n, len(marked), filepath.Join(*galleryDir, "manifest.txt"))
+		return
+	}
+	log.Printf("exported %d images to %s", n, filepath.Join(*galleryDir, "index.html"))
+}
+
+// writeJPEG writes img to the file name.
+func writeJPEG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 90}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
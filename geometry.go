@@ -27,6 +27,22 @@ func bestFit(dr, sr image.Rectangle) image.Rectangle {
 	return center(dr, r)
 }
 
+// scaleRect maps r from the coordinates of the rectangle from to the
+// coordinates of the rectangle to, like a region of an image to where
+// the image is displayed scaled.
+func scaleRect(r, from, to image.Rectangle) image.Rectangle {
+	if from.Empty() {
+		return image.Rectangle{}
+	}
+	scale := func(p image.Point) image.Point {
+		return image.Point{
+			to.Min.X + (p.X-from.Min.X)*to.Dx()/from.Dx(),
+			to.Min.Y + (p.Y-from.Min.Y)*to.Dy()/from.Dy(),
+		}
+	}
+	return image.Rectangle{scale(r.Min), scale(r.Max)}
+}
+
 // intCeil returns the ceiling of a/b
 func intCeil(a, b int) int {
 	n := a / b
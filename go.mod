@@ -7,3 +7,16 @@ require 9fans.net/go v0.0.7
 require golang.org/x/image v0.24.0
 
 require github.com/xor-gate/goexif2 v1.1.0
+
+require (
+	github.com/makiuchi-d/gozxing v0.1.1
+	github.com/pkg/sftp v1.13.7
+	golang.org/x/text v0.22.0
+)
+
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+)
@@ -2,6 +2,13 @@ package main
 
 import "image"
 
+const (
+	// scrollWidth is the width of the scroll bar at the left edge of the grid.
+	scrollWidth = 12
+	// wheelSteps is the number of mouse wheel steps to scroll a row.
+	wheelSteps = 4
+)
+
 // Grid overlays on area a maximal MxN grid of icons. The dimensions are calculated
 // from the iconSize and the padding.
 type Grid struct {
@@ -11,10 +18,13 @@ type Grid struct {
 }
 
 // Offset is used with a grid and an implicit slice to track which items should be displayed.
-// A MxN grid will display items [pos, pos + M*N) of the slice.
+// A MxN grid will display items [pos, pos + M*N) of the slice. When dy is not zero,
+// the grid is scrolled dy pixels further down, the top row is partially visible and
+// the items of one more row are partially visible at the bottom.
 type Offset struct {
 	grid  *Grid
 	pos   int
+	dy    int // pixels scrolled into the row of pos, less than a cell
 	limit int
 }
 
@@ -34,36 +44,66 @@ func (g *Grid) Attach(r image.Rectangle) {
 
 // dimensions return the grid dimensions, rows x columns.
 func (g *Grid) Dimensions() (rows int, cols int) {
-	rows = (g.area.Dy() - g.padding) / (g.iconSize.Y + g.padding)
-	cols = (g.area.Dx() - g.padding) / (g.iconSize.X + g.padding)
+	a := g.iconArea()
+	rows = (a.Dy() - g.padding) / (g.iconSize.Y + g.padding)
+	cols = (a.Dx() - g.padding) / (g.iconSize.X + g.padding)
 	return
 }
 
+// Scrollbar returns the area of the scroll bar, at the left edge of the grid.
+func (g *Grid) Scrollbar() image.Rectangle {
+	r := g.area
+	r.Max.X = min(r.Max.X, r.Min.X+scrollWidth)
+	return r
+}
+
+// iconArea returns the area of the grid right of the scroll bar.
+func (g *Grid) iconArea() image.Rectangle {
+	r := g.area
+	r.Min.X = g.Scrollbar().Max.X
+	return r
+}
+
 // Area returns the icon area of the grid, rows * columns.
 func (g *Grid) Area() int {
 	rows, cols := g.Dimensions()
 	return rows * cols
 }
 
-// gridCoords translates the area coordinates to the grid coordinates.
-func (g *Grid) GridCoords(at image.Point) (x int, y int, inside bool) {
+// gridCoords translates the area coordinates to the grid coordinates,
+// for a grid scrolled dy pixels down.
+func (g *Grid) GridCoords(at image.Point, dy int) (x int, y int, inside bool) {
 	h := g.PaintableArea()
 	inside = at.In(h)
 	if !inside {
 		return
 	}
-	x = (at.X - h.Min.X) / g.iconSize.X
-	y = (at.Y - h.Min.Y) / g.iconSize.Y
+	cell := g.CellSize()
+	x = (at.X - h.Min.X) / cell.X
+	y = (at.Y - h.Min.Y + dy) / cell.Y
 	return
 }
 
+// CellSize returns the size of an icon with its padding.
+func (g *Grid) CellSize() image.Point {
+	return g.iconSize.Add(image.Pt(g.padding, g.padding))
+}
+
 // PaintableArea is the area of the grid which contains icons.
 // Only full icons are displayed and there maybe empty space at the edges of grid.area
 func (g *Grid) PaintableArea() image.Rectangle {
 	rows, cols := g.Dimensions()
 	ir := image.Rect(0, 0,
 		cols*(g.iconSize.X+g.padding), rows*(g.iconSize.Y+g.padding))
-	return center(g.area, ir)
+	return center(g.iconArea(), ir)
+}
+
+// snapshot returns a copy of the offset and its grid, for painting.
+func (o *Offset) snapshot() *Offset {
+	s := *o
+	g := *o.grid
+	s.grid = &g
+	return &s
 }
 
 // NewOffset returns a new offset with limit and grid.
@@ -71,9 +111,15 @@ func NewOffset(grid *Grid, limit int) *Offset {
 	return &Offset{grid: grid, limit: limit}
 }
 
-// Visible returns the visible items for the current grid page.
+// Visible returns the visible items for the current grid page,
+// including the partially visible ones.
 func (o *Offset) Visible() (int, int) {
-	return o.pos, min(o.limit, o.pos+o.grid.Area())
+	to := o.pos + o.grid.Area()
+	if o.dy > 0 {
+		_, cols := o.grid.Dimensions()
+		to += cols
+	}
+	return o.pos, min(o.limit, to)
 }
 
 // CurrentPage return the current page.
@@ -93,14 +139,39 @@ func (o *Offset) PageOfItem(i int) int {
 func (o *Offset) MoveUpRow() {
 	_, cols := o.grid.Dimensions()
 	o.pos = max(0, o.pos-cols)
+	o.dy = 0
 }
 
 // MoveDownRow scrolls the page one grid row down.
 func (o *Offset) MoveDownRow() {
+	_, cols := o.grid.Dimensions()
+	o.pos = min(o.pos+cols, o.maxPos())
+	o.dy = 0
+}
+
+// maxPos returns the last position the grid can scroll down to.
+func (o *Offset) maxPos() int {
 	rows, cols := o.grid.Dimensions()
 	// add cols as an offset so that it displays
 	// an empty row at the end of the icons
-	o.pos = min(o.pos+cols, max(0, o.limit-(rows*cols)+cols))
+	return max(0, o.limit-(rows*cols)+cols)
+}
+
+// ScrollPixels scrolls the grid n pixels down, or up if n is negative.
+func (o *Offset) ScrollPixels(n int) {
+	_, cols := o.grid.Dimensions()
+	cellY := o.grid.CellSize().Y
+	dy := o.dy + n
+	for ; dy < 0 && o.pos > 0; dy += cellY {
+		o.pos = max(0, o.pos-cols)
+	}
+	for ; dy >= cellY && o.pos < o.maxPos(); dy -= cellY {
+		o.pos = min(o.pos+cols, o.maxPos())
+	}
+	if dy < 0 || o.pos >= o.maxPos() {
+		dy = 0
+	}
+	o.dy = min(dy, cellY-1)
 }
 
 // GotoPage moves view to page.
@@ -108,12 +179,73 @@ func (o *Offset) GotoPage(page int) {
 	numPages := intCeil(o.limit, o.grid.Area())
 	if 0 <= page && page < numPages {
 		o.pos = page * o.grid.Area()
+		o.dy = 0
+	}
+}
+
+// StepPages moves the view d pages, stopping at the first and the last.
+func (o *Offset) StepPages(d int) {
+	numPages := intCeil(o.limit, o.grid.Area())
+	o.GotoPage(max(0, min(o.CurrentPage()+d, numPages-1)))
+}
+
+// Row returns the grid row of the item, or -1 if it is not visible.
+func (o *Offset) Row(i int) int {
+	if from, to := o.Visible(); from <= i && i < to {
+		_, cols := o.grid.Dimensions()
+		return (i - o.pos) / cols
+	}
+	return -1
+}
+
+// ShowAtRow scrolls so that the item is displayed at the grid row,
+// or as close to it as the limits allow.
+func (o *Offset) ShowAtRow(i, row int) {
+	if i < 0 || i >= o.limit {
+		return
+	}
+	rows, cols := o.grid.Dimensions()
+	row = max(0, min(row, rows-1))
+	o.pos = max(0, (i/cols-row)*cols)
+	o.dy = 0
+}
+
+// Thumb returns the part of the scroll bar r that corresponds to the visible items.
+func (o *Offset) Thumb(r image.Rectangle) image.Rectangle {
+	if o.limit == 0 {
+		return r
+	}
+	from, to := o.Visible()
+	thumb := r
+	thumb.Min.Y = r.Min.Y + from*r.Dy()/o.limit
+	thumb.Max.Y = r.Min.Y + to*r.Dy()/o.limit
+	// keep the thumb visible for long lists
+	if thumb.Dy() < 2 {
+		thumb.Max.Y = min(r.Max.Y, thumb.Min.Y+2)
+		thumb.Min.Y = thumb.Max.Y - 2
+	}
+	return thumb
+}
+
+// ScrollTo scrolls so that the item at the position y of the scroll bar r
+// is at the top row. The scroll is in pixels, so dragging is smooth.
+func (o *Offset) ScrollTo(r image.Rectangle, y int) {
+	if o.limit == 0 || r.Dy() == 0 {
+		return
+	}
+	y = max(r.Min.Y, min(y, r.Max.Y))
+	_, cols := o.grid.Dimensions()
+	cellY := o.grid.CellSize().Y
+	px := (y - r.Min.Y) * intCeil(o.limit, cols) * cellY / r.Dy()
+	o.pos, o.dy = px/cellY*cols, px%cellY
+	if o.pos >= o.maxPos() {
+		o.pos, o.dy = o.maxPos(), 0
 	}
 }
 
 // At computes the offset under the point.
 func (o *Offset) At(p image.Point) (int, bool) {
-	x, y, inside := o.grid.GridCoords(p)
+	x, y, inside := o.grid.GridCoords(p, o.dy)
 	if !inside {
 		return -1, false
 	}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// groupSet is the named groups of the session, like maybe or ask client,
+// for triage beyond marking. Unlike the tags, they are not saved: with
+// -groupdir the paths of each group are written to a file on exit.
+type groupSet struct {
+	names []string // in the order they were created
+	last  string   // the group assigned last, the default of the prompt
+}
+
+// sessionGroups are the groups of the session, at first those of -groups.
+var sessionGroups groupSet
+
+// add adds the group name, if new.
+func (g *groupSet) add(name string) {
+	if !slices.Contains(g.names, name) {
+		g.names = append(g.names, name)
+	}
+}
+
+// Complete returns the names of the groups that start with word.
+func (g *groupSet) Complete(word string) []string {
+	var names []string
+	for _, n := range g.names {
+		if strings.HasPrefix(n, word) {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// splitGroups splits the comma separated names of -groups.
+func splitGroups(s string) []string {
+	var names []string
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// inGroup reports whether the icon is in the group.
+func (i *Icon) inGroup(name string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return slices.Contains(i.groups, name)
+}
+
+// Groups returns the groups the icon is in.
+func (i *Icon) Groups() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return slices.Clone(i.groups)
+}
+
+// toggleGroup adds the icons to the group or, if all are in it, removes
+// them. It returns whether they were added.
+func toggleGroup(icons []*Icon, name string) bool {
+	all := true
+	for _, icon := range icons {
+		all = all && icon.inGroup(name)
+	}
+	for _, icon := range icons {
+		icon.mu.Lock()
+		if all {
+			icon.groups = slices.DeleteFunc(icon.groups, func(g string) bool { return g == name })
+		} else if !slices.Contains(icon.groups, name) {
+			icon.groups = append(icon.groups, name)
+		}
+		icon.mu.Unlock()
+	}
+	return !all
+}
+
+// groupIcons returns the icons of the group, in order.
+func groupIcons(icons []*Icon, name string) []*Icon {
+	var members []*Icon
+	for _, icon := range icons {
+		if icon.inGroup(name) {
+			members = append(members, icon)
+		}
+	}
+	return members
+}
+
+// readGroup asks for the name of a group. An empty answer is the group
+// assigned last.
+func (dctl *DisplayControl) readGroup(prompt string) (string, bool) {
+	if sessionGroups.last != "" {
+		prompt = fmt.Sprintf("%s (%s): ", prompt, sessionGroups.last)
+	} else {
+		prompt += ": "
+	}
+	name, ok := dctl.readText(prompt, sessionGroups.Complete)
+	if name == "" {
+		name = sessionGroups.last
+	}
+	return name, ok && name != ""
+}
+
+// assignGroup asks for a group, creating it if new, and adds the icons to
+// it or removes them.
+func (dctl *DisplayControl) assignGroup(icons []*Icon) {
+	name, ok := dctl.readGroup(fmt.Sprintf("group %d images", len(icons)))
+	if !ok {
+		return
+	}
+	sessionGroups.add(name)
+	sessionGroups.last = name
+	if toggleGroup(icons, name) {
+		log.Printf("group %s: added %d images", name, len(icons))
+	} else {
+		log.Printf("group %s: removed %d images", name, len(icons))
+	}
+}
+
+// chooseGroup asks for a group and returns its icons.
+func (dctl *DisplayControl) chooseGroup(icons []*Icon) []*Icon {
+	if len(sessionGroups.names) == 0 {
+		log.Printf("groups: no groups, assign images to one with a")
+		return nil
+	}
+	name, ok := dctl.readGroup("view group, " + strings.Join(sessionGroups.names, ", "))
+	if !ok {
+		return nil
+	}
+	members := groupIcons(icons, name)
+	if len(members) == 0 {
+		log.Printf("group %s: no images", name)
+	}
+	return members
+}
+
+// writeGroups writes the paths of the images of each group, with their
+// siblings, one per line, to the file of the group name in dir.
+func writeGroups(dir string, icons []*Icon) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("groups: %w", err)
+	}
+	for _, name := range sessionGroups.names {
+		var b strings.Builder
+		for _, icon := range groupIcons(icons, name) {
+			for _, f := range icon.Files() {
+				fmt.Fprintln(&b, f)
+			}
+		}
+		file := filepath.Join(dir, strings.ReplaceAll(name, "/", "_")+".txt")
+		if err := os.WriteFile(file, []byte(b.String()), 0644); err != nil {
+			return fmt.Errorf("groups: %w", err)
+		}
+	}
+	return nil
+}
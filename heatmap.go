@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// HeatmapView is a View that shows the per-pixel differences of two images
+// with the same dimensions as a heatmap. The pixels that are the same are
+// dimmed, the others are colored from blue to red by how much they differ.
+type HeatmapView struct {
+	a, b *Icon
+	area image.Rectangle
+	heat ScreenImage // the heatmap, scaled to fit the area
+	diff *imageDiff
+	err  error // why there is no heatmap
+
+	dctl *DisplayControl
+}
+
+// NewHeatmapView returns a HeatmapView of the differences of b from a.
+func NewHeatmapView(a, b *Icon, r image.Rectangle) *HeatmapView {
+	return &HeatmapView{a: a, b: b, area: r}
+}
+
+func (hv *HeatmapView) Connect(dctl *DisplayControl) {
+	hv.dctl = dctl
+}
+
+func (hv *HeatmapView) Attach(r image.Rectangle) {
+	if r.Eq(hv.area) {
+		return
+	}
+	hv.Free()
+	hv.area = r
+}
+
+func (hv *HeatmapView) Free() {
+	hv.dctl.waitPaint()
+	if hv.heat != nil {
+		hv.heat.Free()
+		hv.heat = nil
+	}
+}
+
+func (hv *HeatmapView) Handle() View {
+	bt2menu := &draw9.Menu{
+		Item: []string{"back"},
+	}
+
+	dctl := hv.dctl
+	hv.load()
+	hv.paint(dctl)
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case k := <-dctl.kctl.C:
+			switch k {
+			case 'q', 'b', escKey: // back
+				return nil
+			case 'S': // snapshot
+				dctl.snapshot()
+			}
+		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			if dctl.mctl.Mouse.Buttons == 2 && dctl.screen.MenuHit(2, bt2menu) == 0 {
+				return nil
+			}
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			dctl.applyCtl(req)
+		case <-dctl.mctl.Resize:
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			hv.Attach(dctl.screen.Bounds())
+			hv.load()
+			hv.paint(dctl)
+		}
+	}
+}
+
+// load computes the heatmap and uploads it to the display, if not done yet.
+func (hv *HeatmapView) load() {
+	if hv.heat != nil || hv.err != nil {
+		return
+	}
+	hv.dctl.showWaitingAndCall(func() {
+		imgA, err := renderIcon(hv.a)
+		if err != nil {
+			hv.err = err
+			return
+		}
+		imgB, err := renderIcon(hv.b)
+		if err != nil {
+			hv.err = err
+			return
+		}
+		heat, diff, err := heatmap(imgA, imgB)
+		if err != nil {
+			hv.err = err
+			return
+		}
+		r := hv.area
+		r.Min.Y += 3 * hv.dctl.screen.FontHeight()
+		hv.heat, hv.err = FitBest(hv.dctl.screen, heat, r)
+		hv.diff = diff
+	})
+	if hv.err != nil {
+		log.Printf("heatmap: %v", hv.err)
+	}
+}
+
+// paint posts a request to paint the heatmap.
+func (hv *HeatmapView) paint(dctl *DisplayControl) {
+	h := *hv
+	dctl.post(func() { h.render(dctl) })
+}
+
+// render paints the heatmap with the names of the images and the
+// percentage of the pixels that differ.
+func (hv *HeatmapView) render(dctl *DisplayControl) {
+	dctl.painted = nil
+	window := dctl.screen
+	window.Draw(window.Bounds(), dctl.bgColor, image.Point{})
+	fontHeight := window.FontHeight()
+
+	p := hv.area.Min
+	window.String(p, dctl.fontColor, fmt.Sprintf("%s vs %s", hv.a.Path(), hv.b.Path()))
+	p.Y += fontHeight
+	if hv.err != nil {
+		window.String(p, dctl.warnColor, fmt.Sprintf("no heatmap: %v", hv.err))
+	} else {
+		window.String(p, dctl.fontColor, fmt.Sprintf("%.2f%% of pixels differ, %d regions",
+			hv.diff.percent(), len(hv.diff.regions)))
+		r := hv.area
+		r.Min.Y += 3 * fontHeight
+		window.Draw(bestFit(r, hv.heat.Bounds()), hv.heat, image.Point{})
+	}
+
+	if err := window.Flush(); err != nil {
+		log.Printf("display: flush: %v", err)
+	}
+}
+
+// heatmap returns an image of the per-pixel differences of a and b, and
+// their summary. The images must have the same dimensions.
+func heatmap(a, b image.Image) (*image.RGBA, *imageDiff, error) {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return nil, nil, fmt.Errorf("dimensions differ: %v and %v", a.Bounds().Size(), b.Bounds().Size())
+	}
+	ra, rb := toRGBA(a), toRGBA(b)
+	size := rb.Bounds().Size()
+	heat := image.NewRGBA(image.Rectangle{Max: size})
+	for y := 0; y < size.Y; y++ {
+		pa := ra.Pix[y*ra.Stride:]
+		pb := rb.Pix[y*rb.Stride:]
+		for x := 0; x < size.X; x++ {
+			d := 0
+			for c := 0; c < 4; c++ {
+				d = max(d, absDiff(pa[4*x+c], pb[4*x+c]))
+			}
+			if d == 0 {
+				lum := (int(pb[4*x]) + int(pb[4*x+1]) + int(pb[4*x+2])) / 12
+				heat.SetRGBA(x, y, color.RGBA{uint8(lum), uint8(lum), uint8(lum), 0xFF})
+			} else {
+				heat.SetRGBA(x, y, heatColor(d))
+			}
+		}
+	}
+	return heat, pixelDiff(a, b), nil
+}
+
+// heatColor returns the color of a difference d in 1-255: blue for small
+// differences, through green and yellow, to red for the largest.
+func heatColor(d int) color.RGBA {
+	switch {
+	case d < 64:
+		return color.RGBA{0, uint8(d * 4), 0xFF, 0xFF}
+	case d < 128:
+		return color.RGBA{0, 0xFF, uint8(255 - (d-64)*4), 0xFF}
+	case d < 192:
+		return color.RGBA{uint8((d - 128) * 4), 0xFF, 0, 0xFF}
+	default:
+		return color.RGBA{0xFF, uint8(255 - (d-192)*4), 0, 0xFF}
+	}
+}
+
+// absDiff returns |x-y|.
+func absDiff(x, y uint8) int {
+	if x > y {
+		return int(x - y)
+	}
+	return int(y - x)
+}
@@ -0,0 +1,47 @@
+package main
+
+// historyMax is the most images kept in the history.
+const historyMax = 1000
+
+// viewHistory is the sequence of the images displayed in the display
+// views of the session, for going back and forward like in a browser,
+// whatever the order of the images.
+type viewHistory struct {
+	icons []*Icon
+	at    int // the position of the displayed image
+}
+
+// history is the history of the session.
+var history viewHistory
+
+// visit records that icon is displayed. After going back, the images
+// ahead are dropped, like a browser does for a new page.
+func (h *viewHistory) visit(icon *Icon) {
+	if len(h.icons) > 0 && h.icons[h.at] == icon {
+		return
+	}
+	if len(h.icons) > 0 {
+		h.icons = h.icons[:h.at+1]
+	}
+	h.icons = append(h.icons, icon)
+	if len(h.icons) > historyMax {
+		h.icons = h.icons[len(h.icons)-historyMax:]
+	}
+	h.at = len(h.icons) - 1
+}
+
+// step goes back, for d -1, or forward, for d 1, to the nearest image of
+// the history that is in icons, and returns its index in icons. The images
+// of the history that are not in icons, like those of other views, are
+// skipped.
+func (h *viewHistory) step(d int, icons []*Icon) (int, bool) {
+	for at := h.at + d; 0 <= at && at < len(h.icons); at += d {
+		for i, icon := range icons {
+			if icon == h.icons[at] {
+				h.at = at
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
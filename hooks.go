@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// hookEvents are the events that can run hooks.
+var hookEvents = []string{"view", "mark", "unmark", "exit"}
+
+// hookFlag maps events to shell commands. It is a flag.Value set
+// as "event=command" and it can be repeated.
+type hookFlag map[string]string
+
+func (h hookFlag) String() string {
+	var s []string
+	for _, e := range hookEvents {
+		if cmd, ok := h[e]; ok {
+			s = append(s, e+"="+cmd)
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func (h hookFlag) Set(s string) error {
+	event, cmd, ok := strings.Cut(s, "=")
+	if !ok || cmd == "" {
+		return fmt.Errorf("want event=command")
+	}
+	if !slices.Contains(hookEvents, event) {
+		return fmt.Errorf("unknown event %q, want one of %s", event, strings.Join(hookEvents, ", "))
+	}
+	h[event] = cmd
+	return nil
+}
+
+// hookFlagVar defines a hookFlag flag.
+func hookFlagVar(name, usage string) hookFlag {
+	h := make(hookFlag)
+	flag.Var(h, name, usage)
+	return h
+}
+
+// runHook runs the hook of the event, if any, with the path in $file.
+// It does not wait for the hook to finish.
+func runHook(event, path string) {
+	cmd := hookCommand(event, path)
+	if cmd == nil {
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("hook %s: %v", event, err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("hook %s: %s: %v", event, path, err)
+		}
+	}()
+}
+
+// runExitHook runs the exit hook, if any, and waits for it. The paths
+// of the marked icons are written to its standard input.
+func runExitHook(icons []*Icon) {
+	cmd := hookCommand("exit", "")
+	if cmd == nil {
+		return
+	}
+	var marked strings.Builder
+	for _, icon := range icons {
+		if icon.Marked() {
+			for _, f := range icon.Files() {
+				fmt.Fprintln(&marked, f)
+			}
+		}
+	}
+	cmd.Stdin = strings.NewReader(marked.String())
+	if err := cmd.Run(); err != nil {
+		log.Printf("hook exit: %v", err)
+	}
+}
+
+// hookCommand returns the command of the hook of the event, or nil.
+func hookCommand(event, path string) *exec.Cmd {
+	sh, ok := hooks[event]
+	if !ok {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", sh)
+	cmd.Env = append(os.Environ(), "file="+path, "event="+event)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd
+}
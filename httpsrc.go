@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"time"
+)
+
+// httpSource is a RemoteSource for http and https URLs of single images,
+// like the ones copied from a browser. There are no directories to walk.
+type httpSource struct {
+	client *http.Client
+}
+
+func newHTTPSource() *httpSource {
+	return &httpSource{client: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+// httpFile is the file info of an image on the web.
+type httpFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (f *httpFile) Name() string       { return path.Base(f.name) }
+func (f *httpFile) Size() int64        { return f.size }
+func (f *httpFile) ModTime() time.Time { return f.modTime }
+func (f *httpFile) IsDir() bool        { return false }
+func (f *httpFile) Sys() any           { return nil }
+func (f *httpFile) Mode() fs.FileMode  { return 0444 }
+
+// Walk calls fn for the image of root, as there are no listings.
+func (s *httpSource) Walk(root string, fn fs.WalkDirFunc) error {
+	info, err := s.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	err = fn(root, fs.FileInfoToDirEntry(info), nil)
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// Stat asks the server for the size and the modification time of the
+// image. Servers that do not answer HEAD requests get an empty info.
+func (s *httpSource) Stat(url string) (fs.FileInfo, error) {
+	resp, err := s.client.Head(url)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &httpFile{name: resp.Request.URL.Path, size: max(resp.ContentLength, 0), modTime: modTime}, nil
+	case resp.StatusCode == http.StatusMethodNotAllowed:
+		return &httpFile{name: resp.Request.URL.Path}, nil
+	default:
+		return nil, fmt.Errorf("http: stat %s: %s", url, resp.Status)
+	}
+}
+
+func (s *httpSource) ReadFile(url string) ([]byte, error) {
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http: get %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("http: get %s: %w", url, err)
+	}
+	return data, nil
+}
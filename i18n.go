@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// collator orders the names of the images by the rules of the language of
+// -collate. If nil, they are in natural byte order. It is not safe for
+// concurrent use, the sorts run one at a time.
+var collator *collate.Collator
+
+// newCollator returns a collator for the language lang, like de or el. The
+// numbers in the names are compared by value, like in naturalCompare. If fold,
+// the case and the diacritics are ignored.
+func newCollator(lang string, fold bool) (*collate.Collator, error) {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return nil, fmt.Errorf("collate: %w", err)
+	}
+	opts := []collate.Option{collate.Numeric}
+	if fold {
+		opts = append(opts, collate.Loose)
+	}
+	return collate.New(tag, opts...), nil
+}
+
+// compareNames compares the paths a and b with the collator, or in natural
+// order if there is none.
+func compareNames(a, b string) int {
+	if collator == nil {
+		return naturalCompare(norm.NFC.String(a), norm.NFC.String(b))
+	}
+	return collator.CompareString(a, b)
+}
+
+// matchForm returns the form of a name or a pattern that is matched. The
+// names are in NFC, as the same name may be composed or decomposed, like
+// on macOS. With -fold the case and the diacritics are removed too, so
+// that αθηνα matches ΑΘΉΝΑ and cafe matches Café.
+func matchForm(s string) string {
+	if !*foldNames {
+		return norm.NFC.String(s)
+	}
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC, cases.Fold())
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		return norm.NFC.String(s)
+	}
+	return folded
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// ICO files, the icons of Windows and of the favicons of web sites, hold
+// the same icon in several sizes and depths. Each is a PNG or a DIB, the
+// bitmap of BMP without the file header, whose height counts the colors and
+// then the mask of the transparent pixels. The largest is displayed.
+
+func init() {
+	image.RegisterFormat("ico", "\x00\x00\x01\x00", decodeICO, decodeICOConfig)
+}
+
+const (
+	icoHeaderSize = 6
+	icoEntrySize  = 16
+	dibHeaderSize = 40
+	// dibMaxPixels limits the size of corrupt icons.
+	dibMaxPixels = 1 << 26
+)
+
+var (
+	errNotICO = errors.New("ico: not an ICO image")
+	errBadDIB = errors.New("ico: bad bitmap")
+)
+
+// icoEntry is an image of an ICO file.
+type icoEntry struct {
+	width, height int // 256 for 0
+	bpp           int // the bits per pixel, 0 if unknown
+	data          []byte
+}
+
+// largestICOEntry returns the largest image of the ICO data, the deepest of
+// those of the same size.
+func largestICOEntry(data []byte) (icoEntry, error) {
+	if len(data) < icoHeaderSize || string(data[:4]) != "\x00\x00\x01\x00" {
+		return icoEntry{}, errNotICO
+	}
+	n := int(binary.LittleEndian.Uint16(data[4:]))
+	var best icoEntry
+	for i := range n {
+		e := data[icoHeaderSize+i*icoEntrySize:]
+		if len(e) < icoEntrySize {
+			return icoEntry{}, io.ErrUnexpectedEOF
+		}
+		size, offset := binary.LittleEndian.Uint32(e[8:]), binary.LittleEndian.Uint32(e[12:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			continue
+		}
+		entry := icoEntry{
+			width:  int(e[0]),
+			height: int(e[1]),
+			bpp:    int(binary.LittleEndian.Uint16(e[6:])),
+			data:   data[offset : offset+size],
+		}
+		if entry.width == 0 {
+			entry.width = 256
+		}
+		if entry.height == 0 {
+			entry.height = 256
+		}
+		if best.data == nil || entry.width*entry.height > best.width*best.height ||
+			entry.width*entry.height == best.width*best.height && entry.bpp > best.bpp {
+			best = entry
+		}
+	}
+	if best.data == nil {
+		return icoEntry{}, errors.New("ico: no images")
+	}
+	return best, nil
+}
+
+// decodeICO decodes the largest image of the ICO file of r.
+func decodeICO(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	e, err := largestICOEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(e.data, []byte("\x89PNG")) {
+		return png.Decode(bytes.NewReader(e.data))
+	}
+	return decodeDIB(e.data)
+}
+
+// decodeICOConfig reads the dimensions of the largest image of the ICO
+// file of r.
+func decodeICOConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	e, err := largestICOEntry(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if bytes.HasPrefix(e.data, []byte("\x89PNG")) {
+		return png.DecodeConfig(bytes.NewReader(e.data))
+	}
+	w, h, _, err := dibHeader(e.data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: w, Height: h}, nil
+}
+
+// dibHeader reads the dimensions and the bits per pixel of the DIB of an
+// icon. The height is that of the icon, half that of the header.
+func dibHeader(data []byte) (w, h, bpp int, err error) {
+	if len(data) < dibHeaderSize || binary.LittleEndian.Uint32(data) < dibHeaderSize {
+		return 0, 0, 0, errBadDIB
+	}
+	w = int(int32(binary.LittleEndian.Uint32(data[4:])))
+	h = int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bpp = int(binary.LittleEndian.Uint16(data[14:]))
+	compression := binary.LittleEndian.Uint32(data[16:])
+	if w <= 0 || h <= 0 || w > dibMaxPixels/h || compression != 0 && !(compression == 3 && bpp == 32) {
+		return 0, 0, 0, errBadDIB
+	}
+	switch bpp {
+	case 1, 4, 8, 24, 32:
+		return w, h, bpp, nil
+	}
+	return 0, 0, 0, errBadDIB
+}
+
+// decodeDIB decodes the DIB of an icon: the colors, from a palette up to
+// 8 bits per pixel, then the mask, with the rows bottom up and padded to 4
+// bytes. Icons of 32 bits have alpha and the mask is used only if their
+// alpha is all 0, like in some old icons.
+func decodeDIB(data []byte) (image.Image, error) {
+	w, h, bpp, err := dibHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	p := int(binary.LittleEndian.Uint32(data))
+	if bpp == 32 && binary.LittleEndian.Uint32(data[16:]) == 3 && p == dibHeaderSize {
+		p += 12 // the masks of the channels, always BGRA in icons
+	}
+	if p < 0 || p > len(data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var palette []color.NRGBA
+	if bpp <= 8 {
+		n := int(binary.LittleEndian.Uint32(data[32:]))
+		if n == 0 || n > 1<<bpp {
+			n = 1 << bpp
+		}
+		if len(data) < p+4*n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		palette = make([]color.NRGBA, n)
+		for i := range palette {
+			b := data[p+4*i:]
+			palette[i] = color.NRGBA{b[2], b[1], b[0], 0xFF}
+		}
+		p += 4 * n
+	}
+
+	rowSize := (w*bpp + 31) / 32 * 4
+	maskRowSize := (w + 31) / 32 * 4
+	colors := data[p:]
+	if len(colors) < h*rowSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// the mask is missing in some icons of 32 bits
+	mask := colors[h*rowSize:]
+	if len(mask) < h*maskRowSize {
+		mask = nil
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	hasAlpha := false
+	for y := range h {
+		row := colors[(h-1-y)*rowSize:]
+		for x := range w {
+			var c color.NRGBA
+			switch bpp {
+			case 1, 4, 8:
+				bit := x * bpp
+				i := int(row[bit/8]>>(8-bpp-bit%8)) & (1<<bpp - 1)
+				if i >= len(palette) {
+					return nil, errBadDIB
+				}
+				c = palette[i]
+			case 24:
+				c = color.NRGBA{row[3*x+2], row[3*x+1], row[3*x], 0xFF}
+			case 32:
+				c = color.NRGBA{row[4*x+2], row[4*x+1], row[4*x], row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	if bpp == 32 && hasAlpha {
+		return img, nil
+	}
+	for y := range h {
+		for x := range w {
+			transparent := mask != nil && mask[(h-1-y)*maskRowSize+x/8]&(0x80>>(x%8)) != 0
+			i := img.PixOffset(x, y)
+			if transparent {
+				img.Pix[i+3] = 0
+			} else {
+				img.Pix[i+3] = 0xFF
+			}
+		}
+	}
+	return img, nil
+}
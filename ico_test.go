@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// dibImage returns the DIB of an icon of w x h with bpp bits per pixel:
+// the header of headerSize, then the rest, the palette, colors and mask.
+func dibImage(headerSize uint32, w, h int32, bpp uint16, rest ...byte) []byte {
+	le := binary.LittleEndian
+	data := le.AppendUint32(nil, headerSize)
+	data = le.AppendUint32(data, uint32(w))
+	data = le.AppendUint32(data, uint32(2*h))
+	data = le.AppendUint16(data, 1)
+	data = le.AppendUint16(data, bpp)
+	data = append(data, make([]byte, dibHeaderSize-16)...)
+	return append(data, rest...)
+}
+
+// icoFile returns an ICO file with the images, all said to be 2 x 2.
+func icoFile(images ...[]byte) []byte {
+	le := binary.LittleEndian
+	data := []byte{0, 0, 1, 0}
+	data = le.AppendUint16(data, uint16(len(images)))
+	offset := icoHeaderSize + icoEntrySize*len(images)
+	for _, img := range images {
+		data = append(data, 2, 2, 0, 0, 1, 0, 32, 0)
+		data = le.AppendUint32(data, uint32(len(img)))
+		data = le.AppendUint32(data, uint32(offset))
+		offset += len(img)
+	}
+	for _, img := range images {
+		data = append(data, img...)
+	}
+	return data
+}
+
+func TestDecodeICO(t *testing.T) {
+	// 2 x 2 of 32 bits, bottom up: a blue and a transparent pixel, then
+	// red and green. The mask is ignored as there is alpha.
+	colors := []byte{
+		0xFF, 0, 0, 0xFF, 0, 0, 0, 0,
+		0, 0, 0xFF, 0xFF, 0, 0xFF, 0, 0x80,
+	}
+	mask := make([]byte, 8)
+	img, format, err := image.Decode(bytes.NewReader(icoFile(dibImage(dibHeaderSize, 2, 2, 32, append(colors, mask...)...))))
+	if err != nil || format != "ico" {
+		t.Fatalf("decode: %v, format %q", err, format)
+	}
+	want := [][]color.NRGBA{
+		{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0x80}},
+		{{0, 0, 0xFF, 0xFF}, {0, 0, 0, 0}},
+	}
+	for y, row := range want {
+		for x, c := range row {
+			if got := img.(*image.NRGBA).NRGBAAt(x, y); got != c {
+				t.Errorf("pixel %d,%d = %v, want %v", x, y, got, c)
+			}
+		}
+	}
+}
+
+func TestDecodeICOCorrupt(t *testing.T) {
+	colors := make([]byte, 16)
+	// the masks of the channels follow the header, which ends the data
+	bitfields := dibImage(dibHeaderSize, 2, 2, 32, 1, 2, 3)
+	binary.LittleEndian.PutUint32(bitfields[16:], 3)
+	tests := []struct {
+		name string
+		data []byte
+		err  error // if nil, any error
+	}{
+		{"no images", icoFile(), nil},
+		{"truncated entries", icoFile(dibImage(dibHeaderSize, 2, 2, 32, colors...))[:12], io.ErrUnexpectedEOF},
+		{"huge header size", icoFile(dibImage(0x7FFFFFFF, 2, 2, 32, colors...)), io.ErrUnexpectedEOF},
+		{"header size past the data", icoFile(dibImage(dibHeaderSize+17, 2, 2, 32, colors...)), io.ErrUnexpectedEOF},
+		{"bitfields past the data", icoFile(bitfields), io.ErrUnexpectedEOF},
+		{"truncated header", icoFile(dibImage(dibHeaderSize, 2, 2, 32)[:20]), errBadDIB},
+		{"truncated palette", icoFile(dibImage(dibHeaderSize, 2, 2, 8, 1, 2, 3)), io.ErrUnexpectedEOF},
+		{"truncated colors", icoFile(dibImage(dibHeaderSize, 2, 2, 24, 1, 2, 3)), io.ErrUnexpectedEOF},
+		{"bad bits per pixel", icoFile(dibImage(dibHeaderSize, 2, 2, 7, colors...)), errBadDIB},
+		{"negative width", icoFile(dibImage(dibHeaderSize, -2, 2, 32, colors...)), errBadDIB},
+		{"huge", icoFile(dibImage(dibHeaderSize, 1<<20, 1<<20, 32, colors...)), errBadDIB},
+	}
+	for _, tt := range tests {
+		_, err := decodeICO(bytes.NewReader(tt.data))
+		if err == nil || tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
@@ -8,46 +8,105 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"log"
-	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
-	draw9 "9fans.net/go/draw"
 	"github.com/xor-gate/goexif2/exif"
 	"github.com/xor-gate/goexif2/tiff"
+	_ "golang.org/x/image/bmp"
 	xdraw "golang.org/x/image/draw"
 	_ "golang.org/x/image/webp"
 )
 
 var (
-	// fastScaler is used to scale small icons.
-	fastScaler xdraw.Scaler = xdraw.BiLinear
-	// bestScaler is used to scale large images.
-	bestScaler xdraw.Scaler = xdraw.CatmullRom
+	// fastScaler is used to scale small icons. If nil, it is chosen per image.
+	fastScaler xdraw.Scaler
+	// bestScaler is used to scale large images. If nil, it is chosen per image.
+	bestScaler xdraw.Scaler
 )
 
 // Displayer returns the display version of the image.
-type Displayer func(image.Image) (*draw9.Image, error)
+type Displayer func(image.Image) (ScreenImage, error)
 
-// Icon is an image for viewing.
+// Icon is an image for viewing. The views change it while the caches load
+// its images and the painter displays them in other goroutines. The fields
+// guarded by mu are written holding it, by the views on the UI goroutine,
+// which may read them directly; the other goroutines use the methods.
 type Icon struct {
-	path   string // path of the image file
-	marked bool   // true if marked by the user
+	mu       sync.Mutex    // guards all the fields but size, note and diff, which are set before the views start
+	path     string        // path of the image file
+	marked   bool          // true if marked by the user
+	gps      bool          // true if the EXIF data contain GPS tags
+	gpsKnown bool          // true if gps has been computed
+	size     int64         // size of the image file. Set only when sorting by size
+	siblings []string      // other files of the same shot, like the RAW of a JPEG
+	failed   bool          // true if the file is not an image in a supported format
+	note     string        // a line of the info, like the references of the image with -doc
+	diff     *imageDiff    // the differences with the other version, with -diff
+	viewTime time.Duration // how long it was displayed in the single view
+	views    int           // how many times it was displayed in the single view
+	trashed  bool          // moved to the trash, see trashIcon
+	rating   int           // the stars of the XMP rating, -1 if rejected, 0 if none
+	label    string        // the label of the XMP, like Red
+	xmpRead  bool          // true if rating and label have been read, see readXMP
+	groups   []string      // the groups of the session it is in, see groupSet
 }
 
-// IconImage hold the contents of an icon.
+// IconImage hold the contents of an icon. It is loaded and unloaded by the
+// goroutines of a cache, one at a time by loadMu. The thumbnail and what the
+// load learned about the image are guarded by thumbMu, the views read them
+// with Ready and Info.
 type IconImage struct {
 	*Icon                      // the origin of the image
-	data       []byte          // the image contents from file
+	loadMu     sync.Mutex      // serializes Load and Unload, guards data, orient and key
+	data       []byte          // the image contents from file. Written also holding thumbMu
 	origBounds image.Rectangle // the bounds of image
-	thumb      *draw9.Image    // thumbnail for display
+	thumb      ScreenImage     // thumbnail for display
+	thumbMu    sync.Mutex      // guards thumb, frame and the fields of Info. thumb is freed also by drawMem
 	displayer  Displayer       // function to compute the display for the image
 	exifInfo   string          // a summary of the EXIF data if present
+	sizeInfo   string          // a summary of the file size and compression
+	frame      int             // the frame to display for animated images
+	numFrames  int             // the number of frames of the image
+	useMip     bool            // decode from the intermediate resolution if possible
+	orient     int             // the exif orientation, applied with -orient
+	lowDepth   bool            // upload the thumbnail in 16 bits per pixel, with -lowbw
+	findCodes  bool            // look for QR codes and barcodes when decoding
+	codes      []code          // the codes found, in the coordinates of origBounds
+	autoCrop   bool            // trim the uniform borders before fitting, with -autocrop
+	crop       image.Rectangle // the content without the borders, in the coordinates of origBounds. Empty if not cropped
+	invert     bool            // invert the colors, like a film negative
+	colorMgmt  bool            // convert the colors to the monitor profile of -icc
+	diskThumb  image.Point     // the size of the thumbnail kept in the persistent cache, if any
+	key        string          // the content key, with -cachedir
+}
+
+// imageInfo is what the load of an image learned about it.
+type imageInfo struct {
+	origBounds image.Rectangle // the bounds of image
+	crop       image.Rectangle // the content without the borders, empty if not cropped
+	numFrames  int             // the number of frames of the image
+	codes      []code          // the codes found, in the coordinates of origBounds
+	exifInfo   string          // a summary of the EXIF data if present
+	sizeInfo   string          // a summary of the file size and compression
+}
+
+// contentBounds returns the part of origBounds that is displayed: the
+// crop, if the borders were trimmed, or else all of it.
+func (in imageInfo) contentBounds() image.Rectangle {
+	if in.crop.Empty() {
+		return in.origBounds
+	}
+	return in.crop
 }
 
 var (
 	errNotSupportedFormat = errors.New("not supported format")
+	errNotLoaded          = errors.New("not loaded")
 )
 
 // NewIcon returns a new Icon for path.
@@ -60,111 +119,470 @@ func (i *Icon) NewIconImage(displayer Displayer) *IconImage {
 	return &IconImage{Icon: i, displayer: displayer}
 }
 
+// Files returns the paths of the image and its siblings.
+// File operations should act on all of them.
+func (i *Icon) Files() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]string{i.path}, i.siblings...)
+}
+
+// Path returns the path of the image file, which changes if it is renamed.
+func (i *Icon) Path() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.path
+}
+
+// setPaths records the new paths of the image file and its siblings.
+func (i *Icon) setPaths(path string, siblings []string) {
+	i.mu.Lock()
+	i.path, i.siblings = path, siblings
+	i.mu.Unlock()
+}
+
+// Trashed reports whether the image is in the trash.
+func (i *Icon) Trashed() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.trashed
+}
+
+// setTrashed records that the image was moved to the trash or restored.
+func (i *Icon) setTrashed(trashed bool) {
+	i.mu.Lock()
+	i.trashed = trashed
+	i.mu.Unlock()
+}
+
+// Marked reports whether the icon is marked by the user.
+func (i *Icon) Marked() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.marked
+}
+
+// setMarked marks or unmarks the icon, without recording it, like when
+// replaying the journal.
+func (i *Icon) setMarked(marked bool) {
+	i.mu.Lock()
+	i.marked = marked
+	i.mu.Unlock()
+}
+
+// Failed reports whether the file is not an image in a supported format.
+func (i *Icon) Failed() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.failed
+}
+
+// setFailed records that the file is not an image in a supported format.
+func (i *Icon) setFailed() {
+	i.mu.Lock()
+	i.failed = true
+	i.mu.Unlock()
+}
+
+// GPS returns whether the image contains GPS EXIF tags and whether that
+// is known yet. Unlike HasGPS, it does not read the file.
+func (i *Icon) GPS() (gps, known bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.gps, i.gpsKnown
+}
+
+// setGPS records whether the image contains GPS EXIF tags.
+func (i *Icon) setGPS(gps bool) {
+	i.mu.Lock()
+	i.gps, i.gpsKnown = gps, true
+	i.mu.Unlock()
+}
+
 // ToggleMarked marks/unmarks the icon
 func (i *Icon) ToggleMarked() {
+	i.mu.Lock()
 	i.marked = !i.marked
+	marked := i.marked
+	i.mu.Unlock()
+	if marked {
+		journal.Record("mark", i.path)
+		sessionEvent("mark", i.path)
+	} else {
+		journal.Record("unmark", i.path)
+		sessionEvent("unmark", i.path)
+	}
+	markedList.update(i.path, marked)
+}
+
+// remoteReadSize is the size of the reads for files on remote file systems.
+// Large sequential reads reduce the round trips of protocols like 9P.
+const remoteReadSize = 1 << 20
+
+// readImageFile reads the contents of the image file.
+func readImageFile(path string) ([]byte, error) {
+	if src, ok := remoteSourceOf(path); ok {
+		return src.ReadFile(path)
+	}
+	if !*remote {
+		return os.ReadFile(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var b bytes.Buffer
+	if info, err := f.Stat(); err == nil {
+		b.Grow(int(info.Size()))
+	}
+	if _, err := io.CopyBuffer(&b, f, make([]byte, remoteReadSize)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// HasGPS reports whether the image contains GPS EXIF tags.
+// The file is read only if the icon has not been loaded before.
+func (i *Icon) HasGPS() bool {
+	if gps, known := i.GPS(); known {
+		return gps
+	}
+	var gps bool
+	if isRemote(i.path) {
+		data, err := readImageFile(i.path)
+		if err != nil {
+			log.Printf("hasGPS: %v", err)
+			return false
+		}
+		gps = exifHasGPS(readExif(bytes.NewReader(data)))
+	} else {
+		f, err := os.Open(i.path)
+		if err != nil {
+			log.Printf("hasGPS: %v", err)
+			return false
+		}
+		defer f.Close()
+		gps = exifHasGPS(readExif(f))
+	}
+	i.setGPS(gps)
+	return gps
+}
+
+// Ready returns the thumbnail, if the image is loaded. Unlike ForDisplay,
+// it does not load the image.
+func (i *IconImage) Ready() (ScreenImage, bool) {
+	thumb := i.loadedThumb()
+	if thumb != nil {
+		drawMem.touch(i)
+	}
+	return thumb, thumb != nil
 }
 
-func (i *IconImage) ForDisplay() (*draw9.Image, error) {
+func (i *IconImage) ForDisplay() (ScreenImage, error) {
 	if err := i.Load(); err != nil {
 		return nil, err
 	}
-	return i.thumb, nil
+	drawMem.touch(i)
+	return i.loadedThumb(), nil
+}
+
+// loadedThumb returns the thumbnail, nil if not loaded.
+func (i *IconImage) loadedThumb() ScreenImage {
+	i.thumbMu.Lock()
+	defer i.thumbMu.Unlock()
+	return i.thumb
+}
+
+// Info returns what the last load learned about the image.
+func (i *IconImage) Info() imageInfo {
+	i.thumbMu.Lock()
+	defer i.thumbMu.Unlock()
+	return imageInfo{i.origBounds, i.crop, i.numFrames, i.codes, i.exifInfo, i.sizeInfo}
+}
+
+// Frame returns the frame to display for animated images.
+func (i *IconImage) Frame() int {
+	i.thumbMu.Lock()
+	defer i.thumbMu.Unlock()
+	return i.frame
+}
+
+// loadedData returns the image contents, nil if not loaded.
+func (i *IconImage) loadedData() []byte {
+	i.thumbMu.Lock()
+	defer i.thumbMu.Unlock()
+	return i.data
 }
 
 // Loads load the image from the file.
 func (i *IconImage) Load() error {
+	i.loadMu.Lock()
+	defer i.loadMu.Unlock()
+	if i.data == nil && i.loadedThumb() == nil && i.loadDiskThumb() {
+		return nil
+	}
 	if i.data == nil {
-		data, err := os.ReadFile(i.path)
+		path := i.Path()
+		data, err := reads.Do(path, func() ([]byte, error) {
+			var data []byte
+			var err error
+			fetchPool.Do(func() {
+				start := time.Now()
+				data, err = readImageFile(path)
+				if err == nil {
+					loads.fetched(time.Since(start), len(data))
+				}
+			})
+			return data, err
+		})
 		if err != nil {
 			return fmt.Errorf("load: %w", err)
 		}
 
-		switch ct := http.DetectContentType(data); ct {
-		case "image/gif", "image/jpeg", "image/png", "image/webp":
-			// supported format
-		default:
+		if ct := contentType(data); !isSupportedType(ct) {
+			i.setFailed()
 			return fmt.Errorf("load: cannot handle %s: %w", ct, errNotSupportedFormat)
 		}
 
-		i.exifInfo = getExifInfo(bytes.NewReader(data))
+		ex := readExif(bytes.NewReader(data))
+		exifInfo := getExifInfo(ex)
+		i.thumbMu.Lock()
+		i.exifInfo = exifInfo
 		i.data = data
+		i.thumbMu.Unlock()
+		i.setGPS(exifHasGPS(ex))
+		if *orientImages {
+			i.orient = exifOrientation(ex)
+		}
+		if imageIndex != nil {
+			i.indexImage(ex)
+		}
 	}
 
-	if i.thumb == nil {
-		img, _, err := image.Decode(bytes.NewBuffer(i.data))
+	if i.loadedThumb() == nil {
+		var err error
+		decodePool.Do(func() {
+			start := time.Now()
+			err = i.decode()
+			loads.decoded(time.Since(start))
+		})
 		if err != nil {
-			return fmt.Errorf("load: decode image: %w", err)
+			return err
 		}
-		thumb, err := i.displayer(img)
-		if err != nil {
-			return fmt.Errorf("load: display image: %w", err)
+	}
+
+	return nil
+}
+
+// decode decodes the image data and computes the thumbnail.
+func (i *IconImage) decode() error {
+	if i.useMip && !bytes.HasPrefix(i.data, []byte("GIF8")) {
+		if img, ok := decodeMip(i.data); ok {
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(i.data))
+			if err != nil {
+				return fmt.Errorf("load: decode image: %w", err)
+			}
+			r := orientBounds(image.Rect(0, 0, cfg.Width, cfg.Height), i.orient)
+			return i.setThumb(orient(img, i.orient), 1, r)
 		}
-		i.thumb = thumb
-		i.origBounds = image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
 	}
 
+	img, n, err := decodeFrame(i.data, i.Frame())
+	if err != nil {
+		i.setFailed()
+		return fmt.Errorf("load: decode image: %w", err)
+	}
+	img = orient(img, i.orient)
+	return i.setThumb(img, n, image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+}
+
+// setThumb computes the thumbnail from img. The bounds of the original
+// image may be different, if img is an intermediate resolution.
+func (i *IconImage) setThumb(img image.Image, numFrames int, origBounds image.Rectangle) error {
+	info := imageInfo{origBounds: origBounds, numFrames: numFrames}
+	// the persistent cache keeps the image before the transforms of the
+	// view, which are applied when it is loaded, like the first time
+	if imageIndex != nil && i.data != nil && i.diskThumb != (image.Point{}) {
+		i.storeDiskThumb(img, numFrames)
+	}
+	if i.autoCrop {
+		if r := borderCrop(img); !r.Eq(img.Bounds()) {
+			info.crop = scaleRect(r, img.Bounds(), origBounds)
+			img = cropImage(img, r)
+		}
+	}
+	// the thumbnail keeps the conversion, it is done once per load
+	shown := colorManaged(inverted(img, i.invert), i.colorMgmt)
+	var thumb ScreenImage
+	var err error
+	if i.lowDepth {
+		thumb, err = i.displayer(lowDepth{shown})
+	} else {
+		thumb, err = i.displayer(shown)
+	}
+	if err != nil {
+		return fmt.Errorf("load: display image: %w", err)
+	}
+	// loaded from the persistent cache, the file is not read
+	if i.data != nil {
+		info.sizeInfo = getSizeInfo(i.data, origBounds)
+	}
+	if i.findCodes {
+		info.codes = findCodes(img)
+		for k := range info.codes {
+			info.codes[k].r = scaleRect(info.codes[k].r, img.Bounds(), info.contentBounds())
+		}
+	}
+	i.thumbMu.Lock()
+	i.thumb = thumb
+	i.origBounds, i.crop, i.numFrames = info.origBounds, info.crop, info.numFrames
+	i.codes, i.sizeInfo = info.codes, info.sizeInfo
+	i.thumbMu.Unlock()
+	drawMem.add(i, thumb)
 	return nil
 }
 
 // Unload frees the image data. To use it again, call Load first.
 func (i *IconImage) Unload() {
-	if i.data == nil {
+	i.loadMu.Lock()
+	defer i.loadMu.Unlock()
+	i.thumbMu.Lock()
+	defer i.thumbMu.Unlock()
+	i.data = nil
+	if i.thumb != nil {
+		drawMem.remove(i)
+		if err := i.thumb.Free(); err != nil {
+			log.Printf("unload: failed to free thumbnail %s: %v", i.Path(), err)
+		}
+		i.thumb = nil
+	}
+}
+
+// dropThumb frees the thumbnail but keeps the image data.
+// The next load computes the thumbnail again.
+func (i *IconImage) dropThumb() {
+	i.thumbMu.Lock()
+	defer i.thumbMu.Unlock()
+	if i.thumb == nil {
 		return
 	}
+	if err := i.thumb.Free(); err != nil {
+		log.Printf("dropThumb: failed to free thumbnail %s: %v", i.Path(), err)
+	}
+	i.thumb = nil
+}
 
-	i.data = nil
+// SetFrame selects the frame to display for animated images.
+// The thumbnail is recomputed on the next load.
+func (i *IconImage) SetFrame(n int) {
+	i.thumbMu.Lock()
+	defer i.thumbMu.Unlock()
+	if n < 0 || (i.numFrames > 0 && n >= i.numFrames) || n == i.frame {
+		return
+	}
+	i.frame = n
 	if i.thumb != nil {
+		drawMem.remove(i)
 		if err := i.thumb.Free(); err != nil {
-			log.Printf("unload: failed to free thumbnail %s: %v", i.path, err)
+			log.Printf("setFrame: failed to free thumbnail %s: %v", i.path, err)
 		}
 		i.thumb = nil
 	}
 }
 
 // FitFast fits img in r using a fast algorithm and an acceptable result.
-func FitFast(disp *draw9.Display, img image.Image, r image.Rectangle) (*draw9.Image, error) {
-	dr := bestFit(r, img.Bounds())
-	dimg := image.NewRGBA(dr)
-	fastScaler.Scale(dimg, dr, img, img.Bounds(), xdraw.Src, nil)
-	t, err := disp.ReadImage(toPlan9Bitmap(dimg))
+func FitFast(scr Screen, img image.Image, r image.Rectangle) (ScreenImage, error) {
+	return fitWith(fastScaler, scr, img, r)
+}
+
+// FitBest fits img in r produces the best result but it is slow.
+func FitBest(scr Screen, img image.Image, r image.Rectangle) (ScreenImage, error) {
+	return fitWith(bestScaler, scr, img, r)
+}
+
+// fitWith fits img in r using the scaler and uploads it to the display.
+// If scaler is nil, it is chosen by the scaling ratio. The intermediate buffers are pooled.
+func fitWith(scaler xdraw.Scaler, scr Screen, img image.Image, r image.Rectangle) (ScreenImage, error) {
+	low, isLow := img.(lowDepth)
+	if isLow {
+		img = low.Image
+	}
+	dimg := scaleToFit(scaler, img, r)
+	if uploads != nil {
+		return uploads.upload(dimg, isLow)
+	}
+	t, err := uploadRGBA(scr, dimg, isLow)
+	putBytes(dimg.Pix)
+	return t, err
+}
+
+// uploadRGBA uploads img to the display, in 16 bits per pixel if low.
+func uploadRGBA(scr Screen, img *image.RGBA, low bool) (ScreenImage, error) {
+	var bitmap []byte
+	if low {
+		bitmap = toPlan9Bitmap16(img)
+	} else {
+		bitmap = toPlan9Bitmap(img)
+	}
+	t, err := scr.ReadImage(bytes.NewReader(bitmap))
+	putBytes(bitmap)
 	if err != nil {
 		return nil, err
 	}
 	return t, nil
 }
 
-// FitBest fits img in r produces the best result but it is slow.
-func FitBest(disp *draw9.Display, img image.Image, r image.Rectangle) (*draw9.Image, error) {
+// scaleToFit scales img to fit in r. If scaler is nil, it is chosen by the scaling ratio.
+// The result is from the pools, release it with putBytes(dimg.Pix) after use.
+func scaleToFit(scaler xdraw.Scaler, img image.Image, r image.Rectangle) *image.RGBA {
 	dr := bestFit(r, img.Bounds())
-	dimg := image.NewRGBA(dr)
-	bestScaler.Scale(dimg, dr, img, img.Bounds(), xdraw.Src, nil)
-	t, err := disp.ReadImage(toPlan9Bitmap(dimg))
-	if err != nil {
-		return nil, err
+	if scaler == nil {
+		scaler = chooseScaler(img.Bounds(), dr)
 	}
-	return t, nil
+	// the Src operator writes all the pixels, no need to clear dimg
+	dimg := newPooledRGBA(dr)
+	scaler.Scale(dimg, dr, img, img.Bounds(), xdraw.Src, nil)
+	return dimg
 }
 
 // toPlan9Bitmap converts an image to the plan9 format for display.
-func toPlan9Bitmap(img *image.RGBA) *bytes.Buffer {
-	n := 60 + img.Bounds().Dx()*img.Bounds().Dy()*4
-	b := bytes.NewBuffer(make([]byte, 0, n))
-	fmt.Fprintf(b, "%11s %11d %11d %11d %11d ",
-		"r8g8b8a8", 0, 0, img.Bounds().Dx(), img.Bounds().Dy())
-	for data := img.Pix; len(data) > 0; data = data[4:] {
-		b.WriteByte(data[3])
-		b.WriteByte(data[2])
-		b.WriteByte(data[1])
-		b.WriteByte(data[0])
+// The result is from the pools, release it with putBytes after use.
+func toPlan9Bitmap(img *image.RGBA) []byte {
+	const headerSize = 60
+	n := headerSize + img.Bounds().Dx()*img.Bounds().Dy()*4
+	b := getBytes(n)
+	copy(b, fmt.Sprintf("%11s %11d %11d %11d %11d ",
+		"r8g8b8a8", 0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	out := b[headerSize:]
+	for data := img.Pix; len(data) > 0; data, out = data[4:], out[4:] {
+		out[0], out[1], out[2], out[3] = data[3], data[2], data[1], data[0]
 	}
 	return b
 }
 
-// getExifInfo returns an online human readable string of the exif data.
-func getExifInfo(r tiff.ReadAtReaderSeeker) string {
+// readExif decodes the exif data of r. It returns nil if there are none.
+func readExif(r tiff.ReadAtReaderSeeker) *exif.Exif {
 	ex, err := exif.Decode(r)
 	if err != nil {
+		return nil
+	}
+	return ex
+}
+
+// exifHasGPS reports whether the exif data contain a GPS position.
+func exifHasGPS(ex *exif.Exif) bool {
+	if ex == nil {
+		return false
+	}
+	_, _, err := ex.LatLong()
+	return err == nil
+}
+
+// getExifInfo returns an online human readable string of the exif data.
+func getExifInfo(ex *exif.Exif) string {
+	if ex == nil {
 		return ""
 	}
 
@@ -206,11 +624,27 @@ func getExifInfo(r tiff.ReadAtReaderSeeker) string {
 	return ""
 }
 
-// NewIconImages is the slice version of Icon.NewIconImage.
-func NewIconImages(icons []*Icon, displayer Displayer) []*IconImage {
-	var images []*IconImage
-	for _, icon := range icons {
-		images = append(images, icon.NewIconImage(displayer))
+// getSizeInfo returns an online human readable string of the file size,
+// the bytes per megapixel and for JPEGs the estimated encoder quality.
+func getSizeInfo(data []byte, r image.Rectangle) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Size: %d KB", len(data)/1024)
+	if mp := float64(r.Dx()*r.Dy()) / 1e6; mp > 0 {
+		fmt.Fprintf(&b, " %.0f KB/MP", float64(len(data))/1024/mp)
+	}
+	if q, ok := estimateJPEGQuality(data); ok {
+		fmt.Fprintf(&b, " JPEG quality: ~%d", q)
+	}
+	return b.String()
+}
+
+// iconImageMaker returns a function that makes IconImages with the displayer,
+// for the caches of the views of thumbnails. With -lowbw the thumbnails
+// are uploaded in low depth first.
+func iconImageMaker(displayer Displayer) func(*Icon) *IconImage {
+	return func(icon *Icon) *IconImage {
+		img := icon.NewIconImage(displayer)
+		img.lowDepth = *lowBandwidth
+		return img
 	}
-	return images
 }
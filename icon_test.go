@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestIconImageConcurrent loads and unloads icons while the views read
+// them and rename them, as the caches, the painter and the UI goroutine
+// do. Run it with -race.
+func TestIconImageConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for k := range img.Pix {
+		img.Pix[k] = uint8(k)
+	}
+	var paths []string
+	for _, name := range []string{"a.png", "b.png"} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		paths = append(paths, f.Name())
+	}
+
+	scr := newFakeScreen(image.Rect(0, 0, 100, 100))
+	displayer := func(img image.Image) (ScreenImage, error) {
+		return FitFast(scr, img, image.Rect(0, 0, 4, 4))
+	}
+
+	icon := NewIcon(paths[0])
+	images := []*IconImage{icon.NewIconImage(displayer), NewIcon(paths[1]).NewIconImage(displayer)}
+
+	var wg sync.WaitGroup
+	run := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				fn()
+			}
+		}()
+	}
+	for _, i := range images {
+		run(func() {
+			if err := i.Load(); err != nil {
+				t.Error(err)
+			}
+		})
+		run(i.Unload)
+		run(i.dropThumb) // like drawMem over its budget
+		run(func() {
+			i.Ready()
+			i.Info()
+			statsOf(i)
+			i.ratingInfo()
+			i.Groups()
+		})
+	}
+	run(func() {
+		// renamed by the UI goroutine, to the same path as the file is not moved
+		icon.setPaths(paths[0], nil)
+		toggleGroup([]*Icon{icon}, "g")
+		icon.setTrashed(!icon.Trashed())
+	})
+	wg.Wait()
+
+	for _, i := range images {
+		if err := i.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if got := i.Info().origBounds; got != img.Bounds() {
+			t.Errorf("%s: bounds %v, want %v", i.Path(), got, img.Bounds())
+		}
+		i.Unload()
+	}
+}
@@ -1,49 +1,124 @@
 package main
 
 import (
+	"fmt"
 	"image"
 	"log"
 	"slices"
+	"time"
 
 	draw9 "9fans.net/go/draw"
 )
 
+const (
+	// fillInterval is how often the first page is repainted while it loads.
+	fillInterval = 100 * time.Millisecond
+	// fillTimeout is how long the view waits for the icons to load
+	// in the background, before it loads them while painting.
+	fillTimeout = 5 * time.Second
+	// firstPageWait is how long the first paint waits for a small set of icons
+	// to load, so that they appear at once.
+	firstPageWait = 300 * time.Millisecond
+)
+
 // IconsView handles a display of icons over a grid.
 // One screen of icons is called a page. It provides operations to
 // scroll pages and mark icons. It also maintains an icon cache
 // for smoother UI.
 type IconsView struct {
 	icons           []*Icon
-	iconsCache      CachedSlice[*IconImage]
+	iconsCache      CachedSlice[*Icon, *IconImage]
 	offset          *Offset
-	pageSize        int
-	pagesWithMarked []int // the pages with marked icons. Used for moving up/down.
+	tuning          cacheTuning
+	pagesWithMarked []int    // the pages with marked icons. Used for moving up/down.
+	scanner         *Scanner // the scan that still adds icons, if any
+	scanC           <-chan []*Icon
+	order           string        // the sort key of the icons
+	dropC           chan struct{} // signals failed icons in sniff mode
+	gp              *gridPaint
+	current         *Icon        // the icon last displayed in the single view
+	fill            *time.Ticker // repaints the icons as they load, while filling
+	fillUntil       time.Time    // when filling times out
+	waitFirst       bool         // whether the first paint waits for the icons
+	lastInput       time.Time    // when the user last pressed a key or moved the mouse
+	anchor          int          // the icon last marked or unmarked, where shift-marking extends from
+	removed         []*Icon      // the icons moved to the trash, to put them back if restored
+	idle            *idleLoad    // loads more while the user is idle
 
 	dctl *DisplayControl
 }
 
 // NewIconsView returns an IconsView for the icons and the grid.
-func NewIconsView(icons []*Icon, grid *Grid, pageSize int) *IconsView {
-	if pageSize == 0 {
-		pageSize = grid.Area()
-	}
+func NewIconsView(icons []*Icon, grid *Grid, t cacheTuning) *IconsView {
 	return &IconsView{
-		icons:    icons,
-		offset:   NewOffset(grid, len(icons)),
-		pageSize: pageSize,
+		icons:  icons,
+		offset: NewOffset(grid, len(icons)),
+		tuning: t.withDefaults(grid.Area()),
+		gp:     new(gridPaint),
+		order:  *sortKey,
+		dropC:  make(chan struct{}, 1),
+		anchor: -1,
+		idle:   new(idleLoad),
 	}
 }
 
+// Follow adds the icons found by the scanner to the view, as they arrive.
+func (iv *IconsView) Follow(s *Scanner) {
+	iv.scanner = s
+	iv.scanC = s.C
+}
+
+// Goto shows the page of the icon i, with the tab of the current icon.
+func (iv *IconsView) Goto(i int) {
+	iv.offset.GotoPage(iv.offset.PageOfItem(i))
+	iv.current = iv.icons[i]
+}
+
 func (iv *IconsView) Connect(dctl *DisplayControl) {
 	iv.dctl = dctl
+	dctl.waitPaint()
 	if iv.iconsCache != nil {
 		iv.iconsCache.Free()
 	}
-	images := NewIconImages(iv.icons, func(img image.Image) (*draw9.Image, error) {
-		return FitFast(iv.dctl.display, img,
-			image.Rectangle{image.Point{}, iv.offset.grid.iconSize})
-	})
-	iv.iconsCache = NewCachedSlicePaged[*IconImage]("icons", images, iv.pageSize)
+	images := iconImageMaker(iv.displayer)
+	iv.iconsCache = NewCachedSlicePaged("icons", iv.icons, func(icon *Icon) *IconImage {
+		img := images(icon)
+		// the first pages of the next session are painted from these
+		img.diskThumb = iv.offset.grid.iconSize
+		return img
+	}, iv.tuning)
+}
+
+// displayer fits the images in the grid icons.
+func (iv *IconsView) displayer(img image.Image) (ScreenImage, error) {
+	return FitFast(iv.dctl.screen, img,
+		image.Rectangle{image.Point{}, iv.offset.grid.iconSize})
+}
+
+// addIcons appends icons found by the scanner. It returns whether the
+// visible page was not full, so it must be repainted.
+func (iv *IconsView) addIcons(icons []*Icon) bool {
+	from, to := iv.offset.Visible()
+	iv.icons = append(iv.icons, icons...)
+	iv.iconsCache.Append(icons...)
+	iv.offset.limit = len(iv.icons)
+	return to-from < iv.offset.grid.Area()
+}
+
+// addSnarfed appends the images of paths that are not in the view yet. It
+// returns the index of the first of paths.
+func (iv *IconsView) addSnarfed(paths []string) int {
+	var added []*Icon
+	for _, p := range paths {
+		if indexOfPath(iv.icons, p) < 0 && indexOfPath(added, p) < 0 {
+			added = append(added, NewIcon(p))
+		}
+	}
+	if len(added) > 0 {
+		log.Printf("snarf: added %d images", len(added))
+		iv.addIcons(added)
+	}
+	return indexOfPath(iv.icons, paths[0])
 }
 
 func (iv *IconsView) Attach(r image.Rectangle) {
@@ -55,47 +130,165 @@ func (iv *IconsView) Attach(r image.Rectangle) {
 }
 
 func (iv *IconsView) Free() {
+	iv.dctl.waitPaint()
 	iv.iconsCache.Free()
 }
 
 // handle handles mouse and keyboard actions
 func (iv *IconsView) Handle() View {
+	items := []string{"mark", "plumb", "", "prev page", "next page", "",
+		"marked", "view marked", "gps", "prev mark", "next mark", "export gallery"}
+	for _, p := range exportPresets {
+		items = append(items, "export "+p.name)
+	}
 	bt2menu := &draw9.Menu{
-		Item: []string{"mark", "plumb", "", "prev page", "next page", "",
-			"marked", "prev mark", "next mark", "", "exit"},
+		Item: append(items, "export links", "shift dates", "rename", "print", "montage", "animation", "trash", "tags", "groups", "", "exit"),
 	}
+	const firstPreset = 12 // the export presets follow export gallery
+	linksItem := firstPreset + len(exportPresets)
+	shiftItem := linksItem + 1
+	renameItem := linksItem + 2
+	printItem := linksItem + 3
+	montageItem := linksItem + 4
+	animItem := linksItem + 5
+	trashItem := linksItem + 6
 
 	dctl := iv.dctl
+	var upgradeC <-chan time.Time
+	if *lowBandwidth {
+		t := time.NewTicker(lowbwIdle / 2)
+		defer t.Stop()
+		upgradeC = t.C
+	}
+	var idleC <-chan time.Time
+	if *idleLoading {
+		t := time.NewTicker(idleLoadTick)
+		defer t.Stop()
+		idleC = t.C
+	}
+	iv.syncTrash()
+	iv.startFill()
+	defer iv.stopFill()
 	iv.paint(dctl)
 	for {
+		var fillC <-chan time.Time
+		if iv.fill != nil {
+			fillC = iv.fill.C
+		}
 		select {
 		case err := <-dctl.errch:
 			log.Printf("display: %v", err)
+		case <-fillC:
+			if iv.visibleReady() || time.Now().After(iv.fillUntil) {
+				iv.stopFill()
+			}
+			iv.paint(dctl)
+		case batch, ok := <-iv.scanC:
+			if !ok {
+				iv.scanC = nil
+			} else if iv.addIcons(batch) {
+				iv.paint(dctl)
+			}
+		case <-iv.dropC:
+			if iv.dropFailed() {
+				iv.paint(dctl)
+			}
 		case k := <-dctl.kctl.C:
+			iv.lastInput = time.Now()
 			switch k {
 			case 'q', 'e', escKey: // exit
 				return nil
+			case 'S': // snapshot
+				dctl.snapshot()
+			case 'd': // heatmap of the two marked images
+				if marked := iv.collectMarkedIcons(); len(marked) == 2 {
+					return NewHeatmapView(marked[0], marked[1], iv.offset.grid.area)
+				}
+				log.Printf("heatmap: mark exactly two images to compare")
+			case deleteKey: // move the image to the trash
+				if i, ok := iv.offset.At(dctl.mctl.Mouse.Point); ok {
+					if err := trashIcon(iv.icons[i]); err != nil {
+						log.Printf("iconsView: %v", err)
+					} else if iv.syncTrash() {
+						iv.paint(dctl)
+					}
+				}
+			case 'g': // tag the marked images, or the one under the mouse
+				targets := iv.collectMarkedIcons()
+				if i, ok := iv.offset.At(dctl.mctl.Mouse.Point); ok && len(targets) == 0 {
+					targets = []*Icon{iv.icons[i]}
+				}
+				if len(targets) > 0 {
+					editTags(dctl, targets)
+					iv.paint(dctl)
+				}
+			case 'a': // add the marked images, or the one under the mouse, to a group or remove
+				targets := iv.collectMarkedIcons()
+				if i, ok := iv.offset.At(dctl.mctl.Mouse.Point); ok && len(targets) == 0 {
+					targets = []*Icon{iv.icons[i]}
+				}
+				if len(targets) > 0 {
+					dctl.assignGroup(targets)
+					iv.paint(dctl)
+				}
+			case 's': // stop scan
+				if iv.scanner != nil {
+					iv.scanner.Cancel()
+				}
+			case 'o': // cycle order
+				order := "size"
+				switch iv.order {
+				case "size":
+					order = "viewed"
+				case "viewed":
+					order = "brightness"
+				case "brightness":
+					order = "hue"
+				case "hue":
+					order = "date"
+				case "date":
+					order = "name"
+				}
+				dctl.showWaitingAndCall(func() {
+					iv.sortBy(order)
+				})
+				iv.paint(dctl)
 			case upArrowKey: // scroll up
-				iv.offset.MoveUpRow()
+				dctl.scroll(iv.offset, -1, 0)
 				iv.paint(dctl)
 			case downArrowKey: // scroll down
-				iv.offset.MoveDownRow()
+				dctl.scroll(iv.offset, 1, 0)
+				iv.paint(dctl)
+			case leftArrowKey: // prev page, 10 with shift, first with ctl
+				iv.offset.StepPages(arrowStep(-1, len(iv.icons)))
 				iv.paint(dctl)
-			case leftArrowKey: // prev page
-				iv.offset.GotoPage(iv.offset.CurrentPage() - 1)
+			case rightArrowKey: // next page, 10 with shift, last with ctl
+				iv.offset.StepPages(arrowStep(1, len(iv.icons)))
 				iv.paint(dctl)
-			case rightArrowKey: // next page
-				iv.offset.GotoPage(iv.offset.CurrentPage() + 1)
+			case homeKey: // first page
+				iv.offset.StepPages(-len(iv.icons))
+				iv.paint(dctl)
+			case endKey: // last page
+				iv.offset.StepPages(len(iv.icons))
 				iv.paint(dctl)
 			}
 		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			iv.lastInput = time.Now()
+			if m := dctl.mctl.Mouse; m.Buttons&7 != 0 && m.Point.In(iv.offset.grid.Scrollbar()) {
+				dctl.scrollWithMouse(iv.offset, func() { iv.paint(dctl) })
+				continue
+			}
 			switch dctl.mctl.Mouse.Buttons {
-			case 1: // select image
+			case 1: // select image, or pick it with -pick
 				if i, ok := iv.offset.At(dctl.mctl.Mouse.Point); ok {
+					if *pickMode {
+						dctl.picked = iv.icons[i]
+						return nil
+					}
 					return NewSingleView(iv.icons, i, iv.offset.grid.area)
 				}
 			case 2: // view menu
-				switch draw9.MenuHit(2, dctl.mctl, bt2menu, nil) {
+				switch hit := dctl.screen.MenuHit(2, bt2menu); hit {
 				case 0: // mark
 					if i, ok := iv.offset.At(dctl.mctl.Mouse.Point); ok {
 						iv.toggleMarked(i)
@@ -103,9 +296,7 @@ func (iv *IconsView) Handle() View {
 					}
 				case 1: // plumb
 					if i, ok := iv.offset.At(dctl.mctl.Mouse.Point); ok {
-						if icon, ok := iv.iconsCache.At(i); ok {
-							plumbImage(icon.path)
-						}
+						plumbImage(iv.icons[i].path)
 					}
 				case 2: // nop
 				case 3: // prev page
@@ -117,48 +308,322 @@ func (iv *IconsView) Handle() View {
 				case 5: // nop
 				case 6: // marked
 					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
-						return NewMarkedView(marked, iv.offset.grid, iv.offset.grid.Area())
+						return NewMarkedView(marked, iv.offset.grid, *markedCache)
+					}
+				case 7: // view marked
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						return NewSingleView(marked, 0, iv.offset.grid.area)
 					}
-				case 7: // prev mark
+				case 8: // gps
+					var withGPS []*Icon
+					dctl.showWaitingAndCall(func() {
+						withGPS = iv.collectIconsWithGPS()
+					})
+					if len(withGPS) > 0 {
+						return NewMarkedView(withGPS, iv.offset.grid, *markedCache)
+					}
+				case 9: // prev mark
 					iv.moveUpToNextPageWithMarked()
 					iv.paint(dctl)
-				case 8: // next mark
+				case 10: // next mark
 					iv.moveDownToNextPageWithMarked()
 					iv.paint(dctl)
-				case 9: // nop
-				case 10: // exit
+				case 11: // export gallery
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						dctl.exportMarkedGallery(marked)
+						iv.Attach(dctl.screen.Bounds())
+						iv.paint(dctl)
+					}
+				case linksItem: // export links
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						exportMarkedLinks(marked)
+					}
+				case shiftItem: // shift dates
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						dctl.shiftMarkedDates(marked)
+						iv.paint(dctl)
+					}
+				case renameItem: // rename
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						dctl.renameMarked(marked)
+						iv.paint(dctl)
+					}
+				case printItem: // print
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						dctl.printMarked(marked)
+						iv.Attach(dctl.screen.Bounds())
+						iv.paint(dctl)
+					}
+				case montageItem: // montage
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						dctl.montageMarked(marked)
+						iv.Attach(dctl.screen.Bounds())
+						iv.paint(dctl)
+					}
+				case animItem: // animation
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						dctl.animateMarked(marked)
+						iv.Attach(dctl.screen.Bounds())
+						iv.paint(dctl)
+					}
+				case trashItem: // trash
+					if len(sessionTrash) > 0 {
+						return NewTrashView(iv.offset.grid, *markedCache)
+					}
+				case trashItem + 1: // tags
+					return NewTagCloudView(iv.icons, iv.offset.grid)
+				case trashItem + 2: // groups
+					if members := dctl.chooseGroup(iv.icons); len(members) > 0 {
+						return NewMarkedView(members, iv.offset.grid, *markedCache)
+					}
+					iv.paint(dctl)
+				case trashItem + 3: // nop
+				case trashItem + 4: // exit
 					return nil
+				default: // export with a preset
+					if hit < firstPreset || hit >= linksItem {
+						break
+					}
+					if marked := iv.collectMarkedIcons(); len(marked) > 0 {
+						dctl.exportMarked(marked, exportPresets[hit-firstPreset])
+						iv.Attach(dctl.screen.Bounds())
+						iv.paint(dctl)
+					}
 				}
-			case 4: // mark image
+			case 4: // mark image, or the images up to it with shift
 				if i, ok := iv.offset.At(dctl.mctl.Mouse.Point); ok {
-					iv.toggleMarked(i)
+					if modifiers()&modShift != 0 && iv.anchor >= 0 {
+						iv.markRange(iv.anchor, i)
+					} else {
+						iv.toggleMarked(i)
+					}
 					iv.paint(dctl)
 				}
 			case scrollWheelUp: // scroll up
-				iv.offset.MoveUpRow()
+				dctl.scroll(iv.offset, 0, -1)
 				iv.paint(dctl)
 			case scrollWheelDown: // scroll down
-				iv.offset.MoveDownRow()
+				dctl.scroll(iv.offset, 0, 1)
 				iv.paint(dctl)
 			}
+		case <-upgradeC:
+			if time.Since(iv.lastInput) > lowbwIdle {
+				from, to := iv.offset.Visible()
+				// overlap the uploads of the next page with the idle time
+				iv.iconsCache.Prefetch(to, to+(to-from))
+				dctl.waitPaint()
+				if upgradeLowDepth(iv.iconsCache, from, to) {
+					dctl.invalidate()
+					iv.paint(dctl)
+				}
+			}
+		case <-idleC:
+			if time.Since(iv.lastInput) > idleLoadAfter {
+				from, to := iv.offset.Visible()
+				iv.idle.load(iv.iconsCache, iv.icons, from, to)
+			}
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			if dctl.applyCtl(req) {
+				iv.resetPagesWithMarked()
+			}
+			iv.paint(dctl)
+		case path := <-dctl.gotoC: // looked at in the acme list
+			if i := indexOfPath(iv.icons, path); i >= 0 {
+				return NewSingleView(iv.icons, i, iv.offset.grid.area)
+			}
+		case paths := <-dctl.snarfC: // copied to the snarf buffer
+			iv.Goto(iv.addSnarfed(paths))
+			iv.paint(dctl)
 		case <-dctl.mctl.Resize:
-			if err := dctl.display.Attach(draw9.RefNone); err != nil {
-				log.Fatalf("display: failed to attach: %v", err)
+			dctl.invalidate()
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
 			}
-			iv.Attach(dctl.display.Image.Bounds())
+			iv.Attach(dctl.screen.Bounds())
 			iv.paint(dctl)
 		}
 	}
 }
 
+// startFill starts loading the visible icons in the background. Until they are
+// loaded, the view displays a splash and then the icons as they arrive.
+// Small sets, that fit in a page, wait a little to appear at once.
+// Without a painter goroutine, like in replays, the icons are painted
+// when loaded, so that the display operations are deterministic.
+func (iv *IconsView) startFill() {
+	if iv.dctl.painter == nil {
+		return
+	}
+	from, to := iv.offset.Visible()
+	iv.iconsCache.Prefetch(from, to)
+	iv.fill = time.NewTicker(fillInterval)
+	iv.fillUntil = time.Now().Add(fillTimeout)
+	iv.waitFirst = len(iv.icons) <= iv.offset.grid.Area()
+}
+
+// stopFill stops repainting the icons as they load.
+func (iv *IconsView) stopFill() {
+	if iv.fill != nil {
+		iv.fill.Stop()
+		iv.fill = nil
+	}
+}
+
+// visibleReady reports whether the visible icons are loaded.
+func (iv *IconsView) visibleReady() bool {
+	from, to := iv.offset.Visible()
+	for i := from; i < to; i++ {
+		if icon, ok := iv.iconsCache.Peek(i); !ok || icon.loadedThumb() == nil && !icon.Failed() {
+			return false
+		}
+	}
+	return true
+}
+
+// paintFill posts a request to paint the visible icons that are loaded.
+// Before any icon is loaded, it paints a splash.
+func (iv *IconsView) paintFill(dctl *DisplayControl) {
+	offset, cache, gp, wait, current := iv.offset.snapshot(), iv.iconsCache, iv.gp, iv.waitFirst, iv.current
+	iv.waitFirst = false
+	iv.iconsCache.Prefetch(offset.Visible())
+	dctl.post(func() {
+		from, to := offset.Visible()
+		var images []*IconImage
+		ready := func() int {
+			images = images[:0]
+			n := 0
+			for i := from; i < to; i++ {
+				icon, _ := cache.Peek(i)
+				images = append(images, icon)
+				if _, ok := icon.Ready(); ok {
+					n++
+				}
+			}
+			return n
+		}
+		if n := ready(); n == 0 || wait && n < to-from {
+			window := dctl.screen
+			window.Draw(window.Bounds(), dctl.bgColor, image.Point{})
+			window.String(offset.grid.PaintableArea().Min, dctl.fontColor,
+				fmt.Sprintf("loading %d images…", offset.limit))
+			if err := window.Flush(); err != nil {
+				log.Printf("display: flush: %v", err)
+			}
+			dctl.painted = nil
+			for start := time.Now(); wait && n < to-from && time.Since(start) < firstPageWait; n = ready() {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if n == 0 {
+				return
+			}
+		}
+		paintIcons(dctl, offset, images, current, gp, false)
+	})
+}
+
+// paint posts a request to paint the visible icons. In sniff mode, the
+// icons that failed to load are reported on dropC, to be removed.
 func (iv *IconsView) paint(dctl *DisplayControl) {
-	dctl.showWaitingAndCall(func() {
-		from, to := iv.offset.Visible()
-		images := slices.Collect(Get(iv.iconsCache, from, to))
-		paintIcons(dctl, iv.offset.grid, images)
+	if iv.fill != nil {
+		iv.paintFill(dctl)
+		return
+	}
+	offset, cache, gp, dropC, current := iv.offset.snapshot(), iv.iconsCache, iv.gp, iv.dropC, iv.current
+	dctl.post(func() {
+		dctl.showWaitingAndCall(func() {
+			from, to := offset.Visible()
+			images := slices.Collect(Get(cache, from, to))
+			if *sniff && slices.ContainsFunc(images, func(img *IconImage) bool { return img.Failed() }) {
+				select {
+				case dropC <- struct{}{}:
+				default:
+				}
+			}
+			paintIcons(dctl, offset, images, current, gp, true)
+		})
 	})
 }
 
+// dropFailed removes the icons that are not images, so that they are not displayed.
+// It is used in sniff mode, where files are accepted regardless of their suffix
+// and are rejected when loaded. It returns whether some of the icons failed.
+func (iv *IconsView) dropFailed() bool {
+	if !slices.ContainsFunc(iv.icons, func(icon *Icon) bool { return icon.Failed() }) {
+		return false
+	}
+	iv.replaceIcons(func(icons []*Icon) []*Icon {
+		return slices.DeleteFunc(icons, func(icon *Icon) bool { return icon.Failed() })
+	})
+	return true
+}
+
+// syncTrash removes the icons moved to the trash, here or in other views,
+// and puts back the ones restored. It returns whether the icons changed.
+func (iv *IconsView) syncTrash() bool {
+	var restored []*Icon
+	iv.removed = slices.DeleteFunc(iv.removed, func(icon *Icon) bool {
+		if !icon.trashed {
+			restored = append(restored, icon)
+		}
+		return !icon.trashed
+	})
+	if len(restored) == 0 && !slices.ContainsFunc(iv.icons, func(icon *Icon) bool { return icon.trashed }) {
+		return false
+	}
+	iv.replaceIcons(func(icons []*Icon) []*Icon {
+		icons = slices.DeleteFunc(icons, func(icon *Icon) bool {
+			if icon.trashed {
+				iv.removed = append(iv.removed, icon)
+			}
+			return icon.trashed
+		})
+		icons = append(icons, restored...)
+		if len(restored) > 0 && !*rawOrder {
+			if err := sortIcons(icons, iv.order); err != nil {
+				log.Printf("syncTrash: %v", err)
+			}
+		}
+		return icons
+	})
+	return true
+}
+
+// sortBy sorts the icons by key.
+func (iv *IconsView) sortBy(key string) {
+	iv.replaceIcons(func(icons []*Icon) []*Icon {
+		if err := sortIcons(icons, key); err != nil {
+			log.Printf("sortBy: %v", err)
+		}
+		return icons
+	})
+	iv.order = key
+}
+
+// replaceIcons replaces the icons with the result of fn, which gets a copy
+// of them. The first visible icon that is still present stays on the same row,
+// so that a sort or a filter does not lose the place of the user.
+func (iv *IconsView) replaceIcons(fn func([]*Icon) []*Icon) {
+	from, to := iv.offset.Visible()
+	icons := fn(slices.Clone(iv.icons))
+
+	anchor, row := -1, 0
+	for i := from; i < to && anchor == -1; i++ {
+		if j := slices.Index(icons, iv.icons[i]); j >= 0 {
+			anchor, row = j, iv.offset.Row(i)
+		}
+	}
+
+	iv.icons = icons
+	iv.offset.limit = len(iv.icons)
+	if anchor >= 0 {
+		iv.offset.ShowAtRow(anchor, row)
+	} else {
+		iv.offset.pos = min(iv.offset.pos, max(0, iv.offset.limit-1))
+	}
+	iv.Connect(iv.dctl)
+	iv.resetPagesWithMarked()
+}
+
 // moveUpToNextPageWithMarked moves up to the next page with a marked icon.
 func (iv *IconsView) moveUpToNextPageWithMarked() {
 	i, _ := slices.BinarySearch(iv.pagesWithMarked, iv.offset.CurrentPage())
@@ -181,7 +646,7 @@ func (iv *IconsView) moveDownToNextPageWithMarked() {
 func (iv *IconsView) resetPagesWithMarked() {
 	iv.pagesWithMarked = iv.pagesWithMarked[0:0]
 	for i, icon := range iv.icons {
-		if icon.marked {
+		if icon.Marked() {
 			if p := iv.offset.PageOfItem(i); !slices.Contains(iv.pagesWithMarked, p) {
 				iv.pagesWithMarked = append(iv.pagesWithMarked, p)
 			}
@@ -189,17 +654,39 @@ func (iv *IconsView) resetPagesWithMarked() {
 	}
 }
 
+// toggleMarked toggles the mark of the ith icon. It does not go through
+// the cache, so that marking never waits for a page to load.
 func (iv *IconsView) toggleMarked(i int) {
-	if icon, ok := iv.iconsCache.At(i); ok {
-		icon.ToggleMarked()
+	iv.icons[i].ToggleMarked()
+	iv.anchor = i
+	iv.resetPagesWithMarked()
+}
+
+// markRange marks the icons from i to j, inclusive, in any order.
+func (iv *IconsView) markRange(i, j int) {
+	for k := min(i, j); k <= max(i, j) && k < len(iv.icons); k++ {
+		if !iv.icons[k].Marked() {
+			iv.icons[k].ToggleMarked()
+		}
 	}
+	iv.anchor = j
 	iv.resetPagesWithMarked()
 }
 
 func (iv *IconsView) collectMarkedIcons() []*Icon {
 	var icons []*Icon
 	for _, icon := range iv.icons {
-		if icon.marked {
+		if icon.Marked() {
+			icons = append(icons, icon)
+		}
+	}
+	return icons
+}
+
+func (iv *IconsView) collectIconsWithGPS() []*Icon {
+	var icons []*Icon
+	for _, icon := range iv.icons {
+		if icon.HasGPS() {
 			icons = append(icons, icon)
 		}
 	}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// testIcons writes n PNG images of 64x48 and returns their icons.
+func testIcons(t *testing.T, n int) []*Icon {
+	t.Helper()
+	dir := t.TempDir()
+	var icons []*Icon
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("%d.png", i))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 64, 48))); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		icons = append(icons, NewIcon(path))
+	}
+	return icons
+}
+
+// runIconsView handles the input of send in an IconsView of the icons on a
+// fake screen, then quits it. It returns the operations of the screen.
+func runIconsView(t *testing.T, icons []*Icon, send func(in *fakeInput)) []string {
+	t.Helper()
+	dctl, scr, in := newFakeDisplayControl(image.Rect(0, 0, 700, 300))
+	iv := NewIconsView(icons, NewGrid(scr.Bounds(), image.Pt(200, 100), padding), cacheTuning{})
+	iv.Connect(dctl)
+	done := make(chan View)
+	go func() { done <- iv.Handle() }()
+	send(in)
+	in.Keys <- 'q'
+	if v := <-done; v != nil {
+		t.Errorf("quit returned view %T, want none", v)
+	}
+	iv.Free()
+	return scr.Ops
+}
+
+func TestIconsViewPaint(t *testing.T) {
+	ops := runIconsView(t, testIcons(t, 3), func(*fakeInput) {})
+	want := []string{
+		"draw (0,0)-(700,300) color666666ff/666666ff (0,0)",
+		"draw (0,0)-(12,300) color999999ff/999999ff (0,0)",
+		"draw (1,1)-(11,299) color666666ff/666666ff (0,0)",
+		"draw (122,76)-(186,124) image64x48 (0,0)",
+		"draw (326,76)-(390,124) image64x48 (0,0)",
+		"draw (530,76)-(594,124) image64x48 (0,0)",
+		"flush",
+	}
+	if !slices.Equal(ops, want) {
+		t.Errorf("ops:\n%q\nwant:\n%q", ops, want)
+	}
+}
+
+func TestIconsViewMark(t *testing.T) {
+	icons := testIcons(t, 3)
+	ops := runIconsView(t, icons, func(in *fakeInput) {
+		in.Mouse <- draw9.Mouse{Point: image.Pt(330, 80), Buttons: 4}
+	})
+	for i, icon := range icons {
+		if got := icon.Marked(); got != (i == 1) {
+			t.Errorf("icon %d marked %v, want %v", i, got, i == 1)
+		}
+	}
+	border := "border (326,76)-(390,124) 4 color666666ff/ffff00ff"
+	if !slices.Contains(ops, border) {
+		t.Errorf("ops:\n%q\nmissing %q", ops, border)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// idleLoadAfter is how long a view waits without input before it
+	// loads more in the background.
+	idleLoadAfter = 2 * time.Second
+	// idleLoadTick is how often a view loads more while idle. Each tick
+	// loads at most one page or warms one image, so that the loads
+	// started when the user comes back are not kept waiting.
+	idleLoadTick = 250 * time.Millisecond
+	// mipWarmAhead is how many images after the visible ones have their
+	// intermediate resolutions warmed in the persistent cache.
+	mipWarmAhead = 200
+)
+
+// idleLoad loads more of a view while the user is idle: first the pages
+// near the visible ones, beyond the prefetched, and then, with -cachedir,
+// the intermediate resolutions of the images further away, so that paging
+// fast finds them ready.
+type idleLoad struct {
+	from    int             // the first visible image when warming started
+	next    int             // the next image to warm
+	warmed  map[string]bool // the images warmed, not read again
+	warming atomic.Bool     // whether an image is being warmed
+}
+
+// load loads one more page near [from, to), or warms one image after it.
+func (l *idleLoad) load(cache CachedSlice[*Icon, *IconImage], icons []*Icon, from, to int) {
+	if cache.IdleLoad(from) || persistentCache == nil || l.warming.Load() || !poolsIdle() {
+		return
+	}
+	if l.warmed == nil || l.from != from {
+		l.from, l.next = from, to
+		if l.warmed == nil {
+			l.warmed = make(map[string]bool)
+		}
+	}
+	for ; l.next < min(len(icons), to+mipWarmAhead); l.next++ {
+		icon := icons[l.next]
+		if icon.Failed() || l.warmed[icon.path] {
+			continue
+		}
+		l.warmed[icon.path] = true
+		l.warming.Store(true)
+		go func() {
+			defer l.warming.Store(false)
+			warmMip(icon.path)
+		}()
+		return
+	}
+}
+
+// warmMip stores the intermediate resolution of the image of path in the
+// persistent cache, if it is not there.
+func warmMip(path string) {
+	data, err := reads.Do(path, func() ([]byte, error) {
+		var data []byte
+		var err error
+		fetchPool.Do(func() {
+			data, err = readImageFile(path)
+		})
+		return data, err
+	})
+	if err != nil {
+		log.Printf("idle load: %v", err)
+		return
+	}
+	if bytes.HasPrefix(data, []byte("GIF8")) || !isSupportedType(contentType(data)) {
+		return
+	}
+	decodePool.Do(func() {
+		decodeMip(data)
+	})
+}
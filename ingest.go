@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ingestFrames reads images from the named pipe and stores them in dir.
+// Each writer opens the pipe, writes the contents of one image and closes it.
+// The frames are first written with a temporary name and then renamed, so
+// that viewers watching dir never see partial files. It runs forever.
+func ingestFrames(pipe, dir string) {
+	for n := 1; ; {
+		data, err := readFrame(pipe)
+		if err != nil {
+			fatalf("ingest: %v", err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		ext, ok := frameExtension(data)
+		if !ok {
+			log.Printf("ingest: ignoring frame of type %s", contentType(data))
+			continue
+		}
+		name := filepath.Join(dir, fmt.Sprintf("frame-%05d%s", n, ext))
+		if err := os.WriteFile(name+".part", data, 0644); err != nil {
+			log.Printf("ingest: %v", err)
+			continue
+		}
+		if err := os.Rename(name+".part", name); err != nil {
+			log.Printf("ingest: %v", err)
+			continue
+		}
+		n++
+	}
+}
+
+// readFrame opens the pipe, waiting for a writer, and reads until the writer closes it.
+func readFrame(pipe string) ([]byte, error) {
+	f, err := os.Open(pipe)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// frameExtension returns a file suffix for the image data, based on its contents.
+func frameExtension(data []byte) (string, bool) {
+	switch contentType(data) {
+	case "image/avif":
+		return ".avif", true
+	case "image/bmp":
+		return ".bmp", true
+	case "image/gif":
+		return ".gif", true
+	case "image/jpeg":
+		return ".jpg", true
+	case "image/png":
+		return ".png", true
+	case "image/webp":
+		return ".webp", true
+	case "image/x-portable-bitmap":
+		return ".pbm", true
+	case "image/x-portable-graymap":
+		return ".pgm", true
+	case "image/x-portable-pixmap":
+		return ".ppm", true
+	case "image/qoi":
+		return ".qoi", true
+	case "image/x-farbfeld":
+		return ".ff", true
+	case "image/x-icon":
+		return ".ico", true
+	case "image/x-tga":
+		return ".tga", true
+	}
+	return "", false
+}
@@ -0,0 +1,57 @@
+package main
+
+import draw9 "9fans.net/go/draw"
+
+// inputQueue forwards input events and allows the receiver to put back
+// an event it does not want to handle, like Unread of bufio.
+type inputQueue[T any] struct {
+	out    chan T
+	unread chan T
+}
+
+// newInputQueue starts forwarding the events of in. The events are
+// received from the out channel of the queue.
+func newInputQueue[T any](in <-chan T) *inputQueue[T] {
+	q := &inputQueue[T]{out: make(chan T), unread: make(chan T)}
+	go func() {
+		var held []T
+		for {
+			var out chan T
+			var next T
+			if len(held) > 0 {
+				out, next = q.out, held[0]
+			}
+			select {
+			case e, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				held = append(held, e)
+			case out <- next:
+				held = held[1:]
+			case e := <-q.unread:
+				held = append([]T{e}, held...)
+			}
+		}
+	}()
+	return q
+}
+
+// queueInput routes the mouse and keyboard events through input queues,
+// so that they can be put back with unreadKey and unreadMouse.
+func (dctl *DisplayControl) queueInput() {
+	dctl.keyQ = newInputQueue(dctl.kctl.C)
+	dctl.mouseQ = newInputQueue(dctl.mctl.C)
+	dctl.kctl.C, dctl.mctl.C = dctl.keyQ.out, dctl.mouseQ.out
+}
+
+// unreadKey puts back a key, so that it is the next one received.
+func (dctl *DisplayControl) unreadKey(k rune) {
+	dctl.keyQ.unread <- k
+}
+
+// unreadMouse puts back a mouse event, so that it is the next one received.
+func (dctl *DisplayControl) unreadMouse(m draw9.Mouse) {
+	dctl.mouseQ.unread <- m
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+)
+
+// invertImage returns a copy of img with the colors inverted, like a film
+// negative. The alpha is kept.
+func invertImage(img image.Image) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		// the colors are premultiplied by alpha
+		a := dst.Pix[i+3]
+		dst.Pix[i] = a - dst.Pix[i]
+		dst.Pix[i+1] = a - dst.Pix[i+1]
+		dst.Pix[i+2] = a - dst.Pix[i+2]
+	}
+	return dst
+}
+
+// inverted returns img with the colors inverted, if invert.
+func inverted(img image.Image, invert bool) image.Image {
+	if !invert {
+		return img
+	}
+	return invertImage(img)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Journal is an append-only log of the operations of the user on images,
+// like marks. Each operation is written and synced as it happens, so that
+// a long review session can be restored after a crash. The journal is
+// removed when the program exits normally.
+//
+// Each line is an operation, the path of the image and, for some, an
+// argument after a tab:
+//
+//	mark path
+//	unmark path
+//	rate path	stars, -1 if rejected
+//	rename path	new path
+//	trash path
+//	restore path
+type Journal struct {
+	mu   sync.Mutex
+	name string
+	f    *os.File
+}
+
+// journal is the journal of the session. It is nil if disabled.
+var journal *Journal
+
+// journalOp is an operation read from a journal.
+type journalOp struct {
+	op   string
+	path string
+	arg  string // the rating of rate, the new path of rename
+}
+
+// OpenJournal opens the journal in file name. It returns the operations
+// found in the file, left by a session that did not exit normally.
+func OpenJournal(name string) (*Journal, []journalOp, error) {
+	ops, err := readJournal(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("journal: %w", err)
+	}
+	return &Journal{name: name, f: f}, ops, nil
+}
+
+// readJournal reads the operations of the journal file.
+func readJournal(name string) ([]journalOp, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	defer f.Close()
+
+	var ops []journalOp
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// a crash may leave a partial last line, which has no space
+		op, rest, ok := strings.Cut(sc.Text(), " ")
+		path, arg, _ := strings.Cut(rest, "\t")
+		if ok && path != "" {
+			ops = append(ops, journalOp{op, path, arg})
+		}
+	}
+	return ops, sc.Err()
+}
+
+// Record appends the operation on the image at path, with the argument of
+// the operation, if any.
+func (j *Journal) Record(op, path string, arg ...string) {
+	if j == nil {
+		return
+	}
+	line := op + " " + path
+	if len(arg) > 0 {
+		line += "\t" + arg[0]
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := fmt.Fprintln(j.f, line); err != nil {
+		log.Printf("journal: %v", err)
+		return
+	}
+	if err := j.f.Sync(); err != nil {
+		log.Printf("journal: %v", err)
+	}
+}
+
+// Clear truncates the journal. Operations recorded before are lost.
+func (j *Journal) Clear() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Truncate(0); err != nil {
+		log.Printf("journal: %v", err)
+	}
+}
+
+// Close closes and removes the journal, after a normal exit.
+func (j *Journal) Close() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.f.Close()
+	if err := os.Remove(j.name); err != nil {
+		log.Printf("journal: %v", err)
+	}
+}
+
+// applyJournal applies the operations to the icons. It returns the number of
+// operations applied. Operations on images not in icons are ignored. The
+// icons are at the paths after the renames of the journal, the operations
+// before a rename apply to the image at its new path.
+func applyJournal(icons []*Icon, ops []journalOp) int {
+	byPath := make(map[string]*Icon, len(icons))
+	for _, icon := range icons {
+		byPath[icon.path] = icon
+	}
+	// final are the paths of the images of the operations after all the
+	// renames, found from the last operation back. An image replaced by a
+	// rename has no path.
+	renamed := make(map[string]string)
+	final := make([]string, len(ops))
+	for k := len(ops) - 1; k >= 0; k-- {
+		op := ops[k]
+		if op.op == "rename" && op.arg != op.path {
+			to, ok := renamed[op.arg]
+			if !ok {
+				to = op.arg
+			}
+			renamed[op.path] = to
+			renamed[op.arg] = ""
+		}
+		final[k] = op.path
+		if p, ok := renamed[op.path]; ok {
+			final[k] = p
+		}
+	}
+
+	n := 0
+	for k, op := range ops {
+		icon, ok := byPath[final[k]]
+		if !ok {
+			continue
+		}
+		switch op.op {
+		case "mark":
+			icon.setMarked(true)
+		case "unmark":
+			icon.setMarked(false)
+		case "rate":
+			stars, err := strconv.Atoi(op.arg)
+			if err != nil {
+				continue
+			}
+			icon.setRating(stars)
+		case "rename":
+			// the icon is already at the new path
+		case "trash":
+			icon.setMarked(false)
+			icon.setTrashed(true)
+		case "restore":
+			icon.setTrashed(false)
+		default:
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// askYesNo asks the user a question on the terminal. It returns false
+// if there is no terminal, for example when running from a script.
+func askYesNo(question string) bool {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+	fmt.Fprintf(tty, "%s [y/n] ", question)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y")
+}
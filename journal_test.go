@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestJournalRecord(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "journal")
+	j, ops, err := OpenJournal(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 0 {
+		t.Errorf("new journal has operations %v", ops)
+	}
+	j.Record("mark", "/a b.jpg")
+	j.Record("rate", "/a b.jpg", "3")
+	j.Record("rename", "/a b.jpg", "/c d.jpg")
+	j.f.Close()
+
+	_, ops, err = OpenJournal(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []journalOp{
+		{"mark", "/a b.jpg", ""},
+		{"rate", "/a b.jpg", "3"},
+		{"rename", "/a b.jpg", "/c d.jpg"},
+	}
+	if !slices.Equal(ops, want) {
+		t.Errorf("operations %v, want %v", ops, want)
+	}
+}
+
+func TestApplyJournal(t *testing.T) {
+	icons := []*Icon{NewIcon("/c.jpg"), NewIcon("/d.jpg"), NewIcon("/e.jpg")}
+	ops := []journalOp{
+		{"mark", "/a.jpg", ""},
+		{"rate", "/a.jpg", "4"},
+		{"rename", "/a.jpg", "/b.jpg"},
+		{"rename", "/b.jpg", "/c.jpg"},
+		{"mark", "/d.jpg", ""},
+		{"rename", "/d.jpg", "/x.jpg"},
+		{"trash", "/x.jpg", ""},
+		{"mark", "/e.jpg", ""},
+		{"rate", "/e.jpg", "bad"},
+		{"mark", "/missing.jpg", ""},
+	}
+	if n := applyJournal(icons, ops); n != 5 {
+		t.Errorf("applied %d operations, want 5", n)
+	}
+	c, d, e := icons[0], icons[1], icons[2]
+	if !c.Marked() || c.rating != 4 {
+		t.Errorf("renamed image: marked %v rating %d, want marked with 4 stars", c.Marked(), c.rating)
+	}
+	if d.Marked() || d.trashed {
+		t.Errorf("image at the path of a renamed one: marked %v trashed %v, want neither", d.Marked(), d.trashed)
+	}
+	if !e.Marked() || e.rating != 0 {
+		t.Errorf("image with a bad rating: marked %v rating %d, want marked without rating", e.Marked(), e.rating)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import "encoding/binary"
+
+// stdLuminanceQuant is the luminance quantization table of the JPEG standard
+// (Annex K). Encoders scale it according to the quality.
+var stdLuminanceQuant = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// estimateJPEGQuality estimates the quality setting used by the encoder of a JPEG
+// by comparing its luminance quantization table with the standard one.
+// It is only an estimate, encoders that use custom tables will give odd results.
+// The bool is false if data is not a JPEG or has no luminance table.
+func estimateJPEGQuality(data []byte) (int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, false
+	}
+	for p := 2; p+4 <= len(data); {
+		if data[p] != 0xFF {
+			return 0, false
+		}
+		marker := data[p+1]
+		if marker == 0xD8 || (0xD0 <= marker && marker <= 0xD7) || marker == 0x01 {
+			p += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan or end of image
+			return 0, false
+		}
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if n < 2 || p+2+n > len(data) {
+			return 0, false
+		}
+		if marker == 0xDB { // define quantization tables
+			if q, ok := qualityOfTables(data[p+4 : p+2+n]); ok {
+				return q, true
+			}
+		}
+		p += 2 + n
+	}
+	return 0, false
+}
+
+// qualityOfTables looks for the luminance table in the segment of a DQT marker
+// and estimates the quality using the scaling formula of libjpeg. Only the sums
+// of the tables are compared, so the order of the coefficients does not matter.
+func qualityOfTables(seg []byte) (int, bool) {
+	for len(seg) > 0 {
+		precision, id := seg[0]>>4, seg[0]&0x0F
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if len(seg) < 1+size {
+			return 0, false
+		}
+		if id == 0 {
+			sum := 0
+			for i := 0; i < 64; i++ {
+				if precision == 0 {
+					sum += int(seg[1+i]) * 100
+				} else {
+					sum += int(binary.BigEndian.Uint16(seg[1+2*i:])) * 100
+				}
+			}
+			stdSum := 0
+			for _, v := range stdLuminanceQuant {
+				stdSum += v
+			}
+			scale := float64(sum) / float64(stdSum)
+			var q float64
+			if scale <= 100 {
+				q = (200 - scale) / 2
+			} else {
+				q = 5000 / scale
+			}
+			return min(100, max(1, int(q+0.5))), true
+		}
+		seg = seg[1+size:]
+	}
+	return 0, false
+}
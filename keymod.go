@@ -0,0 +1,39 @@
+package main
+
+import "sync/atomic"
+
+// modifier is a set of modifier keys held down.
+type modifier uint32
+
+const (
+	modShift modifier = 1 << iota
+	modCtl
+	modAlt
+)
+
+// pageJump is how many pages or images the shifted arrow keys move.
+const pageJump = 10
+
+// heldModifiers are the modifier keys held down now. Only the platforms
+// that report them, like Plan 9 with /dev/kbd, set them. Elsewhere they
+// stay 0 and the keys work without modifiers.
+var heldModifiers atomic.Uint32
+
+// modifiers returns the modifier keys held down now. It applies to the
+// key or the mouse event being handled, as they are handled as they come.
+func modifiers() modifier {
+	return modifier(heldModifiers.Load())
+}
+
+// arrowStep returns how far an arrow key in the direction d moves with the
+// modifiers held: one step, pageJump steps with Shift or all the n steps
+// to the end with Ctl.
+func arrowStep(d, n int) int {
+	switch mods := modifiers(); {
+	case mods&modCtl != 0:
+		return d * n
+	case mods&modShift != 0:
+		return d * pageJump
+	}
+	return d
+}
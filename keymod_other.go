@@ -0,0 +1,10 @@
+//go:build !plan9
+
+package main
+
+import draw9 "9fans.net/go/draw"
+
+// watchModifiers returns kctl, as devdraw does not report the modifier keys.
+func watchModifiers(kctl *draw9.Keyboardctl) *draw9.Keyboardctl {
+	return kctl
+}
@@ -0,0 +1,69 @@
+//go:build plan9
+
+package main
+
+import (
+	"log"
+	"os"
+	"unicode/utf8"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// watchModifiers reads the keyboard from /dev/kbd, which reports the keys
+// held down, and tracks the modifiers. It returns a Keyboardctl with the
+// typed characters. The keys stop coming to /dev/cons, so kctl is left idle.
+// If /dev/kbd is not available, it returns kctl.
+func watchModifiers(kctl *draw9.Keyboardctl) *draw9.Keyboardctl {
+	f, err := os.Open("/dev/kbd")
+	if err != nil {
+		log.Printf("watchModifiers: %v", err)
+		return kctl
+	}
+	ch := make(chan rune, 20)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				fatalf("watchModifiers: %v", err)
+			}
+			readKbd(buf[:n], ch)
+		}
+	}()
+	return &draw9.Keyboardctl{C: ch}
+}
+
+// readKbd handles the messages of a read of /dev/kbd. Each is a type and
+// a string of runes, terminated by 0: 'c' for a typed character, 'k' and
+// 'K' for the keys held down after a press and a release.
+func readKbd(b []byte, ch chan<- rune) {
+	for len(b) > 0 {
+		typ := b[0]
+		b = b[1:]
+		var mods modifier
+		for len(b) > 0 && b[0] != 0 {
+			r, n := utf8.DecodeRune(b)
+			b = b[n:]
+			switch typ {
+			case 'c':
+				ch <- r
+			case 'k', 'K':
+				switch r {
+				case draw9.KeyShift:
+					mods |= modShift
+				case draw9.KeyCtl:
+					mods |= modCtl
+				case draw9.KeyAlt:
+					mods |= modAlt
+				}
+			}
+		}
+		if len(b) > 0 {
+			b = b[1:] // the 0
+		}
+		if typ == 'k' || typ == 'K' {
+			heldModifiers.Store(uint32(mods))
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// latestPollInterval is how often LatestView checks the directory for new images.
+const latestPollInterval = time.Second
+
+// LatestView is a View that watches a directory and always shows the newest image.
+// It is useful for tethered shooting or for reviewing screenshots as they are taken.
+type LatestView struct {
+	dir      string
+	icons    []*Icon // the images displayed so far, oldest first
+	current  *IconImage
+	modTime  time.Time
+	area     image.Rectangle
+	showInfo bool
+	retryC   chan struct{} // signals that the current image was not ready
+
+	dctl *DisplayControl
+}
+
+// NewLatestView returns a LatestView for the directory.
+func NewLatestView(dir string, r image.Rectangle) *LatestView {
+	return &LatestView{
+		dir:    dir,
+		area:   r,
+		retryC: make(chan struct{}, 1),
+	}
+}
+
+func (lv *LatestView) Connect(dctl *DisplayControl) {
+	lv.dctl = dctl
+}
+
+func (lv *LatestView) Attach(r image.Rectangle) {
+	if r.Eq(lv.area) {
+		return
+	}
+	lv.area = r
+	if lv.current != nil {
+		lv.dctl.waitPaint()
+		lv.current.Unload()
+	}
+}
+
+func (lv *LatestView) Free() {
+	lv.dctl.waitPaint()
+	if lv.current != nil {
+		lv.current.Unload()
+	}
+}
+
+func (lv *LatestView) Handle() View {
+	bt2menu := &draw9.Menu{
+		Item: []string{"info", "mark", "plumb", "exit"},
+	}
+
+	ticker := time.NewTicker(latestPollInterval)
+	defer ticker.Stop()
+
+	dctl := lv.dctl
+	lv.update()
+	lv.paint(dctl)
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case <-ticker.C:
+			if lv.update() {
+				lv.paint(dctl)
+			}
+		case <-lv.retryC:
+			// the file may still be written. Retry on the next poll.
+			lv.modTime = time.Time{}
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			dctl.applyCtl(req)
+			lv.paint(dctl)
+		case k := <-dctl.kctl.C:
+			switch k {
+			case 'q', 'e', escKey: // exit
+				return nil
+			case 'i': // info
+				lv.showInfo = !lv.showInfo
+				lv.paint(dctl)
+			case 'm': // mark
+				if lv.current != nil {
+					lv.current.ToggleMarked()
+					lv.paint(dctl)
+				}
+			case 'p': // plumb
+				if lv.current != nil {
+					plumbImage(lv.current.path)
+				}
+			case 'S': // snapshot
+				dctl.snapshot()
+			}
+		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			switch dctl.mctl.Mouse.Buttons {
+			case 2: // view menu
+				switch dctl.screen.MenuHit(2, bt2menu) {
+				case 0: // info
+					lv.showInfo = !lv.showInfo
+					lv.paint(dctl)
+				case 1: // mark
+					if lv.current != nil {
+						lv.current.ToggleMarked()
+						lv.paint(dctl)
+					}
+				case 2: // plumb
+					if lv.current != nil {
+						plumbImage(lv.current.path)
+					}
+				case 3: // exit
+					return nil
+				}
+			}
+		case <-dctl.mctl.Resize:
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			lv.Attach(dctl.screen.Bounds())
+			lv.paint(dctl)
+		}
+	}
+}
+
+// update checks the directory for a newer image and makes it current.
+// It returns whether the current image changed.
+func (lv *LatestView) update() bool {
+	path, modTime, ok := newestImage(lv.dir)
+	if !ok || !modTime.After(lv.modTime) {
+		return false
+	}
+	lv.dctl.waitPaint()
+	if lv.current != nil && lv.current.path == path {
+		lv.modTime = modTime
+		lv.current.Unload()
+		return true
+	}
+	if lv.current != nil {
+		lv.current.Unload()
+	}
+	icon := NewIcon(path)
+	lv.icons = append(lv.icons, icon)
+	lv.current = icon.NewIconImage(func(img image.Image) (ScreenImage, error) {
+		return FitBest(lv.dctl.screen, img, lv.area)
+	})
+	lv.modTime = modTime
+	sessionEvent("view", path)
+	return true
+}
+
+// paint posts a request to paint the current image. The painter gets
+// a copy of the view, as the view changes while it paints.
+func (lv *LatestView) paint(dctl *DisplayControl) {
+	l := *lv
+	dctl.post(func() { l.render(dctl) })
+}
+
+// render paints the current image.
+func (lv *LatestView) render(dctl *DisplayControl) {
+	dctl.painted = nil
+	window := dctl.screen
+	window.Draw(window.Bounds(), dctl.bgColor, image.Point{})
+	fontHeight := window.FontHeight()
+
+	if lv.current == nil {
+		window.String(lv.area.Min, dctl.fontColor, fmt.Sprintf("waiting for images in %s", lv.dir))
+		if err := window.Flush(); err != nil {
+			log.Printf("display: flush: %v", err)
+		}
+		return
+	}
+
+	var img ScreenImage
+	var err error
+	dctl.showWaitingAndCall(func() {
+		img, err = lv.current.ForDisplay()
+	})
+	if err != nil {
+		log.Printf("latestView: image not ready: %v", err)
+		select {
+		case lv.retryC <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	imgR := bestFit(lv.area, img.Bounds())
+	if lv.showInfo {
+		window.String(lv.area.Min, dctl.fontColor,
+			fmt.Sprintf("%d %v %s", len(lv.icons), lv.current.Info().origBounds, lv.current.Path()))
+		imgR.Min.Y += 2 * fontHeight
+	}
+	window.Draw(imgR, img, image.Point{})
+	if lv.current.Marked() {
+		mr := image.Rect(window.Bounds().Max.X-50, window.Bounds().Min.Y,
+			window.Bounds().Max.X, window.Bounds().Min.Y+fontHeight)
+		window.Draw(mr, dctl.borderColor, image.Point{})
+	}
+
+	if err := window.Flush(); err != nil {
+		log.Printf("display: flush: %v", err)
+	}
+}
+
+// newestImage returns the path and modification time of the most recently
+// modified image in dir. Subdirectories are not searched.
+func newestImage(dir string) (string, time.Time, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("newestImage: %v", err)
+		return "", time.Time{}, false
+	}
+
+	var newest string
+	var newestTime time.Time
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !isImageFile(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(newestTime) {
+			newest, newestTime = filepath.Join(dir, e.Name()), info.ModTime()
+		}
+	}
+	return newest, newestTime, newest != ""
+}
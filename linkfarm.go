@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// farmLink is a name in the link farm for an original file.
+type farmLink struct {
+	target string // the absolute path of the original
+	name   string // the path of the link
+}
+
+// exportLinks adds links to the originals of the icons, with their siblings,
+// to dir, so that albums take no space. The links have the names of the
+// originals, the names that exist are handled by -oncollision. Remote images
+// are skipped. It returns the number of links.
+func exportLinks(icons []*Icon, dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("export links: %w", err)
+	}
+	var links []farmLink
+	used := make(map[string]bool) // names are claimed before the links exist
+	for _, icon := range icons {
+		if _, remote := remoteSourceOf(icon.path); remote {
+			log.Printf("export links: %s: remote images cannot be linked", icon.path)
+			continue
+		}
+		for _, file := range icon.Files() {
+			target, err := filepath.Abs(file)
+			if err != nil {
+				return 0, fmt.Errorf("export links: %w", err)
+			}
+			name, err := linkName(dir, file, used)
+			if err != nil {
+				log.Printf("export links: %v", err)
+				continue
+			}
+			used[name] = true
+			links = append(links, farmLink{target: target, name: name})
+		}
+	}
+	if err := makeLinks(dir, links); err != nil {
+		return 0, fmt.Errorf("export links: %w", err)
+	}
+	return len(links), nil
+}
+
+// linkName returns the name of the link to file in dir. If another link of
+// the export took it, the name is numbered like freeName does.
+func linkName(dir, file string, used map[string]bool) (string, error) {
+	ext := filepath.Ext(file)
+	stem := strings.TrimSuffix(filepath.Base(file), ext)
+	for n := 1; ; n++ {
+		name := filepath.Join(dir, stem+ext)
+		if n > 1 {
+			name = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, n, ext))
+		}
+		if used[name] {
+			continue
+		}
+		dst, err := destination(name, collides)
+		if err != nil {
+			return "", err
+		}
+		if !used[dst] {
+			return dst, nil
+		}
+	}
+}
+
+// exportMarkedLinks links the marked icons in the directory of -linkdir.
+func exportMarkedLinks(marked []*Icon) {
+	n, err := exportLinks(marked, *linkDir)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	log.Printf("linked %d files in %s", n, *linkDir)
+}
@@ -0,0 +1,23 @@
+//go:build !plan9
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// makeLinks creates the links as symbolic links, replacing the files that
+// -oncollision allows to overwrite.
+func makeLinks(dir string, links []farmLink) error {
+	for _, l := range links {
+		if err := os.Remove(l.name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := os.Symlink(l.target, l.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build plan9
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// makeLinks appends to the rc script bind in dir the commands that bind the
+// originals on the names, as Plan 9 has no symbolic links. Running the
+// script, or adding it to the profile, shows the album in the namespace.
+func makeLinks(dir string, links []farmLink) error {
+	script := filepath.Join(dir, "bind")
+	_, err := os.Stat(script)
+	f, ferr := os.OpenFile(script, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0755)
+	if ferr != nil {
+		return ferr
+	}
+	if err != nil {
+		fmt.Fprintf(f, "#!/bin/rc\n# the album of %s, bound from the originals\n", progName)
+	}
+	for _, l := range links {
+		fmt.Fprintf(f, "touch %s && bind %s %s\n", rcQuote(l.name), rcQuote(l.target), rcQuote(l.name))
+	}
+	return f.Close()
+}
+
+// rcQuote quotes s for rc.
+func rcQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
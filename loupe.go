@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"log"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// loupeSize is the side of the square of the loupe on the window.
+const loupeSize = 256
+
+// loupe is a magnifier that follows the mouse in the single view. It
+// magnifies the original image, not the scaled one on the window, so that
+// small text in screenshots can be read.
+type loupe struct {
+	src  image.Image // the original image
+	at   int         // the index of the image in the view
+	zoom int         // the magnification, 4 or 8
+	pt   image.Point // the mouse position on the window
+}
+
+// toggleLoupe cycles the loupe between 4x, 8x and off.
+func (sv *SingleView) toggleLoupe() {
+	switch {
+	case sv.loupe == nil:
+		sv.loupe = &loupe{at: -1, zoom: 4, pt: sv.dctl.mctl.Mouse.Point}
+		sv.loadLoupe()
+	case sv.loupe.zoom == 4:
+		l := *sv.loupe
+		l.zoom = 8
+		sv.loupe = &l
+	default:
+		sv.loupe = nil
+	}
+}
+
+// moveLoupe moves the loupe to the point p of the window.
+func (sv *SingleView) moveLoupe(p image.Point) {
+	l := *sv.loupe
+	l.pt = p
+	sv.loupe = &l
+}
+
+// loupeState is the loupe of an image when it was last displayed: the
+// magnification, 0 if off, and the place on the view, as fractions of its
+// width and height so that it survives resizes.
+type loupeState struct {
+	zoom int
+	x, y float64
+}
+
+// loupeStates remembers the loupe of the images displayed in the session,
+// by path, so that flipping between images to compare them keeps the spot
+// looked at in each.
+var loupeStates = make(map[string]loupeState)
+
+// rememberLoupe saves the loupe of the icon.
+func (sv *SingleView) rememberLoupe(icon *Icon) {
+	var s loupeState
+	if l := sv.loupe; l != nil {
+		s.zoom = l.zoom
+		s.x = float64(l.pt.X-sv.area.Min.X) / float64(max(1, sv.area.Dx()))
+		s.y = float64(l.pt.Y-sv.area.Min.Y) / float64(max(1, sv.area.Dy()))
+	}
+	loupeStates[icon.path] = s
+}
+
+// restoreLoupe sets the loupe the icon had when it was last displayed.
+// Icons not displayed before keep the loupe as is, at the same spot.
+func (sv *SingleView) restoreLoupe(icon *Icon) {
+	s, ok := loupeStates[icon.path]
+	switch {
+	case !ok:
+	case s.zoom == 0:
+		sv.loupe = nil
+	default:
+		pt := image.Pt(sv.area.Min.X+int(s.x*float64(sv.area.Dx())), sv.area.Min.Y+int(s.y*float64(sv.area.Dy())))
+		sv.loupe = &loupe{at: -1, zoom: s.zoom, pt: pt}
+	}
+}
+
+// loadLoupe decodes the current image for the loupe, if not done yet.
+func (sv *SingleView) loadLoupe() {
+	if sv.loupe == nil || sv.loupe.at == sv.at {
+		return
+	}
+	l := *sv.loupe
+	l.at, l.src = sv.at, nil
+	sv.dctl.showWaitingAndCall(func() {
+		img, err := renderIcon(sv.icons[sv.at])
+		if err != nil {
+			log.Printf("loupe: %v", err)
+			return
+		}
+		l.src = colorManaged(inverted(autoCropped(img, sv.autoCrop), sv.invert), sv.colorManage)
+	})
+	sv.loupe = &l
+}
+
+// paintLoupe paints the loupe around its point, magnifying the part of the
+// original image that is displayed scaled in imgR.
+func paintLoupe(dctl *DisplayControl, l *loupe, imgR image.Rectangle) {
+	if l.src == nil || !l.pt.In(imgR) {
+		return
+	}
+	b := l.src.Bounds()
+	sp := image.Point{
+		b.Min.X + (l.pt.X-imgR.Min.X)*b.Dx()/imgR.Dx(),
+		b.Min.Y + (l.pt.Y-imgR.Min.Y)*b.Dy()/imgR.Dy(),
+	}
+	n := loupeSize / l.zoom
+	sr := image.Rect(sp.X-n/2, sp.Y-n/2, sp.X-n/2+n, sp.Y-n/2+n)
+	// keep the source square inside the image, as long as it fits
+	sr = sr.Add(image.Point{max(0, b.Min.X-sr.Min.X), max(0, b.Min.Y-sr.Min.Y)})
+	sr = sr.Sub(image.Point{max(0, sr.Max.X-b.Max.X), max(0, sr.Max.Y-b.Max.Y)})
+	sr = sr.Intersect(b)
+	if sr.Empty() {
+		return
+	}
+
+	dr := image.Rect(0, 0, sr.Dx()*l.zoom, sr.Dy()*l.zoom)
+	dimg := newPooledRGBA(dr)
+	xdraw.NearestNeighbor.Scale(dimg, dr, l.src, sr, xdraw.Src, nil)
+	bitmap := toPlan9Bitmap(dimg)
+	putBytes(dimg.Pix)
+	img, err := dctl.screen.ReadImage(bytes.NewReader(bitmap))
+	putBytes(bitmap)
+	if err != nil {
+		log.Printf("loupe: %v", err)
+		return
+	}
+	defer img.Free()
+
+	window := dctl.screen
+	r := dr.Add(l.pt.Sub(dr.Size().Div(2)))
+	window.Draw(r, img, image.Point{})
+	window.Border(r.Inset(-2), 2, dctl.borderColor, image.Point{})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+// lowbwIdle is how long a view waits without input before it uploads
+// its visible icons again in full color, with -lowbw.
+const lowbwIdle = 2 * time.Second
+
+// lowDepth wraps an image to upload it to the display with 16 bits per
+// pixel instead of 32, which halves the traffic over slow connections.
+type lowDepth struct {
+	image.Image
+}
+
+// toPlan9Bitmap16 is like toPlan9Bitmap but converts the pixels to r5g6b5.
+func toPlan9Bitmap16(img *image.RGBA) []byte {
+	const headerSize = 60
+	n := headerSize + img.Bounds().Dx()*img.Bounds().Dy()*2
+	b := getBytes(n)
+	copy(b, fmt.Sprintf("%11s %11d %11d %11d %11d ",
+		"r5g6b5", 0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	out := b[headerSize:]
+	for data := img.Pix; len(data) > 0; data, out = data[4:], out[2:] {
+		p := uint16(data[0]>>3)<<11 | uint16(data[1]>>2)<<5 | uint16(data[2]>>3)
+		out[0], out[1] = byte(p), byte(p>>8)
+	}
+	return b
+}
+
+// upgradeLowDepth frees the low depth thumbnails of the loaded icons in
+// [from, to), so that the next paint uploads them in full color. It
+// returns whether there were any.
+func upgradeLowDepth(cache CachedSlice[*Icon, *IconImage], from, to int) bool {
+	found := false
+	for i := from; i < to; i++ {
+		icon, ok := cache.Peek(i)
+		if !ok || !icon.lowDepth {
+			continue
+		}
+		if _, ok := icon.Ready(); ok {
+			icon.lowDepth = false
+			drawMem.remove(icon)
+			icon.dropThumb()
+			found = true
+		}
+	}
+	return found
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"image"
 	"io"
-	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -15,12 +14,14 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	draw9 "9fans.net/go/draw"
 	"9fans.net/go/plan9"
 	"9fans.net/go/plan9/client"
 	"9fans.net/go/plumb"
 	xdraw "golang.org/x/image/draw"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
@@ -28,26 +29,100 @@ const (
 
 	darkgrey = draw9.Color(uint32(0x666666FF))
 	yellow   = draw9.Color(uint32(0xFFFF00FF))
+	red      = draw9.Color(uint32(0xFF0000FF))
+	grey     = draw9.Color(uint32(0x999999FF))
+	cyan     = draw9.Color(uint32(0x00FFFFFF))
+	black    = draw9.Color(uint32(0x000000FF))
 
 	upArrowKey      = 61454
 	downArrowKey    = 128
 	leftArrowKey    = 61457
 	rightArrowKey   = 61458
+	homeKey         = 61453
+	endKey          = 61464
 	scrollWheelUp   = 8
 	scrollWheelDown = 16
 	escKey          = 27
+	deleteKey       = 127
+	backspaceKey    = 8
+	tabKey          = 9
 )
 
 var (
 	windowSizeFlag = flag.String("w", "1300x1000", "set window size")
+	monitorFlag    = flag.String("screen", "1920x1080", "set the `size` of the monitor for the fullscreen mode")
 	iconSizeFlag   = flag.String("i", "320x240", "set icon size")
 	outputMarked   = flag.Bool("o", false, "output the paths of marked images")
+	pickMode       = flag.Bool("pick", false, "pick an image: clicking on an icon, or enter in the single view, prints its path and exits")
 	startSingle    = flag.Bool("s", false, "start with the single view")
+	printSummary   = flag.Bool("summary", false, "print the counts of viewed, marked, rejected and failed images to stderr on exit")
+	startCmds      = flag.String("cmd", "", "apply the `commands`, separated by semicolons, after loading, like 'sort name; filter *.jpg; goto last'")
+	rightToLeft    = flag.Bool("rtl", false, "read right to left in the single view, like manga: the left button and arrow go to the next image")
 	silent         = flag.Bool("q", false, "silent mode, do not log anything")
 	verbose        = flag.Bool("v", false, "verbose mode, log statistics for cache")
-	fast           = flag.Bool("f", false, "choose fast over best algorithms for scaling")
+	fast           = flag.Bool("f", false, "always choose fast over best algorithms for scaling")
 	pageSize       = flag.Int("p", 0, "set page size. Default is 1 grid page")
+	iconsCache     = cacheFlag("iconscache", "set the `pagesize,prefetch,pages` of the cache of the icons view")
+	singleCache    = cacheFlag("singlecache", "set the `pagesize,prefetch,pages` of the cache of the single view")
+	markedCache    = cacheFlag("markedcache", "set the `pagesize,prefetch,pages` of the cache of the marked view")
 	setMemoryLimit = flag.Bool("m", false, "run with 1G soft memory limit. Overrides GOMEMLIMIT")
+	latest         = flag.Bool("latest", false, "watch the directory and always display the newest image")
+	snarfWatch     = flag.Bool("snarf", false, "add the images whose paths or URLs are copied to the snarf buffer, the clipboard, and go to them")
+	pipeName       = flag.String("pipe", "", "read images from the named pipe `fifo` and display them as they arrive")
+	extraFormats   = flag.String("ext", "", "accept files with the comma separated `suffixes` as images")
+	sniff          = flag.Bool("sniff", false, "accept all files and detect images from their contents")
+	remote         = flag.Bool("remote", false, "tune caching and reads for images on high latency file systems")
+	galleryDir     = flag.String("gallery", "gallery", "export the galleries of marked images to `dir`")
+	gallerySize    = flag.Int("gallerysize", 0, "scale down the images of the galleries to fit in `pixels` x pixels. 0 copies the files")
+	linkDir        = flag.String("linkdir", "links", "link the marked images in `dir`, as symbolic links or, on Plan 9, as an rc script of binds")
+	printFile      = flag.String("printto", "proof.pdf", "print the marked images from the menu as proof sheets to `file`, PDF or PostScript by its suffix")
+	paperName      = flag.String("paper", "a4", "the `size` of the pages of the proof sheets, a4 or letter")
+	nUp            = flag.Int("nup", 6, "the `number` of images on each page of the proof sheets")
+	montageFile    = flag.String("montageto", "montage.png", "compose the marked images from the menu into `file`, JPEG or PNG by its suffix")
+	montageGap     = flag.Int("montagegap", 8, "the spacing of the montages in `pixels`")
+	montageBg      = flag.String("montagebg", "white", "the background `color` of the montages, a name like white, black, grey or transparent, or #rrggbb")
+	animFile       = flag.String("animto", "burst.gif", "assemble the marked images from the menu into the animation `file`, GIF or, with img2webp, WebP by its suffix")
+	groupNames     = flag.String("groups", "", "create the groups of the session with the comma separated `names`, like 'maybe,ask client'. The a key adds images to groups")
+	groupDir       = flag.String("groupdir", "", "write the paths of the images of each group to name.txt in `dir` on exit")
+	renameTo       = flag.String("renameto", "{date}_{time}_{model}", "rename the marked images from the menu by the `template` of EXIF fields")
+	exportDir      = flag.String("exportdir", "export", "export the marked images with the presets of the menu to `dir`")
+	eventsPort     = flag.String("events", "", "plumb the events of the session, like viewed and marked images, to `port`")
+	onlyExpr       = flag.String("only", "", "display only the images that satisfy all the comma separated `conditions`, like -markif")
+	albumName      = flag.String("album", "", "display the album saved as `name`")
+	saveAlbumAs    = flag.String("savealbum", "", "save the files and directories, -only and -sort as the album `name`")
+	markIfExpr     = flag.String("markif", "", "mark the images that satisfy all the comma separated `conditions`, like size>5MB,width<800,date<2020-01-01,name~*.png")
+	ctlService     = flag.String("ctl", "", "post a 9P file server as `service` with a ctl file to mark images from scripts")
+	hooks          = hookFlagVar("hook", "run the shell `event=command` on events: view, mark, unmark or exit. The path is in $file. Repeat for more events")
+	detectCodes    = flag.Bool("qr", false, "detect QR codes and barcodes in the display view. Clicking on one plumbs its text")
+	autoCrop       = flag.Bool("autocrop", false, "trim the uniform borders of images, like scans and letterboxed screenshots, in the display view")
+	cropExport     = flag.Bool("cropexport", false, "trim the uniform borders of the exported frames and gallery images too")
+	avifDecoder    = flag.String("avif", "magick avif:- png:-", "decode AVIF images with the shell `command`. It reads the image from its standard input and prints it as PNG")
+	rawDecoder     = flag.String("raw", `dcraw -c -w -t 0 "$file"`, "decode camera RAW images with the shell `command`. The file is in $file and it prints the image as PPM, PNG or JPEG. Empty, or if it fails, displays the embedded JPEG previews")
+	ocrCommand     = flag.String("ocr", "tesseract stdin stdout", "recognize the text of images with the shell `command`. It reads the image from its standard input and prints the text")
+	acmeMarked     = flag.Bool("acme", false, "list the marked images in an acme window. Looking at a path displays the image")
+	renderDir      = flag.String("render", "", "render the images as contact sheets, one per page of icons, in `dir` with an index.html and exit")
+	benchmark      = flag.Bool("bench", false, "process the images without display and print statistics per stage")
+	recordFile     = flag.String("record", "", "record the input events to `file`")
+	replayFile     = flag.String("replay", "", "replay the input events of `file` on a fake display and print the display operations")
+	journalFile    = flag.String("journal", "", "record marks, ratings, renames and deletes in `file` to restore them after a crash")
+	cacheDir       = flag.String("cachedir", "", "keep intermediate resolutions of images in `dir` to speed up display")
+	cacheSize      = flag.Int("cachesize", 2048, "keep the cache of -cachedir under `MB`, removing the entries used least recently at startup")
+	cacheGC        = flag.Bool("cachegc", false, "remove the entries of the cache of -cachedir over -cachesize and exit")
+	collateLang    = flag.String("collate", "", "sort the names of images by the rules of the `language`, like de or el")
+	foldNames      = flag.Bool("fold", false, "ignore case and diacritics when sorting with -collate and matching names with -markif")
+	sortKey        = flag.String("sort", "", "sort images by `keys`, comma separated, the ties of each by the next: name (default, natural order), dir, date (taken, oldest first), size (largest first), viewed (longest displayed first), brightness (darkest first) or hue (like a color wheel, grays last)")
+	viewStatsFile  = flag.String("viewstats", "", "write how long and how many times each image was displayed to the CSV `file` on exit")
+	diffMode       = flag.Bool("diff", false, "display the images of the second directory that differ from the images with the same path in the first")
+	docFile        = flag.String("doc", "", "display the local images referenced in the markdown, HTML or troff `file`, in document order")
+	rawOrder       = flag.Bool("raworder", false, "do not sort, keep the order of the command line and the directory walk. Needed to browse the images found while a scan continues, as sorted the order is not final")
+	showDims       = flag.Bool("dims", false, "show the pixel dimensions of the images on the thumbnails")
+	lowBandwidth   = flag.Bool("lowbw", false, "upload the thumbnails in batches and in 16 bits per pixel first, in full color when idle, for slow connections to the display")
+	idleLoading    = flag.Bool("idleload", true, "load the pages near the current one while idle and, with -cachedir, the intermediate resolutions of the images after it")
+	drawMemLimit   = flag.Int("drawmem", 0, "keep at most `MB` megabytes of thumbnails on the display server. 0 means no limit")
+	readRatings    = flag.Bool("xmp", false, "read the ratings and labels of the images from XMP sidecars, like those of Lightroom and digiKam, or embedded XMP")
+	iccFile        = flag.String("icc", "", "convert the colors of the display view to the monitor ICC profile `file`. The default is monitor.icc in the configuration directory, if it exists")
+	orientImages   = flag.Bool("orient", false, "display the images upright by their EXIF orientation and shape the icons for the majority of them")
+	onCollision    = flag.String("oncollision", "rename", "when an exported file exists: rename (add a number), overwrite, skip or ask")
 )
 
 var (
@@ -57,22 +132,69 @@ var (
 )
 
 var (
-	windowSize      image.Point
-	iconSize        image.Point
-	padding         = 4
-	acceptedFormats = []string{".gif", ".jpg", ".jpeg", ".png", ".webp"}
+	windowSize  image.Point
+	monitorSize image.Point
+	collides    collision
+	iconSize    image.Point
+	padding     = 4
+	// acceptedFormats maps the suffixes of image files to their MIME type.
+	acceptedFormats = map[string]string{
+		".arw":   "image/x-raw",
+		".avif":  "image/avif",
+		".bmp":   "image/bmp",
+		".cr2":   "image/x-raw",
+		".dib":   "image/bmp",
+		".dng":   "image/x-raw",
+		".ff":    "image/x-farbfeld",
+		".gif":   "image/gif",
+		".ico":   "image/x-icon",
+		".jpg":   "image/jpeg",
+		".jpeg":  "image/jpeg",
+		".jpe":   "image/jpeg",
+		".jfif":  "image/jpeg",
+		".nef":   "image/x-raw",
+		".pjpeg": "image/jpeg",
+		".pjp":   "image/jpeg",
+		".png":   "image/png",
+		".pbm":   "image/x-portable-bitmap",
+		".pgm":   "image/x-portable-graymap",
+		".ppm":   "image/x-portable-pixmap",
+		".pnm":   "", // any of the three above, detected from the contents
+		".qoi":   "image/qoi",
+		".tga":   "image/x-tga",
+		".webp":  "image/webp",
+	}
 
 	plumber *client.Fid
 )
 
 type DisplayControl struct {
-	display     *draw9.Display
-	errch       chan error
-	mctl        *draw9.Mousectl
-	kctl        *draw9.Keyboardctl
-	bgColor     *draw9.Image
-	borderColor *draw9.Image
-	fontColor   *draw9.Image
+	errch        chan error
+	mctl         *draw9.Mousectl
+	kctl         *draw9.Keyboardctl
+	screen       Screen
+	bgColor      ScreenImage
+	borderColor  ScreenImage
+	fontColor    ScreenImage
+	warnColor    ScreenImage
+	scrollColor  ScreenImage
+	currentColor ScreenImage
+	blackColor   ScreenImage
+
+	painter   *painter
+	painted   any // the owner of what is on the window, see gridPaint
+	keyQ      *inputQueue[rune]
+	mouseQ    *inputQueue[draw9.Mouse]
+	scrolling scrollState
+	gotoC     chan string // paths of images to display, from the acme list
+	ctlC      chan ctlRequest
+	snarfC    chan []string  // images copied to the snarf buffer, with -snarf
+	allIcons  func() []*Icon // the icons of the bottom view, for ctl
+	picked    *Icon          // the image chosen with -pick, which ends all the views
+
+	fullscreen bool            // presenting: black background and no overlays
+	windowed   image.Rectangle // the window before fullscreen, to restore it
+	windowBg   ScreenImage     // the background before fullscreen
 }
 
 func usage() {
@@ -83,10 +205,15 @@ func usage() {
 Flags:
 `, progName, progName)
 	flag.PrintDefaults()
-	os.Exit(2)
+	os.Exit(exitError)
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs the viewer and returns the exit code.
+func run() int {
 	log.SetPrefix("")
 	log.SetFlags(0)
 	flag.Usage = usage
@@ -95,11 +222,11 @@ func main() {
 	if *enableProfiler {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
-			log.Fatal("could not create CPU profile: ", err)
+			fatal("could not create CPU profile: ", err)
 		}
 		defer f.Close()
 		if err := pprof.StartCPUProfile(f); err != nil {
-			log.Fatal("could not start CPU profile: ", err)
+			fatal("could not start CPU profile: ", err)
 		}
 		defer pprof.StopCPUProfile()
 	}
@@ -107,14 +234,43 @@ func main() {
 	var ok bool
 	windowSize, ok = stringToPoint(*windowSizeFlag)
 	if !ok {
-		log.Fatalf("cannot compute window size from %s", *windowSizeFlag)
+		fatalf("cannot compute window size from %s", *windowSizeFlag)
+	}
+
+	monitorSize, ok = stringToPoint(*monitorFlag)
+	if !ok {
+		fatalf("cannot compute monitor size from %s", *monitorFlag)
+	}
+
+	var err error
+	if collides, err = parseCollision(*onCollision); err != nil {
+		fatal(err)
+	}
+	if err := checkRenameTemplate(*renameTo); err != nil {
+		fatal(err)
+	}
+	if err := checkPrintFlags(); err != nil {
+		fatal(err)
+	}
+	if _, err := parseMontageBg(*montageBg); err != nil {
+		fatal(err)
+	}
+	if _, err := parseSortKey(*sortKey); err != nil {
+		fatal(err)
+	}
+	sessionGroups.names = splitGroups(*groupNames)
+
+	if displayProfile, err = loadDisplayProfile(*iccFile); err != nil {
+		fatal(err)
 	}
 
 	iconSize, ok = stringToPoint(*iconSizeFlag)
 	if !ok {
-		log.Fatalf("cannot compute icon size from %s", *iconSizeFlag)
+		fatalf("cannot compute icon size from %s", *iconSizeFlag)
 	}
 
+	drawMem.limit = int64(*drawMemLimit) << 20
+
 	if *setMemoryLimit {
 		debug.SetMemoryLimit(1 * 1024 * 1024) // or GOMEMLIMIT=1GiB
 	}
@@ -123,66 +279,433 @@ func main() {
 		log.SetOutput(io.Discard)
 	}
 
+	if slices.ContainsFunc(flag.Args(), isRemote) {
+		*remote = true
+	}
+	if *remote {
+		// more and larger pages compensate for the latency
+		cachePages = 9
+		prefetchDepth = 2
+		fetchPool.resize(32)
+	}
+
 	if *fast {
 		fastScaler = xdraw.NearestNeighbor
 		bestScaler = xdraw.BiLinear
 	}
 
+	addAcceptedFormats(*extraFormats)
+
+	if *cacheDir != "" {
+		c, err := openDiskCache(*cacheDir)
+		if err != nil {
+			fatal(err)
+		}
+		persistentCache = c
+		limit := int64(*cacheSize) << 20
+		if *cacheGC {
+			files, freed, err := c.GC(limit)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Printf("removed %d files, %dMB\n", files, freed>>20)
+			return 0
+		}
+		if imageIndex, err = openCacheIndex(*cacheDir); err != nil {
+			fatal(err)
+		}
+		go func() {
+			if files, freed, err := c.GC(limit); err != nil {
+				log.Printf("%v", err)
+			} else if *verbose && files > 0 {
+				log.Printf("disk cache: removed %d files, %dMB", files, freed>>20)
+			}
+		}()
+	} else if *cacheGC {
+		fatalf("-cachegc needs -cachedir")
+	}
+
+	var journalOps []journalOp
+	if *journalFile != "" {
+		j, ops, err := OpenJournal(*journalFile)
+		if err != nil {
+			fatal(err)
+		}
+		if len(ops) > 0 {
+			q := fmt.Sprintf("%s: replay %d operations of a previous session?", *journalFile, len(ops))
+			if askYesNo(q) {
+				journalOps = ops
+			} else {
+				j.Clear()
+			}
+		}
+		journal = j
+		defer journal.Close()
+	}
+
+	if *collateLang != "" {
+		c, err := newCollator(*collateLang, *foldNames)
+		if err != nil {
+			fatal(err)
+		}
+		collator = c
+	}
+
+	var markRules []markRule
+	if *markIfExpr != "" {
+		rules, err := parseMarkIf(*markIfExpr)
+		if err != nil {
+			fatal(err)
+		}
+		markRules = rules
+	}
+
+	paths := flag.Args()
+	var docRefs []*docRef
+	if *docFile != "" {
+		if flag.NArg() != 0 {
+			fatal("-doc does not accept files")
+		}
+		refs, err := readDocImages(*docFile)
+		if err != nil {
+			fatal(err)
+		}
+		paths = nil
+		for _, r := range refs {
+			paths = append(paths, r.path)
+		}
+		docRefs = refs
+		*rawOrder = true
+	}
+	if *albumName != "" {
+		if flag.NArg() != 0 {
+			fatal("-album does not accept files")
+		}
+		a, err := openAlbum(*albumName)
+		if err != nil {
+			fatal(err)
+		}
+		paths, *onlyExpr, *sortKey = a.Paths, a.Only, a.Sort
+	}
+	if *saveAlbumAs != "" {
+		if len(paths) == 0 {
+			fatal("-savealbum needs files or directories")
+		}
+		a := album{Paths: slices.Clone(paths), Only: *onlyExpr, Sort: *sortKey}
+		if err := saveAlbum(*saveAlbumAs, a); err != nil {
+			fatal(err)
+		}
+		log.Printf("saved album %s", *saveAlbumAs)
+	}
+	var onlyRules []markRule
+	if *onlyExpr != "" {
+		rules, err := parseMarkIf(*onlyExpr)
+		if err != nil {
+			fatal(err)
+		}
+		onlyRules = rules
+	}
+
+	if *benchmark {
+		runBenchmark(flag.Args(), os.Stdout)
+		return 0
+	}
+	if *renderDir != "" {
+		if err := runRender(flag.Args(), *renderDir); err != nil {
+			fatal(err)
+		}
+		return 0
+	}
+
 	var icons []*Icon
-	for _, p := range flag.Args() {
-		icons = append(icons, addImagesOfPath(p)...)
+	var latestDir string
+	if *pipeName != "" {
+		if flag.NArg() != 0 {
+			fatal("-pipe does not accept files")
+		}
+		dir, err := os.MkdirTemp("", progName)
+		if err != nil {
+			fatalf("-pipe: %v", err)
+		}
+		log.Printf("frames from %s are saved in %s", *pipeName, dir)
+		go ingestFrames(*pipeName, dir)
+		latestDir = dir
+	} else if *latest {
+		if flag.NArg() != 1 {
+			fatal("-latest needs exactly one directory")
+		}
+		if info, err := os.Stat(flag.Arg(0)); err != nil || !info.IsDir() {
+			fatalf("-latest: %s is not a directory", flag.Arg(0))
+		}
+		latestDir = flag.Arg(0)
 	}
-	if len(icons) == 0 {
-		os.Exit(0)
+
+	var scanner *Scanner
+	scanning := false
+	if *diffMode {
+		if flag.NArg() != 2 {
+			fatal("-diff needs exactly two directories")
+		}
+		var err error
+		if icons, err = diffDirs(flag.Arg(0), flag.Arg(1)); err != nil {
+			fatal(err)
+		}
+		if len(icons) == 0 {
+			return exitNoneMarked
+		}
+	} else if latestDir == "" {
+		scanner = StartScanner(paths)
+		icons, scanning = collectScan(scanner, scanQuietTime)
+		if !scanning && len(icons) == 0 {
+			return exitNoneMarked
+		}
 	}
 
-	connectToPlumber()
-	dctl := connectToDisplay(windowSize)
+	var dctl *DisplayControl
+	var replayScreen *fakeScreen
+	replayDone := make(chan struct{})
+	if *replayFile != "" {
+		f, err := os.Open(*replayFile)
+		if err != nil {
+			fatalf("replay: %v", err)
+		}
+		events, err := readInputLog(f)
+		f.Close()
+		if err != nil {
+			fatalf("replay: %v", err)
+		}
+		var in *fakeInput
+		dctl, replayScreen, in = newFakeDisplayControl(image.Rectangle{Max: windowSize})
+		replayInput(events, replayScreen, in, replayDone)
+	} else {
+		connectToPlumber()
+		dctl = connectToDisplay(windowSize)
+	}
+	if *recordFile != "" {
+		f, err := os.Create(*recordFile)
+		if err != nil {
+			fatalf("record: %v", err)
+		}
+		defer f.Close()
+		dctl.recordInput(f)
+	}
 	dctl.cls()
+	if *lowBandwidth {
+		uploads = newBatchUploader(dctl.screen)
+	}
+
+	if scanning {
+		// browsing while scanning is possible only in the icons view
+		// and without sorting, as the order is not final.
+		browseEarly := !*startSingle && *rawOrder && len(onlyRules) == 0 && *startCmds == ""
+		icons, scanning = dctl.waitForScan(scanner, icons, browseEarly)
+		if len(icons) == 0 {
+			return exitNoneMarked
+		}
+	}
+	if *readRatings {
+		dctl.showWaitingAndCall(func() {
+			readXMPs(icons)
+		})
+	}
+	if len(onlyRules) > 0 {
+		dctl.showWaitingAndCall(func() {
+			icons = filterIcons(icons, onlyRules)
+		})
+		if len(icons) == 0 {
+			log.Print("only: no images satisfy the conditions")
+			return exitNoneMarked
+		}
+	}
+	if !*rawOrder {
+		if err := sortIcons(icons, *sortKey); err != nil {
+			fatal(err)
+		}
+	}
+	if len(docRefs) > 0 {
+		noteDocRefs(icons, docRefs, *docFile)
+	}
+	if len(journalOps) > 0 {
+		log.Printf("journal: applied %d operations", applyJournal(icons, journalOps))
+	}
+	if len(markRules) > 0 {
+		dctl.showWaitingAndCall(func() {
+			log.Printf("markif: marked %d images", markIf(icons, markRules))
+		})
+	}
+	var start startState
+	if *startCmds != "" && latestDir == "" {
+		if icons, start, err = runStartCmds(icons, *startCmds); err != nil {
+			fatal(err)
+		}
+	}
+	if *acmeMarked {
+		dctl.gotoC = make(chan string, 1)
+		if l, err := openAcmeList(icons, dctl.gotoC); err != nil {
+			log.Printf("acme: %v", err)
+		} else {
+			markedList = l
+		}
+	}
 
-	grid := NewGrid(dctl.display.Image.Bounds(), iconSize, padding)
+	if *orientImages && !isFlagSet("i") && mostlyPortrait(icons[:min(len(icons), orientSample)]) {
+		iconSize = image.Pt(iconSize.Y, iconSize.X)
+	}
+	grid := NewGrid(dctl.screen.Bounds(), iconSize, padding)
 
 	var views []View
-	if *startSingle {
-		sv := NewSingleView(icons, 0, grid.area)
+	var lv *LatestView
+	if latestDir != "" {
+		lv = NewLatestView(latestDir, grid.area)
+		lv.Connect(dctl)
+		views = append(views, lv)
+		dctl.allIcons = func() []*Icon { return lv.icons }
+	} else if *startSingle || start.single {
+		sv := NewSingleView(icons, start.at, grid.area)
 		sv.Connect(dctl)
 		views = append(views, sv)
+		dctl.allIcons = func() []*Icon { return sv.icons }
 	} else {
-		iv := NewIconsView(icons, grid, *pageSize)
+		t := *iconsCache
+		if t.pageSize <= 0 && *pageSize > 0 {
+			t.pageSize = *pageSize
+		}
+		if *remote && t.pageSize <= 0 {
+			t.pageSize = 2 * grid.Area()
+		}
+		iv := NewIconsView(icons, grid, t)
+		if start.at > 0 {
+			iv.Goto(start.at)
+		}
+		if scanning {
+			iv.Follow(scanner)
+		}
 		iv.Connect(dctl)
 		views = append(views, iv)
+		dctl.allIcons = func() []*Icon { return iv.icons }
+		if *snarfWatch {
+			dctl.snarfC = make(chan []string, 1)
+			go dctl.watchSnarf(dctl.snarfC)
+		}
 	}
 
-	for len(views) > 0 {
-		v := views[len(views)-1]
-		v.Attach(dctl.display.Image.Bounds())
-		if nv := v.Handle(); nv != nil {
-			nv.Connect(dctl)
-			views = append(views, nv)
-		} else {
-			views = views[0 : len(views)-1]
-			if len(views) > 0 {
-				syncViewsOnExit(v, views[len(views)-1])
-			}
+	if *ctlService != "" {
+		dctl.ctlC = make(chan ctlRequest)
+		if err := serveCtl(*ctlService, dctl.ctlC); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+
+	// replays paint synchronously, so that the operations are deterministic
+	if replayScreen == nil {
+		dctl.startPainter()
+	}
+	viewsDone := make(chan struct{})
+	go func() {
+		defer close(viewsDone)
+		runViews(dctl, views)
+	}()
+	select {
+	case <-viewsDone:
+	case <-replayDone:
+		// the log may end before the user exits
+		select {
+		case <-viewsDone:
+		case <-time.After(time.Second):
+		}
+	}
+	dctl.stopPainter()
+	if replayScreen != nil {
+		for _, op := range replayScreen.Ops {
+			fmt.Println(op)
 		}
 	}
 
 	if *enableProfiler {
 		f, err := os.Create(*memprofile)
 		if err != nil {
-			log.Fatal("could not create memory profile: ", err)
+			fatal("could not create memory profile: ", err)
 		}
 		defer f.Close()
 		runtime.GC()
 		if err := pprof.WriteHeapProfile(f); err != nil {
-			log.Fatal("could not write memory profile: ", err)
+			fatal("could not write memory profile: ", err)
+		}
+	}
+
+	if lv != nil {
+		icons = lv.icons
+	}
+	if scanning {
+		scanner.Cancel()
+		icons = scanner.Found()
+	}
+	runExitHook(icons)
+	if *viewStatsFile != "" {
+		if err := writeViewStats(*viewStatsFile, icons); err != nil {
+			log.Print(err)
+		}
+	}
+	if *groupDir != "" {
+		if err := writeGroups(*groupDir, icons); err != nil {
+			log.Print(err)
+		}
+	}
+	if imageIndex != nil {
+		if err := imageIndex.save(); err != nil {
+			log.Print(err)
 		}
 	}
 
+	if *pickMode {
+		if *printSummary {
+			writeSummary(os.Stderr, icons)
+		}
+		if dctl.picked == nil {
+			return exitNoneMarked
+		}
+		fmt.Println(dctl.picked.path)
+		return exitMarked
+	}
 	if *outputMarked {
 		for _, icon := range icons {
-			if icon.marked {
-				fmt.Println(icon.path)
+			if icon.Marked() {
+				for _, f := range icon.Files() {
+					fmt.Println(f)
+				}
+			}
+		}
+	}
+	if *printSummary {
+		writeSummary(os.Stderr, icons)
+	}
+	return exitCode(icons)
+}
+
+// runViews runs the stack of views until the last one exits.
+// A view that exits is freed, so that its images are released
+// on the display server before the view below it takes its place.
+func runViews(dctl *DisplayControl, views []View) {
+	dctl.queueInput()
+	for len(views) > 0 {
+		v := views[len(views)-1]
+		v.Attach(dctl.screen.Bounds())
+		nv := v.Handle()
+		dctl.waitPaint()
+		if nv != nil {
+			nv.Connect(dctl)
+			views = append(views, nv)
+		} else {
+			views = views[0 : len(views)-1]
+			v.Free()
+			if dctl.picked != nil {
+				for i := len(views) - 1; i >= 0; i-- {
+					views[i].Free()
+				}
+				return
+			}
+			if len(views) > 0 {
+				syncViewsOnExit(v, views[len(views)-1])
 			}
 		}
 	}
@@ -191,102 +714,124 @@ func main() {
 // syncViewsOnExit is an ugly hack to sync the position of
 // the singleview with the page of iconsview.
 // It is simpler than augment the View interface with some callbacks.
+// The singleview may show a subset of the icons, like the marked ones,
+// so the image is looked up by identity rather than by index.
 func syncViewsOnExit(viewExited, viewToGo View) {
-	if sv, ok1 := viewExited.(*SingleView); ok1 {
-		if iv, ok2 := viewToGo.(*IconsView); ok2 {
-			iv.offset.GotoPage(iv.offset.PageOfItem(sv.at))
+	if sv, ok1 := viewExited.(*SingleView); ok1 && sv.at < len(sv.icons) {
+		var offset *Offset
+		var icons []*Icon
+		switch v := viewToGo.(type) {
+		case *IconsView:
+			offset, icons = v.offset, v.icons
+			v.current = sv.icons[sv.at]
+		case *MarkedView:
+			offset, icons = v.offset, v.icons
+			v.current = sv.icons[sv.at]
+		default:
+			return
+		}
+		if i := slices.Index(icons, sv.icons[sv.at]); i >= 0 {
+			offset.GotoPage(offset.PageOfItem(i))
 		}
 	}
 }
 
+// cacheFlag defines a cacheTuning flag with the defaults.
+func cacheFlag(name, usage string) *cacheTuning {
+	t := defaultTuning
+	flag.Var(&t, name, usage)
+	return &t
+}
+
 // isImageFile checks the file suffix to check if it is an image.
 func isImageFile(name string) bool {
-	return slices.Contains(acceptedFormats, strings.ToLower(filepath.Ext(name)))
+	_, ok := acceptedFormats[fileSuffix(name)]
+	return ok
 }
 
-// addImagesOfPath adds the image at path, descending it if a directory.
-func addImagesOfPath(name string) []*Icon {
-	info, err := os.Stat(name)
-	if err != nil {
-		log.Printf("addImagesOfPath: cannot stat file: %v", err)
-		return nil
-	}
-	if info.IsDir() {
-		return scanForImages(name)
-	}
-	if !info.Mode().IsRegular() {
-		log.Printf("addImagesOfPath: ignoring special file %s", name)
-		return nil
-	}
-	if !isImageFile(name) {
-		return nil
-	}
-	return []*Icon{NewIcon(name)}
+// fileSuffix returns the suffix of the file name for the lookups of the
+// formats: lower case and in the composed form of Unicode, as file systems
+// like that of macOS keep the names decomposed.
+func fileSuffix(name string) string {
+	return normSuffix(filepath.Ext(name))
 }
 
-// scanForImages walks dir and adds the images found.
-func scanForImages(dir string) []*Icon {
-	var icons []*Icon
+// normSuffix returns the suffix ext lower case and composed.
+func normSuffix(ext string) string {
+	return strings.ToLower(norm.NFC.String(ext))
+}
 
-	walkFn := func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+// isSupportedType checks if the MIME type is one of the accepted formats.
+func isSupportedType(mimeType string) bool {
+	for _, t := range acceptedFormats {
+		if t != "" && t == mimeType {
+			return true
 		}
-		if d.IsDir() {
-			return nil
+	}
+	return false
+}
+
+// addAcceptedFormats adds the comma separated suffixes to the accepted formats.
+// The leading dot is optional. The type of these files is detected from their contents.
+func addAcceptedFormats(suffixes string) {
+	for _, ext := range strings.Split(suffixes, ",") {
+		ext = normSuffix(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
 		}
-		if !d.Type().IsRegular() {
-			log.Printf("scanForImages: ignoring special file %s", path)
-			return nil
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
 		}
-		if !isImageFile(path) {
-			return nil
+		if _, ok := acceptedFormats[ext]; !ok {
+			acceptedFormats[ext] = ""
 		}
-		icons = append(icons, NewIcon(path))
-		return nil
-	}
-
-	if err := filepath.WalkDir(dir, walkFn); err != nil {
-		log.Printf("scanForImages: %s: %v", dir, err)
 	}
-
-	return icons
 }
 
 func connectToDisplay(dims image.Point) *DisplayControl {
 	errch := make(chan error)
 	disp, err := draw9.Init(errch, "", progName, fmt.Sprintf("%dx%d", dims.X, dims.Y))
 	if err != nil {
-		log.Fatalf("display: cannot connect: %v", err)
+		fatalf("display: cannot connect: %v", err)
 	}
-	kctl := disp.InitKeyboard()
+	kctl := watchModifiers(disp.InitKeyboard())
 	mctl := disp.InitMouse()
 
+	return newDisplayControl(&drawScreen{display: disp, mctl: mctl}, errch, mctl, kctl)
+}
+
+// newDisplayControl returns a DisplayControl for the screen and the input devices.
+func newDisplayControl(scr Screen, errch chan error, mctl *draw9.Mousectl, kctl *draw9.Keyboardctl) *DisplayControl {
 	return &DisplayControl{
-		display:     disp,
-		errch:       errch,
-		mctl:        mctl,
-		kctl:        kctl,
-		bgColor:     disp.AllocImageMix(darkgrey, darkgrey),
-		borderColor: disp.AllocImageMix(darkgrey, yellow),
-		fontColor:   disp.AllocImageMix(darkgrey, yellow),
+		screen:       scr,
+		errch:        errch,
+		mctl:         mctl,
+		kctl:         kctl,
+		bgColor:      scr.AllocColor(darkgrey, darkgrey),
+		borderColor:  scr.AllocColor(darkgrey, yellow),
+		fontColor:    scr.AllocColor(darkgrey, yellow),
+		warnColor:    scr.AllocColor(red, red),
+		scrollColor:  scr.AllocColor(grey, grey),
+		currentColor: scr.AllocColor(cyan, cyan),
+		blackColor:   scr.AllocColor(black, black),
 	}
 }
 
 // showWaitingAndCall changes the cursor to the waiting one and executes fn
 func (dctl *DisplayControl) showWaitingAndCall(fn func()) {
-	if err := dctl.display.SwitchCursor(lockarrow); err != nil {
+	if err := dctl.screen.SwitchCursor(lockarrow); err != nil {
 		log.Printf("failed to switch cursor: %v", err)
 	}
 	fn()
-	if err := dctl.display.SwitchCursor(nil); err != nil {
+	if err := dctl.screen.SwitchCursor(nil); err != nil {
 		log.Printf("failed to switch cursor: %v", err)
 	}
 }
 
 func (dctl *DisplayControl) cls() {
-	dctl.display.Image.Draw(dctl.display.Image.Bounds(), dctl.bgColor, nil, image.Point{})
-	dctl.display.Flush()
+	dctl.painted = nil
+	dctl.screen.Draw(dctl.screen.Bounds(), dctl.bgColor, image.Point{})
+	dctl.screen.Flush()
 }
 
 func connectToPlumber() {
@@ -329,3 +874,12 @@ func stringToPoint(s string) (image.Point, bool) {
 	}
 	return image.Pt(x, y), true
 }
+
+// isFlagSet reports whether the flag was set in the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
@@ -4,6 +4,7 @@ import (
 	"image"
 	"log"
 	"slices"
+	"time"
 
 	draw9 "9fans.net/go/draw"
 )
@@ -11,33 +12,37 @@ import (
 // MarkedView is a View that show the marked images as thumbnails.
 type MarkedView struct {
 	icons      []*Icon
-	iconsCache CachedSlice[*IconImage]
+	iconsCache CachedSlice[*Icon, *IconImage]
 	offset     *Offset
-	pageSize   int
+	tuning     cacheTuning
+	gp         *gridPaint
+	current    *Icon     // the icon last displayed in the single view
+	lastInput  time.Time // when the user last pressed a key or moved the mouse
+	idle       *idleLoad // loads more while the user is idle
 
 	dctl *DisplayControl
 }
 
-func NewMarkedView(icons []*Icon, grid *Grid, pageSize int) *MarkedView {
-	if pageSize == 0 {
-		pageSize = grid.Area()
-	}
+func NewMarkedView(icons []*Icon, grid *Grid, t cacheTuning) *MarkedView {
 	return &MarkedView{
-		icons:    icons,
-		offset:   NewOffset(grid, len(icons)),
-		pageSize: pageSize,
+		icons:  icons,
+		offset: NewOffset(grid, len(icons)),
+		tuning: t.withDefaults(grid.Area()),
+		gp:     new(gridPaint),
+		idle:   new(idleLoad),
 	}
 }
 
 func (mv *MarkedView) Connect(dctl *DisplayControl) {
 	mv.dctl = dctl
+	dctl.waitPaint()
 	if mv.iconsCache != nil {
 		mv.iconsCache.Free()
 	}
-	images := NewIconImages(mv.icons, func(img image.Image) (*draw9.Image, error) {
-		return FitFast(dctl.display, img, image.Rectangle{image.Point{}, mv.offset.grid.iconSize})
+	images := iconImageMaker(func(img image.Image) (ScreenImage, error) {
+		return FitFast(dctl.screen, img, image.Rectangle{image.Point{}, mv.offset.grid.iconSize})
 	})
-	mv.iconsCache = NewCachedSlicePaged[*IconImage]("marked", images, mv.pageSize)
+	mv.iconsCache = NewCachedSlicePaged("marked", mv.icons, images, mv.tuning)
 }
 
 func (mv *MarkedView) Attach(r image.Rectangle) {
@@ -48,6 +53,7 @@ func (mv *MarkedView) Attach(r image.Rectangle) {
 }
 
 func (mv *MarkedView) Free() {
+	mv.dctl.waitPaint()
 	mv.iconsCache.Free()
 }
 
@@ -57,48 +63,74 @@ func (mv *MarkedView) Handle() View {
 	}
 
 	dctl := mv.dctl
+	var upgradeC <-chan time.Time
+	if *lowBandwidth {
+		t := time.NewTicker(lowbwIdle / 2)
+		defer t.Stop()
+		upgradeC = t.C
+	}
+	var idleC <-chan time.Time
+	if *idleLoading {
+		t := time.NewTicker(idleLoadTick)
+		defer t.Stop()
+		idleC = t.C
+	}
 	mv.paint(dctl)
 	for {
 		select {
 		case err := <-dctl.errch:
 			log.Printf("display: %v", err)
 		case k := <-dctl.kctl.C:
+			mv.lastInput = time.Now()
 			switch k {
 			case 'q', 'b', escKey: // back
 				return nil
+			case 'S': // snapshot
+				dctl.snapshot()
 			case upArrowKey: // scroll up
-				mv.offset.MoveUpRow()
+				dctl.scroll(mv.offset, -1, 0)
 				mv.paint(dctl)
 			case downArrowKey: // scroll down
-				mv.offset.MoveDownRow()
+				dctl.scroll(mv.offset, 1, 0)
+				mv.paint(dctl)
+			case leftArrowKey: // prev page, 10 with shift, first with ctl
+				mv.offset.StepPages(arrowStep(-1, len(mv.icons)))
 				mv.paint(dctl)
-			case leftArrowKey: // prev page
-				mv.offset.GotoPage(mv.offset.CurrentPage() - 1)
+			case rightArrowKey: // next page, 10 with shift, last with ctl
+				mv.offset.StepPages(arrowStep(1, len(mv.icons)))
 				mv.paint(dctl)
-			case rightArrowKey: // next page
-				mv.offset.GotoPage(mv.offset.CurrentPage() + 1)
+			case homeKey: // first page
+				mv.offset.StepPages(-len(mv.icons))
+				mv.paint(dctl)
+			case endKey: // last page
+				mv.offset.StepPages(len(mv.icons))
 				mv.paint(dctl)
 			}
 		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			mv.lastInput = time.Now()
+			if m := dctl.mctl.Mouse; m.Buttons&7 != 0 && m.Point.In(mv.offset.grid.Scrollbar()) {
+				dctl.scrollWithMouse(mv.offset, func() { mv.paint(dctl) })
+				continue
+			}
 			switch dctl.mctl.Mouse.Buttons {
-			case 1: // select image
+			case 1: // select image, or pick it with -pick
 				if i, ok := mv.offset.At(dctl.mctl.Mouse.Point); ok {
+					if *pickMode {
+						dctl.picked = mv.icons[i]
+						return nil
+					}
 					return NewSingleView(mv.icons, i, mv.offset.grid.area)
 				}
 			case 2: // view menu
-				switch draw9.MenuHit(2, dctl.mctl, bt2menu, nil) {
+				switch dctl.screen.MenuHit(2, bt2menu) {
 				case 0: // mark
 					if i, ok := mv.offset.At(dctl.mctl.Mouse.Point); ok {
-						if icon, ok := mv.iconsCache.At(i); ok {
-							icon.ToggleMarked()
-						}
+						mv.icons[i].ToggleMarked()
 					}
 					mv.paint(dctl)
 				case 1: // plumb
 					if i, ok := mv.offset.At(dctl.mctl.Mouse.Point); ok {
-						if icon, ok := mv.iconsCache.At(i); ok {
-							plumbImage(icon.path)
-						}
+						plumbImage(mv.icons[i].path)
 					}
 				case 2:
 					// nop
@@ -115,32 +147,58 @@ func (mv *MarkedView) Handle() View {
 				}
 			case 4: // mark image
 				if i, ok := mv.offset.At(dctl.mctl.Mouse.Point); ok {
-					if icon, ok := mv.iconsCache.At(i); ok {
-						icon.ToggleMarked()
-					}
+					mv.icons[i].ToggleMarked()
 				}
 				mv.paint(dctl)
 			case scrollWheelUp: // scroll up
-				mv.offset.MoveUpRow()
+				dctl.scroll(mv.offset, 0, -1)
 				mv.paint(dctl)
 			case scrollWheelDown: // scroll down
-				mv.offset.MoveDownRow()
+				dctl.scroll(mv.offset, 0, 1)
 				mv.paint(dctl)
 			}
+		case <-upgradeC:
+			if time.Since(mv.lastInput) > lowbwIdle {
+				from, to := mv.offset.Visible()
+				// overlap the uploads of the next page with the idle time
+				mv.iconsCache.Prefetch(to, to+(to-from))
+				dctl.waitPaint()
+				if upgradeLowDepth(mv.iconsCache, from, to) {
+					dctl.invalidate()
+					mv.paint(dctl)
+				}
+			}
+		case <-idleC:
+			if time.Since(mv.lastInput) > idleLoadAfter {
+				from, to := mv.offset.Visible()
+				mv.idle.load(mv.iconsCache, mv.icons, from, to)
+			}
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			dctl.applyCtl(req)
+			mv.paint(dctl)
+		case path := <-dctl.gotoC: // looked at in the acme list
+			if i := indexOfPath(mv.icons, path); i >= 0 {
+				return NewSingleView(mv.icons, i, mv.offset.grid.area)
+			}
 		case <-dctl.mctl.Resize:
-			if err := dctl.display.Attach(draw9.RefNone); err != nil {
-				log.Fatalf("display: failed to attach: %v", err)
+			dctl.invalidate()
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
 			}
-			mv.Attach(dctl.display.Image.Bounds())
+			mv.Attach(dctl.screen.Bounds())
 			mv.paint(dctl)
 		}
 	}
 }
 
+// paint posts a request to paint the visible icons.
 func (mv *MarkedView) paint(dctl *DisplayControl) {
-	dctl.showWaitingAndCall(func() {
-		from, to := mv.offset.Visible()
-		images := slices.Collect(Get(mv.iconsCache, from, to))
-		paintIcons(dctl, mv.offset.grid, images)
+	offset, cache, gp, current := mv.offset.snapshot(), mv.iconsCache, mv.gp, mv.current
+	dctl.post(func() {
+		dctl.showWaitingAndCall(func() {
+			from, to := offset.Visible()
+			images := slices.Collect(Get(cache, from, to))
+			paintIcons(dctl, offset, images, current, gp, true)
+		})
 	})
 }
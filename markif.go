@@ -0,0 +1,207 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// markRule is a condition of -markif, like size>5MB.
+type markRule struct {
+	key   string // size, width, height, date, name, tag, rating or label
+	op    string // <, <=, =, >=, > or ~ for name globs
+	num   int64
+	date  time.Time
+	value string
+}
+
+var markRuleRe = regexp.MustCompile(`^(\w+)\s*(<=|>=|<|>|=|~)\s*(.+)$`)
+
+// sizeUnits are the units of sizes in markRules.
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}}
+
+// parseMarkIf parses a -markif expression. The conditions are separated
+// by commas and an image must satisfy all of them.
+func parseMarkIf(expr string) ([]markRule, error) {
+	var rules []markRule
+	for _, cond := range strings.Split(expr, ",") {
+		cond = strings.TrimSpace(cond)
+		m := markRuleRe.FindStringSubmatch(cond)
+		if m == nil {
+			return nil, fmt.Errorf("markif: bad condition %q", cond)
+		}
+		r := markRule{key: m[1], op: m[2], value: strings.TrimSpace(m[3])}
+		var err error
+		switch {
+		case r.key == "name":
+			if r.op != "=" && r.op != "~" {
+				return nil, fmt.Errorf("markif: name takes = or ~, not %s", r.op)
+			}
+			r.value = matchForm(r.value)
+			_, err = filepath.Match(r.value, "")
+		case r.op == "~":
+			return nil, fmt.Errorf("markif: ~ is only for name")
+		case r.key == "tag" || r.key == "label":
+			if r.op != "=" {
+				return nil, fmt.Errorf("markif: %s takes =, not %s", r.key, r.op)
+			}
+		case r.key == "rating":
+			r.num, err = strconv.ParseInt(r.value, 10, 64)
+		case r.key == "size":
+			r.num, err = parseSize(r.value)
+		case r.key == "width" || r.key == "height":
+			r.num, err = strconv.ParseInt(r.value, 10, 64)
+		case r.key == "date":
+			r.date, err = time.ParseInLocation(time.DateOnly, r.value, time.Local)
+		default:
+			return nil, fmt.Errorf("markif: unknown key %q", r.key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("markif: %s: %w", cond, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// parseSize parses sizes like 5MB.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(s)
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			return int64(f * float64(u.n)), err
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// needsHeader reports whether the rule needs the header of the image.
+func (r markRule) needsHeader() bool {
+	return r.key == "width" || r.key == "height" || r.key == "date"
+}
+
+// match reports whether the icon satisfies the rule. h is the header of
+// the image, if read.
+func (r markRule) match(icon *Icon, h imageHeader, hok bool) bool {
+	if r.needsHeader() && !hok {
+		return false
+	}
+	var c int
+	switch r.key {
+	case "name":
+		name := matchForm(filepath.Base(icon.path))
+		if r.op == "~" {
+			ok, _ := filepath.Match(r.value, name)
+			return ok
+		}
+		return name == r.value
+	case "tag":
+		return imageTags.Has(icon.path, r.value)
+	case "label":
+		_, label := icon.Rating()
+		return strings.EqualFold(label, r.value)
+	case "rating":
+		rating, _ := icon.Rating()
+		c = cmp.Compare(int64(rating), r.num)
+	case "size":
+		c = cmp.Compare(icon.size, r.num)
+	case "width":
+		c = cmp.Compare(int64(h.bounds.Dx()), r.num)
+	case "height":
+		c = cmp.Compare(int64(h.bounds.Dy()), r.num)
+	case "date":
+		c = h.date.Compare(r.date)
+	}
+	switch r.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	default:
+		return c > 0
+	}
+}
+
+// markIf marks the icons that satisfy all the rules. It returns the number
+// of icons marked.
+func markIf(icons []*Icon, rules []markRule) int {
+	marked := 0
+	for i, ok := range matchRules(icons, rules) {
+		if ok && !icons[i].Marked() {
+			icons[i].setMarked(true)
+			marked++
+		}
+	}
+	return marked
+}
+
+// filterIcons returns the icons that satisfy all the rules, in order.
+func filterIcons(icons []*Icon, rules []markRule) []*Icon {
+	var selected []*Icon
+	for i, ok := range matchRules(icons, rules) {
+		if ok {
+			selected = append(selected, icons[i])
+		}
+	}
+	return selected
+}
+
+// matchRules reports for each icon whether it satisfies all the rules. Only
+// the metadata that the rules need are read, in parallel.
+func matchRules(icons []*Icon, rules []markRule) []bool {
+	needSize, needHeader, needXMP := false, false, false
+	for _, r := range rules {
+		needSize = needSize || r.key == "size"
+		needHeader = needHeader || r.needsHeader()
+		needXMP = needXMP || r.key == "rating" || r.key == "label"
+	}
+	if needSize {
+		statSizes(icons)
+	}
+	if needXMP {
+		readXMPs(icons)
+	}
+
+	const workers = 16
+	work := make(chan int)
+	matched := make([]bool, len(icons))
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				icon := icons[i]
+				var h imageHeader
+				var hok bool
+				if _, remote := remoteSourceOf(icon.path); needHeader && !remote {
+					h, hok = readImageHeader(icon.path)
+				}
+				all := true
+				for _, r := range rules {
+					all = all && r.match(icon, h, hok)
+				}
+				matched[i] = all
+			}
+		}()
+	}
+	for i := range icons {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return matched
+}
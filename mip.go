@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"log"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// mipSize is the largest dimension of the intermediate resolution of images.
+	mipSize = 2048
+	// mipKind is the kind of the intermediate resolutions in the persistent cache.
+	mipKind = "mip"
+)
+
+// decodeMip returns the intermediate resolution of the image in data, which fits
+// in mipSize x mipSize. It is taken from the persistent cache, or computed from
+// the original and stored. Views that display images up to mipSize scale from it,
+// so that refits after resizes do not decode the original each time.
+// The bool is false if the image is not larger than the intermediate or if
+// there is no persistent cache.
+func decodeMip(data []byte) (image.Image, bool) {
+	if persistentCache == nil {
+		return nil, false
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || max(cfg.Width, cfg.Height) <= mipSize {
+		return nil, false
+	}
+
+	key := contentKey(data)
+	if mdata, ok := persistentCache.Get(mipKind, key); ok {
+		if img, err := jpeg.Decode(bytes.NewReader(mdata)); err == nil {
+			return img, true
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	mr := bestFit(image.Rect(0, 0, mipSize, mipSize), img.Bounds())
+	mr = mr.Sub(mr.Min)
+	mip := image.NewRGBA(mr)
+	xdraw.CatmullRom.Scale(mip, mr, img, img.Bounds(), xdraw.Src, nil)
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, mip, &jpeg.Options{Quality: 92}); err != nil {
+		log.Printf("mip: encode: %v", err)
+	} else if err := persistentCache.Put(mipKind, key, b.Bytes()); err != nil {
+		log.Printf("mip: %v", err)
+	}
+	return mip, true
+}
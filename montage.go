@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// montageMax is the largest side of an image in a montage, so that
+// montages of photos stay printable and viewable.
+const montageMax = 2048
+
+// montageColors are the named backgrounds of -montagebg.
+var montageColors = map[string]color.RGBA{
+	"white":       {0xFF, 0xFF, 0xFF, 0xFF},
+	"black":       {0x00, 0x00, 0x00, 0xFF},
+	"grey":        rgbaOf(darkgrey),
+	"gray":        rgbaOf(darkgrey),
+	"transparent": {},
+}
+
+// parseMontageBg parses the background of -montagebg, a name or a hex
+// color like #336699 or #33669980 with alpha.
+func parseMontageBg(s string) (color.RGBA, error) {
+	if c, ok := montageColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("montagebg: bad color %q, use a name like white or #rrggbb", s)
+	}
+	c := color.RGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+	// image.RGBA is premultiplied
+	c.R, c.G, c.B = uint8(int(c.R)*int(c.A)/0xFF), uint8(int(c.G)*int(c.A)/0xFF), uint8(int(c.B)*int(c.A)/0xFF)
+	return c, nil
+}
+
+// parseMontageLayout parses the layout of a montage of n images: h for a
+// row, v for a column, or columns x rows like 3x2. A number of columns
+// alone takes as many rows as needed.
+func parseMontageLayout(s string, n int) (cols, rows int, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", "h":
+		return n, 1, nil
+	case "v":
+		return 1, n, nil
+	}
+	c, r, hasRows := strings.Cut(s, "x")
+	cols, err = strconv.Atoi(c)
+	if err != nil || cols < 1 {
+		return 0, 0, fmt.Errorf("montage: bad layout %q, use h, v or columns x rows like 3x2", s)
+	}
+	rows = (n + cols - 1) / cols
+	if hasRows {
+		if rows, err = strconv.Atoi(r); err != nil || rows < 1 {
+			return 0, 0, fmt.Errorf("montage: bad layout %q, use h, v or columns x rows like 3x2", s)
+		}
+		if cols*rows < n {
+			return 0, 0, fmt.Errorf("montage: %d images do not fit in %dx%d", n, cols, rows)
+		}
+	}
+	return cols, rows, nil
+}
+
+// composeMontage puts the images in cols columns and rows rows, gap pixels
+// apart and around, on bg. A row is scaled to a common height and a column
+// to a common width, the smallest, so that comparison strips line up.
+// Otherwise the cells have the size of the largest image and the images
+// are centered in them. Images are not scaled up.
+func composeMontage(imgs []image.Image, cols, rows, gap int, bg color.Color) *image.RGBA {
+	limit := image.Pt(montageMax, montageMax)
+	for _, img := range imgs {
+		switch {
+		case rows == 1:
+			limit.Y = min(limit.Y, img.Bounds().Dy())
+		case cols == 1:
+			limit.X = min(limit.X, img.Bounds().Dx())
+		}
+	}
+	scaled := make([]*image.RGBA, len(imgs))
+	var cell image.Point
+	for i, img := range imgs {
+		scaled[i] = scaleToFit(nil, img, image.Rectangle{Max: limit})
+		cell.X = max(cell.X, scaled[i].Rect.Dx())
+		cell.Y = max(cell.Y, scaled[i].Rect.Dy())
+	}
+
+	// the widths of the columns and the heights of the rows
+	widths, heights := make([]int, cols), make([]int, rows)
+	for i, s := range scaled {
+		widths[i%cols] = max(widths[i%cols], s.Rect.Dx())
+		heights[i/cols] = max(heights[i/cols], s.Rect.Dy())
+	}
+	if rows > 1 && cols > 1 {
+		for i := range widths {
+			widths[i] = cell.X
+		}
+		for i := range heights {
+			heights[i] = cell.Y
+		}
+	}
+	size := image.Pt(gap, gap)
+	for _, w := range widths {
+		size.X += w + gap
+	}
+	for _, h := range heights {
+		size.Y += h + gap
+	}
+
+	m := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(m, m.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+	y := gap
+	for r := range rows {
+		x := gap
+		for c := range cols {
+			if i := r*cols + c; i < len(scaled) {
+				s := scaled[i]
+				dr := center(image.Rect(x, y, x+widths[c], y+heights[r]), s.Rect)
+				draw.Draw(m, dr, s, s.Rect.Min, draw.Over)
+			}
+			x += widths[c] + gap
+		}
+		y += heights[r] + gap
+	}
+	for _, s := range scaled {
+		putBytes(s.Pix)
+	}
+	return m
+}
+
+// writeMontage decodes the images of the icons, composes them by the
+// layout and writes the montage to the file of -montageto, as JPEG if it
+// ends in .jpg or .jpeg, else PNG. It returns the name written.
+func writeMontage(ctx context.Context, icons []*Icon, layout string, progress func(batchStatus)) (string, error) {
+	cols, rows, err := parseMontageLayout(layout, len(icons))
+	if err != nil {
+		return "", err
+	}
+	bg, err := parseMontageBg(*montageBg)
+	if err != nil {
+		return "", err
+	}
+	imgs := make([]image.Image, len(icons))
+	runBatch(ctx, len(icons), func(i int) batchStatus {
+		var err error
+		imgs[i], err = renderIcon(icons[i])
+		return batchStatus{name: icons[i].path, err: err}
+	}, progress)
+	if ctx.Err() != nil {
+		return "", errors.New("montage: cancelled")
+	}
+	for i, img := range imgs {
+		if img == nil {
+			return "", fmt.Errorf("montage: %s cannot be decoded", icons[i].path)
+		}
+	}
+
+	m := composeMontage(imgs, cols, rows, *montageGap, bg)
+	var b bytes.Buffer
+	switch strings.ToLower(filepath.Ext(*montageFile)) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&b, m, &jpeg.Options{Quality: 90})
+	default:
+		err = png.Encode(&b, m)
+	}
+	if err != nil {
+		return "", fmt.Errorf("montage: %w", err)
+	}
+	name, err := writeExport(*montageFile, b.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("montage: %w", err)
+	}
+	return name, nil
+}
+
+// montageMarked asks for the layout and composes the marked images into
+// the montage of -montageto.
+func (dctl *DisplayControl) montageMarked(marked []*Icon) {
+	layout, ok := dctl.readText("montage, h, v or columns x rows like 3x2 (h): ", func(string) []string { return nil })
+	if !ok {
+		return
+	}
+	if _, _, err := parseMontageLayout(layout, len(marked)); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	var name string
+	err := dctl.showBatch("montage "+*montageFile, len(marked), func(ctx context.Context, progress func(batchStatus)) error {
+		var err error
+		name, err = writeMontage(ctx, marked, layout, progress)
+		return err
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	log.Printf("montage: %d images in %s", len(marked), name)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// recognizeText runs the -ocr command with the image file on its standard
+// input and returns the text it prints.
+func recognizeText(path string) (string, error) {
+	data, err := readImageFile(path)
+	if err != nil {
+		return "", fmt.Errorf("ocr: %w", err)
+	}
+	cmd := exec.Command("sh", "-c", *ocrCommand)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ocr: %s: %w", *ocrCommand, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// snarfText recognizes the text of the image and writes it to the snarf
+// buffer, so that it can be pasted in other programs.
+func (dctl *DisplayControl) snarfText(path string) {
+	var text string
+	var err error
+	dctl.showWaitingAndCall(func() {
+		text, err = recognizeText(path)
+	})
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if text == "" {
+		log.Printf("ocr: no text in %s", path)
+		return
+	}
+	if err := dctl.screen.WriteSnarf([]byte(text)); err != nil {
+		log.Printf("ocr: snarf: %v", err)
+		return
+	}
+	log.Printf("ocr: snarfed %d characters of %s", len(text), path)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+// orientSample is the number of images checked to choose the aspect of the cells.
+const orientSample = 64
+
+// exifOrientation returns the orientation tag of the exif data, 1 to 8,
+// or 0 if it is missing.
+func exifOrientation(ex *exif.Exif) int {
+	if ex == nil {
+		return 0
+	}
+	t, err := ex.Get(exif.Orientation)
+	if err != nil {
+		return 0
+	}
+	o, err := t.Int(0)
+	if err != nil || o < 1 || o > 8 {
+		return 0
+	}
+	return o
+}
+
+// orientBounds returns the bounds of an image of size r after orientation o.
+func orientBounds(r image.Rectangle, o int) image.Rectangle {
+	if o >= 5 {
+		return image.Rect(0, 0, r.Dy(), r.Dx())
+	}
+	return image.Rect(0, 0, r.Dx(), r.Dy())
+}
+
+// orient transforms img so that it is displayed upright, according
+// to the exif orientation o. Orientations 5 to 8 swap the dimensions.
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+		draw.Draw(src, src.Rect, img, img.Bounds().Min, draw.Src)
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(orientBounds(src.Rect, o))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // mirror horizontal
+				dx, dy = w-1-x, y
+			case 3: // rotate 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				dx, dy = x, h-1-y
+			case 5: // transpose
+				dx, dy = y, x
+			case 6: // rotate 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate 90 counterclockwise
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(src.Rect.Min.X+x, src.Rect.Min.Y+y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// mostlyPortrait reports whether most of the icons are portraits, after their
+// exif orientation. Only the headers of the local files are read.
+func mostlyPortrait(icons []*Icon) bool {
+	portraits, landscapes := 0, 0
+	for _, icon := range icons {
+		if _, ok := remoteSourceOf(icon.path); ok {
+			continue
+		}
+		h, ok := readImageHeader(icon.path)
+		switch r := h.bounds; {
+		case !ok:
+		case r.Dy() > r.Dx():
+			portraits++
+		case r.Dx() > r.Dy():
+			landscapes++
+		}
+	}
+	return portraits > landscapes
+}
+
+// imageHeader is the metadata of an image file that is read from its headers.
+type imageHeader struct {
+	bounds image.Rectangle // after the exif orientation
+	date   time.Time       // when the photo was taken, or else the modification time
+}
+
+// readImageHeader reads the header of the local image file, without decoding the image.
+// With -cachedir, the headers of the files that did not change since a
+// previous session are taken from the index of the cache.
+func readImageHeader(path string) (imageHeader, bool) {
+	if imageIndex != nil {
+		if e, ok := imageIndex.lookup(path); ok {
+			if h, ok := e.header(); ok {
+				return h, true
+			}
+		}
+	}
+	var h imageHeader
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("readImageHeader: %v", err)
+		return h, false
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return h, false
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return h, false
+	}
+	ex := readExif(f)
+	h.bounds = orientBounds(image.Rect(0, 0, cfg.Width, cfg.Height), exifOrientation(ex))
+	if ex != nil {
+		h.date, _ = ex.DateTime()
+	}
+	if h.date.IsZero() {
+		if info, err := f.Stat(); err == nil {
+			h.date = info.ModTime()
+		}
+	}
+	if imageIndex != nil {
+		imageIndex.update(path, func(e *indexEntry) {
+			e.Width, e.Height = cfg.Width, cfg.Height
+			e.Orient = exifOrientation(ex)
+			e.Date = h.date
+		})
+	}
+	return h, true
+}
@@ -0,0 +1,74 @@
+package main
+
+import "sync"
+
+// painter paints the views in its own goroutine, so that the input is
+// handled while a slow page loads. Only the latest paint request is kept,
+// older ones that have not started are dropped.
+type painter struct {
+	reqC chan func()
+	busy sync.WaitGroup // the running and the pending requests
+}
+
+// startPainter starts the painter goroutine of dctl.
+func (dctl *DisplayControl) startPainter() {
+	p := &painter{reqC: make(chan func(), 1)}
+	go func() {
+		for fn := range p.reqC {
+			fn()
+			p.busy.Done()
+		}
+	}()
+	dctl.painter = p
+}
+
+// stopPainter waits for the requests in progress and stops the painter.
+func (dctl *DisplayControl) stopPainter() {
+	if dctl.painter == nil {
+		return
+	}
+	dctl.waitPaint()
+	close(dctl.painter.reqC)
+	dctl.painter = nil
+}
+
+// post requests to paint with fn. It replaces the pending request, if any.
+// fn runs in the painter goroutine, so it must not use the state of the view
+// that may change meanwhile. Views pass a copy of it. Without a painter,
+// fn runs immediately.
+func (dctl *DisplayControl) post(fn func()) {
+	p := dctl.painter
+	if p == nil {
+		fn()
+		return
+	}
+	select {
+	case <-p.reqC:
+		p.busy.Done()
+	default:
+	}
+	p.busy.Add(1)
+	p.reqC <- fn
+}
+
+// invalidate makes the next paint redraw the whole window, after the window
+// has been damaged, like after a resize.
+func (dctl *DisplayControl) invalidate() {
+	dctl.waitPaint()
+	dctl.painted = nil
+}
+
+// waitPaint drops the pending paint request and waits for the running one.
+// Views call it before they free or unload images the painter may use.
+func (dctl *DisplayControl) waitPaint() {
+	p := dctl.painter
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.reqC:
+		p.busy.Done()
+	default:
+	}
+	p.busy.Wait()
+}
@@ -5,37 +5,147 @@ import (
 	"log"
 )
 
-// paintIcons draws the grid of icons.
-func paintIcons(dctl *DisplayControl, grid *Grid, icons []*IconImage) {
-	dctl.display.Image.Draw(dctl.display.Image.Bounds(), dctl.bgColor, nil, image.Point{})
+// gridPaint is what a grid view has painted on the window. It is used to
+// repaint only the damaged parts of the window, which matters over slow
+// connections to devdraw. Only the painter uses it.
+type gridPaint struct {
+	offset *Offset           // the offset painted
+	cells  map[int]cellPaint // the painted icons by index
+}
 
-	pad := image.Pt(grid.padding, grid.padding)
-	iconSize := grid.iconSize
-	iconRect := image.Rect(0, 0, iconSize.X, iconSize.Y)
-	zp := image.Point{}
+// cellPaint is what has been painted in a cell of the grid.
+type cellPaint struct {
+	icon   *IconImage
+	ready  bool
+	badges badges
+}
 
+// paintIcons draws the grid of icons and its scroll bar. If gp is not nil,
+// only the parts that changed since the last paint with gp are drawn: the rows
+// still visible after a scroll are copied and a toggled mark repaints its cell.
+// If load is false, the icons that are not loaded yet are left empty.
+// The current icon, if any, is badged as the one last displayed.
+func paintIcons(dctl *DisplayControl, offset *Offset, icons []*IconImage, current *Icon, gp *gridPaint, load bool) {
+	window := dctl.screen
+	grid := offset.grid
 	ir := grid.PaintableArea()
-	pin := ir.Min
-	nextIcon := 0
-	for nextIcon < len(icons) && pin.Add(iconSize).In(ir) {
-		for nextIcon < len(icons) && pin.Add(iconSize).In(ir) {
-			icon := icons[nextIcon]
-			if img, err := icon.ForDisplay(); err == nil {
-				dr := center(iconRect.Add(pin).Add(pad), img.Bounds())
-				dctl.display.Image.Draw(dr, img, nil, zp)
-				if icon.marked {
-					dctl.display.Image.Border(dr, pad.X, dctl.borderColor, zp)
+	_, cols := grid.Dimensions()
+	cell := grid.CellSize()
+
+	// exposed is the part of the grid where all the icons are drawn
+	exposed := ir
+	full := gp == nil || gp.offset == nil || dctl.painted != gp ||
+		*gp.offset.grid != *grid || gp.offset.pos%cols != offset.pos%cols
+	if !full {
+		top := func(o *Offset) int { return o.pos/cols*cell.Y + o.dy }
+		switch d := top(offset) - top(gp.offset); {
+		case d == 0:
+			exposed = image.Rectangle{}
+		case d > 0 && d < ir.Dy():
+			window.Copy(image.Rect(ir.Min.X, ir.Min.Y, ir.Max.X, ir.Max.Y-d), image.Pt(ir.Min.X, ir.Min.Y+d))
+			exposed.Min.Y = ir.Max.Y - d
+		case d < 0 && -d < ir.Dy():
+			window.Copy(image.Rect(ir.Min.X, ir.Min.Y-d, ir.Max.X, ir.Max.Y), ir.Min)
+			exposed.Max.Y = ir.Min.Y - d
+		default:
+			full = true
+		}
+	}
+	if full {
+		window.Draw(window.Bounds(), dctl.bgColor, image.Point{})
+		exposed = ir
+	} else if !exposed.Empty() {
+		window.Draw(exposed, dctl.bgColor, image.Point{})
+	}
+	paintScrollbar(dctl, offset)
+
+	cells := make(map[int]cellPaint, len(icons))
+	// the rows scrolled by offset.dy are clipped at the top and the bottom
+	for n, pin := 0, ir.Min.Sub(image.Pt(0, offset.dy)); pin.Y < ir.Max.Y; pin.Y += cell.Y {
+		for col := 0; col < cols; col, n = col+1, n+1 {
+			cr := image.Rectangle{pin, pin.Add(cell)}.Add(image.Pt(col*cell.X, 0))
+			var state cellPaint
+			var img ScreenImage
+			var err error
+			if n < len(icons) {
+				if load {
+					img, err = icons[n].ForDisplay()
+				} else if img, _ = icons[n].Ready(); img == nil {
+					err = errNotLoaded
 				}
-			} else {
+				state = cellPaint{icons[n], err == nil, iconBadges(icons[n], icons[n].Icon == current)}
+				cells[offset.pos+n] = state
+			}
+			clip := exposed
+			if old, ok := gp.cellAt(offset.pos + n); !full && old != state {
+				// the icon changed, or it is not there anymore
+				window.Draw(cr.Intersect(ir), dctl.bgColor, image.Point{})
+				clip = ir
+			} else if full || !ok {
+				clip = ir
+			}
+			switch {
+			case state.icon == nil || cr.Intersect(clip).Empty():
+			case err == errNotLoaded:
+			case err != nil:
 				log.Printf("paintIcons: image not ready: %v", err)
+			default:
+				paintIcon(dctl, grid, state, img, cr.Min, clip, ir)
 			}
-			nextIcon++
-			pin.X += iconSize.X + pad.X
 		}
-		pin.Y += iconSize.Y + pad.Y
-		pin.X = ir.Min.X
 	}
-	if err := dctl.display.Flush(); err != nil {
+	if gp != nil {
+		gp.offset, gp.cells = offset, cells
+		dctl.painted = gp
+	}
+	if err := window.Flush(); err != nil {
 		log.Printf("display: flush: %v", err)
 	}
 }
+
+// cellAt returns what was painted for the icon i.
+func (gp *gridPaint) cellAt(i int) (cellPaint, bool) {
+	if gp == nil {
+		return cellPaint{}, false
+	}
+	c, ok := gp.cells[i]
+	return c, ok
+}
+
+// paintIcon draws the thumbnail img of the cell at pin with its badges,
+// clipped to clip.
+func paintIcon(dctl *DisplayControl, grid *Grid, state cellPaint, img ScreenImage, pin image.Point, clip, ir image.Rectangle) {
+	pad := image.Pt(grid.padding, grid.padding)
+	iconRect := image.Rectangle{Max: grid.iconSize}
+	dr := center(iconRect.Add(pin).Add(pad), img.Bounds())
+	drawClipped(dctl.screen, dr, img, clip)
+	paintBadges(dctl, state.icon, state.badges, dr, pad.X, clip, ir)
+}
+
+// drawClipped draws img at dr, clipped to clip.
+func drawClipped(window Screen, dr image.Rectangle, img ScreenImage, clip image.Rectangle) {
+	r := dr.Intersect(clip)
+	if r.Empty() {
+		return
+	}
+	window.Draw(r, img, img.Bounds().Min.Add(r.Min.Sub(dr.Min)))
+}
+
+// borderClipped draws a border of width w inside r, clipped to clip.
+func borderClipped(window Screen, r image.Rectangle, w int, color ScreenImage, clip image.Rectangle) {
+	if r.In(clip) {
+		window.Border(r, w, color, image.Point{})
+		return
+	}
+	edges := []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+w),
+		image.Rect(r.Min.X, r.Max.Y-w, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y+w, r.Min.X+w, r.Max.Y-w),
+		image.Rect(r.Max.X-w, r.Min.Y+w, r.Max.X, r.Max.Y-w),
+	}
+	for _, e := range edges {
+		if e = e.Intersect(clip); !e.Empty() {
+			window.Draw(e, color, image.Point{})
+		}
+	}
+}
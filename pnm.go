@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// Netpbm images, PBM, PGM and PPM, plain or binary, are emitted by many
+// Plan 9 and research tools, and by dcraw. The header is text: the magic,
+// the width, the height and, except for PBM, the maximum sample, separated
+// by white space and comments.
+
+func init() {
+	for _, f := range []struct{ name, magic string }{
+		{"pbm", "P1"}, {"pgm", "P2"}, {"ppm", "P3"},
+		{"pbm", "P4"}, {"pgm", "P5"}, {"ppm", "P6"},
+	} {
+		image.RegisterFormat(f.name, f.magic, decodePNM, decodePNMConfig)
+	}
+}
+
+// pnmHeaderMax is the most bytes read for the header, with its comments.
+const pnmHeaderMax = 4096
+
+var (
+	errNotPNM    = errors.New("pnm: not a Netpbm image")
+	errBadHeader = errors.New("pnm: bad header")
+	errBadSample = errors.New("pnm: bad sample")
+)
+
+// pnmHeader is the header of a Netpbm image.
+type pnmHeader struct {
+	magic  byte // 1 to 6
+	width  int
+	height int
+	maxval int    // the maximum sample, 1 for PBM
+	data   []byte // the samples, after the header
+}
+
+// pnmType returns the MIME type of the Netpbm image data, or "" if it is not
+// one.
+func pnmType(data []byte) string {
+	if len(data) < 3 || data[0] != 'P' || !isPNMSpace(data[2]) {
+		return ""
+	}
+	switch data[1] {
+	case '1', '4':
+		return "image/x-portable-bitmap"
+	case '2', '5':
+		return "image/x-portable-graymap"
+	case '3', '6':
+		return "image/x-portable-pixmap"
+	}
+	return ""
+}
+
+// parsePNMHeader parses the header of the Netpbm image data.
+func parsePNMHeader(data []byte) (pnmHeader, error) {
+	var h pnmHeader
+	if pnmType(data) == "" {
+		return h, errNotPNM
+	}
+	h.magic, h.maxval = data[1]-'0', 1
+	data = data[2:]
+	fields := []*int{&h.width, &h.height, &h.maxval}
+	if h.magic == 1 || h.magic == 4 {
+		fields = fields[:2]
+	}
+	for _, f := range fields {
+		var tok []byte
+		tok, data = pnmToken(data)
+		n, err := strconv.Atoi(string(tok))
+		if err != nil || n <= 0 || n > 65535 {
+			return h, errBadHeader
+		}
+		*f = n
+	}
+	// a single white space separates the header from the binary samples
+	if h.magic >= 4 {
+		if len(data) == 0 {
+			return h, io.ErrUnexpectedEOF
+		}
+		data = data[1:]
+	}
+	h.data = data
+	return h, nil
+}
+
+// colorModel returns the color model of the decoded image.
+func (h pnmHeader) colorModel() color.Model {
+	switch {
+	case h.magic == 3 || h.magic == 6:
+		if h.maxval > 0xFF {
+			return color.RGBA64Model
+		}
+		return color.RGBAModel
+	case h.maxval > 0xFF:
+		return color.Gray16Model
+	}
+	return color.GrayModel
+}
+
+// minDataSize returns the fewest bytes of samples the image can have: the
+// rows of bits of PBM, the samples of one or two bytes of the binary ones
+// and, for the plain ones, a digit per sample.
+func (h pnmHeader) minDataSize() int {
+	n := h.width * h.height
+	switch h.magic {
+	case 1:
+		return n
+	case 4:
+		return (h.width + 7) / 8 * h.height
+	case 3, 6:
+		n *= 3
+	}
+	if h.magic >= 4 && h.maxval > 0xFF {
+		n *= 2
+	}
+	return n
+}
+
+// sampleReader returns a function that returns the next sample of the
+// image, in the order of the pixels.
+func (h pnmHeader) sampleReader() func() (int, error) {
+	data := h.data
+	switch h.magic {
+	case 1: // the digits 0 and 1, the white space between them is optional
+		return func() (int, error) {
+			data = skipPNMSpace(data)
+			if len(data) == 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			c := data[0]
+			data = data[1:]
+			if c != '0' && c != '1' {
+				return 0, errBadSample
+			}
+			return int(c - '0'), nil
+		}
+	case 2, 3: // numbers
+		return func() (int, error) {
+			var tok []byte
+			tok, data = pnmToken(data)
+			if tok == nil {
+				return 0, io.ErrUnexpectedEOF
+			}
+			n, err := strconv.Atoi(string(tok))
+			if err != nil || n < 0 || n > h.maxval {
+				return 0, errBadSample
+			}
+			return n, nil
+		}
+	case 4: // bits, the rows are padded to bytes
+		x, bit := 0, 0
+		return func() (int, error) {
+			if len(data) == 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			v := int(data[0]>>(7-bit)) & 1
+			bit, x = bit+1, x+1
+			if x == h.width {
+				x, bit = 0, 8
+			}
+			if bit == 8 {
+				data, bit = data[1:], 0
+			}
+			return v, nil
+		}
+	}
+	// bytes, or big endian pairs of bytes over 255
+	size := 1
+	if h.maxval > 0xFF {
+		size = 2
+	}
+	return func() (int, error) {
+		if len(data) < size {
+			return 0, io.ErrUnexpectedEOF
+		}
+		v := int(data[0])
+		if size == 2 {
+			v = v<<8 | int(data[1])
+		}
+		data = data[size:]
+		if v > h.maxval {
+			return 0, errBadSample
+		}
+		return v, nil
+	}
+}
+
+// decodePNM decodes the Netpbm image of r.
+func decodePNM(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := parsePNMHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	// the header alone must not size the image
+	if len(h.data) < h.minDataSize() {
+		return nil, io.ErrUnexpectedEOF
+	}
+	next := h.sampleReader()
+	rect := image.Rect(0, 0, h.width, h.height)
+	n := h.width * h.height
+	// scale scales a sample to 8 bits, or to 16 bits over 255
+	scale := func(v int) int {
+		if h.maxval > 0xFF {
+			return v * 0xFFFF / h.maxval
+		}
+		return v * 0xFF / h.maxval
+	}
+
+	switch h.magic {
+	case 1, 4: // 1 is black
+		img := image.NewGray(rect)
+		for i := range n {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			img.Pix[i] = uint8(0xFF * (1 - v))
+		}
+		return img, nil
+	case 2, 5:
+		if h.maxval > 0xFF {
+			img := image.NewGray16(rect)
+			for i := range n {
+				v, err := next()
+				if err != nil {
+					return nil, err
+				}
+				v = scale(v)
+				img.Pix[2*i], img.Pix[2*i+1] = uint8(v>>8), uint8(v)
+			}
+			return img, nil
+		}
+		img := image.NewGray(rect)
+		for i := range n {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			img.Pix[i] = uint8(scale(v))
+		}
+		return img, nil
+	}
+
+	if h.maxval > 0xFF {
+		img := image.NewRGBA64(rect)
+		for i := range n {
+			for c := range 3 {
+				v, err := next()
+				if err != nil {
+					return nil, err
+				}
+				v = scale(v)
+				img.Pix[8*i+2*c], img.Pix[8*i+2*c+1] = uint8(v>>8), uint8(v)
+			}
+			img.Pix[8*i+6], img.Pix[8*i+7] = 0xFF, 0xFF
+		}
+		return img, nil
+	}
+	img := image.NewRGBA(rect)
+	for i := range n {
+		for c := range 3 {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			img.Pix[4*i+c] = uint8(scale(v))
+		}
+		img.Pix[4*i+3] = 0xFF
+	}
+	return img, nil
+}
+
+// decodePNMConfig reads the dimensions of the Netpbm image of r from its
+// header.
+func decodePNMConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(io.LimitReader(r, pnmHeaderMax))
+	if err != nil {
+		return image.Config{}, err
+	}
+	h, err := parsePNMHeader(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// isPNMSpace reports whether c is white space in a Netpbm header.
+func isPNMSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+// skipPNMSpace skips the white space and the comments at the start of data.
+func skipPNMSpace(data []byte) []byte {
+	for len(data) > 0 {
+		switch {
+		case isPNMSpace(data[0]):
+			data = data[1:]
+		case data[0] == '#':
+			if i := bytes.IndexByte(data, '\n'); i >= 0 {
+				data = data[i+1:]
+			} else {
+				data = nil
+			}
+		default:
+			return data
+		}
+	}
+	return data
+}
+
+// pnmToken returns the first token of the plain text in data, after white
+// space and comments, and the rest of data.
+func pnmToken(data []byte) (tok, rest []byte) {
+	data = skipPNMSpace(data)
+	i := 0
+	for i < len(data) && !isPNMSpace(data[i]) && data[i] != '#' {
+		i++
+	}
+	if i == 0 {
+		return nil, data
+	}
+	return data[:i], data[i:]
+}
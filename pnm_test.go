@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestDecodePNM(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		want   []color.Color // the pixels of the first row
+	}{
+		{"plain pbm", "P1\n# black white\n2 1\n10\n", "pbm",
+			[]color.Color{color.Gray{0}, color.Gray{0xFF}}},
+		{"binary pbm", "P4 2 1\n\x80", "pbm",
+			[]color.Color{color.Gray{0}, color.Gray{0xFF}}},
+		{"plain pgm", "P2 2 1 4\n0 4\n", "pgm",
+			[]color.Color{color.Gray{0}, color.Gray{0xFF}}},
+		{"binary pgm", "P5 2 1 255\n\x10\x20", "pgm",
+			[]color.Color{color.Gray{0x10}, color.Gray{0x20}}},
+		{"16 bit pgm", "P5 1 1 65535\n\x12\x34", "pgm",
+			[]color.Color{color.Gray16{0x1234}}},
+		{"plain ppm", "P3 1 1 255\n1 2 3\n", "ppm",
+			[]color.Color{color.RGBA{1, 2, 3, 0xFF}}},
+		{"binary ppm", "P6 2 1 255\n\x01\x02\x03\x04\x05\x06", "ppm",
+			[]color.Color{color.RGBA{1, 2, 3, 0xFF}, color.RGBA{4, 5, 6, 0xFF}}},
+		{"16 bit ppm", "P6 1 1 65535\n\x12\x34\x56\x78\x9A\xBC", "ppm",
+			[]color.Color{color.RGBA64{0x1234, 0x5678, 0x9ABC, 0xFFFF}}},
+	}
+	for _, tt := range tests {
+		img, format, err := image.Decode(bytes.NewReader([]byte(tt.data)))
+		if err != nil || format != tt.format {
+			t.Errorf("%s: %v, format %q", tt.name, err, format)
+			continue
+		}
+		for x, c := range tt.want {
+			if got := img.At(x, 0); got != c {
+				t.Errorf("%s: pixel %d = %v, want %v", tt.name, x, got, c)
+			}
+		}
+	}
+}
+
+func TestDecodePNMCorrupt(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		truncated bool // fails with io.ErrUnexpectedEOF, or else a bad header or sample
+	}{
+		{"truncated plain", "P2 2 2 255\n1 2 3", true},
+		{"truncated binary", "P5 2 2 255\n\x01\x02\x03", true},
+		{"truncated 16 bit", "P6 1 1 65535\n\x01\x02\x03\x04\x05", true},
+		{"truncated bits", "P4 9 2\n\x00\x00\x00", true},
+		{"no samples", "P6 1 1 255", true},
+		{"huge", "P6 65535 65535 65535\n", true},
+		{"huge plain", "P1 65535 65535\n0", true},
+		{"sample over maxval", "P2 1 1 3\n4\n", false},
+		{"zero width", "P5 0 1 255\n\x00", false},
+	}
+	for _, tt := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := decodePNM(bytes.NewReader([]byte(tt.data)))
+		runtime.ReadMemStats(&after)
+		if err == nil || tt.truncated && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: error %v, want truncated %v", tt.name, err, tt.truncated)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+			t.Errorf("%s: allocated %d bytes", tt.name, n)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+// workPool limits the number of concurrent jobs of a kind. Loading is split in
+// a fetch stage, which is I/O bound, and a decode stage, which is CPU bound, each
+// with its own pool, so that slow I/O overlaps with decoding.
+type workPool struct {
+	name   string
+	sem    chan struct{}
+	queued atomic.Int32
+	active atomic.Int32
+}
+
+var (
+	// fetchPool runs the reads of image files.
+	fetchPool = newWorkPool("fetch", 8)
+	// decodePool runs the decoding and scaling of images.
+	decodePool = newWorkPool("decode", runtime.NumCPU())
+)
+
+// newWorkPool returns a pool that runs at most n jobs concurrently.
+func newWorkPool(name string, n int) *workPool {
+	return &workPool{name: name, sem: make(chan struct{}, max(1, n))}
+}
+
+// resize changes the number of concurrent jobs. It must be called before the pool is used.
+func (p *workPool) resize(n int) {
+	p.sem = make(chan struct{}, max(1, n))
+}
+
+// Do runs fn when a worker is available and waits for it to finish.
+func (p *workPool) Do(fn func()) {
+	p.queued.Add(1)
+	p.sem <- struct{}{}
+	p.queued.Add(-1)
+	p.active.Add(1)
+	defer func() {
+		p.active.Add(-1)
+		<-p.sem
+	}()
+	fn()
+}
+
+// idle reports whether the pool has no jobs, running or queued.
+func (p *workPool) idle() bool {
+	return p.active.Load() == 0 && p.queued.Load() == 0
+}
+
+// poolsIdle reports whether nothing is being read or decoded.
+func poolsIdle() bool {
+	return fetchPool.idle() && decodePool.idle()
+}
+
+// String returns the queue depths of the pool.
+func (p *workPool) String() string {
+	return fmt.Sprintf("%s: %d/%d active %d queued",
+		p.name, p.active.Load(), cap(p.sem), p.queued.Load())
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/ascii85"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// Proof sheets lay out the marked images N-up on A4 or Letter pages, with
+// their names below them, as a PDF or a PostScript file for printing, on
+// Plan 9 with page and lp. The cells are those of the grid of the icons
+// view, in points, and the images are embedded as JPEGs at printDPI.
+
+const (
+	printMargin  = 36  // the margin of the pages, half an inch
+	printPadding = 8   // the space between the cells
+	printCaption = 10  // the height of the names below the images
+	printFont    = 7   // the size of the names
+	printDPI     = 200 // the resolution of the images
+	printQuality = 90  // the JPEG quality of the images
+)
+
+// paperSizes are the sizes of the pages of -paper, in points.
+var paperSizes = map[string]image.Point{
+	"a4":     {595, 842},
+	"letter": {612, 792},
+}
+
+// checkPrintFlags checks -paper, -nup and the suffix of -printto.
+func checkPrintFlags() error {
+	if _, ok := paperSizes[strings.ToLower(*paperName)]; !ok {
+		return fmt.Errorf("paper: unknown size %q, use a4 or letter", *paperName)
+	}
+	if *nUp < 1 {
+		return fmt.Errorf("nup: %d images per page", *nUp)
+	}
+	switch strings.ToLower(filepath.Ext(*printFile)) {
+	case ".pdf", ".ps":
+		return nil
+	}
+	return fmt.Errorf("printto: %s: the file must be .pdf or .ps", *printFile)
+}
+
+// proofLayout returns the grid of n cells on a page of size paper. The
+// columns are about the square root of n, so that the cells are portrait
+// like the pages.
+func proofLayout(paper image.Point, n int) (*Grid, error) {
+	cols := max(1, int(math.Sqrt(float64(n))))
+	rows := (n + cols - 1) / cols
+	// the grid keeps the left edge for the scroll bar, the pages have none
+	area := image.Rect(printMargin-scrollWidth, printMargin, paper.X-printMargin, paper.Y-printMargin)
+	cell := image.Pt((area.Dx()-scrollWidth-printPadding)/cols, (area.Dy()-printPadding)/rows)
+	icon := cell.Sub(image.Pt(printPadding, printPadding))
+	if icon.X <= 0 || icon.Y <= printCaption {
+		return nil, fmt.Errorf("print: %d images do not fit on a page", n)
+	}
+	return NewGrid(area, icon, printPadding), nil
+}
+
+// proofWriter writes the pages of a proof sheet. The rectangles and points
+// are in points from the top left corner of the page.
+type proofWriter interface {
+	beginPage()
+	placeImage(r image.Rectangle, jpg []byte, size image.Point)
+	caption(p image.Point, s string)
+	endPage()
+	finish() []byte
+}
+
+// writeProofs lays out the images of the icons -nup per page in the file
+// name, as PDF or PostScript by its suffix. It returns the number of pages
+// and the name written, which differs from name by -oncollision.
+func writeProofs(ctx context.Context, icons []*Icon, name string, progress func(batchStatus)) (int, string, error) {
+	paper := paperSizes[strings.ToLower(*paperName)]
+	grid, err := proofLayout(paper, *nUp)
+	if err != nil {
+		return 0, "", err
+	}
+	perPage := min(*nUp, grid.Area())
+	box := image.Rectangle{Max: grid.iconSize.Sub(image.Pt(0, printCaption))}
+	pixels := image.Rectangle{Max: box.Max.Mul(printDPI).Div(72)}
+
+	type proof struct {
+		jpg  []byte
+		size image.Point
+	}
+	proofs := make([]proof, len(icons))
+	done := runBatch(ctx, len(icons), func(i int) batchStatus {
+		st := batchStatus{name: icons[i].path}
+		img, err := renderIcon(icons[i])
+		if err != nil {
+			st.err = err
+			return st
+		}
+		dimg := scaleToFit(nil, img, pixels)
+		var b bytes.Buffer
+		st.err = jpeg.Encode(&b, dimg, &jpeg.Options{Quality: printQuality})
+		proofs[i] = proof{b.Bytes(), dimg.Rect.Size()}
+		putBytes(dimg.Pix)
+		return st
+	}, progress)
+	if ctx.Err() != nil {
+		return 0, "", errors.New("print: cancelled")
+	}
+
+	var w proofWriter = newPDFWriter(paper)
+	if strings.EqualFold(filepath.Ext(name), ".ps") {
+		w = newPSWriter(paper)
+	}
+	ir := grid.PaintableArea()
+	_, cols := grid.Dimensions()
+	cell := grid.CellSize()
+	pad := image.Pt(grid.padding, grid.padding)
+	pages := 0
+	for from := 0; from < len(icons); from += perPage {
+		w.beginPage()
+		for n, i := 0, from; i < min(from+perPage, len(icons)); n, i = n+1, i+1 {
+			if !done[i] || proofs[i].jpg == nil {
+				continue
+			}
+			pin := ir.Min.Add(image.Pt(n%cols*cell.X, n/cols*cell.Y)).Add(pad)
+			r := fitPoints(box.Add(pin), proofs[i].size)
+			w.placeImage(r, proofs[i].jpg, proofs[i].size)
+			// the name is below the image
+			w.caption(image.Pt(r.Min.X, r.Max.Y+printCaption-2), shortCaption(filepath.Base(icons[i].path), box.Dx()))
+		}
+		w.endPage()
+		pages++
+	}
+
+	name, err = writeExport(name, w.finish())
+	if err != nil {
+		return 0, "", fmt.Errorf("print: %w", err)
+	}
+	return pages, name, nil
+}
+
+// fitPoints returns the largest rectangle of the aspect of size centered
+// in r. Unlike bestFit it scales up, small images fill their cells.
+func fitPoints(r image.Rectangle, size image.Point) image.Rectangle {
+	scale := min(float64(r.Dx())/float64(size.X), float64(r.Dy())/float64(size.Y))
+	fit := image.Pt(int(float64(size.X)*scale), int(float64(size.Y)*scale))
+	return center(r, image.Rectangle{Max: fit})
+}
+
+// shortCaption shortens the name to about the width, in points, of the
+// cell, keeping its start and its suffix.
+func shortCaption(name string, width int) string {
+	// the average width of the characters of Helvetica is about half the size
+	n := max(8, width*2/printFont)
+	if len(name) <= n {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > n/2 {
+		ext = ""
+	}
+	return name[:n-3-len(ext)] + "..." + ext
+}
+
+// psString returns s as a string of PDF and PostScript, escaping the
+// parentheses and the backslashes. Characters outside ASCII are replaced.
+func psString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r > '~':
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// pdfWriter writes a PDF. Objects 1, 2 and 3 are the catalog, the page tree
+// and the font, written last when the pages are known.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	paper   image.Point
+	offsets []int // the offsets of the objects, by number from 1
+	pages   []int // the objects of the pages
+	content bytes.Buffer
+	images  []int // the objects of the images of the page
+}
+
+func newPDFWriter(paper image.Point) *pdfWriter {
+	w := &pdfWriter{paper: paper, offsets: make([]int, 3)}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	return w
+}
+
+// object writes the object num with body, or a new object if num is 0.
+// It returns its number.
+func (w *pdfWriter) object(num int, body string, stream []byte) int {
+	if num == 0 {
+		w.offsets = append(w.offsets, 0)
+		num = len(w.offsets)
+	}
+	w.offsets[num-1] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\n", num, body)
+	if stream != nil {
+		w.buf.WriteString("stream\n")
+		w.buf.Write(stream)
+		w.buf.WriteString("\nendstream\n")
+	}
+	w.buf.WriteString("endobj\n")
+	return num
+}
+
+func (w *pdfWriter) beginPage() {
+	w.content.Reset()
+	w.images = w.images[:0]
+}
+
+func (w *pdfWriter) placeImage(r image.Rectangle, jpg []byte, size image.Point) {
+	im := w.object(0, fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>",
+		size.X, size.Y, len(jpg)), jpg)
+	w.images = append(w.images, im)
+	fmt.Fprintf(&w.content, "q %d 0 0 %d %d %d cm /Im%d Do Q\n", r.Dx(), r.Dy(), r.Min.X, w.paper.Y-r.Max.Y, im)
+}
+
+func (w *pdfWriter) caption(p image.Point, s string) {
+	fmt.Fprintf(&w.content, "BT /F1 %d Tf %d %d Td %s Tj ET\n", printFont, p.X, w.paper.Y-p.Y, psString(s))
+}
+
+func (w *pdfWriter) endPage() {
+	contents := w.object(0, fmt.Sprintf("<< /Length %d >>", w.content.Len()), w.content.Bytes())
+	var xobjects strings.Builder
+	for _, im := range w.images {
+		fmt.Fprintf(&xobjects, " /Im%d %d 0 R", im, im)
+	}
+	page := w.object(0, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>",
+		w.paper.X, w.paper.Y, xobjects.String(), contents), nil)
+	w.pages = append(w.pages, page)
+}
+
+func (w *pdfWriter) finish() []byte {
+	w.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	var kids strings.Builder
+	for _, p := range w.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", p)
+	}
+	w.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(w.pages)), nil)
+	w.object(1, "<< /Type /Catalog /Pages 2 0 R >>", nil)
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, off := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, xref)
+	return w.buf.Bytes()
+}
+
+// psWriter writes PostScript level 2, with the images as JPEGs in ASCII85.
+type psWriter struct {
+	buf   bytes.Buffer
+	paper image.Point
+	pages int
+}
+
+func newPSWriter(paper image.Point) *psWriter {
+	w := &psWriter{paper: paper}
+	fmt.Fprintf(&w.buf, "%%!PS-Adobe-3.0\n%%%%Creator: %s\n%%%%LanguageLevel: 2\n%%%%BoundingBox: 0 0 %d %d\n%%%%Pages: (atend)\n%%%%EndComments\n",
+		progName, paper.X, paper.Y)
+	fmt.Fprintf(&w.buf, "%%%%BeginSetup\n<< /PageSize [%d %d] >> setpagedevice\n%%%%EndSetup\n", paper.X, paper.Y)
+	return w
+}
+
+func (w *psWriter) beginPage() {
+	w.pages++
+	fmt.Fprintf(&w.buf, "%%%%Page: %d %d\n/Helvetica findfont %d scalefont setfont\n", w.pages, w.pages, printFont)
+}
+
+func (w *psWriter) placeImage(r image.Rectangle, jpg []byte, size image.Point) {
+	fmt.Fprintf(&w.buf, "gsave %d %d translate %d %d scale /DeviceRGB setcolorspace\n", r.Min.X, w.paper.Y-r.Max.Y, r.Dx(), r.Dy())
+	fmt.Fprintf(&w.buf, "<< /ImageType 1 /Width %d /Height %d /BitsPerComponent 8 /Decode [0 1 0 1 0 1] /ImageMatrix [%d 0 0 -%d 0 %d] /DataSource currentfile /ASCII85Decode filter /DCTDecode filter >> image\n",
+		size.X, size.Y, size.X, size.Y, size.Y)
+	a85 := make([]byte, ascii85.MaxEncodedLen(len(jpg)))
+	a85 = a85[:ascii85.Encode(a85, jpg)]
+	// short lines, for the spoolers
+	for len(a85) > 0 {
+		n := min(len(a85), 76)
+		w.buf.Write(a85[:n])
+		w.buf.WriteByte('\n')
+		a85 = a85[n:]
+	}
+	w.buf.WriteString("~>\ngrestore\n")
+}
+
+func (w *psWriter) caption(p image.Point, s string) {
+	fmt.Fprintf(&w.buf, "%d %d moveto %s show\n", p.X, w.paper.Y-p.Y, psString(s))
+}
+
+func (w *psWriter) endPage() {
+	w.buf.WriteString("showpage\n")
+}
+
+func (w *psWriter) finish() []byte {
+	fmt.Fprintf(&w.buf, "%%%%Trailer\n%%%%Pages: %d\n%%%%EOF\n", w.pages)
+	return w.buf.Bytes()
+}
+
+// printMarked lays out the marked images in the proof sheet of -printto.
+func (dctl *DisplayControl) printMarked(marked []*Icon) {
+	var pages int
+	var name string
+	err := dctl.showBatch("print "+*printFile, len(marked), func(ctx context.Context, progress func(batchStatus)) error {
+		var err error
+		pages, name, err = writeProofs(ctx, marked, *printFile, progress)
+		return err
+	})
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	log.Printf("print: %d images %d-up on %d %s pages in %s", len(marked), *nUp, pages, *paperName, name)
+}
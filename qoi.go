@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// QOI, the Quite OK Image format, is a simple lossless format used by
+// game and tooling pipelines. See https://qoiformat.org/qoi-specification.pdf.
+
+func init() {
+	image.RegisterFormat("qoi", "qoif", decodeQOI, decodeQOIConfig)
+}
+
+const (
+	qoiHeaderSize = 14
+	// qoiMaxPixels limits the size of corrupt images, like the reference
+	// decoder does.
+	qoiMaxPixels = 400_000_000
+	// qoiMaxRun is the most pixels of a byte of the data, a run.
+	qoiMaxRun = 62
+)
+
+var errNotQOI = errors.New("qoi: not a QOI image")
+
+// qoiHeader reads the dimensions and the channels of the QOI image.
+func qoiHeader(data []byte) (w, h, channels int, err error) {
+	if len(data) < qoiHeaderSize || string(data[:4]) != "qoif" {
+		return 0, 0, 0, errNotQOI
+	}
+	w, h = int(binary.BigEndian.Uint32(data[4:])), int(binary.BigEndian.Uint32(data[8:]))
+	channels = int(data[12])
+	if w == 0 || h == 0 || w > qoiMaxPixels/h || (channels != 3 && channels != 4) {
+		return 0, 0, 0, errors.New("qoi: bad header")
+	}
+	return w, h, channels, nil
+}
+
+// decodeQOI decodes the QOI image of r. The colors are not premultiplied.
+func decodeQOI(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	w, h, _, err := qoiHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	// a corrupt header fails before allocating for its pixels
+	if w*h > qoiMaxRun*(len(data)-qoiHeaderSize) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	var index [64]color.NRGBA
+	px := color.NRGBA{A: 0xFF}
+	run := 0
+	p := qoiHeaderSize
+	for i := 0; i < len(img.Pix); i += 4 {
+		switch {
+		case run > 0:
+			run--
+		case p >= len(data):
+			return nil, io.ErrUnexpectedEOF
+		default:
+			b := data[p]
+			p++
+			switch {
+			case b == 0xFE: // RGB
+				if p+3 > len(data) {
+					return nil, io.ErrUnexpectedEOF
+				}
+				px.R, px.G, px.B = data[p], data[p+1], data[p+2]
+				p += 3
+			case b == 0xFF: // RGBA
+				if p+4 > len(data) {
+					return nil, io.ErrUnexpectedEOF
+				}
+				px = color.NRGBA{data[p], data[p+1], data[p+2], data[p+3]}
+				p += 4
+			case b>>6 == 0: // index
+				px = index[b]
+			case b>>6 == 1: // diff, biased by 2
+				px.R += (b>>4)&3 - 2
+				px.G += (b>>2)&3 - 2
+				px.B += b&3 - 2
+			case b>>6 == 2: // luma, green biased by 32 and red and blue relative to it by 8
+				if p >= len(data) {
+					return nil, io.ErrUnexpectedEOF
+				}
+				dg := b&0x3F - 32
+				px.R += dg + data[p]>>4 - 8
+				px.G += dg
+				px.B += dg + data[p]&0xF - 8
+				p++
+			default: // run, biased by 1
+				run = int(b & 0x3F)
+			}
+			index[(int(px.R)*3+int(px.G)*5+int(px.B)*7+int(px.A)*11)%64] = px
+		}
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = px.R, px.G, px.B, px.A
+	}
+	return img, nil
+}
+
+// decodeQOIConfig reads the dimensions of the QOI image of r.
+func decodeQOIConfig(r io.Reader) (image.Config, error) {
+	var header [qoiHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return image.Config{}, err
+	}
+	w, h, _, err := qoiHeader(header[:])
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: w, Height: h}, nil
+}
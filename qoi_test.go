@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// qoiImage returns a QOI image of w x h with the ops after the header.
+func qoiImage(w, h uint32, ops ...byte) []byte {
+	data := []byte("qoif")
+	data = binary.BigEndian.AppendUint32(data, w)
+	data = binary.BigEndian.AppendUint32(data, h)
+	data = append(data, 4, 0)
+	return append(data, ops...)
+}
+
+func TestDecodeQOI(t *testing.T) {
+	end := []byte{0, 0, 0, 0, 0, 0, 0, 1}
+	// a red pixel, a run of 2 and a pixel with alpha
+	ops := append([]byte{0xFE, 0xFF, 0, 0, 0xC1, 0xFF, 1, 2, 3, 4}, end...)
+	img, format, err := image.Decode(bytes.NewReader(qoiImage(4, 1, ops...)))
+	if err != nil || format != "qoi" {
+		t.Fatalf("decode: %v, format %q", err, format)
+	}
+	want := []color.NRGBA{{0xFF, 0, 0, 0xFF}, {0xFF, 0, 0, 0xFF}, {0xFF, 0, 0, 0xFF}, {1, 2, 3, 4}}
+	for x, c := range want {
+		if got := img.(*image.NRGBA).NRGBAAt(x, 0); got != c {
+			t.Errorf("pixel %d = %v, want %v", x, got, c)
+		}
+	}
+}
+
+func TestDecodeQOICorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no pixels", qoiImage(2, 2)},
+		{"truncated rgb", qoiImage(1, 1, 0xFE, 0xFF)},
+		{"truncated rgba", qoiImage(1, 1, 0xFF, 1, 2)},
+		{"truncated luma", qoiImage(1, 1, 0x80)},
+		{"too few runs", qoiImage(1000, 1, 0xFD)},
+		{"huge", qoiImage(20000, 20000, 0xFD, 0xFD)},
+	}
+	for _, tt := range tests {
+		_, err := decodeQOI(bytes.NewReader(tt.data))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, io.ErrUnexpectedEOF)
+		}
+	}
+	if _, err := decodeQOI(bytes.NewReader(qoiImage(0, 1))); err == nil {
+		t.Errorf("empty image: no error")
+	}
+}
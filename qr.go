@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"strings"
+
+	"9fans.net/go/plumb"
+	"github.com/makiuchi-d/gozxing"
+	mqrcode "github.com/makiuchi-d/gozxing/multi/qrcode"
+	"github.com/makiuchi-d/gozxing/oned"
+)
+
+// code is a QR code or a barcode found in an image.
+type code struct {
+	text   string
+	format string
+	r      image.Rectangle // where it is in the image
+}
+
+// String returns the code for the info.
+func (c code) String() string {
+	return fmt.Sprintf("%s: %s", c.format, c.text)
+}
+
+// barcodeReaders read the common barcodes of products and tickets.
+var barcodeReaders = []gozxing.Reader{
+	oned.NewMultiFormatUPCEANReader(nil),
+	oned.NewCode128Reader(),
+	oned.NewCode39Reader(),
+}
+
+// findCodes returns the QR codes of img or, if there are none, a barcode.
+func findCodes(img image.Image) []code {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return nil
+	}
+	var codes []code
+	results, _ := mqrcode.NewQRCodeMultiReader().DecodeMultiple(bmp, nil)
+	for _, res := range results {
+		codes = append(codes, codeOf(res, img.Bounds().Min))
+	}
+	if len(codes) > 0 {
+		return codes
+	}
+	for _, r := range barcodeReaders {
+		if res, err := r.Decode(bmp, nil); err == nil {
+			return []code{codeOf(res, img.Bounds().Min)}
+		}
+	}
+	return nil
+}
+
+// codeOf returns the code of the result. The points of the result are
+// relative to min.
+func codeOf(res *gozxing.Result, min image.Point) code {
+	var r image.Rectangle
+	for i, p := range res.GetResultPoints() {
+		pr := image.Rect(int(p.GetX()), int(p.GetY()), int(p.GetX())+1, int(p.GetY())+1)
+		if i == 0 {
+			r = pr
+		} else {
+			r = r.Union(pr)
+		}
+	}
+	// the points are the centers of the finder patterns or the ends
+	// of a barcode line, add a margin to cover the whole code
+	m := max(r.Dx(), r.Dy()) / 4
+	r = r.Inset(-max(m, 4)).Add(min)
+	return code{
+		text:   res.GetText(),
+		format: strings.ReplaceAll(res.GetBarcodeFormat().String(), "_", " "),
+		r:      r,
+	}
+}
+
+// plumbCode plumbs the text of a code, for example to open a URL.
+func plumbCode(c code) {
+	if plumber == nil {
+		log.Printf("plumber not available")
+		return
+	}
+	dir, _ := os.Getwd()
+	m := plumb.Message{
+		Src:  progName,
+		Dir:  dir,
+		Type: "text",
+		Data: []byte(c.text),
+	}
+	if err := m.Send(plumber); err != nil {
+		log.Printf("plumber: %v", err)
+	}
+}
+
+// paintCodes outlines the codes of an image with bounds orig that is
+// displayed scaled in r.
+func paintCodes(dctl *DisplayControl, codes []code, orig, r image.Rectangle) {
+	for _, c := range codes {
+		borderClipped(dctl.screen, scaleRect(c.r, orig, r), 2, dctl.currentColor, r)
+	}
+}
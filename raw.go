@@ -0,0 +1,60 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// rawFormats are the suffixes of camera RAW files. They are paired with the
+// JPEG of the same shot, if any, and displayed only without one.
+var rawFormats = []string{".arw", ".cr2", ".cr3", ".dng", ".nef", ".orf", ".raf", ".rw2"}
+
+// isRawFile checks the file suffix to check if it is a camera RAW file.
+func isRawFile(name string) bool {
+	return slices.Contains(rawFormats, fileSuffix(name))
+}
+
+// rawKey returns the key used to pair a RAW with an image: the path without extension.
+func rawKey(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// pairRawSiblings attaches the RAW files to the images of the same shot.
+// raws maps rawKey to the path of the RAW file. It returns the icons with
+// the icons of the RAW files that can be displayed and have no image.
+func pairRawSiblings(icons []*Icon, raws map[string]string) []*Icon {
+	if len(raws) == 0 {
+		return icons
+	}
+	paired := make(map[string]bool)
+	for _, icon := range icons {
+		if raw, ok := raws[rawKey(icon.path)]; ok {
+			icon.siblings = append(icon.siblings, raw)
+			paired[raw] = true
+		}
+	}
+	// in the order of the walk
+	for _, raw := range slices.Sorted(maps.Values(raws)) {
+		if !paired[raw] && isImageFile(raw) {
+			icons = append(icons, NewIcon(raw))
+		}
+	}
+	return icons
+}
+
+// findRawSibling returns the RAW file of the same shot as the image at path.
+// It is used for images given explicitly on the command line.
+func findRawSibling(path string) (string, bool) {
+	key := rawKey(path)
+	for _, ext := range rawFormats {
+		for _, name := range []string{key + ext, key + strings.ToUpper(ext)} {
+			if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// Camera RAW images without a JPEG of the same shot are displayed. CR2,
+// NEF, ARW and DNG are TIFF files and they are decoded by the shell command
+// of -raw, by default dcraw, which finds the image in $file and prints it
+// as PPM, PNG or JPEG. The command must not rotate the image, the EXIF
+// orientation is applied like for JPEGs. Without the command,
+// or if it fails, the largest JPEG preview embedded by the camera is
+// displayed instead. The dimensions are those of the preview.
+
+func init() {
+	for _, magic := range []string{"II*\x00", "MM\x00*"} {
+		image.RegisterFormat("raw", magic, decodeRAW, decodeRAWConfig)
+	}
+}
+
+var (
+	errNotRAW = errors.New("raw: not a RAW image")
+	errNoJPEG = errors.New("raw: no embedded preview")
+
+	// rawFailed logs the first failure of the command, the previews are
+	// used silently after that.
+	rawFailed sync.Once
+)
+
+// rawPreviews is the most embedded JPEGs looked at. Cameras store a few,
+// from a thumbnail to a full size preview.
+const rawPreviews = 64
+
+// isRAW reports whether data is a TIFF based RAW file.
+func isRAW(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
+
+// decodeRAW decodes the RAW image of r with the command of -raw, or else
+// decodes its preview.
+func decodeRAW(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !isRAW(data) {
+		return nil, errNotRAW
+	}
+	if *rawDecoder != "" {
+		img, err := runRAWDecoder(data)
+		if err == nil {
+			return img, nil
+		}
+		rawFailed.Do(func() { log.Printf("%v, using the embedded previews", err) })
+	}
+	preview, err := rawPreview(data)
+	if err != nil {
+		return nil, err
+	}
+	return jpeg.Decode(bytes.NewReader(preview))
+}
+
+// runRAWDecoder runs the command of -raw for the RAW image data. The
+// decoders read files, so the data is written to a temporary one.
+func runRAWDecoder(data []byte) (image.Image, error) {
+	f, err := os.CreateTemp("", progName+"-*.raw")
+	if err != nil {
+		return nil, fmt.Errorf("raw: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("raw: %w", err)
+	}
+
+	cmd := exec.Command("sh", "-c", *rawDecoder)
+	cmd.Env = append(os.Environ(), "file="+f.Name())
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("raw: %s: %w", *rawDecoder, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		return nil, fmt.Errorf("raw: %s: %w", *rawDecoder, err)
+	}
+	return img, nil
+}
+
+// decodeRAWConfig reads the dimensions of the preview of the RAW image of
+// r, as the command is too slow to run for them.
+func decodeRAWConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if !isRAW(data) {
+		return image.Config{}, errNotRAW
+	}
+	preview, err := rawPreview(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return jpeg.DecodeConfig(bytes.NewReader(preview))
+}
+
+// rawPreview returns the largest baseline or progressive JPEG embedded in
+// the RAW data. The RAW data itself, which may be a lossless JPEG, cannot
+// be decoded by image/jpeg and is skipped.
+func rawPreview(data []byte) ([]byte, error) {
+	soi := []byte{0xFF, 0xD8, 0xFF}
+	var best []byte
+	var area int
+	for n, off := 0, 0; n < rawPreviews; n++ {
+		i := bytes.Index(data[off:], soi)
+		if i < 0 {
+			break
+		}
+		off += i
+		if cfg, err := jpeg.DecodeConfig(bytes.NewReader(data[off:])); err == nil && cfg.Width*cfg.Height > area {
+			best, area = data[off:], cfg.Width*cfg.Height
+		}
+		off += len(soi)
+	}
+	if best == nil {
+		return nil, errNoJPEG
+	}
+	return best, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// The input log has one event per line: the milliseconds since the start,
+// the kind of the event and its arguments.
+//
+//	120 key 61458
+//	350 mouse 640 480 1
+//	900 menu 3
+//	1200 resize
+//	1500 mods 1
+//
+// Menu events are the items selected in menus, since menus read the mouse directly.
+// Mods events are the modifier keys held down, recorded when they change.
+
+// inputRecorder writes the input events to a log.
+type inputRecorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	mods  modifier // the modifiers last recorded
+}
+
+func (r *inputRecorder) record(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.w, "%d ", time.Since(r.start).Milliseconds())
+	fmt.Fprintf(r.w, format, args...)
+	fmt.Fprintln(r.w)
+}
+
+// recordMods records the modifiers held down, if they changed.
+func (r *inputRecorder) recordMods() {
+	r.mu.Lock()
+	mods := modifiers()
+	changed := mods != r.mods
+	r.mods = mods
+	r.mu.Unlock()
+	if changed {
+		r.record("mods %d", mods)
+	}
+}
+
+// recordingScreen is a Screen that records the menu selections.
+type recordingScreen struct {
+	Screen
+	rec *inputRecorder
+}
+
+func (s *recordingScreen) MenuHit(but int, menu *draw9.Menu) int {
+	hit := s.Screen.MenuHit(but, menu)
+	s.rec.record("menu %d", hit)
+	return hit
+}
+
+// recordInput logs all the input events of dctl to w, so that the
+// session can be replayed later with replayInput.
+func (dctl *DisplayControl) recordInput(w io.Writer) {
+	rec := &inputRecorder{w: w, start: time.Now()}
+	dctl.screen = &recordingScreen{Screen: dctl.screen, rec: rec}
+
+	mouse, keys, resize := make(chan draw9.Mouse), make(chan rune), make(chan bool)
+	go func(in <-chan draw9.Mouse) {
+		for m := range in {
+			rec.recordMods()
+			rec.record("mouse %d %d %d", m.Point.X, m.Point.Y, m.Buttons)
+			mouse <- m
+		}
+	}(dctl.mctl.C)
+	go func(in <-chan rune) {
+		for k := range in {
+			rec.recordMods()
+			rec.record("key %d", k)
+			keys <- k
+		}
+	}(dctl.kctl.C)
+	go func(in <-chan bool) {
+		for b := range in {
+			rec.record("resize")
+			resize <- b
+		}
+	}(dctl.mctl.Resize)
+	dctl.mctl.C, dctl.kctl.C, dctl.mctl.Resize = mouse, keys, resize
+}
+
+// inputEvent is an event of the input log.
+type inputEvent struct {
+	at   time.Duration
+	kind string
+	args []int
+}
+
+// readInputLog parses the input log.
+func readInputLog(r io.Reader) ([]inputEvent, error) {
+	var events []inputEvent
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("input log: line %d: missing event", n)
+		}
+		var ev inputEvent
+		var ms int64
+		if _, err := fmt.Sscan(fields[0], &ms); err != nil {
+			return nil, fmt.Errorf("input log: line %d: bad time: %w", n, err)
+		}
+		ev.at = time.Duration(ms) * time.Millisecond
+		ev.kind = fields[1]
+		for _, f := range fields[2:] {
+			var a int
+			if _, err := fmt.Sscan(f, &a); err != nil {
+				return nil, fmt.Errorf("input log: line %d: bad argument: %w", n, err)
+			}
+			ev.args = append(ev.args, a)
+		}
+		want := map[string]int{"key": 1, "mouse": 3, "menu": 1, "resize": 0, "mods": 1}
+		if nargs, ok := want[ev.kind]; !ok || nargs != len(ev.args) {
+			return nil, fmt.Errorf("input log: line %d: bad event %q", n, sc.Text())
+		}
+		events = append(events, ev)
+	}
+	return events, sc.Err()
+}
+
+// replayInput sends the events to the fake display with their original timing.
+// The menu selections are queued in the screen, as menus do not read events.
+// It closes done after the last event.
+func replayInput(events []inputEvent, scr *fakeScreen, in *fakeInput, done chan<- struct{}) {
+	for _, ev := range events {
+		if ev.kind == "menu" {
+			scr.MenuHits = append(scr.MenuHits, ev.args[0])
+		}
+	}
+	go func() {
+		defer close(done)
+		start := time.Now()
+		for _, ev := range events {
+			time.Sleep(ev.at - time.Since(start))
+			switch ev.kind {
+			case "key":
+				in.Keys <- rune(ev.args[0])
+			case "mouse":
+				in.Mouse <- draw9.Mouse{Point: image.Pt(ev.args[0], ev.args[1]), Buttons: ev.args[2]}
+			case "resize":
+				in.Resize <- true
+			case "mods":
+				heldModifiers.Store(uint32(ev.args[0]))
+			}
+		}
+		log.Printf("replay: %d events replayed", len(events))
+	}()
+}
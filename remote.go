@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// RemoteSource is a source of images other than the local file system.
+// Its paths are URLs, like sftp://host/dir/image.jpg.
+type RemoteSource interface {
+	// Walk walks the file tree rooted at root, like filepath.WalkDir.
+	Walk(root string, fn fs.WalkDirFunc) error
+	// Stat returns the file info of the path.
+	Stat(path string) (fs.FileInfo, error)
+	// ReadFile reads the contents of the path.
+	ReadFile(path string) ([]byte, error)
+}
+
+// remoteSources maps URL schemes to sources.
+var remoteSources = map[string]RemoteSource{
+	"sftp":  newSFTPSource(),
+	"s3":    newS3Source(),
+	"http":  newHTTPSource(),
+	"https": newHTTPSource(),
+}
+
+// remoteSourceOf returns the source of path if it is a URL of a remote source.
+func remoteSourceOf(path string) (RemoteSource, bool) {
+	scheme, _, ok := strings.Cut(path, "://")
+	if !ok {
+		return nil, false
+	}
+	src, ok := remoteSources[scheme]
+	return src, ok
+}
+
+// isRemote reports whether path is in a remote source.
+func isRemote(path string) bool {
+	_, ok := remoteSourceOf(path)
+	return ok
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/xor-gate/goexif2/exif"
+)
+
+// renameFieldRe matches the fields of a rename template, like {date}.
+var renameFieldRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// renameSepRe matches the runs of separators.
+var renameSepRe = regexp.MustCompile(`[_ -]{2,}`)
+
+// renameFields are the fields of the rename templates and their values.
+var renameFields = map[string]func(f renameInfo) string{
+	"date":  func(f renameInfo) string { return f.date.Format("2006-01-02") },
+	"time":  func(f renameInfo) string { return f.date.Format("150405") },
+	"year":  func(f renameInfo) string { return f.date.Format("2006") },
+	"month": func(f renameInfo) string { return f.date.Format("01") },
+	"day":   func(f renameInfo) string { return f.date.Format("02") },
+	"make":  func(f renameInfo) string { return f.make },
+	"model": func(f renameInfo) string { return f.model },
+	"name":  func(f renameInfo) string { return f.name },
+	"n":     func(f renameInfo) string { return fmt.Sprintf("%03d", f.n) },
+}
+
+// renameInfo are the values of the fields of an image.
+type renameInfo struct {
+	date     time.Time
+	fileTime bool // date is the modification time, there is no EXIF date
+	make     string
+	model    string
+	name     string // the name of the file, without the suffix
+	n        int    // the position of the image in the renamed ones, from 1
+}
+
+// checkRenameTemplate checks that the fields of the template are known.
+func checkRenameTemplate(tmpl string) error {
+	if strings.ContainsAny(tmpl, `/\`) {
+		return fmt.Errorf("rename: template %q: the names cannot have directories", tmpl)
+	}
+	for _, m := range renameFieldRe.FindAllStringSubmatch(tmpl, -1) {
+		if _, ok := renameFields[m[1]]; !ok {
+			return fmt.Errorf("rename: template %q: unknown field {%s}", tmpl, m[1])
+		}
+	}
+	return nil
+}
+
+// expand returns the name of the image by the template, without the suffix.
+// The separators left around empty fields, like a missing model, are
+// dropped. An empty name is the old one.
+func (f renameInfo) expand(tmpl string) string {
+	name := renameFieldRe.ReplaceAllStringFunc(tmpl, func(s string) string {
+		return renameFields[s[1:len(s)-1]](f)
+	})
+	name = renameSepRe.ReplaceAllStringFunc(name, func(s string) string { return s[:1] })
+	if name = strings.Trim(name, "_- "); name == "" {
+		return f.name
+	}
+	return name
+}
+
+// readRenameInfo reads the values of the fields of the image at path. The
+// date is the time the photo was taken, or else the modification time.
+func readRenameInfo(path string, n int) (renameInfo, error) {
+	f := renameInfo{name: filepath.Base(rawKey(path)), n: n}
+	file, err := os.Open(path)
+	if err != nil {
+		return f, err
+	}
+	defer file.Close()
+	if ex := readExif(file); ex != nil {
+		if t, err := ex.DateTime(); err == nil {
+			f.date = t
+		}
+		f.make = exifName(ex, exif.Make)
+		f.model = exifName(ex, exif.Model)
+	}
+	if f.date.IsZero() {
+		info, err := file.Stat()
+		if err != nil {
+			return f, err
+		}
+		f.date, f.fileTime = info.ModTime(), true
+	}
+	return f, nil
+}
+
+// exifName returns the string field of the EXIF data as part of a file
+// name: the spaces become dashes and the characters that file systems or
+// shells do not like are dropped.
+func exifName(ex *exif.Exif, name exif.FieldName) string {
+	tag, err := ex.Get(name)
+	if err != nil {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	s = strings.Join(strings.Fields(s), "-")
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|'$`, r) || r < ' ' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// renamePlan is the renaming of the files of an image.
+type renamePlan struct {
+	icon      *Icon
+	info      renameInfo
+	from, to  []string // the files of the image and their new names
+	overwrite bool     // some new names exist and are replaced
+}
+
+// planRenames computes the new names of the images of the icons by the
+// template and the policy c for the names that exist or are taken by an
+// earlier image. The files of an image, like its RAW and its XMP sidecar,
+// get the same new name with their own suffixes. Images that keep their
+// names or are skipped by the policy are left out and logged.
+func planRenames(icons []*Icon, tmpl string, c collision) []renamePlan {
+	var plans []renamePlan
+	taken := make(map[string]bool) // the new names of the earlier images
+	for n, icon := range icons {
+		if _, remote := remoteSourceOf(icon.path); remote {
+			log.Printf("rename: %s: remote images cannot be renamed", icon.path)
+			continue
+		}
+		info, err := readRenameInfo(icon.path, n+1)
+		if err != nil {
+			log.Printf("rename: %v", err)
+			continue
+		}
+		p := renamePlan{icon: icon, info: info, from: renameFiles(icon)}
+		stem := filepath.Join(filepath.Dir(icon.path), info.expand(tmpl))
+		if stem == rawKey(icon.path) {
+			continue
+		}
+		for k := 1; ; k++ {
+			try := stem
+			if k > 1 {
+				try = fmt.Sprintf("%s-%d", stem, k)
+			}
+			p.to = renameTargets(p.from, rawKey(icon.path), try)
+			clash, exists := renameClash(p.from, p.to, taken)
+			if !clash {
+				break
+			}
+			if !exists || c == collisionRename {
+				continue
+			}
+			if c == collisionOverwrite || c == collisionAsk && askYesNo(fmt.Sprintf("%s exists, overwrite it?", p.to[0])) {
+				p.overwrite = true
+				break
+			}
+			log.Printf("rename: %s: %v", icon.path, errSkipped)
+			p.to = nil
+			break
+		}
+		if p.to == nil {
+			continue
+		}
+		for _, name := range p.to {
+			taken[name] = true
+		}
+		plans = append(plans, p)
+	}
+	return plans
+}
+
+// renameFiles returns the files of the image of the icon together with its
+// XMP sidecars.
+func renameFiles(icon *Icon) []string {
+	files := icon.Files()
+	for _, name := range []string{rawKey(icon.path) + ".xmp", rawKey(icon.path) + ".XMP", icon.path + ".xmp"} {
+		if _, err := os.Lstat(name); err == nil {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// renameTargets returns the new names of the files, which share the old
+// stem, for the new stem.
+func renameTargets(files []string, oldStem, newStem string) []string {
+	to := make([]string, len(files))
+	for i, name := range files {
+		if rest, ok := strings.CutPrefix(name, oldStem); ok {
+			to[i] = newStem + rest
+		} else {
+			to[i] = newStem + filepath.Ext(name)
+		}
+	}
+	return to
+}
+
+// renameClash reports whether a new name is taken by an earlier image of
+// the batch or exists, and whether any exists on disk. The files being
+// renamed do not count as existing.
+func renameClash(from, to []string, taken map[string]bool) (clash, exists bool) {
+	for _, name := range to {
+		if taken[name] {
+			return true, false
+		}
+	}
+	for _, name := range to {
+		if _, err := os.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		isSource := false
+		for _, f := range from {
+			if f == name {
+				isSource = true
+			}
+		}
+		if !isSource {
+			clash, exists = true, true
+		}
+	}
+	return clash, exists
+}
+
+// apply renames the files of the image and updates the icon and its tags.
+// If a file cannot be renamed, the files already renamed are put back.
+func (p renamePlan) apply() error {
+	c := collisionSkip // a file created after the plan is not replaced
+	if p.overwrite {
+		c = collisionOverwrite
+	}
+	for i := range p.from {
+		if _, err := moveFile(p.from[i], p.to[i], c); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if _, rerr := moveFile(p.to[j], p.from[j], collisionSkip); rerr != nil {
+					log.Printf("rename: %v", rerr)
+				}
+			}
+			return fmt.Errorf("rename: %w", err)
+		}
+	}
+	old := p.icon.path
+	p.icon.setPaths(p.to[0], p.to[1:len(p.icon.siblings)+1])
+	// the operations of the journal before the rename follow the image
+	journal.Record("rename", old, p.icon.path)
+	if err := imageTags.Rename(old, p.icon.path); err != nil {
+		log.Printf("%v", err)
+	}
+	return nil
+}
+
+// renameMarked asks for a template, previews the new names of the marked
+// images and renames them if confirmed.
+func (dctl *DisplayControl) renameMarked(marked []*Icon) {
+	prompt := fmt.Sprintf("rename to, {date} {time} {year} {month} {day} {make} {model} {name} {n} (%s): ", *renameTo)
+	tmpl, ok := dctl.readText(prompt, func(string) []string { return nil })
+	if !ok {
+		return
+	}
+	if tmpl == "" {
+		tmpl = *renameTo
+	}
+	if err := checkRenameTemplate(tmpl); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	var plans []renamePlan
+	dctl.showWaitingAndCall(func() {
+		plans = planRenames(marked, tmpl, collides)
+	})
+	if len(plans) == 0 {
+		log.Printf("rename: no marked image gets a new name")
+		return
+	}
+
+	var lines []string
+	for _, p := range plans {
+		line := fmt.Sprintf("%s -> %s", p.from[0], filepath.Base(p.to[0]))
+		if p.info.fileTime {
+			line += "  (no EXIF date, by the file time)"
+		}
+		if p.overwrite {
+			line += "  (replaces the existing file)"
+		}
+		lines = append(lines, line)
+	}
+	title := fmt.Sprintf("rename %d images? enter to apply, esc to cancel", len(plans))
+	if !dctl.confirm(title, lines) {
+		return
+	}
+	n := 0
+	for _, p := range plans {
+		if err := p.apply(); err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		n++
+	}
+	log.Printf("rename: renamed %d images", n)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// renderIndex is the HTML page of the contact sheets.
+var renderIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="background: #666666">
+{{range .Sheets}}<p><a href="{{.}}"><img src="{{.}}" style="max-width: 100%"></a></p>
+{{end}}</body>
+</html>
+`))
+
+// runRender renders the images of paths without a display, as contact sheets
+// in dir. Each sheet is a page of the icons view, for the window and icon
+// sizes, and index.html displays them all.
+func runRender(paths []string, dir string) error {
+	icons := StartScanner(paths).Wait()
+	if !*rawOrder {
+		if err := sortIcons(icons, *sortKey); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+
+	grid := NewGrid(image.Rectangle{Max: windowSize}, iconSize, padding)
+	if grid.Area() == 0 {
+		return fmt.Errorf("render: the icons do not fit in the window")
+	}
+	var sheets []string
+	for from := 0; from < len(icons); from += grid.Area() {
+		to := min(len(icons), from+grid.Area())
+		name := fmt.Sprintf("sheet-%03d.png", len(sheets)+1)
+		if err := writePNG(filepath.Join(dir, name), renderSheet(grid, icons[from:to])); err != nil {
+			return fmt.Errorf("render: %w", err)
+		}
+		log.Printf("render: %s, images %d-%d of %d", name, from+1, to, len(icons))
+		sheets = append(sheets, name)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	err = renderIndex.Execute(f, struct {
+		Title  string
+		Sheets []string
+	}{progName, sheets})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	return nil
+}
+
+// renderSheet draws the icons on a page of the grid, like paintIcons.
+// The sheet is the paintable area of the grid with a margin.
+func renderSheet(grid *Grid, icons []*Icon) *image.RGBA {
+	ir := grid.PaintableArea()
+	_, cols := grid.Dimensions()
+	cell := grid.CellSize()
+	pad := image.Pt(grid.padding, grid.padding)
+	iconRect := image.Rectangle{Max: grid.iconSize}
+
+	sheet := image.NewRGBA(image.Rectangle{ir.Min, ir.Max.Add(pad)})
+	draw.Draw(sheet, sheet.Rect, image.NewUniform(rgbaOf(darkgrey)), image.Point{}, draw.Src)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	for n, icon := range icons {
+		pin := ir.Min.Add(image.Pt(n%cols*cell.X, n/cols*cell.Y))
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			img, err := renderIcon(icon)
+			if err != nil {
+				log.Printf("render: %s: %v", icon.path, err)
+				return
+			}
+			dimg := scaleToFit(nil, img, iconRect)
+			// the icons do not overlap, so they can be drawn concurrently
+			dr := center(iconRect.Add(pin).Add(pad), dimg.Bounds())
+			draw.Draw(sheet, dr, dimg, dimg.Rect.Min, draw.Src)
+			putBytes(dimg.Pix)
+		}()
+	}
+	wg.Wait()
+	return sheet
+}
+
+// renderIcon decodes the image of the icon, upright if -orient.
+func renderIcon(icon *Icon) (image.Image, error) {
+	data, err := readImageFile(icon.path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := decodeFrame(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if *orientImages {
+		img = orient(img, exifOrientation(readExif(bytes.NewReader(data))))
+	}
+	return img, nil
+}
+
+// writePNG writes img to the file name.
+func writePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rgbaOf converts a draw9 color to a Go color.
+func rgbaOf(c draw9.Color) color.RGBA {
+	return color.RGBA{uint8(c >> 24), uint8(c >> 16), uint8(c >> 8), uint8(c)}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3Source is a RemoteSource for s3://bucket/prefix URLs. The credentials,
+// the region and an optional endpoint for S3 compatible stores are taken from
+// the environment variables used by the AWS tools: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION and AWS_ENDPOINT_URL.
+// Without credentials the requests are anonymous, which works for public buckets.
+type s3Source struct {
+	client *http.Client
+}
+
+func newS3Source() *s3Source {
+	return &s3Source{client: &http.Client{Timeout: 5 * time.Minute}}
+}
+
+// s3Object is the file info of an object or a prefix of a bucket.
+type s3Object struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (o *s3Object) Name() string       { return path.Base(o.name) }
+func (o *s3Object) Size() int64        { return o.size }
+func (o *s3Object) ModTime() time.Time { return o.modTime }
+func (o *s3Object) IsDir() bool        { return o.dir }
+func (o *s3Object) Sys() any           { return nil }
+
+func (o *s3Object) Mode() fs.FileMode {
+	if o.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// parseS3 splits an s3 URL to the bucket and the key.
+func parseS3(rawURL string) (string, string, error) {
+	rest, ok := strings.CutPrefix(rawURL, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("s3: bad url %s", rawURL)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("s3: no bucket in %s", rawURL)
+	}
+	return bucket, key, nil
+}
+
+func (s *s3Source) Walk(root string, fn fs.WalkDirFunc) error {
+	bucket, prefix, err := parseS3(root)
+	if err != nil {
+		return err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	err = fn(root, fs.FileInfoToDirEntry(&s3Object{name: prefix, dir: true}), nil)
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var result struct {
+		Contents []struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+		IsTruncated           bool
+		NextContinuationToken string
+	}
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		body, err := s.do("GET", bucket, "", query)
+		if err != nil {
+			return err
+		}
+		err = xml.Unmarshal(body, &result)
+		if err != nil {
+			return fmt.Errorf("s3: list %s: %w", root, err)
+		}
+		for _, obj := range result.Contents {
+			if strings.HasSuffix(obj.Key, "/") {
+				continue
+			}
+			info := &s3Object{name: obj.Key, size: obj.Size, modTime: obj.LastModified}
+			err := fn("s3://"+bucket+"/"+obj.Key, fs.FileInfoToDirEntry(info), nil)
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			} else if err != nil && !errors.Is(err, fs.SkipDir) {
+				return err
+			}
+		}
+		if !result.IsTruncated {
+			return nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+		result.Contents = nil
+	}
+}
+
+// Stat returns the info of the object. Keys that are not objects are
+// considered prefixes, like directories.
+func (s *s3Source) Stat(rawURL string) (fs.FileInfo, error) {
+	bucket, key, err := parseS3(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		return &s3Object{name: key, dir: true}, nil
+	}
+	resp, err := s.request("HEAD", bucket, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &s3Object{name: key, size: resp.ContentLength, modTime: modTime}, nil
+	case http.StatusNotFound:
+		return &s3Object{name: key, dir: true}, nil
+	default:
+		return nil, fmt.Errorf("s3: stat %s: %s", rawURL, resp.Status)
+	}
+}
+
+func (s *s3Source) ReadFile(rawURL string) ([]byte, error) {
+	bucket, key, err := parseS3(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return s.do("GET", bucket, key, nil)
+}
+
+// do sends a request and returns the body of a successful response.
+func (s *s3Source) do(method, bucket, key string, query url.Values) ([]byte, error) {
+	resp, err := s.request(method, bucket, key, query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %s/%s: %w", bucket, key, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3: %s/%s: %s", bucket, key, resp.Status)
+	}
+	return body, nil
+}
+
+// request sends a signed request for the key of the bucket.
+func (s *s3Source) request(method, bucket, key string, query url.Values) (*http.Response, error) {
+	region := cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	var u *url.URL
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		// S3 compatible stores usually need path style requests
+		var err error
+		if u, err = url.Parse(endpoint); err != nil {
+			return nil, fmt.Errorf("s3: bad endpoint: %w", err)
+		}
+		u.Path = path.Join("/", u.Path, bucket, key)
+	} else {
+		u = &url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/" + key}
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	signS3Request(req, u, region, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	return resp, nil
+}
+
+// signS3Request signs the request with AWS signature version 4.
+// It does nothing if there are no credentials in the environment.
+func signS3Request(req *http.Request, u *url.URL, region string, now time.Time) {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return
+	}
+
+	const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("x-amz-security-token", token)
+	}
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("x-amz-security-token") != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	slices.Sort(headers)
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = u.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		u.EscapedPath(),
+		u.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes the query sorted by key, as required by the signature.
+func canonicalQuery(query url.Values) string {
+	var parts []string
+	for k, vs := range query {
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent encodes s as specified by AWS. Slashes are kept unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
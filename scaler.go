@@ -0,0 +1,27 @@
+package main
+
+import (
+	"image"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// tinySize is the largest dimension of images that are scaled with nearest neighbor.
+	tinySize = 64
+	// largeDownscale is the ratio above which the best scaler is worth its cost.
+	largeDownscale = 4
+)
+
+// chooseScaler picks the scaler for scaling src to dst. Nearest neighbor is enough
+// for tiny images or no scaling, bilinear for medium ratios and Catmull-Rom is used
+// only for large downscales, where the others produce visible artifacts.
+func chooseScaler(src, dst image.Rectangle) xdraw.Scaler {
+	if src.Size().Eq(dst.Size()) || max(src.Dx(), src.Dy(), dst.Dx(), dst.Dy()) <= tinySize {
+		return xdraw.NearestNeighbor
+	}
+	if dst.Dx() > 0 && src.Dx() >= largeDownscale*dst.Dx() {
+		return xdraw.CatmullRom
+	}
+	return xdraw.BiLinear
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// scanBatchSize is the maximum number of icons in a batch of a Scanner.
+	scanBatchSize = 512
+	// scanBatchInterval is the maximum time a Scanner holds found icons before sending them.
+	scanBatchInterval = 200 * time.Millisecond
+	// scanQuietTime is how long to wait for a scan before displaying its progress.
+	scanQuietTime = 500 * time.Millisecond
+)
+
+// Scanner finds the images of paths in a background goroutine and sends them
+// in batches, so that the user can browse the images found while the scan continues.
+// The scan blocks if nobody receives the batches.
+type Scanner struct {
+	// C delivers batches of icons. It is closed when the scan ends.
+	C <-chan []*Icon
+
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	found  []*Icon
+}
+
+// StartScanner starts scanning paths for images.
+func StartScanner(paths []string) *Scanner {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan []*Icon)
+	s := &Scanner{C: c, cancel: cancel}
+	go func() {
+		defer close(c)
+		var batch []*Icon
+		last := time.Now()
+		emit := func(icons []*Icon, force bool) {
+			batch = append(batch, icons...)
+			if len(batch) == 0 || !(force || len(batch) >= scanBatchSize || time.Since(last) >= scanBatchInterval) {
+				return
+			}
+			s.mu.Lock()
+			s.found = append(s.found, batch...)
+			s.mu.Unlock()
+			select {
+			case c <- batch:
+			case <-ctx.Done():
+			}
+			batch, last = nil, time.Now()
+		}
+		for _, p := range paths {
+			if ctx.Err() != nil {
+				break
+			}
+			addImagesOfPath(ctx, p, emit)
+		}
+		emit(nil, true)
+	}()
+	return s
+}
+
+// Cancel stops the scan. The images found so far are kept.
+func (s *Scanner) Cancel() {
+	s.cancel()
+}
+
+// Found returns the icons sent so far.
+func (s *Scanner) Found() []*Icon {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.found
+}
+
+// Wait receives all the batches until the scan ends and returns the icons found.
+func (s *Scanner) Wait() []*Icon {
+	for range s.C {
+	}
+	return s.Found()
+}
+
+// addImagesOfPath adds the image at path, descending it if a directory.
+// Paths may also be URLs of remote sources.
+func addImagesOfPath(ctx context.Context, name string, emit func([]*Icon, bool)) {
+	stat, walk := os.Stat, filepath.WalkDir
+	src, remote := remoteSourceOf(name)
+	if remote {
+		stat, walk = src.Stat, src.Walk
+	}
+
+	info, err := stat(name)
+	if err != nil {
+		log.Printf("addImagesOfPath: cannot stat file: %v", err)
+		return
+	}
+	if info.IsDir() {
+		scanForImages(ctx, name, walk, emit)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		log.Printf("addImagesOfPath: ignoring special file %s", name)
+		return
+	}
+	if !*sniff && !isImageFile(name) {
+		return
+	}
+	icon := NewIcon(name)
+	if !remote && !isRawFile(name) {
+		if raw, ok := findRawSibling(name); ok {
+			icon.siblings = append(icon.siblings, raw)
+		}
+	}
+	emit([]*Icon{icon}, false)
+}
+
+// scanForImages walks dir with walk and adds the images found. The images of a directory
+// are held until the walk leaves it, so that they can be paired with their RAW files.
+// Unreadable directories are skipped.
+func scanForImages(ctx context.Context, dir string, walk func(string, fs.WalkDirFunc) error, emit func([]*Icon, bool)) {
+	var pending []*Icon
+	var pendingDir string
+	raws := make(map[string]string)
+
+	flush := func() {
+		emit(pairRawSiblings(pending, raws), false)
+		pending = nil
+		clear(raws)
+	}
+	// flushBatch flushes a full batch in the middle of a directory, holding
+	// back the files of the shot of path. The files of a shot differ only in
+	// the suffix and the walk is in lexical order, so those before it are
+	// all seen.
+	flushBatch := func(path string) {
+		shot := func(p string) bool { return strings.HasPrefix(path, rawKey(p)+".") }
+		var held []*Icon
+		pending = slices.DeleteFunc(pending, func(icon *Icon) bool {
+			if shot(icon.path) {
+				held = append(held, icon)
+				return true
+			}
+			return false
+		})
+		heldRaws := maps.Clone(raws)
+		maps.DeleteFunc(heldRaws, func(_, raw string) bool { return !shot(raw) })
+		maps.DeleteFunc(raws, func(_, raw string) bool { return shot(raw) })
+		flush()
+		pending = held
+		maps.Copy(raws, heldRaws)
+	}
+
+	walkFn := func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			log.Printf("scanForImages: %v", err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			log.Printf("scanForImages: ignoring special file %s", path)
+			return nil
+		}
+		if pd := filepath.Dir(path); pd != pendingDir {
+			flush()
+			pendingDir = pd
+		} else if len(pending) >= scanBatchSize {
+			flushBatch(path)
+		}
+		if isRawFile(path) {
+			raws[rawKey(path)] = path
+			return nil
+		}
+		if !*sniff && !isImageFile(path) {
+			return nil
+		}
+		pending = append(pending, NewIcon(path))
+		return nil
+	}
+
+	if err := walk(dir, walkFn); err != nil {
+		log.Printf("scanForImages: %s: %v", dir, err)
+	}
+	flush()
+}
+
+// collectScan receives batches from the scanner for at most d. It returns the icons
+// received and whether the scan is still running.
+func collectScan(s *Scanner, d time.Duration) ([]*Icon, bool) {
+	var icons []*Icon
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case batch, ok := <-s.C:
+			if !ok {
+				return icons, false
+			}
+			icons = append(icons, batch...)
+		case <-timer.C:
+			return icons, true
+		}
+	}
+}
+
+// waitForScan displays the progress of the scan until it ends. The user can stop
+// the scan with esc and, if browseEarly is set, start browsing the images found
+// with enter while the scan continues. It returns the icons found and whether the
+// scan is still running.
+func (dctl *DisplayControl) waitForScan(s *Scanner, icons []*Icon, browseEarly bool) ([]*Icon, bool) {
+	stopping := false
+	paint := func() {
+		msg := fmt.Sprintf("scanning: %d images found. esc to stop", len(icons))
+		if stopping {
+			msg = fmt.Sprintf("stopping scan: %d images found", len(icons))
+		} else if browseEarly && len(icons) > 0 {
+			msg += ", enter to browse"
+		}
+		dctl.cls()
+		dctl.screen.String(dctl.screen.Bounds().Min, dctl.fontColor, msg)
+		if err := dctl.screen.Flush(); err != nil {
+			log.Printf("display: flush: %v", err)
+		}
+	}
+
+	paint()
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case batch, ok := <-s.C:
+			if !ok {
+				return icons, false
+			}
+			icons = append(icons, batch...)
+			paint()
+		case k := <-dctl.kctl.C:
+			switch k {
+			case 'q', escKey: // stop scan
+				s.Cancel()
+				stopping = true
+				paint()
+			case '\n': // browse
+				if browseEarly && !stopping && len(icons) > 0 {
+					return icons, true
+				}
+			}
+		case <-dctl.mctl.C:
+		case <-dctl.mctl.Resize:
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			paint()
+		}
+	}
+}
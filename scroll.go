@@ -0,0 +1,76 @@
+package main
+
+import "time"
+
+const (
+	// burstInterval is the maximum time between scroll events of a burst.
+	burstInterval = 80 * time.Millisecond
+	// maxAccel is the maximum acceleration of scrolling in bursts.
+	maxAccel = 8
+)
+
+// scrollState tracks the bursts of scroll events, for acceleration.
+type scrollState struct {
+	last  time.Time
+	burst int
+}
+
+// accel returns the acceleration for a scroll event. Events that arrive
+// in bursts, like a held key or a fast spinning wheel, scroll more.
+func (s *scrollState) accel() int {
+	now := time.Now()
+	if now.Sub(s.last) < burstInterval {
+		s.burst++
+	} else {
+		s.burst = 0
+	}
+	s.last = now
+	return min(maxAccel, 1+s.burst/4)
+}
+
+// scroll scrolls o by rows and wheel steps, negative is up. The scroll events
+// already pending are added, so that a burst is painted once. A pending event
+// that is not a scroll ends the burst and is sent back to be handled by the view.
+func (dctl *DisplayControl) scroll(o *Offset, rows, wheels int) {
+	a := dctl.scrolling.accel()
+	rows, wheels = rows*a, wheels*a
+drain:
+	for {
+		select {
+		case k := <-dctl.kctl.C:
+			switch k {
+			case upArrowKey:
+				rows -= dctl.scrolling.accel()
+			case downArrowKey:
+				rows += dctl.scrolling.accel()
+			default:
+				dctl.unreadKey(k)
+				break drain
+			}
+		case m := <-dctl.mctl.C:
+			switch m.Buttons {
+			case 0: // motion between wheel steps
+				dctl.mctl.Mouse = m
+			case scrollWheelUp:
+				wheels -= dctl.scrolling.accel()
+			case scrollWheelDown:
+				wheels += dctl.scrolling.accel()
+			default:
+				dctl.unreadMouse(m)
+				break drain
+			}
+		default:
+			break drain
+		}
+	}
+
+	for ; rows < 0; rows++ {
+		o.MoveUpRow()
+	}
+	for ; rows > 0; rows-- {
+		o.MoveDownRow()
+	}
+	if wheels != 0 {
+		o.ScrollPixels(wheels * o.grid.CellSize().Y / wheelSteps)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "image"
+
+// paintScrollbar draws the scroll bar of the grid. The thumb shows
+// the visible icons as part of all the icons.
+func paintScrollbar(dctl *DisplayControl, o *Offset) {
+	r := o.grid.Scrollbar()
+	dctl.screen.Draw(r, dctl.scrollColor, image.Point{})
+	dctl.screen.Draw(o.Thumb(r.Inset(1)), dctl.bgColor, image.Point{})
+}
+
+// scrollWithMouse handles a click on the scroll bar, the Plan 9 way.
+// Button 1 scrolls up and button 3 scrolls down, more rows the lower
+// the click. Button 2 jumps to the position and scrolls as it is dragged.
+// It calls paint whenever the offset changes.
+func (dctl *DisplayControl) scrollWithMouse(o *Offset, paint func()) {
+	r := o.grid.Scrollbar()
+	m := dctl.mctl.Mouse
+	switch m.Buttons {
+	case 1, 4:
+		n := 1 + (m.Point.Y-r.Min.Y)/(o.grid.iconSize.Y+o.grid.padding)
+		for range n {
+			if m.Buttons == 1 {
+				o.MoveUpRow()
+			} else {
+				o.MoveDownRow()
+			}
+		}
+		paint()
+	case 2:
+		for m.Buttons == 2 {
+			pos := o.pos
+			if o.ScrollTo(r, m.Point.Y); o.pos != pos {
+				paint()
+			}
+			m = <-dctl.mctl.C
+		}
+	}
+	dctl.mctl.Mouse = m
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+
+	draw9 "9fans.net/go/draw"
+	xdraw "golang.org/x/image/draw"
+)
+
+// scrollStrip is the height of the strips in which ScrollView uploads the
+// images. Only the strips near the visible part are kept in the display.
+const scrollStrip = 512
+
+// scrollPositions remembers where each image was left in the scroll view,
+// as a fraction of its height, so that it survives resizes.
+var scrollPositions = make(map[string]float64)
+
+// ScrollView is a View that shows tall images, like webtoons and long
+// screenshots, at the width of the window and pans them vertically with the
+// wheel. Scrolling past the end of an image continues with the next one.
+type ScrollView struct {
+	icons    []*Icon
+	at       int
+	area     image.Rectangle
+	showInfo bool
+	src      image.Image // the current image, decoded
+	err      error       // why there is no src
+	width    int         // the width of the image on the display
+	height   int         // the height of the image on the display
+	y        int         // the row of the scaled image at the top of the area
+	strips   map[int]ScreenImage
+
+	dctl *DisplayControl
+}
+
+// NewScrollView returns a ScrollView that starts at the image at.
+func NewScrollView(icons []*Icon, at int, r image.Rectangle) *ScrollView {
+	return &ScrollView{
+		icons:  icons,
+		at:     at,
+		area:   r,
+		strips: make(map[int]ScreenImage),
+	}
+}
+
+func (sv *ScrollView) Connect(dctl *DisplayControl) {
+	sv.dctl = dctl
+}
+
+func (sv *ScrollView) Attach(r image.Rectangle) {
+	if r.Eq(sv.area) {
+		return
+	}
+	sv.remember()
+	sv.freeStrips(0, -1)
+	sv.area = r
+	sv.fit()
+	sv.restore()
+}
+
+func (sv *ScrollView) Free() {
+	sv.remember()
+	sv.freeStrips(0, -1)
+	sv.src = nil
+}
+
+func (sv *ScrollView) Handle() View {
+	bt2menu := &draw9.Menu{
+		Item: []string{"info", "mark", "plumb", "", "prev image", "next image", "", "back"},
+	}
+
+	dctl := sv.dctl
+	sv.load(sv.at)
+	sv.restore()
+	sv.paint(dctl)
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case k := <-dctl.kctl.C:
+			switch k {
+			case 'q', 'b', escKey: // back
+				return nil
+			case upArrowKey: // scroll up
+				sv.scroll(-sv.area.Dy() / 4)
+			case downArrowKey: // scroll down
+				sv.scroll(sv.area.Dy() / 4)
+			case ' ': // next screen
+				sv.scroll(sv.area.Dy() * 9 / 10)
+			case leftArrowKey: // prev image
+				sv.goTo(sv.at - 1)
+			case rightArrowKey: // next image
+				sv.goTo(sv.at + 1)
+			case 'i': // info
+				sv.showInfo = !sv.showInfo
+			case 'm': // mark
+				sv.icons[sv.at].ToggleMarked()
+			case 'p': // plumb
+				plumbImage(sv.icons[sv.at].path)
+			case 'S': // snapshot
+				dctl.snapshot()
+				continue
+			default:
+				continue
+			}
+			sv.paint(dctl)
+		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			switch dctl.mctl.Mouse.Buttons {
+			case scrollWheelUp: // scroll up
+				sv.scroll(-sv.area.Dy() / 8)
+			case scrollWheelDown: // scroll down
+				sv.scroll(sv.area.Dy() / 8)
+			case 1: // prev image
+				sv.goTo(sv.at - 1)
+			case 4: // next image
+				sv.goTo(sv.at + 1)
+			case 2: // view menu
+				switch dctl.screen.MenuHit(2, bt2menu) {
+				case 0: // info
+					sv.showInfo = !sv.showInfo
+				case 1: // mark
+					sv.icons[sv.at].ToggleMarked()
+				case 2: // plumb
+					plumbImage(sv.icons[sv.at].path)
+				case 4: // prev image
+					sv.goTo(sv.at - 1)
+				case 5: // next image
+					sv.goTo(sv.at + 1)
+				case 7: // back
+					return nil
+				default:
+					continue
+				}
+			default:
+				continue
+			}
+			sv.paint(dctl)
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			dctl.applyCtl(req)
+			sv.paint(dctl)
+		case path := <-dctl.gotoC: // looked at in the acme list
+			if i := indexOfPath(sv.icons, path); i >= 0 {
+				sv.goTo(i)
+				sv.paint(dctl)
+			}
+		case <-dctl.mctl.Resize:
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			sv.Attach(dctl.screen.Bounds())
+			sv.paint(dctl)
+		}
+	}
+}
+
+// load decodes the image i and makes it current.
+func (sv *ScrollView) load(i int) {
+	sv.freeStrips(0, -1)
+	sv.at = i
+	sv.dctl.showWaitingAndCall(func() {
+		sv.src, sv.err = renderIcon(sv.icons[i])
+	})
+	if sv.err != nil {
+		log.Printf("scrollView: %v", sv.err)
+	}
+	sv.fit()
+	sessionEvent("view", sv.icons[i].path)
+}
+
+// fit computes the size of the current image on the display. Images are
+// fitted to the width of the area, but they are not enlarged.
+func (sv *ScrollView) fit() {
+	sv.width, sv.height, sv.y = 0, 0, 0
+	if sv.src == nil {
+		return
+	}
+	b := sv.src.Bounds()
+	sv.width = min(sv.area.Dx(), b.Dx())
+	sv.height = max(1, b.Dy()*sv.width/b.Dx())
+}
+
+// goTo makes the image i current and restores its remembered position.
+func (sv *ScrollView) goTo(i int) {
+	if i < 0 || i >= len(sv.icons) || i == sv.at {
+		return
+	}
+	sv.remember()
+	sv.load(i)
+	sv.restore()
+}
+
+// remember saves the position of the current image.
+func (sv *ScrollView) remember() {
+	if sv.height > 0 {
+		scrollPositions[sv.icons[sv.at].path] = float64(sv.y) / float64(sv.height)
+	}
+}
+
+// restore moves to the remembered position of the current image.
+func (sv *ScrollView) restore() {
+	sv.y = int(scrollPositions[sv.icons[sv.at].path] * float64(sv.height))
+	sv.clamp()
+}
+
+// maxY returns the largest valid position of the current image.
+func (sv *ScrollView) maxY() int {
+	return max(0, sv.height-sv.area.Dy())
+}
+
+func (sv *ScrollView) clamp() {
+	sv.y = min(max(sv.y, 0), sv.maxY())
+}
+
+// scroll moves the image by dy rows. Scrolling past the end of the image
+// continues at the top of the next one, and before the start at the
+// bottom of the previous one.
+func (sv *ScrollView) scroll(dy int) {
+	switch {
+	case dy > 0 && sv.y == sv.maxY() && sv.at+1 < len(sv.icons):
+		sv.remember()
+		sv.load(sv.at + 1)
+	case dy < 0 && sv.y == 0 && sv.at > 0:
+		sv.remember()
+		sv.load(sv.at - 1)
+		sv.y = sv.maxY()
+	default:
+		sv.y += dy
+		sv.clamp()
+	}
+}
+
+// visibleStrips returns the range of the strips in the area.
+func (sv *ScrollView) visibleStrips() (int, int) {
+	return sv.y / scrollStrip, (min(sv.y+sv.area.Dy(), sv.height) - 1) / scrollStrip
+}
+
+// loadStrips uploads the visible strips and frees the others.
+func (sv *ScrollView) loadStrips() {
+	if sv.src == nil {
+		return
+	}
+	first, last := sv.visibleStrips()
+	sv.freeStrips(first-1, last+1)
+	for k := first; k <= last; k++ {
+		if sv.strips[k] != nil {
+			continue
+		}
+		img, err := sv.scaleStrip(k)
+		if err != nil {
+			log.Printf("scrollView: strip %d of %s: %v", k, sv.icons[sv.at].path, err)
+			continue
+		}
+		sv.strips[k] = img
+	}
+}
+
+// scaleStrip scales the rows of the source that make the strip k and
+// uploads them to the display.
+func (sv *ScrollView) scaleStrip(k int) (ScreenImage, error) {
+	b := sv.src.Bounds()
+	y0, y1 := k*scrollStrip, min((k+1)*scrollStrip, sv.height)
+	sr := image.Rect(b.Min.X, b.Min.Y+y0*b.Dy()/sv.height, b.Max.X, b.Min.Y+y1*b.Dy()/sv.height)
+	dr := image.Rect(0, 0, sv.width, y1-y0)
+	dimg := newPooledRGBA(dr)
+	chooseScaler(sr, dr).Scale(dimg, dr, sv.src, sr, xdraw.Src, nil)
+	t, err := uploadRGBA(sv.dctl.screen, dimg, false)
+	putBytes(dimg.Pix)
+	return t, err
+}
+
+// freeStrips frees the strips outside first-last. If last < first, it frees all.
+func (sv *ScrollView) freeStrips(first, last int) {
+	sv.dctl.waitPaint()
+	for k, img := range sv.strips {
+		if last >= first && k >= first && k <= last {
+			continue
+		}
+		if err := img.Free(); err != nil {
+			log.Printf("scrollView: failed to free strip: %v", err)
+		}
+		delete(sv.strips, k)
+	}
+}
+
+// paint uploads the visible strips and posts a request to paint them.
+func (sv *ScrollView) paint(dctl *DisplayControl) {
+	dctl.showWaitingAndCall(sv.loadStrips)
+	s := *sv
+	s.strips = make(map[int]ScreenImage, len(sv.strips))
+	for k, img := range sv.strips {
+		s.strips[k] = img
+	}
+	dctl.post(func() { s.render(dctl) })
+}
+
+// render paints the visible part of the current image, centered horizontally.
+func (sv *ScrollView) render(dctl *DisplayControl) {
+	dctl.painted = nil
+	window := dctl.screen
+	window.Draw(window.Bounds(), dctl.bgColor, image.Point{})
+	fontHeight := window.FontHeight()
+	icon := sv.icons[sv.at]
+
+	if sv.err != nil {
+		window.String(sv.area.Min, dctl.warnColor, fmt.Sprintf("%s: %v", icon.Path(), sv.err))
+	} else {
+		x := sv.area.Min.X + (sv.area.Dx()-sv.width)/2
+		first, last := sv.visibleStrips()
+		for k := first; k <= last; k++ {
+			if img := sv.strips[k]; img != nil {
+				p := image.Pt(x, sv.area.Min.Y+k*scrollStrip-sv.y)
+				drawClipped(window, image.Rectangle{p, p.Add(img.Bounds().Size())}, img, sv.area)
+			}
+		}
+	}
+	if sv.showInfo {
+		pos := 100
+		if sv.maxY() > 0 {
+			pos = 100 * sv.y / sv.maxY()
+		}
+		info := fmt.Sprintf("%d/%d %s %d%%", sv.at+1, len(sv.icons), icon.Path(), pos)
+		window.StringBg(sv.area.Min, dctl.fontColor, info, dctl.bgColor)
+	}
+	if icon.Marked() {
+		mr := image.Rect(sv.area.Max.X-50, sv.area.Min.Y, sv.area.Max.X, sv.area.Min.Y+fontHeight)
+		window.Draw(mr, dctl.borderColor, image.Point{})
+	}
+
+	if err := window.Flush(); err != nil {
+		log.Printf("display: flush: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os/exec"
+	"path"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+// sftpSource is a RemoteSource for sftp://[user@]host[:port]/path URLs.
+// Paths starting with /~/ are relative to the home directory.
+// It runs the ssh command for the connection, so that authentication
+// uses the ssh configuration and agent of the user.
+type sftpSource struct {
+	mu      sync.Mutex
+	clients map[string]*sftp.Client // by user@host:port
+}
+
+func newSFTPSource() *sftpSource {
+	return &sftpSource{clients: make(map[string]*sftp.Client)}
+}
+
+// parseSFTP splits an sftp URL to the URL of the server and the remote path.
+func parseSFTP(rawURL string) (*url.URL, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != "sftp" || u.Host == "" {
+		return nil, "", fmt.Errorf("sftp: bad url %s", rawURL)
+	}
+	p := u.Path
+	if rel, ok := cutPrefixDir(p, "/~"); ok {
+		p = rel
+	}
+	if p == "" {
+		p = "."
+	}
+	return u, p, nil
+}
+
+// cutPrefixDir returns p without the directory prefix.
+func cutPrefixDir(p, prefix string) (string, bool) {
+	if p == prefix {
+		return "", true
+	}
+	if len(p) > len(prefix) && p[:len(prefix)+1] == prefix+"/" {
+		return p[len(prefix)+1:], true
+	}
+	return p, false
+}
+
+// toURL returns the URL for the remote path on the server of u.
+func toURL(u *url.URL, p string) string {
+	if !path.IsAbs(p) {
+		p = "/~/" + p
+	}
+	return (&url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host, Path: p}).String()
+}
+
+// client returns a client connected to the server of u.
+func (s *sftpSource) client(u *url.URL) (*sftp.Client, error) {
+	key := u.User.String() + "@" + u.Host
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.clients[key]; ok {
+		return c, nil
+	}
+
+	var args []string
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	if user := u.User.Username(); user != "" {
+		args = append(args, "-l", user)
+	}
+	args = append(args, u.Hostname(), "-s", "sftp")
+	cmd := exec.Command("ssh", args...)
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	c, err := sftp.NewClientPipe(r, w)
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("sftp: %s: %w", u.Host, err)
+	}
+	s.clients[key] = c
+	return c, nil
+}
+
+func (s *sftpSource) Walk(root string, fn fs.WalkDirFunc) error {
+	u, p, err := parseSFTP(root)
+	if err != nil {
+		return err
+	}
+	c, err := s.client(u)
+	if err != nil {
+		return err
+	}
+	for w := c.Walk(p); w.Step(); {
+		var d fs.DirEntry
+		if info := w.Stat(); info != nil {
+			d = fs.FileInfoToDirEntry(info)
+		}
+		err := fn(toURL(u, w.Path()), d, w.Err())
+		switch {
+		case errors.Is(err, fs.SkipAll):
+			return nil
+		case errors.Is(err, fs.SkipDir):
+			if d != nil && d.IsDir() {
+				w.SkipDir()
+			}
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sftpSource) Stat(rawURL string) (fs.FileInfo, error) {
+	u, p, err := parseSFTP(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.client(u)
+	if err != nil {
+		return nil, err
+	}
+	return c.Stat(p)
+}
+
+func (s *sftpSource) ReadFile(rawURL string) ([]byte, error) {
+	u, p, err := parseSFTP(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.client(u)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -4,37 +4,67 @@ import (
 	"fmt"
 	"image"
 	"log"
+	"slices"
+	"strings"
+	"time"
 
 	draw9 "9fans.net/go/draw"
 )
 
 // SingleView is a View that show single images at large scale.
 type SingleView struct {
-	icons      []*Icon
-	iconsCache CachedSlice[*IconImage]
-	at         int
-	area       image.Rectangle
-	showInfo   bool
+	icons       []*Icon
+	iconsCache  CachedSlice[*Icon, *IconImage]
+	at          int
+	area        image.Rectangle
+	showInfo    bool
+	wipe        *IconImage // the other version of the image for wipe compare
+	wipeFor     int        // the image compared with wipe
+	wipeX       int        // the position of the wipe line
+	viewed      *Icon      // the image displayed, for the events and the view statistics
+	viewedSince time.Time  // when the viewed image was displayed
+	spread      bool       // display two pages side by side
+	autoCrop    bool       // trim the uniform borders of the images, like scans
+	invert      bool       // invert the colors of the images, like film negatives
+	colorManage bool       // convert the colors to the monitor profile
+	loupe       *loupe     // the magnifier, if on. Replaced, not changed, as the painter has a copy
+	lastInput   time.Time  // when the user last pressed a key or moved the mouse
+	idle        *idleLoad  // loads more while the user is idle
 
 	dctl *DisplayControl
 }
 
 func NewSingleView(icons []*Icon, at int, r image.Rectangle) *SingleView {
 	return &SingleView{
-		icons: icons,
-		at:    at,
-		area:  r,
+		icons:    icons,
+		at:       at,
+		area:     r,
+		autoCrop: *autoCrop,
+		idle:     new(idleLoad),
+
+		colorManage: displayProfile != nil,
 	}
 }
 
 func (sv *SingleView) resetCache() {
+	sv.dctl.waitPaint()
 	if sv.iconsCache != nil {
 		sv.iconsCache.Free()
 	}
-	images := NewIconImages(sv.icons, func(img image.Image) (*draw9.Image, error) {
-		return FitBest(sv.dctl.display, img, sv.area)
-	})
-	sv.iconsCache = NewCachedSlicePaged[*IconImage]("single", images, 2)
+	area := sv.pageArea()
+	useMip := max(area.Dx(), area.Dy()) <= mipSize
+	images := func(icon *Icon) *IconImage {
+		img := icon.NewIconImage(func(img image.Image) (ScreenImage, error) {
+			return FitBest(sv.dctl.screen, img, area)
+		})
+		img.useMip = useMip
+		img.findCodes = *detectCodes
+		img.autoCrop = sv.autoCrop
+		img.invert = sv.invert
+		img.colorMgmt = sv.colorManage
+		return img
+	}
+	sv.iconsCache = NewCachedSlicePaged("single", sv.icons, images, singleCache.withDefaults(2))
 }
 
 func (sv *SingleView) Connect(dctl *DisplayControl) {
@@ -47,101 +77,252 @@ func (sv *SingleView) Attach(r image.Rectangle) {
 		return
 	}
 
+	sv.dctl.waitPaint()
 	sv.dctl.showWaitingAndCall(func() {
 		sv.dctl.cls()
 		sv.area = r
 		sv.resetCache()
+		if sv.wipe != nil {
+			sv.wipe.Unload()
+			sv.wipeX = (r.Min.X + r.Max.X) / 2
+		}
 	})
 }
 
 func (sv *SingleView) Free() {
+	sv.dctl.waitPaint()
 	sv.iconsCache.Free()
+	if sv.wipe != nil {
+		sv.wipe.Unload()
+	}
 }
 
 func (sv *SingleView) Handle() View {
 	bt2menu := &draw9.Menu{
-		Item: []string{"info", "mark", "plumb", "back"},
+		Item: []string{"info", "mark", "plumb", "next frame", "export frame", "wipe", "ocr", "spread", "scroll", "back"},
 	}
 
 	dctl := sv.dctl
+	defer sv.stopViewing()
+	defer func() {
+		if sv.viewed != nil {
+			sv.rememberLoupe(sv.viewed)
+		}
+	}()
+	defer dctl.leaveFullscreen()
+	var idleC <-chan time.Time
+	if *idleLoading {
+		t := time.NewTicker(idleLoadTick)
+		defer t.Stop()
+		idleC = t.C
+	}
 	sv.paint(dctl)
 	for {
 		select {
 		case err := <-dctl.errch:
 			log.Printf("display: %v", err)
 		case k := <-dctl.kctl.C:
+			sv.lastInput = time.Now()
 			switch k {
 			case 'q', 'b', escKey: // back
 				return nil
-			case leftArrowKey: // prev image
-				if sv.at > 0 {
-					sv.at--
+			case '\n': // pick the image with -pick
+				if *pickMode {
+					dctl.picked = sv.icons[sv.at]
+					return nil
+				}
+			case 'f': // fullscreen
+				dctl.toggleFullscreen()
+				sv.paint(dctl)
+			case leftArrowKey: // prev image, next with -rtl. 10 with shift, to the end with ctl
+				if sv.step(arrowStep(-readingDir(), len(sv.icons))) {
+					sv.paint(dctl)
+				}
+			case rightArrowKey: // next image, prev with -rtl. 10 with shift, to the end with ctl
+				if sv.step(arrowStep(readingDir(), len(sv.icons))) {
+					sv.paint(dctl)
+				}
+			case '[', ']': // back and forward in the history of the displayed images
+				d := 1
+				if k == '[' {
+					d = -1
+				}
+				if i, ok := history.step(d, sv.icons); ok {
+					sv.at = i
+					sv.paint(dctl)
+				}
+			case homeKey: // first image
+				if sv.step(-len(sv.icons)) {
 					sv.paint(dctl)
 				}
-			case rightArrowKey: // next image
-				if sv.at < sv.iconsCache.Len()-1 {
-					sv.at++
+			case endKey: // last image
+				if sv.step(len(sv.icons)) {
 					sv.paint(dctl)
 				}
+			case '2': // spread
+				sv.toggleSpread()
+				sv.paint(dctl)
 			case 'i': // info
 				sv.showInfo = !sv.showInfo
 				sv.paint(dctl)
 			case 'm': // mark
-				if icon, ok := sv.iconsCache.At(sv.at); ok {
-					icon.ToggleMarked()
+				sv.icons[sv.at].ToggleMarked()
+				sv.paint(dctl)
+			case 'p': // plumb
+				plumbImage(sv.icons[sv.at].path)
+			case ',': // prev frame
+				sv.stepFrame(-1)
+				sv.paint(dctl)
+			case '.': // next frame
+				sv.stepFrame(1)
+				sv.paint(dctl)
+			case 'x': // export frame
+				sv.exportFrame()
+			case 'w': // wipe compare
+				sv.toggleWipe()
+				sv.paint(dctl)
+			case 't': // ocr
+				dctl.snarfText(sv.icons[sv.at].path)
+			case 'l': // loupe
+				sv.toggleLoupe()
+				sv.paint(dctl)
+			case deleteKey: // move the image to the trash
+				if !sv.trashCurrent() {
+					return nil
+				}
+				sv.paint(dctl)
+			case 'c': // autocrop
+				sv.toggleAutoCrop()
+				sv.paint(dctl)
+			case 'n': // negative
+				sv.toggleInvert()
+				sv.paint(dctl)
+			case 'g': // tag
+				editTags(dctl, []*Icon{sv.icons[sv.at]})
+				sv.paint(dctl)
+			case 'a': // add to a group or remove
+				dctl.assignGroup([]*Icon{sv.icons[sv.at]})
+				sv.paint(dctl)
+			case 'k': // color management
+				if displayProfile != nil {
+					sv.toggleColorManage()
 					sv.paint(dctl)
 				}
-			case 'p': // plumb
-				if icon, ok := sv.iconsCache.At(sv.at); ok {
-					plumbImage(icon.path)
+			case 'v': // scroll tall images
+				return NewScrollView(sv.icons, sv.at, sv.area)
+			case 'h': // heatmap with the other version
+				if other, ok := companionOf(sv.icons, sv.at); ok {
+					return NewHeatmapView(other, sv.icons[sv.at], sv.area)
 				}
+				log.Printf("singleView: no other version of %s to compare", sv.icons[sv.at].path)
+			case 'S': // snapshot
+				dctl.snapshot()
 			}
 		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			sv.lastInput = time.Now()
 			switch dctl.mctl.Mouse.Buttons {
-			case 1: // prev image
-				if sv.at > 0 {
-					sv.at--
+			case 1: // plumb the code under the mouse or prev image
+				if c, ok := sv.codeAt(dctl.mctl.Mouse.Point); ok {
+					plumbCode(c)
+				} else if sv.step(-readingDir()) {
 					sv.paint(dctl)
 				}
 			case 2: // view menu
-				switch draw9.MenuHit(2, dctl.mctl, bt2menu, nil) {
+				switch dctl.screen.MenuHit(2, bt2menu) {
 				case 0: // info
 					sv.showInfo = !sv.showInfo
 					sv.paint(dctl)
 				case 1: // mark
-					if icon, ok := sv.iconsCache.At(sv.at); ok {
-						icon.ToggleMarked()
-						sv.paint(dctl)
-					}
+					sv.icons[sv.at].ToggleMarked()
+					sv.paint(dctl)
 				case 2: // plumb
-					if icon, ok := sv.iconsCache.At(sv.at); ok {
-						plumbImage(icon.path)
-					}
-				case 3: // back
+					plumbImage(sv.icons[sv.at].path)
+				case 3: // next frame
+					sv.stepFrame(1)
+					sv.paint(dctl)
+				case 4: // export frame
+					sv.exportFrame()
+				case 5: // wipe compare
+					sv.toggleWipe()
+					sv.paint(dctl)
+				case 6: // ocr
+					dctl.snarfText(sv.icons[sv.at].path)
+				case 7: // spread
+					sv.toggleSpread()
+					sv.paint(dctl)
+				case 8: // scroll tall images
+					return NewScrollView(sv.icons, sv.at, sv.area)
+				case 9: // back
 					return nil
 				}
-			case 4: // next image
-				if sv.at < sv.iconsCache.Len()-1 {
-					sv.at++
+			case 0: // move wipe line and loupe
+				moved := false
+				if sv.loupe != nil {
+					sv.moveLoupe(dctl.mctl.Mouse.Point)
+					moved = true
+				}
+				if sv.wipe != nil && sv.wipeX != dctl.mctl.Mouse.Point.X {
+					sv.wipeX = dctl.mctl.Mouse.Point.X
+					moved = true
+				}
+				if moved {
+					sv.paint(dctl)
+				}
+			case 4: // next image, prev with -rtl
+				if sv.step(readingDir()) {
 					sv.paint(dctl)
 				}
 			}
+		case <-idleC:
+			if time.Since(sv.lastInput) > idleLoadAfter {
+				sv.idle.load(sv.iconsCache, sv.icons, sv.at, sv.at+1)
+			}
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			dctl.applyCtl(req)
+			sv.paint(dctl)
+		case path := <-dctl.gotoC: // looked at in the acme list
+			if i := indexOfPath(sv.icons, path); i >= 0 {
+				sv.at = i
+				sv.paint(dctl)
+			}
 		case <-dctl.mctl.Resize:
-			if err := dctl.display.Attach(draw9.RefNone); err != nil {
-				log.Fatalf("display: failed to attach: %v", err)
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
 			}
-			sv.Attach(dctl.display.Image.Bounds())
+			sv.Attach(dctl.screen.Bounds())
 			sv.paint(dctl)
 		}
 	}
 }
 
+// paint posts a request to paint the current image. The painter gets
+// a copy of the view, as the view changes while it paints.
 func (sv *SingleView) paint(dctl *DisplayControl) {
-	dctl.display.Image.Draw(dctl.display.Image.Bounds(), dctl.bgColor, nil, image.Point{})
+	if sv.at < len(sv.icons) && sv.icons[sv.at] != sv.viewed {
+		if sv.viewed != nil {
+			sv.rememberLoupe(sv.viewed)
+		}
+		sv.stopViewing()
+		sv.restoreLoupe(sv.icons[sv.at])
+		sv.startViewing(sv.icons[sv.at])
+	}
+	sv.loadLoupe()
+	s := *sv
+	dctl.post(func() { s.render(dctl) })
+}
+
+// render paints the current image.
+func (sv *SingleView) render(dctl *DisplayControl) {
+	if sv.spread {
+		sv.renderSpread(dctl)
+		return
+	}
+	dctl.painted = nil
+	dctl.screen.Draw(dctl.screen.Bounds(), dctl.bgColor, image.Point{})
 
 	var icon *IconImage
 	var ok bool
-	var img *draw9.Image
+	var img ScreenImage
 	var err error
 	dctl.showWaitingAndCall(func() {
 		if icon, ok = sv.iconsCache.At(sv.at); ok {
@@ -153,34 +334,272 @@ func (sv *SingleView) paint(dctl *DisplayControl) {
 		return
 	}
 
-	font := dctl.display.Font
-	window := dctl.display.Image
+	window := dctl.screen
+	fontHeight := window.FontHeight()
 
-	imgR := bestFit(sv.area, img.Bounds())
-	var lines []image.Point
+	// fullscreen presents only the images
+	presenting := dctl.fullscreen
 	var text []string
-	if sv.showInfo {
-		lines = append(lines, sv.area.Min)
-		text = append(text, fmt.Sprintf("%d/%d %v %s",
-			sv.at+1, sv.iconsCache.Len(), icon.origBounds, icon.path))
-		if icon.exifInfo != "" {
-			lines = append(lines, lines[len(lines)-1].Add(image.Point{0, font.Height}))
-			text = append(text, icon.exifInfo)
+	var stats imageStats
+	statsAt := -1
+	if sv.showInfo && !presenting {
+		text = sv.infoText(icon)
+		var ok bool
+		dctl.showWaitingAndCall(func() {
+			stats, ok = statsOf(icon)
+		})
+		if ok {
+			statsAt = len(text)
+			text = append(text, stats.String())
 		}
-		imgR.Min.Y += (len(lines) + 1) * font.Height
 	}
+	imgR := sv.imageRect(img.Bounds(), len(text))
+	// below the info, the image keeps its size and is clipped at the bottom
+	shown := image.Rectangle{imgR.Min, imgR.Min.Add(img.Bounds().Size())}
 
-	window.Draw(imgR, img, nil, image.Point{})
-	if icon.marked {
+	window.Draw(imgR, img, image.Point{})
+	if sv.wipe != nil && sv.wipeFor == sv.at {
+		sv.paintWipe(dctl, imgR.Min.Y-bestFit(sv.area, img.Bounds()).Min.Y)
+	}
+	info := icon.Info()
+	if icon.diff != nil && !presenting {
+		paintDiffRegions(dctl, icon.diff, info.contentBounds(), shown)
+	}
+	if !presenting {
+		paintCodes(dctl, info.codes, info.contentBounds(), shown)
+	}
+	if sv.loupe != nil {
+		paintLoupe(dctl, sv.loupe, shown)
+	}
+	if icon.Marked() && !presenting {
 		mr := image.Rect(window.Bounds().Max.X-50, window.Bounds().Min.Y,
-			window.Bounds().Max.X, window.Bounds().Min.Y+font.Height)
-		window.Draw(mr, dctl.borderColor, nil, image.Point{})
+			window.Bounds().Max.X, window.Bounds().Min.Y+fontHeight)
+		window.Draw(mr, dctl.borderColor, image.Point{})
 	}
-	for i := range lines {
-		window.String(lines[i], dctl.fontColor, image.Point{}, font, text[i])
+	for i := range text {
+		end := window.String(sv.area.Min.Add(image.Point{0, i * fontHeight}), dctl.fontColor, text[i])
+		if i == statsAt {
+			paintSwatches(dctl, end, stats.Colors)
+		}
 	}
 
-	if err := dctl.display.Flush(); err != nil {
+	if err := window.Flush(); err != nil {
 		log.Printf("display: flush: %v", err)
 	}
 }
+
+// infoText returns the lines of the info of the image.
+func (sv *SingleView) infoText(icon *IconImage) []string {
+	info := icon.Info()
+	files := icon.Files()
+	text := []string{fmt.Sprintf("%d/%d %v %s",
+		sv.at+1, sv.iconsCache.Len(), info.origBounds, files[0])}
+	if *verbose {
+		text = append(text, fmt.Sprintf("Queues: %v, %v", fetchPool, decodePool))
+	}
+	if icon.note != "" {
+		text = append(text, icon.note)
+	}
+	if len(files) > 1 {
+		text = append(text, "Paired: "+strings.Join(files[1:], " "))
+	}
+	if sv.wipe != nil && sv.wipeFor == sv.at {
+		text = append(text, "Wipe: "+sv.wipe.Path())
+	}
+	if info.numFrames > 1 {
+		text[0] += fmt.Sprintf(" frame %d/%d", icon.Frame()+1, info.numFrames)
+	}
+	if r := icon.ratingInfo(); r != "" {
+		text = append(text, r)
+	}
+	if tags := imageTags.Of(files[0]); len(tags) > 0 {
+		text = append(text, "Tags: "+strings.Join(tags, " "))
+	}
+	if groups := icon.Groups(); len(groups) > 0 {
+		text = append(text, "Groups: "+strings.Join(groups, ", "))
+	}
+	if icon.invert {
+		text = append(text, "Colors inverted")
+	}
+	if icon.colorMgmt {
+		text = append(text, "Colors for "+displayProfile.name)
+	}
+	if !info.crop.Empty() {
+		text = append(text, cropInfo(info.crop, info.origBounds))
+	}
+	if info.sizeInfo != "" {
+		text = append(text, info.sizeInfo)
+	}
+	if info.exifInfo != "" {
+		text = append(text, info.exifInfo)
+	}
+	if gps, _ := icon.GPS(); gps {
+		text = append(text, "Warning: image contains GPS location")
+	}
+	for _, c := range info.codes {
+		text = append(text, c.String())
+	}
+	return text
+}
+
+// imageRect returns where the image with bounds b is displayed, below
+// the lines of the info, if any.
+func (sv *SingleView) imageRect(b image.Rectangle, infoLines int) image.Rectangle {
+	r := bestFit(sv.area, b)
+	if infoLines > 0 {
+		r.Min.Y += (infoLines + 1) * sv.dctl.screen.FontHeight()
+	}
+	return r
+}
+
+// codeAt returns the QR code or barcode displayed at p, if any.
+func (sv *SingleView) codeAt(p image.Point) (code, bool) {
+	sv.dctl.waitPaint()
+	icon, ok := sv.iconsCache.Peek(sv.at)
+	if !ok || len(icon.Info().codes) == 0 || sv.spread || sv.dctl.fullscreen {
+		return code{}, false
+	}
+	img, ok := icon.Ready()
+	if !ok {
+		return code{}, false
+	}
+	var n int
+	if sv.showInfo && !sv.dctl.fullscreen {
+		n = len(sv.infoText(icon))
+	}
+	r := sv.imageRect(img.Bounds(), n)
+	shown := image.Rectangle{r.Min, r.Min.Add(img.Bounds().Size())}
+	info := icon.Info()
+	for _, c := range info.codes {
+		if p.In(scaleRect(c.r, info.contentBounds(), shown)) {
+			return c, true
+		}
+	}
+	return code{}, false
+}
+
+// stepFrame moves the current image d frames forward. It wraps around at the ends.
+func (sv *SingleView) stepFrame(d int) {
+	sv.dctl.waitPaint()
+	if icon, ok := sv.iconsCache.At(sv.at); ok {
+		if n := icon.Info().numFrames; n > 1 {
+			icon.SetFrame((icon.Frame() + d + n) % n)
+		}
+	}
+}
+
+// exportFrame saves the displayed frame of the current image as a PNG,
+// inverted if the view is.
+func (sv *SingleView) exportFrame() {
+	if icon, ok := sv.iconsCache.At(sv.at); ok {
+		name, err := exportFrame(icon.path, icon.Frame(), *cropExport, sv.invert)
+		if err != nil {
+			log.Printf("singleView: %v", err)
+			return
+		}
+		log.Printf("exported %s", name)
+	}
+}
+
+// trashCurrent moves the current image to the trash and removes it from
+// the view. It returns false if no images are left.
+func (sv *SingleView) trashCurrent() bool {
+	if err := trashIcon(sv.icons[sv.at]); err != nil {
+		log.Printf("singleView: %v", err)
+		return true
+	}
+	sv.dctl.waitPaint()
+	// the icons may be shared with the view below, which removes them itself
+	sv.icons = slices.Delete(slices.Clone(sv.icons), sv.at, sv.at+1)
+	if len(sv.icons) == 0 {
+		return false
+	}
+	sv.at = min(sv.at, len(sv.icons)-1)
+	sv.resetCache()
+	return true
+}
+
+// toggleAutoCrop turns the trimming of the borders on or off. The loupe
+// magnifies what is displayed, so it is loaded again.
+func (sv *SingleView) toggleAutoCrop() {
+	sv.dctl.showWaitingAndCall(func() {
+		sv.autoCrop = !sv.autoCrop
+		sv.resetCache()
+	})
+	if sv.loupe != nil {
+		l := *sv.loupe
+		l.at = -1
+		sv.loupe = &l
+	}
+}
+
+// toggleInvert turns the inversion of the colors on or off.
+func (sv *SingleView) toggleInvert() {
+	sv.dctl.showWaitingAndCall(func() {
+		sv.invert = !sv.invert
+		sv.resetCache()
+	})
+	if sv.loupe != nil {
+		l := *sv.loupe
+		l.at = -1
+		sv.loupe = &l
+	}
+}
+
+// toggleColorManage turns the conversion to the monitor profile on or off.
+func (sv *SingleView) toggleColorManage() {
+	sv.dctl.showWaitingAndCall(func() {
+		sv.colorManage = !sv.colorManage
+		sv.resetCache()
+	})
+	if sv.loupe != nil {
+		l := *sv.loupe
+		l.at = -1
+		sv.loupe = &l
+	}
+}
+
+// toggleWipe starts or stops the wipe compare of the current image with its
+// other version. The other version is displayed left of the wipe line.
+func (sv *SingleView) toggleWipe() {
+	if sv.wipe != nil {
+		sv.dctl.waitPaint()
+		sv.wipe.Unload()
+		sv.wipe = nil
+		return
+	}
+	other, ok := companionOf(sv.icons, sv.at)
+	if !ok {
+		log.Printf("singleView: no other version of %s to compare", sv.icons[sv.at].path)
+		return
+	}
+	sv.wipe = other.NewIconImage(func(img image.Image) (ScreenImage, error) {
+		return FitBest(sv.dctl.screen, img, sv.area)
+	})
+	sv.wipeFor = sv.at
+	sv.wipeX = (sv.area.Min.X + sv.area.Max.X) / 2
+}
+
+// paintWipe paints the other version of the image left of the wipe line.
+// dy is the vertical offset of the image caused by the info lines.
+func (sv *SingleView) paintWipe(dctl *DisplayControl, dy int) {
+	var img ScreenImage
+	var err error
+	dctl.showWaitingAndCall(func() {
+		img, err = sv.wipe.ForDisplay()
+	})
+	if err != nil {
+		log.Printf("singleView: wipe image not ready: %v", err)
+		return
+	}
+
+	window := dctl.screen
+	r := bestFit(sv.area, img.Bounds())
+	r.Min.Y += dy
+	r.Max.X = min(r.Max.X, sv.wipeX)
+	if r.Dx() > 0 {
+		window.Draw(r, img, image.Point{})
+	}
+	line := image.Rect(sv.wipeX, sv.area.Min.Y, sv.wipeX+1, sv.area.Max.Y)
+	window.Draw(line, dctl.borderColor, image.Point{})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"time"
+)
+
+// snapshot saves the window, as painted, to a PNG in the current directory.
+func (dctl *DisplayControl) snapshot() {
+	dctl.waitPaint()
+	img, err := dctl.screen.Snapshot()
+	if err != nil {
+		log.Printf("snapshot: %v", err)
+		return
+	}
+	name, err := saveSnapshot(img, time.Now())
+	if err != nil {
+		log.Printf("snapshot: %v", err)
+		return
+	}
+	log.Printf("saved snapshot %s", name)
+}
+
+// saveSnapshot writes img to a new PNG named after the time t.
+// It returns the name of the PNG.
+func saveSnapshot(img image.Image, t time.Time) (string, error) {
+	name := fmt.Sprintf("iview-%s.png", t.Format("20060102-150405"))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// snarfPoll is how often the snarf buffer is read with -snarf. There is
+	// no notification of changes.
+	snarfPoll = 500 * time.Millisecond
+	// snarfMax is the largest snarf buffer looked at for paths, larger
+	// ones are text, not a list of images.
+	snarfMax = 64 << 10
+)
+
+// watchSnarf polls the snarf buffer and sends the images in it to addC, so
+// that copying the path or the URL of an image anywhere adds it to the
+// viewer. What is in the buffer when the viewer starts is ignored.
+func (dctl *DisplayControl) watchSnarf(addC chan<- []string) {
+	last, lastErr := dctl.screen.ReadSnarf()
+	for range time.Tick(snarfPoll) {
+		data, err := dctl.screen.ReadSnarf()
+		if err != nil {
+			// once, not every poll
+			if lastErr == nil {
+				log.Printf("snarf: %v", err)
+			}
+			lastErr = err
+			continue
+		}
+		lastErr = nil
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		if paths := snarfedImages(string(data)); len(paths) > 0 {
+			addC <- paths
+		}
+	}
+}
+
+// snarfedImages returns the images in text, one per line: paths of image
+// files, file URLs or URLs of remote images. Lines that are not images
+// are skipped, text with none returns nil.
+func snarfedImages(text string) []string {
+	if len(text) > snarfMax {
+		return nil
+	}
+	var paths []string
+	for _, line := range strings.Split(text, "\n") {
+		p := strings.Trim(strings.TrimSpace(line), `"'`)
+		if u, err := url.Parse(p); err == nil && u.Scheme == "file" {
+			p = u.Path
+		}
+		if isRemote(p) {
+			if u, err := url.Parse(p); err == nil && isImageFile(path.Base(u.Path)) {
+				paths = append(paths, p)
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(p, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				p = filepath.Join(home, rest)
+			}
+		}
+		if !filepath.IsAbs(p) || !isImageFile(p) {
+			continue
+		}
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, filepath.Clean(p))
+		}
+	}
+	return paths
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sortKeys are the keys of -sort. Each reads what it needs to know about
+// the icons and returns how to compare them.
+var sortKeys = map[string]func(icons []*Icon) func(a, b *Icon) int{
+	"name": func([]*Icon) func(a, b *Icon) int {
+		return func(a, b *Icon) int {
+			return compareNames(a.path, b.path)
+		}
+	},
+	"dir": func([]*Icon) func(a, b *Icon) int {
+		return func(a, b *Icon) int {
+			return compareNames(filepath.Dir(a.path), filepath.Dir(b.path))
+		}
+	},
+	"date": func(icons []*Icon) func(a, b *Icon) int {
+		dates := iconDates(icons)
+		return func(a, b *Icon) int {
+			da, db := dates[a], dates[b]
+			switch {
+			case da.IsZero() && !db.IsZero(): // the unknown go last
+				return 1
+			case !da.IsZero() && db.IsZero():
+				return -1
+			}
+			return da.Compare(db)
+		}
+	},
+	"size": func(icons []*Icon) func(a, b *Icon) int {
+		statSizes(icons)
+		return func(a, b *Icon) int {
+			return cmp.Compare(b.size, a.size)
+		}
+	},
+	"viewed": func([]*Icon) func(a, b *Icon) int {
+		return func(a, b *Icon) int {
+			return cmp.Compare(b.viewTime, a.viewTime)
+		}
+	},
+	"brightness": func(icons []*Icon) func(a, b *Icon) int {
+		stats := iconStats(icons)
+		return func(a, b *Icon) int {
+			return cmp.Compare(stats[a].Mean, stats[b].Mean)
+		}
+	},
+	"hue": func(icons []*Icon) func(a, b *Icon) int {
+		stats := iconStats(icons)
+		return func(a, b *Icon) int {
+			ha, aok := stats[a].hue()
+			hb, bok := stats[b].hue()
+			switch {
+			case aok && bok:
+				return cmp.Compare(ha, hb)
+			case aok != bok: // the grays go last
+				if aok {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Compare(stats[a].Mean, stats[b].Mean)
+		}
+	},
+}
+
+// parseSortKey splits a sort key into its keys, like date,name for the
+// date and then the name. The empty key is the name.
+func parseSortKey(key string) ([]string, error) {
+	if key == "" {
+		return []string{"name"}, nil
+	}
+	keys := strings.Split(key, ",")
+	for i, k := range keys {
+		keys[i] = strings.TrimSpace(k)
+		if _, ok := sortKeys[keys[i]]; !ok {
+			return nil, fmt.Errorf("sort: unknown key %q", keys[i])
+		}
+	}
+	return keys, nil
+}
+
+// sortIcons sorts the icons by key, one or more comma separated keys. The
+// ties of a key are ordered by the next, and the sort is stable, so the
+// ties of all the keys keep their order. The empty key sorts by name, in
+// natural order, so that the pages are the same on all machines, or by the
+// rules of the language of -collate.
+func sortIcons(icons []*Icon, key string) error {
+	keys, err := parseSortKey(key)
+	if err != nil {
+		return err
+	}
+	compares := make([]func(a, b *Icon) int, len(keys))
+	for i, k := range keys {
+		compares[i] = sortKeys[k](icons)
+	}
+	slices.SortStableFunc(icons, func(a, b *Icon) int {
+		for _, compare := range compares {
+			if c := compare(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+	return nil
+}
+
+// iconDates returns the dates of the icons, when the photo was taken or,
+// without EXIF, the modification time. The headers are read in parallel.
+// Remote images and missing files have no date.
+func iconDates(icons []*Icon) map[*Icon]time.Time {
+	const workers = 16
+	dates := make([]time.Time, len(icons))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if _, remote := remoteSourceOf(icons[i].path); remote {
+					continue
+				}
+				if h, ok := readImageHeader(icons[i].path); ok {
+					dates[i] = h.date
+				} else if info, err := os.Stat(icons[i].path); err == nil {
+					dates[i] = info.ModTime()
+				}
+			}
+		}()
+	}
+	for i := range icons {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	m := make(map[*Icon]time.Time, len(icons))
+	for i, icon := range icons {
+		m[icon] = dates[i]
+	}
+	return m
+}
+
+// iconStats returns the statistics of the images of the icons. The images
+// whose statistics are not cached are read and decoded in parallel.
+func iconStats(icons []*Icon) map[*Icon]imageStats {
+	stats := make([]imageStats, len(icons))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				stats[i], _ = fileStats(icons[i].path)
+			}
+		}()
+	}
+	for i := range icons {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	m := make(map[*Icon]imageStats, len(icons))
+	for i, icon := range icons {
+		m[icon] = stats[i]
+	}
+	return m
+}
+
+// statSizes sets the size of the icons. The stat calls run in parallel
+// as they are slow on remote file systems.
+func statSizes(icons []*Icon) {
+	const workers = 16
+	work := make(chan *Icon)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for icon := range work {
+				icon.statSize()
+			}
+		}()
+	}
+	for _, icon := range icons {
+		work <- icon
+	}
+	close(work)
+	wg.Wait()
+}
+
+// statSize sets the size of the icon from the image file.
+func (i *Icon) statSize() {
+	stat := os.Stat
+	if src, ok := remoteSourceOf(i.path); ok {
+		stat = src.Stat
+	}
+	info, err := stat(i.path)
+	if err != nil {
+		log.Printf("statSize: %v", err)
+		return
+	}
+	i.size = info.Size()
+}
+
+// naturalCompare compares strings like strings.Compare, but the runs of digits
+// are compared by their numeric value, so that img2.jpg comes before img10.jpg.
+// Strings that differ only in leading zeros are ordered bytewise.
+func naturalCompare(a, b string) int {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				return cmp.Compare(a[i], b[j])
+			}
+			i++
+			j++
+			continue
+		}
+		si, sj := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		na := strings.TrimLeft(a[si:i], "0")
+		nb := strings.TrimLeft(b[sj:j], "0")
+		if c := cmp.Compare(len(na), len(nb)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(na, nb); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(len(a)-i, len(b)-j); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+)
+
+// readingDir returns 1 for left-to-right reading and -1 for right-to-left,
+// with -rtl, where the next page is on the left.
+func readingDir() int {
+	if *rightToLeft {
+		return -1
+	}
+	return 1
+}
+
+// step moves d pages forward, or backward if d is negative. In a spread
+// the pages are turned two at a time. It returns whether the page changed.
+func (sv *SingleView) step(d int) bool {
+	if sv.spread {
+		d *= 2
+	}
+	at := max(0, min(sv.at+d, sv.iconsCache.Len()-1))
+	if at == sv.at {
+		return false
+	}
+	sv.at = at
+	return true
+}
+
+// pageArea returns the area an image is fitted in: the whole view, or half
+// of it in a spread.
+func (sv *SingleView) pageArea() image.Rectangle {
+	r := sv.area
+	if sv.spread {
+		r.Max.X = (r.Min.X + r.Max.X) / 2
+	}
+	return r
+}
+
+// toggleSpread switches between one page and two pages side by side.
+func (sv *SingleView) toggleSpread() {
+	sv.dctl.showWaitingAndCall(func() {
+		sv.spread = !sv.spread
+		sv.resetCache()
+	})
+}
+
+// renderSpread paints the current image and the next one side by side, like
+// the pages of a book. With -rtl the current page is on the right. The pages
+// meet at the middle of the window.
+func (sv *SingleView) renderSpread(dctl *DisplayControl) {
+	dctl.painted = nil
+	window := dctl.screen
+	window.Draw(window.Bounds(), dctl.bgColor, image.Point{})
+	fontHeight := window.FontHeight()
+
+	var pages []*IconImage
+	var imgs []ScreenImage
+	var err error
+	dctl.showWaitingAndCall(func() {
+		for i := sv.at; i < min(sv.at+2, sv.iconsCache.Len()) && err == nil; i++ {
+			icon, _ := sv.iconsCache.At(i)
+			var img ScreenImage
+			if img, err = icon.ForDisplay(); err == nil {
+				pages, imgs = append(pages, icon), append(imgs, img)
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("singleView: image not ready: %v", err)
+	}
+
+	area := sv.pageArea()
+	if sv.showInfo && !dctl.fullscreen && len(pages) > 0 {
+		text := fmt.Sprintf("%d/%d %s", sv.at+1, sv.iconsCache.Len(), pages[0].Path())
+		if len(pages) > 1 {
+			text += " " + pages[1].Path()
+		}
+		window.String(sv.area.Min, dctl.fontColor, text)
+		area.Min.Y += 2 * fontHeight
+	}
+	mid := (sv.area.Min.X + sv.area.Max.X) / 2
+	for i, img := range imgs {
+		r := bestFit(area, img.Bounds())
+		if left := (i == 0) == (readingDir() > 0); left {
+			r = r.Add(image.Pt(mid-r.Max.X, 0))
+		} else {
+			r = r.Add(image.Pt(mid-r.Min.X, 0))
+		}
+		window.Draw(r, img, image.Point{})
+		if pages[i].Marked() && !dctl.fullscreen {
+			window.Border(r, 3, dctl.borderColor, image.Point{})
+		}
+	}
+
+	if err := window.Flush(); err != nil {
+		log.Printf("display: flush: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The commands of -cmd set up the view after loading, for launch scripts.
+// They are separated by semicolons and applied in order:
+//
+//	sort keys	sort the images by keys, as with -sort
+//	filter glob	keep only the images whose names match glob
+//	mark glob	mark the images whose names match glob
+//	unmark glob	unmark the images whose names match glob
+//	goto where	start at where: first, last, a position from 1 or a glob
+//	view		start in the display view
+//
+// A glob matches the base name of the image or, if it has a slash, the path.
+
+// startState is where the views start, as set by the commands.
+type startState struct {
+	at     int  // the index of the icon to start at
+	single bool // start in the display view
+}
+
+// runStartCmds applies the commands to the icons. It returns the icons
+// left by the filters and where to start.
+func runStartCmds(icons []*Icon, cmds string) ([]*Icon, startState, error) {
+	var st startState
+	for _, cmd := range strings.Split(cmds, ";") {
+		verb, arg, _ := strings.Cut(strings.TrimSpace(cmd), " ")
+		arg = strings.TrimSpace(arg)
+		if verb == "" {
+			continue
+		}
+		if _, err := filepath.Match(arg, ""); err != nil {
+			return nil, st, fmt.Errorf("cmd: %s: %w", cmd, err)
+		}
+		switch verb {
+		case "sort":
+			if err := sortIcons(icons, arg); err != nil {
+				return nil, st, fmt.Errorf("cmd: %w", err)
+			}
+			*sortKey = arg
+			st.at = 0
+		case "filter":
+			icons = slices.DeleteFunc(icons, func(icon *Icon) bool { return !globMatch(arg, icon.path) })
+			if len(icons) == 0 {
+				return nil, st, fmt.Errorf("cmd: filter %s: no images match", arg)
+			}
+			st.at = 0
+		case "mark", "unmark":
+			for _, icon := range icons {
+				if globMatch(arg, icon.path) && icon.Marked() != (verb == "mark") {
+					icon.ToggleMarked()
+				}
+			}
+		case "goto":
+			at, err := startAt(icons, arg)
+			if err != nil {
+				return nil, st, err
+			}
+			st.at = at
+		case "view":
+			st.single = true
+		default:
+			return nil, st, fmt.Errorf("cmd: unknown command %q", verb)
+		}
+	}
+	return icons, st, nil
+}
+
+// startAt returns the index of the icon at where.
+func startAt(icons []*Icon, where string) (int, error) {
+	switch where {
+	case "first":
+		return 0, nil
+	case "last":
+		return len(icons) - 1, nil
+	}
+	if n, err := strconv.Atoi(where); err == nil {
+		if n < 1 || n > len(icons) {
+			return 0, fmt.Errorf("cmd: goto %d: there are %d images", n, len(icons))
+		}
+		return n - 1, nil
+	}
+	if i := slices.IndexFunc(icons, func(icon *Icon) bool { return globMatch(where, icon.path) }); i >= 0 {
+		return i, nil
+	}
+	return 0, fmt.Errorf("cmd: goto %s: no images match", where)
+}
+
+// globMatch reports whether the glob matches the base name of path or, if
+// the glob has a slash, the path.
+func globMatch(glob, path string) bool {
+	name := filepath.Base(path)
+	if strings.Contains(glob, "/") {
+		name = path
+	}
+	ok, _ := filepath.Match(glob, name)
+	return ok
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"slices"
+	"sync"
+
+	draw9 "9fans.net/go/draw"
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	statsKind   = "stats" // the kind of the statistics in the persistent cache
+	statsSample = 128     // the statistics are computed on the image scaled to fit in statsSample x statsSample
+	swatchCount = 5       // the number of dominant colors
+)
+
+// imageStats are the statistics of the colors of an image, for curating
+// wallpapers and design assets.
+type imageStats struct {
+	Mean   float64    `json:"mean"`   // luminance, 0 to 100
+	Median float64    `json:"median"` // luminance, 0 to 100
+	Colors [][3]uint8 `json:"colors"` // the dominant colors, most frequent first
+}
+
+// String returns the statistics for the info.
+func (s imageStats) String() string {
+	return fmt.Sprintf("Luminance: mean %.0f%% median %.0f%%", s.Mean, s.Median)
+}
+
+// imageStatsMemo keeps the statistics of the images of the session by path
+// and frame, so that they are computed once.
+var imageStatsMemo sync.Map
+
+// statsOf returns the statistics of the frame of the loaded image.
+func statsOf(i *IconImage) (imageStats, bool) {
+	return imageStatsOf(i.Path(), i.Frame(), i.loadedData())
+}
+
+// fileStats returns the statistics of the first frame of the image file,
+// reading it only if they are not known.
+func fileStats(path string) (imageStats, bool) {
+	if s, ok := imageStatsMemo.Load(path + "#0"); ok {
+		return s.(imageStats), true
+	}
+	data, err := readImageFile(path)
+	if err != nil {
+		log.Printf("stats: %v", err)
+		return imageStats{}, false
+	}
+	return imageStatsOf(path, 0, data)
+}
+
+// imageStatsOf returns the statistics of the frame of the image of path with
+// the contents data. They are computed on first use and kept in the
+// persistent cache, if enabled, by the contents of the image.
+func imageStatsOf(path string, frame int, data []byte) (imageStats, bool) {
+	memoKey := fmt.Sprintf("%s#%d", path, frame)
+	if s, ok := imageStatsMemo.Load(memoKey); ok {
+		return s.(imageStats), true
+	}
+	if data == nil {
+		return imageStats{}, false
+	}
+
+	key := fmt.Sprintf("%s-%d", contentKey(data), frame)
+	if persistentCache != nil {
+		if data, ok := persistentCache.Get(statsKind, key); ok {
+			var s imageStats
+			if err := json.Unmarshal(data, &s); err == nil {
+				imageStatsMemo.Store(memoKey, s)
+				return s, true
+			}
+		}
+	}
+
+	img, _, err := decodeFrame(data, frame)
+	if err != nil {
+		log.Printf("stats: %s: %v", path, err)
+		return imageStats{}, false
+	}
+	s := computeStats(img)
+	imageStatsMemo.Store(memoKey, s)
+	if persistentCache != nil {
+		data, _ := json.Marshal(s)
+		if err := persistentCache.Put(statsKind, key, data); err != nil {
+			log.Printf("stats: %v", err)
+		}
+	}
+	return s, true
+}
+
+// grayChroma is the chroma under which a color has no meaningful hue.
+const grayChroma = 0.15
+
+// hue returns the hue, 0 to 360, of the most dominant color that is not
+// grayish. The bool is false for images of grays.
+func (s imageStats) hue() (float64, bool) {
+	for _, c := range s.Colors {
+		r, g, b := float64(c[0])/255, float64(c[1])/255, float64(c[2])/255
+		hi, lo := max(r, g, b), min(r, g, b)
+		chroma := hi - lo
+		if chroma < grayChroma {
+			continue
+		}
+		var h float64
+		switch hi {
+		case r:
+			h = math.Mod((g-b)/chroma+6, 6)
+		case g:
+			h = (b-r)/chroma + 2
+		default:
+			h = (r-g)/chroma + 4
+		}
+		return h * 60, true
+	}
+	return 0, false
+}
+
+// computeStats computes the statistics on a sample of img. The dominant
+// colors are the most frequent of the colors reduced to 4 bits per channel,
+// averaged over the pixels of each.
+func computeStats(img image.Image) imageStats {
+	r := bestFit(image.Rect(0, 0, statsSample, statsSample), img.Bounds())
+	r = r.Sub(r.Min)
+	if b := img.Bounds(); b.Dx() <= r.Dx() && b.Dy() <= r.Dy() {
+		r = b.Sub(b.Min)
+	}
+	sample := image.NewRGBA(r)
+	xdraw.ApproxBiLinear.Scale(sample, r, img, img.Bounds(), xdraw.Src, nil)
+
+	type bin struct {
+		n       int
+		r, g, b int
+	}
+	var lum [256]int
+	bins := make([]bin, 4096)
+	var sum, n int
+	for p := 0; p < len(sample.Pix); p += 4 {
+		c := color.RGBA{sample.Pix[p], sample.Pix[p+1], sample.Pix[p+2], sample.Pix[p+3]}
+		if c.A == 0 {
+			continue
+		}
+		// the luma of Rec. 709, like the sRGB primaries
+		y := (2126*int(c.R) + 7152*int(c.G) + 722*int(c.B)) / 10000
+		lum[y]++
+		sum += y
+		n++
+		b := &bins[int(c.R>>4)<<8|int(c.G>>4)<<4|int(c.B>>4)]
+		b.n++
+		b.r += int(c.R)
+		b.g += int(c.G)
+		b.b += int(c.B)
+	}
+	var s imageStats
+	if n == 0 {
+		return s
+	}
+	s.Mean = float64(sum) / float64(n) / 255 * 100
+	for y, seen := 0, 0; y < len(lum); y++ {
+		if seen += lum[y]; 2*seen >= n {
+			s.Median = float64(y) / 255 * 100
+			break
+		}
+	}
+	slices.SortStableFunc(bins, func(a, b bin) int { return b.n - a.n })
+	for _, b := range bins[:swatchCount] {
+		if b.n == 0 {
+			break
+		}
+		s.Colors = append(s.Colors, [3]uint8{uint8(b.r / b.n), uint8(b.g / b.n), uint8(b.b / b.n)})
+	}
+	return s
+}
+
+// swatchImages are the colors of the swatches allocated on the display.
+// They are used only by the painter.
+var swatchImages = make(map[draw9.Color]ScreenImage)
+
+// paintSwatches paints the dominant colors as a strip of boxes at p, as
+// high as the font.
+func paintSwatches(dctl *DisplayControl, p image.Point, colors [][3]uint8) {
+	if len(swatchImages) > 256 {
+		for _, img := range swatchImages {
+			img.Free()
+		}
+		clear(swatchImages)
+	}
+	h := dctl.screen.FontHeight()
+	r := image.Rect(p.X+h/2, p.Y, p.X+h/2+2*h, p.Y+h)
+	for _, c := range colors {
+		dc := draw9.Color(uint32(c[0])<<24 | uint32(c[1])<<16 | uint32(c[2])<<8 | 0xFF)
+		img, ok := swatchImages[dc]
+		if !ok {
+			img = dctl.screen.AllocColor(dc, dc)
+			swatchImages[dc] = img
+		}
+		dctl.screen.Draw(r, img, image.Point{})
+		dctl.screen.Border(r, 1, dctl.borderColor, image.Point{})
+		r = r.Add(image.Pt(2*h+2, 0))
+	}
+}
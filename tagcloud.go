@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"slices"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// TagCloudView is a View that shows the tags of the images as a cloud, in
+// alphabetical order with the number of images of each. The tags of the
+// most images stand out. Clicking on a tag displays its images.
+type TagCloudView struct {
+	icons  []*Icon // the images whose tags are shown
+	grid   *Grid   // the grid of the views of the images of a tag
+	tags   []string
+	counts map[string]int
+	layout *cloudLayout // where the painter put the tags, for clicks
+
+	dctl *DisplayControl
+}
+
+// cloudLayout is where the tags are on the window, by their index.
+type cloudLayout struct {
+	rects []image.Rectangle
+}
+
+// NewTagCloudView returns a TagCloudView of the tags of the icons.
+func NewTagCloudView(icons []*Icon, grid *Grid) *TagCloudView {
+	tv := &TagCloudView{
+		icons:  icons,
+		grid:   grid,
+		counts: make(map[string]int),
+		layout: new(cloudLayout),
+	}
+	for _, icon := range icons {
+		for _, t := range imageTags.Of(icon.path) {
+			tv.counts[t]++
+		}
+	}
+	for t := range tv.counts {
+		tv.tags = append(tv.tags, t)
+	}
+	slices.SortFunc(tv.tags, compareNames)
+	return tv
+}
+
+func (tv *TagCloudView) Connect(dctl *DisplayControl) {
+	tv.dctl = dctl
+}
+
+func (tv *TagCloudView) Attach(r image.Rectangle) {}
+
+func (tv *TagCloudView) Free() {}
+
+func (tv *TagCloudView) Handle() View {
+	bt2menu := &draw9.Menu{
+		Item: []string{"back"},
+	}
+
+	dctl := tv.dctl
+	tv.paint(dctl)
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case k := <-dctl.kctl.C:
+			switch k {
+			case 'q', 'b', escKey: // back
+				return nil
+			case 'S': // snapshot
+				dctl.snapshot()
+			}
+		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			switch dctl.mctl.Mouse.Buttons {
+			case 1: // display the images of the tag
+				if t, ok := tv.tagAt(dctl.mctl.Mouse.Point); ok {
+					var tagged []*Icon
+					for _, icon := range tv.icons {
+						if imageTags.Has(icon.path, t) {
+							tagged = append(tagged, icon)
+						}
+					}
+					if len(tagged) > 0 {
+						return NewMarkedView(tagged, tv.grid, *markedCache)
+					}
+				}
+			case 2: // view menu
+				if dctl.screen.MenuHit(2, bt2menu) == 0 {
+					return nil
+				}
+			}
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			dctl.applyCtl(req)
+			tv.paint(dctl)
+		case <-dctl.mctl.Resize:
+			dctl.invalidate()
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			tv.paint(dctl)
+		}
+	}
+}
+
+// tagAt returns the tag at p.
+func (tv *TagCloudView) tagAt(p image.Point) (string, bool) {
+	tv.dctl.waitPaint()
+	for i, r := range tv.layout.rects {
+		if p.In(r) {
+			return tv.tags[i], true
+		}
+	}
+	return "", false
+}
+
+// paint posts a request to paint the cloud. The tags flow in centered rows
+// and the tags of the top quarter by number of images are framed.
+func (tv *TagCloudView) paint(dctl *DisplayControl) {
+	tags, counts, layout, n := tv.tags, tv.counts, tv.layout, len(tv.icons)
+	dctl.post(func() {
+		dctl.cls()
+		window := dctl.screen
+		h := window.FontHeight()
+		area := window.Bounds().Inset(h)
+		title := fmt.Sprintf("%d tags of %d images. Click on a tag to display its images", len(tags), n)
+		if len(tags) == 0 {
+			title = "no tags. Tag images with g in the icons and the display view"
+		}
+		window.String(area.Min, dctl.fontColor, title)
+
+		var sorted []int
+		for _, t := range tags {
+			sorted = append(sorted, counts[t])
+		}
+		slices.Sort(sorted)
+		top := 0
+		if len(sorted) > 0 {
+			top = sorted[len(sorted)*3/4]
+		}
+
+		gap := window.StringWidth("  ")
+		words := make([]string, len(tags))
+		widths := make([]int, len(tags))
+		for i, t := range tags {
+			words[i] = fmt.Sprintf("%s (%d)", t, counts[t])
+			widths[i] = window.StringWidth(words[i])
+		}
+		layout.rects = make([]image.Rectangle, len(tags))
+		y := area.Min.Y + 3*h
+		for from := 0; from < len(tags); y += 2 * h {
+			to, w := from+1, widths[from]
+			for to < len(tags) && w+gap+widths[to] <= area.Dx() {
+				w += gap + widths[to]
+				to++
+			}
+			x := area.Min.X + (area.Dx()-w)/2
+			for i := from; i < to; i++ {
+				r := image.Rect(x, y, x+widths[i], y+h)
+				layout.rects[i] = r
+				color := dctl.fontColor
+				if counts[tags[i]] >= top && counts[tags[i]] > 1 {
+					color = dctl.currentColor
+					window.Border(r.Inset(-2), 1, dctl.currentColor, image.Point{})
+				}
+				window.String(r.Min, color, words[i])
+				x += widths[i] + gap
+			}
+			from = to
+		}
+		if err := window.Flush(); err != nil {
+			log.Printf("display: flush: %v", err)
+		}
+	})
+}
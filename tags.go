@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// tagStore keeps the tags of the images by their absolute paths, in
+// iview/tags.json of the user configuration directory.
+type tagStore struct {
+	mu     sync.RWMutex
+	loaded bool
+	tags   map[string][]string
+}
+
+// imageTags are the tags of all the sessions.
+var imageTags tagStore
+
+// tagsFile returns the file of the tags.
+func tagsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("tags: %w", err)
+	}
+	return filepath.Join(dir, progName, "tags.json"), nil
+}
+
+// load reads the tags on first use. It must be called with mu held.
+func (s *tagStore) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.tags = make(map[string][]string)
+	name, err := tagsFile()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &s.tags)
+	}
+	if err != nil {
+		log.Printf("tags: %s: %v", name, err)
+	}
+}
+
+// save writes the tags to a new file and renames it, so that a crash does
+// not lose them. It must be called with mu held.
+func (s *tagStore) save() error {
+	data, err := json.MarshalIndent(s.tags, "", "\t")
+	if err != nil {
+		return fmt.Errorf("tags: %w", err)
+	}
+	file, err := tagsFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("tags: %w", err)
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("tags: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("tags: %w", err)
+	}
+	return nil
+}
+
+// tagKey returns the key of the image of path, absolute for local files.
+func tagKey(path string) string {
+	if _, remote := remoteSourceOf(path); remote {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Of returns the tags of the image of path, sorted.
+func (s *tagStore) Of(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	return slices.Clone(s.tags[tagKey(path)])
+}
+
+// Has reports whether the image of path has the tag.
+func (s *tagStore) Has(path, tag string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	return slices.Contains(s.tags[tagKey(path)], tag)
+}
+
+// Edit applies the edit to the tags of the images of paths and saves them.
+// The edit is a list of tags separated by spaces or commas, a tag with a
+// leading minus is removed.
+func (s *tagStore) Edit(paths []string, edit string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	for _, t := range splitTags(edit) {
+		remove := strings.HasPrefix(t, "-")
+		t = strings.TrimPrefix(t, "-")
+		if t == "" {
+			continue
+		}
+		for _, p := range paths {
+			k := tagKey(p)
+			tags := s.tags[k]
+			i, found := slices.BinarySearch(tags, t)
+			switch {
+			case remove && found:
+				tags = slices.Delete(tags, i, i+1)
+			case !remove && !found:
+				tags = slices.Insert(tags, i, t)
+			}
+			if len(tags) == 0 {
+				delete(s.tags, k)
+			} else {
+				s.tags[k] = tags
+			}
+		}
+	}
+	return s.save()
+}
+
+// Rename moves the tags of the image of path to its new path.
+func (s *tagStore) Rename(path, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	k := tagKey(path)
+	tags, ok := s.tags[k]
+	if !ok {
+		return nil
+	}
+	delete(s.tags, k)
+	s.tags[tagKey(newPath)] = tags
+	return s.save()
+}
+
+// Counts returns the number of images of each tag.
+func (s *tagStore) Counts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+	counts := make(map[string]int)
+	for _, tags := range s.tags {
+		for _, t := range tags {
+			counts[t]++
+		}
+	}
+	return counts
+}
+
+// Complete returns the tags seen so far that start with prefix, the most
+// used first.
+func (s *tagStore) Complete(prefix string) []string {
+	counts := s.Counts()
+	var tags []string
+	for t := range counts {
+		if strings.HasPrefix(t, prefix) {
+			tags = append(tags, t)
+		}
+	}
+	slices.SortFunc(tags, func(a, b string) int {
+		if c := counts[b] - counts[a]; c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	return tags
+}
+
+// editTags reads an edit of the tags of the icons, with completion from the
+// tags seen so far, and applies it.
+func editTags(dctl *DisplayControl, icons []*Icon) {
+	prompt := "tag: "
+	if len(icons) == 1 {
+		if tags := imageTags.Of(icons[0].path); len(tags) > 0 {
+			prompt = fmt.Sprintf("tag (%s): ", strings.Join(tags, " "))
+		}
+	} else {
+		prompt = fmt.Sprintf("tag %d images: ", len(icons))
+	}
+	edit, ok := dctl.readText(prompt, imageTags.Complete)
+	if !ok || edit == "" {
+		return
+	}
+	paths := make([]string, len(icons))
+	for i, icon := range icons {
+		paths[i] = icon.path
+	}
+	if err := imageTags.Edit(paths, edit); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	log.Printf("tagged %d images: %s", len(icons), edit)
+}
+
+// splitTags splits an edit of the tags into the tags.
+func splitTags(edit string) []string {
+	return strings.FieldsFunc(edit, func(r rune) bool { return r == ',' || r == ' ' })
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Targa images are common in the textures and assets of games. They have
+// no magic: the header is the length of an id, whether there is a color
+// map, the image type, the color map, the origin, the dimensions, the bits
+// per pixel and a descriptor with the alpha bits and the order of the rows.
+// The pixels are BGR(A), gray or indices in the color map, optionally run
+// length encoded.
+
+func init() {
+	// the color map type and the image type, with or without run length encoding
+	for _, magic := range []string{"?\x01\x01", "?\x00\x02", "?\x00\x03", "?\x01\x09", "?\x00\x0a", "?\x00\x0b"} {
+		image.RegisterFormat("tga", magic, decodeTGA, decodeTGAConfig)
+	}
+}
+
+const (
+	tgaHeaderSize = 18
+	// tgaMaxPixels limits the size of corrupt images.
+	tgaMaxPixels = 1 << 28
+)
+
+var (
+	errNotTGA = errors.New("tga: not a Targa image")
+	errBadTGA = errors.New("tga: bad image")
+)
+
+// tgaHeader is the header of a Targa image.
+type tgaHeader struct {
+	idLength   int
+	mapType    int
+	imageType  int // 1 color mapped, 2 true color, 3 gray, plus 8 if run length encoded
+	mapFirst   int // the index of the first entry of the color map
+	mapLength  int
+	mapBits    int
+	width      int
+	height     int
+	bits       int // bits per pixel
+	descriptor byte
+}
+
+// parseTGAHeader parses and checks the header of the Targa image data.
+// Without a magic, the checks are all that tell a Targa image.
+func parseTGAHeader(data []byte) (tgaHeader, error) {
+	if len(data) < tgaHeaderSize {
+		return tgaHeader{}, errNotTGA
+	}
+	le := binary.LittleEndian
+	h := tgaHeader{
+		idLength:   int(data[0]),
+		mapType:    int(data[1]),
+		imageType:  int(data[2]),
+		mapFirst:   int(le.Uint16(data[3:])),
+		mapLength:  int(le.Uint16(data[5:])),
+		mapBits:    int(data[7]),
+		width:      int(le.Uint16(data[12:])),
+		height:     int(le.Uint16(data[14:])),
+		bits:       int(data[16]),
+		descriptor: data[17],
+	}
+	if h.width == 0 || h.height == 0 || h.width > tgaMaxPixels/h.height || h.descriptor&0xC0 != 0 {
+		return h, errNotTGA
+	}
+	switch h.imageType &^ 8 {
+	case 1:
+		if h.mapType != 1 || h.mapLength == 0 || (h.bits != 8 && h.bits != 16) {
+			return h, errNotTGA
+		}
+		switch h.mapBits {
+		case 15, 16, 24, 32:
+		default:
+			return h, errNotTGA
+		}
+	case 2:
+		switch h.bits {
+		case 15, 16, 24, 32:
+		default:
+			return h, errNotTGA
+		}
+	case 3:
+		if h.bits != 8 && h.bits != 16 {
+			return h, errNotTGA
+		}
+	default:
+		return h, errNotTGA
+	}
+	// without a color map its fields are 0, unlike the count of images
+	// of cursors, which start like true color Targa images
+	if h.imageType&^8 != 1 && (h.mapType != 0 || h.mapLength != 0) {
+		return h, errNotTGA
+	}
+	return h, nil
+}
+
+// isTGA reports whether data starts with a valid Targa header.
+func isTGA(data []byte) bool {
+	_, err := parseTGAHeader(data)
+	return err == nil
+}
+
+// alphaBits returns the bits of alpha of each pixel.
+func (h tgaHeader) alphaBits() int {
+	return int(h.descriptor & 0x0F)
+}
+
+// tgaColor returns the color of a pixel or of an entry of the color map,
+// of bits per pixel, in b. The alpha is used only if the descriptor has
+// alpha bits, as many writers fill it with 0.
+func tgaColor(b []byte, bits int, alpha bool) color.NRGBA {
+	switch bits {
+	case 15, 16:
+		v := binary.LittleEndian.Uint16(b)
+		c := color.NRGBA{
+			R: uint8(int(v>>10&0x1F) * 255 / 31),
+			G: uint8(int(v>>5&0x1F) * 255 / 31),
+			B: uint8(int(v&0x1F) * 255 / 31),
+			A: 0xFF,
+		}
+		if bits == 16 && alpha && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	case 24:
+		return color.NRGBA{b[2], b[1], b[0], 0xFF}
+	}
+	c := color.NRGBA{b[2], b[1], b[0], b[3]}
+	if !alpha {
+		c.A = 0xFF
+	}
+	return c
+}
+
+// decodeTGA decodes the Targa image of r.
+func decodeTGA(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := parseTGAHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	alpha := h.alphaBits() > 0
+	p := tgaHeaderSize + h.idLength
+	if len(data) < p {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var palette []color.NRGBA
+	if h.mapType == 1 {
+		size := (h.mapBits + 7) / 8
+		if len(data) < p+h.mapLength*size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		// the color map is skipped by images that are not color mapped
+		if h.imageType&^8 == 1 {
+			palette = make([]color.NRGBA, h.mapLength)
+			for i := range palette {
+				palette[i] = tgaColor(data[p+i*size:], h.mapBits, alpha)
+			}
+		}
+		p += h.mapLength * size
+	}
+
+	size := (h.bits + 7) / 8
+	n := h.width * h.height
+	pixels := data[p:]
+	if h.imageType&8 != 0 {
+		if pixels, err = unpackTGA(pixels, n, size); err != nil {
+			return nil, err
+		}
+	} else if len(pixels) < n*size {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	// the rows are bottom up, unless the descriptor says top down
+	pos := func(i int) (int, int) {
+		x, y := i%h.width, i/h.width
+		if h.descriptor&0x10 != 0 {
+			x = h.width - 1 - x
+		}
+		if h.descriptor&0x20 == 0 {
+			y = h.height - 1 - y
+		}
+		return x, y
+	}
+	if h.imageType&^8 == 3 && h.bits == 8 {
+		img := image.NewGray(rect)
+		for i := range n {
+			x, y := pos(i)
+			img.Pix[img.PixOffset(x, y)] = pixels[i]
+		}
+		return img, nil
+	}
+	img := image.NewNRGBA(rect)
+	for i := range n {
+		var c color.NRGBA
+		b := pixels[i*size:]
+		switch h.imageType &^ 8 {
+		case 1:
+			k := int(b[0])
+			if size == 2 {
+				k = int(binary.LittleEndian.Uint16(b))
+			}
+			k -= h.mapFirst
+			if k < 0 || k >= len(palette) {
+				return nil, errBadTGA
+			}
+			c = palette[k]
+		case 2:
+			c = tgaColor(b, h.bits, alpha)
+		case 3: // gray and alpha
+			c = color.NRGBA{b[0], b[0], b[0], b[1]}
+			if !alpha {
+				c.A = 0xFF
+			}
+		}
+		x, y := pos(i)
+		img.SetNRGBA(x, y, c)
+	}
+	return img, nil
+}
+
+// unpackTGA decodes the run length encoding of n pixels of size bytes:
+// each packet is a count, with the high bit set for a run of the next pixel,
+// or else for that many literal pixels.
+func unpackTGA(data []byte, n, size int) ([]byte, error) {
+	// a packet of 1+size bytes at least unpacks to 128 pixels at most
+	if n > 128*(len(data)/(1+size)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	out := make([]byte, 0, n*size)
+	for len(out) < n*size {
+		if len(data) == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		count := int(data[0]&0x7F) + 1
+		run := data[0]&0x80 != 0
+		data = data[1:]
+		if len(out)+count*size > n*size {
+			return nil, errBadTGA
+		}
+		if run {
+			if len(data) < size {
+				return nil, io.ErrUnexpectedEOF
+			}
+			for range count {
+				out = append(out, data[:size]...)
+			}
+			data = data[size:]
+		} else {
+			if len(data) < count*size {
+				return nil, io.ErrUnexpectedEOF
+			}
+			out = append(out, data[:count*size]...)
+			data = data[count*size:]
+		}
+	}
+	return out, nil
+}
+
+// decodeTGAConfig reads the dimensions of the Targa image of r.
+func decodeTGAConfig(r io.Reader) (image.Config, error) {
+	var header [tgaHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return image.Config{}, err
+	}
+	h, err := parseTGAHeader(header[:])
+	if err != nil {
+		return image.Config{}, err
+	}
+	var model color.Model = color.NRGBAModel
+	if h.imageType&^8 == 3 && h.bits == 8 {
+		model = color.GrayModel
+	}
+	return image.Config{ColorModel: model, Width: h.width, Height: h.height}, nil
+}
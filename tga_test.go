@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// tgaImage returns a Targa image of w x h of the type, with the id of
+// idLength, without a color map, and the rest after the header.
+func tgaImage(imageType byte, idLength byte, w, h uint16, bits, descriptor byte, rest ...byte) []byte {
+	data := []byte{idLength, 0, imageType, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	data = binary.LittleEndian.AppendUint16(data, w)
+	data = binary.LittleEndian.AppendUint16(data, h)
+	data = append(data, bits, descriptor)
+	return append(data, rest...)
+}
+
+func TestDecodeTGA(t *testing.T) {
+	red, green := []byte{0, 0, 0xFF}, []byte{0, 0xFF, 0}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// bottom up: green is the last row
+		{"true color", tgaImage(2, 0, 1, 2, 24, 0, append(green, red...)...)},
+		{"top down with an id", tgaImage(2, 3, 1, 2, 24, 0x20, append([]byte("id!"), append(red, green...)...)...)},
+		{"run length encoded", tgaImage(10, 0, 1, 2, 24, 0x20, append(append([]byte{0}, red...), append([]byte{0}, green...)...)...)},
+	}
+	for _, tt := range tests {
+		img, format, err := image.Decode(bytes.NewReader(tt.data))
+		if err != nil || format != "tga" {
+			t.Errorf("%s: %v, format %q", tt.name, err, format)
+			continue
+		}
+		for y, c := range []color.NRGBA{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}} {
+			if got := img.(*image.NRGBA).NRGBAAt(0, y); got != c {
+				t.Errorf("%s: pixel %d = %v, want %v", tt.name, y, got, c)
+			}
+		}
+	}
+}
+
+func TestDecodeTGACorrupt(t *testing.T) {
+	// a color map of 2 entries of 24 bits, of which there is one byte
+	colorMapped := tgaImage(1, 0, 1, 1, 8, 0, 1)
+	colorMapped[1], colorMapped[7] = 1, 24
+	binary.LittleEndian.PutUint16(colorMapped[5:], 2)
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"truncated header", tgaImage(2, 0, 1, 1, 24, 0)[:10], errNotTGA},
+		{"truncated id", tgaImage(2, 200, 1, 1, 24, 0), io.ErrUnexpectedEOF},
+		{"truncated pixels", tgaImage(2, 0, 2, 2, 24, 0, 1, 2, 3), io.ErrUnexpectedEOF},
+		{"truncated run", tgaImage(10, 0, 2, 2, 24, 0, 0x83, 1), io.ErrUnexpectedEOF},
+		{"run past the image", tgaImage(10, 0, 1, 1, 24, 0, 0x81, 1, 2, 3), errBadTGA},
+		{"huge run", tgaImage(10, 0, 16384, 16384, 32, 0, 0xFF, 1, 2, 3, 4), io.ErrUnexpectedEOF},
+		{"bad bits per pixel", tgaImage(2, 0, 1, 1, 12, 0, 1, 2), errNotTGA},
+		{"empty", tgaImage(2, 0, 0, 1, 24, 0), errNotTGA},
+		{"truncated color map", colorMapped, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := decodeTGA(bytes.NewReader(tt.data))
+		runtime.ReadMemStats(&after)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+			t.Errorf("%s: allocated %d bytes", tt.name, n)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// trashedFile is a file moved to the trash.
+type trashedFile struct {
+	orig string // where it was
+	path string // where it is in the trash
+	info string // the .trashinfo file that records orig
+}
+
+// trashEntry is an image moved to the trash, with its siblings.
+type trashEntry struct {
+	icon  *Icon
+	files []trashedFile
+}
+
+// sessionTrash are the images moved to the trash in this session, oldest
+// first. They can be restored from the TrashView.
+var sessionTrash []*trashEntry
+
+// trashDir returns the trash directory of the freedesktop.org specification,
+// which file managers and desktops share.
+func trashDir() (string, error) {
+	if d := os.Getenv("XDG_DATA_HOME"); d != "" {
+		return filepath.Join(d, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("trash: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// trashIcon moves the image of the icon and its siblings to the trash. If a
+// file cannot be moved, the files already moved are put back. A marked
+// icon is unmarked, as it is gone.
+func trashIcon(icon *Icon) error {
+	if _, remote := remoteSourceOf(icon.path); remote {
+		return fmt.Errorf("trash: %s: remote images cannot be moved to the trash", icon.path)
+	}
+	e := &trashEntry{icon: icon}
+	for _, name := range icon.Files() {
+		f, err := trashFile(name)
+		if err != nil {
+			e.restore()
+			return err
+		}
+		e.files = append(e.files, f)
+	}
+	if icon.Marked() {
+		icon.ToggleMarked()
+	}
+	icon.setTrashed(true)
+	journal.Record("trash", icon.path)
+	sessionTrash = append(sessionTrash, e)
+	return nil
+}
+
+// restoreTrashed puts back the files of the entry at their original place.
+func restoreTrashed(e *trashEntry) error {
+	if err := e.restore(); err != nil {
+		return err
+	}
+	e.icon.setTrashed(false)
+	journal.Record("restore", e.icon.path)
+	sessionTrash = slices.DeleteFunc(sessionTrash, func(t *trashEntry) bool { return t == e })
+	return nil
+}
+
+// restore moves the files back. The files restored are removed from the
+// entry, so that it can be retried after an error.
+func (e *trashEntry) restore() error {
+	for len(e.files) > 0 {
+		if err := restoreFile(e.files[0]); err != nil {
+			return err
+		}
+		e.files = e.files[1:]
+	}
+	return nil
+}
+
+// trashFile moves the file name to the trash. The name in the trash is
+// made unique with a number, like photo.2.jpg.
+func trashFile(name string) (trashedFile, error) {
+	orig, err := filepath.Abs(name)
+	if err != nil {
+		return trashedFile{}, fmt.Errorf("trash: %w", err)
+	}
+	dir, err := trashDir()
+	if err != nil {
+		return trashedFile{}, err
+	}
+	for _, d := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			return trashedFile{}, fmt.Errorf("trash: %w", err)
+		}
+	}
+
+	base := filepath.Base(orig)
+	ext := filepath.Ext(base)
+	for n := 1; ; n++ {
+		tname := base
+		if n > 1 {
+			tname = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		// creating the info file claims the name
+		info := filepath.Join(dir, "info", tname+".trashinfo")
+		f, err := os.OpenFile(info, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return trashedFile{}, fmt.Errorf("trash: %w", err)
+		}
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: orig}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		path := filepath.Join(dir, "files", tname)
+		if err == nil {
+			// the trash is in the home directory, maybe on another file system
+			_, err = moveFile(orig, path, collisionSkip)
+		}
+		if err != nil {
+			os.Remove(info)
+			if errors.Is(err, errSkipped) {
+				// a file left in the trash without its info
+				continue
+			}
+			return trashedFile{}, fmt.Errorf("trash: %w", err)
+		}
+		return trashedFile{orig: orig, path: path, info: info}, nil
+	}
+}
+
+// restoreFile moves a file from the trash back to its original place. It
+// does not overwrite a file that took its place.
+func restoreFile(f trashedFile) error {
+	if err := os.MkdirAll(filepath.Dir(f.orig), 0755); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if _, err := moveFile(f.path, f.orig, collisionSkip); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if err := os.Remove(f.info); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"image"
+	"log"
+	"slices"
+
+	draw9 "9fans.net/go/draw"
+)
+
+// TrashView is a View that shows the images moved to the trash in this
+// session as thumbnails, so that they can be restored.
+type TrashView struct {
+	entries    []*trashEntry
+	icons      []*Icon // the images in the trash, for the thumbnails
+	iconsCache CachedSlice[*Icon, *IconImage]
+	offset     *Offset
+	tuning     cacheTuning
+	gp         *gridPaint
+
+	dctl *DisplayControl
+}
+
+// NewTrashView returns a TrashView of the images trashed in this session, newest first.
+func NewTrashView(grid *Grid, t cacheTuning) *TrashView {
+	tv := &TrashView{
+		tuning: t.withDefaults(grid.Area()),
+		gp:     new(gridPaint),
+	}
+	tv.entries = slices.Clone(sessionTrash)
+	slices.Reverse(tv.entries)
+	tv.icons = trashIcons(tv.entries)
+	tv.offset = NewOffset(grid, len(tv.icons))
+	return tv
+}
+
+// trashIcons returns icons for the images of the entries in the trash.
+func trashIcons(entries []*trashEntry) []*Icon {
+	icons := make([]*Icon, len(entries))
+	for i, e := range entries {
+		icons[i] = NewIcon(e.files[0].path)
+	}
+	return icons
+}
+
+func (tv *TrashView) Connect(dctl *DisplayControl) {
+	tv.dctl = dctl
+	dctl.waitPaint()
+	if tv.iconsCache != nil {
+		tv.iconsCache.Free()
+	}
+	images := iconImageMaker(func(img image.Image) (ScreenImage, error) {
+		return FitFast(dctl.screen, img, image.Rectangle{image.Point{}, tv.offset.grid.iconSize})
+	})
+	tv.iconsCache = NewCachedSlicePaged("trash", tv.icons, images, tv.tuning)
+}
+
+func (tv *TrashView) Attach(r image.Rectangle) {
+	if r.Eq(tv.offset.grid.area) {
+		return
+	}
+	tv.offset.grid.Attach(r)
+}
+
+func (tv *TrashView) Free() {
+	tv.dctl.waitPaint()
+	tv.iconsCache.Free()
+}
+
+func (tv *TrashView) Handle() View {
+	bt2menu := &draw9.Menu{
+		Item: []string{"restore", "restore all", "", "back"},
+	}
+
+	dctl := tv.dctl
+	tv.paint(dctl)
+	for {
+		select {
+		case err := <-dctl.errch:
+			log.Printf("display: %v", err)
+		case k := <-dctl.kctl.C:
+			switch k {
+			case 'q', 'b', escKey: // back
+				return nil
+			case 'S': // snapshot
+				dctl.snapshot()
+			case upArrowKey: // scroll up
+				dctl.scroll(tv.offset, -1, 0)
+				tv.paint(dctl)
+			case downArrowKey: // scroll down
+				dctl.scroll(tv.offset, 1, 0)
+				tv.paint(dctl)
+			}
+		case dctl.mctl.Mouse = <-dctl.mctl.C:
+			if m := dctl.mctl.Mouse; m.Buttons&7 != 0 && m.Point.In(tv.offset.grid.Scrollbar()) {
+				dctl.scrollWithMouse(tv.offset, func() { tv.paint(dctl) })
+				continue
+			}
+			switch dctl.mctl.Mouse.Buttons {
+			case 2: // view menu
+				switch dctl.screen.MenuHit(2, bt2menu) {
+				case 0: // restore
+					if i, ok := tv.offset.At(dctl.mctl.Mouse.Point); ok {
+						tv.restore(tv.entries[i])
+					}
+				case 1: // restore all
+					for _, e := range tv.entries {
+						tv.restore(e)
+					}
+				case 3: // back
+					return nil
+				}
+			case 4: // restore image
+				if i, ok := tv.offset.At(dctl.mctl.Mouse.Point); ok {
+					tv.restore(tv.entries[i])
+				}
+			case scrollWheelUp: // scroll up
+				dctl.scroll(tv.offset, 0, -1)
+				tv.paint(dctl)
+			case scrollWheelDown: // scroll down
+				dctl.scroll(tv.offset, 0, 1)
+				tv.paint(dctl)
+			}
+			if len(sessionTrash) == 0 {
+				return nil
+			}
+			if len(tv.entries) != len(sessionTrash) {
+				tv.reload()
+				tv.paint(dctl)
+			}
+		case req := <-dctl.ctlC: // a script reads or writes ctl
+			dctl.applyCtl(req)
+			tv.paint(dctl)
+		case <-dctl.mctl.Resize:
+			dctl.invalidate()
+			if err := dctl.screen.Attach(); err != nil {
+				fatalf("display: failed to attach: %v", err)
+			}
+			tv.Attach(dctl.screen.Bounds())
+			tv.paint(dctl)
+		}
+	}
+}
+
+// restore puts the image of the entry back at its place.
+func (tv *TrashView) restore(e *trashEntry) {
+	if err := restoreTrashed(e); err != nil {
+		log.Printf("trashView: %v", err)
+		return
+	}
+	log.Printf("restored %s", e.icon.path)
+}
+
+// reload shows the images still in the trash.
+func (tv *TrashView) reload() {
+	tv.entries = slices.Clone(sessionTrash)
+	slices.Reverse(tv.entries)
+	tv.icons = trashIcons(tv.entries)
+	tv.offset = NewOffset(tv.offset.grid, len(tv.icons))
+	tv.dctl.invalidate()
+	tv.Connect(tv.dctl)
+}
+
+// paint posts a request to paint the visible icons.
+func (tv *TrashView) paint(dctl *DisplayControl) {
+	offset, cache, gp := tv.offset.snapshot(), tv.iconsCache, tv.gp
+	dctl.post(func() {
+		dctl.showWaitingAndCall(func() {
+			from, to := offset.Visible()
+			images := slices.Collect(Get(cache, from, to))
+			paintIcons(dctl, offset, images, nil, gp, true)
+		})
+	})
+}
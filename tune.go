@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// The caches whose tuning is not set with flags tune themselves from the
+// measured loads of the images: the slower the images load, the larger the
+// pages and the deeper the prefetch, within a share of the memory.
+
+const (
+	// tuneSamples is how many images are measured before tuning.
+	tuneSamples = 8
+	// slowImageLoad is the time to read and decode an image over which
+	// pages get larger, like with -remote, so that more load in parallel.
+	slowImageLoad = 200 * time.Millisecond
+	// pageDwell is how long a page is assumed to be looked at. Pages
+	// that take longer to load are prefetched deeper.
+	pageDwell = time.Second
+	// maxPrefetch is the deepest prefetch of tuning.
+	maxPrefetch = 4
+	// tuneMemory is the memory assumed without a soft memory limit.
+	tuneMemory = 2 << 30
+	// cacheShare is the part of the memory a cache may take, as several
+	// caches are loaded together.
+	cacheShare = 4
+)
+
+// loadMeter measures the loads of images, as moving averages.
+type loadMeter struct {
+	mu      sync.Mutex
+	fetches int
+	decodes int
+	fetch   time.Duration // the time to read an image
+	decode  time.Duration // the time to decode and scale an image
+	size    float64       // the bytes of an image in memory
+}
+
+// loads measures the loads of the session.
+var loads loadMeter
+
+// average adds v to the moving average avg of n samples. The recent
+// samples weigh more, so that the average follows changes, like moving
+// to a directory on another file system.
+func average(avg, v float64, n int) float64 {
+	return avg + (v-avg)/float64(min(n+1, 32))
+}
+
+// fetched records that an image of size bytes was read in d.
+func (m *loadMeter) fetched(d time.Duration, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetch = time.Duration(average(float64(m.fetch), float64(d), m.fetches))
+	m.size = average(m.size, float64(size), m.fetches)
+	m.fetches++
+}
+
+// decoded records that an image was decoded in d.
+func (m *loadMeter) decoded(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decode = time.Duration(average(float64(m.decode), float64(d), m.decodes))
+	m.decodes++
+}
+
+// snapshot returns the averages. The bool is false if there are too few
+// samples to tune.
+func (m *loadMeter) snapshot() (fetch, decode time.Duration, size float64, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fetch, m.decode, m.size, m.fetches >= tuneSamples && m.decodes >= tuneSamples
+}
+
+// cacheMemory returns the bytes that a cache may take.
+func cacheMemory() float64 {
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = tuneMemory
+	}
+	return float64(limit) / cacheShare
+}
+
+// tunePageSize returns the page size for a cache with the default size
+// base: twice that if the images load slowly and the memory allows it.
+func tunePageSize(base int) int {
+	fetch, decode, size, ok := loads.snapshot()
+	if !ok || fetch+decode < slowImageLoad || 3*2*float64(base)*size > cacheMemory() {
+		return base
+	}
+	return 2 * base
+}
+
+// tuneDepth returns the prefetch depth and the pages to keep loaded for a
+// cache with pages of pageSize and the default depth of t. The pages ahead
+// are enough to load while the user looks at the current one, and they fit
+// in the memory of the cache.
+func tuneDepth(t cacheTuning, pageSize int) (prefetch, pages int) {
+	fetch, decode, size, ok := loads.snapshot()
+	if !ok {
+		return t.prefetch, t.pages
+	}
+	// the stages run in parallel, the slower one sets the pace
+	images := float64(pageSize)
+	pageLoad := max(
+		time.Duration(math.Ceil(images/float64(cap(fetchPool.sem))))*fetch,
+		time.Duration(math.Ceil(images/float64(cap(decodePool.sem))))*decode)
+	prefetch = max(t.prefetch, min(maxPrefetch, int(math.Ceil(float64(pageLoad)/float64(pageDwell)))))
+	pages = max(t.pages, 2*prefetch+1)
+	if size > 0 {
+		fit := max(3, int(cacheMemory()/(images*size)))
+		pages = min(pages, fit)
+		prefetch = min(prefetch, (pages-1)/2)
+	}
+	return prefetch, pages
+}
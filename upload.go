@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sync"
+)
+
+// uploadBatchBytes is the maximum size of the pixels of a batch.
+const uploadBatchBytes = 4 << 20
+
+// uploads batches the uploads of images to the display, if not nil.
+var uploads *batchUploader
+
+// batchUploader uploads the images that are ready at about the same time,
+// like the icons of a page, as one image, an atlas. Each image allocated
+// on the display costs round trips, which add up over slow connections.
+// Uploads never wait for a batch to fill: the images that arrive while an
+// atlas uploads form the next batch.
+type batchUploader struct {
+	scr  Screen
+	reqC chan uploadRequest
+}
+
+type uploadRequest struct {
+	img   *image.RGBA // from the pools, released after the upload
+	low   bool
+	reply chan uploadReply
+}
+
+type uploadReply struct {
+	img ScreenImage
+	err error
+}
+
+// newBatchUploader starts a batchUploader for the screen.
+func newBatchUploader(scr Screen) *batchUploader {
+	u := &batchUploader{scr: scr, reqC: make(chan uploadRequest)}
+	go u.run()
+	return u
+}
+
+// upload uploads img as part of a batch and returns its part of the atlas.
+// The pixels of img are released to the pools.
+func (u *batchUploader) upload(img *image.RGBA, low bool) (ScreenImage, error) {
+	req := uploadRequest{img, low, make(chan uploadReply, 1)}
+	u.reqC <- req
+	rep := <-req.reply
+	return rep.img, rep.err
+}
+
+func (u *batchUploader) run() {
+	for req := range u.reqC {
+		batch := []uploadRequest{req}
+		size := len(req.img.Pix)
+	collect:
+		for size < uploadBatchBytes {
+			select {
+			case r := <-u.reqC:
+				batch = append(batch, r)
+				size += len(r.img.Pix)
+			default:
+				break collect
+			}
+		}
+		var low, full []uploadRequest
+		for _, r := range batch {
+			if r.low {
+				low = append(low, r)
+			} else {
+				full = append(full, r)
+			}
+		}
+		u.uploadAtlas(low, true)
+		u.uploadAtlas(full, false)
+	}
+}
+
+// uploadAtlas uploads the images of the requests stacked in one image
+// and replies with their parts.
+func (u *batchUploader) uploadAtlas(reqs []uploadRequest, low bool) {
+	if len(reqs) == 0 {
+		return
+	}
+	if len(reqs) == 1 {
+		img, err := uploadRGBA(u.scr, reqs[0].img, low)
+		putBytes(reqs[0].img.Pix)
+		reqs[0].reply <- uploadReply{img, err}
+		return
+	}
+
+	var size image.Point
+	for _, r := range reqs {
+		size.X = max(size.X, r.img.Rect.Dx())
+		size.Y += r.img.Rect.Dy()
+	}
+	all := newPooledRGBA(image.Rectangle{Max: size})
+	clear(all.Pix)
+	parts := make([]image.Rectangle, len(reqs))
+	y := 0
+	for i, r := range reqs {
+		b := r.img.Rect
+		for row := b.Min.Y; row < b.Max.Y; row++ {
+			from := r.img.Pix[r.img.PixOffset(b.Min.X, row):r.img.PixOffset(b.Max.X, row)]
+			copy(all.Pix[all.PixOffset(0, y+row-b.Min.Y):], from)
+		}
+		parts[i] = image.Rect(0, y, b.Dx(), y+b.Dy())
+		y += b.Dy()
+		putBytes(r.img.Pix)
+	}
+	img, err := uploadRGBA(u.scr, all, low)
+	putBytes(all.Pix)
+	if err != nil {
+		for _, r := range reqs {
+			r.reply <- uploadReply{nil, err}
+		}
+		return
+	}
+	a := &atlas{img: img, refs: len(reqs)}
+	for i, r := range reqs {
+		r.reply <- uploadReply{&atlasPart{atlas: a, r: parts[i]}, nil}
+	}
+}
+
+// atlas is an image on the display with the parts of a batch. It is freed
+// when all its parts are freed.
+type atlas struct {
+	img  ScreenImage
+	mu   sync.Mutex
+	refs int
+}
+
+// atlasPart is an image uploaded in an atlas. Like the images uploaded
+// alone, its bounds start at the origin. The screens translate the points
+// to the atlas when they draw it.
+type atlasPart struct {
+	atlas *atlas
+	r     image.Rectangle // in the atlas
+	freed bool
+}
+
+func (p *atlasPart) Bounds() image.Rectangle {
+	return p.r.Sub(p.r.Min)
+}
+
+func (p *atlasPart) Free() error {
+	a := p.atlas
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if p.freed {
+		return nil
+	}
+	p.freed = true
+	if a.refs--; a.refs == 0 {
+		return a.img.Free()
+	}
+	return nil
+}
+
+func (p *atlasPart) String() string {
+	return fmt.Sprintf("%v", p.atlas.img)
+}
+
+// inAtlas returns the image to draw for src and the point sp of src in it.
+func inAtlas(src ScreenImage, sp image.Point) (ScreenImage, image.Point) {
+	if p, ok := src.(*atlasPart); ok {
+		return p.atlas.img, sp.Add(p.r.Min)
+	}
+	return src, sp
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// startViewing starts timing how long the icon is displayed and records
+// it in the history.
+func (sv *SingleView) startViewing(icon *Icon) {
+	sv.viewed = icon
+	sv.viewedSince = time.Now()
+	icon.mu.Lock()
+	icon.views++
+	icon.mu.Unlock()
+	history.visit(icon)
+	sessionEvent("view", icon.path)
+}
+
+// stopViewing adds the time the viewed icon was displayed to its statistics.
+func (sv *SingleView) stopViewing() {
+	if sv.viewed != nil {
+		sv.viewed.mu.Lock()
+		sv.viewed.viewTime += time.Since(sv.viewedSince)
+		sv.viewed.mu.Unlock()
+		sv.viewed = nil
+	}
+}
+
+// ViewStats returns how many times and how long the icon was displayed in
+// the single view.
+func (i *Icon) ViewStats() (views int, viewTime time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.views, i.viewTime
+}
+
+// writeViewStats writes the view statistics of the icons that were
+// displayed as CSV to the file name, the most viewed first.
+func writeViewStats(name string, icons []*Icon) error {
+	var viewed []*Icon
+	for _, icon := range icons {
+		if views, _ := icon.ViewStats(); views > 0 {
+			viewed = append(viewed, icon)
+		}
+	}
+	slices.SortStableFunc(viewed, func(a, b *Icon) int {
+		_, ta := a.ViewStats()
+		_, tb := b.ViewStats()
+		return cmp.Compare(tb, ta)
+	})
+
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("viewstats: %w", err)
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"path", "seconds", "views", "marked"})
+	for _, icon := range viewed {
+		views, viewTime := icon.ViewStats()
+		w.Write([]string{
+			icon.Path(),
+			strconv.FormatFloat(viewTime.Seconds(), 'f', 1, 64),
+			strconv.Itoa(views),
+			strconv.FormatBool(icon.Marked()),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("viewstats: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("viewstats: %w", err)
+	}
+	return nil
+}
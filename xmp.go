@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// xmpHeadSize is how much of an image file is searched for embedded XMP.
+// The cameras and the editors put it in the first segments.
+const xmpHeadSize = 256 << 10
+
+// The properties of the ratings and labels of Lightroom, Bridge and digiKam,
+// as attributes or as elements.
+var (
+	xmpRatingRe = regexp.MustCompile(`xmp:Rating(?:="|>)\s*(-?\d)`)
+	xmpLabelRe  = regexp.MustCompile(`xmp:Label(?:="|>)([^"<]*)`)
+	xmpPickRe   = regexp.MustCompile(`digiKam:PickLabel(?:="|>)\s*(\d)`)
+)
+
+// digiKamRejected is the pick label of digiKam for rejected images.
+const digiKamRejected = 1
+
+// readXMP sets the rating and the label of the icon from its XMP sidecar,
+// photo.xmp as written by Lightroom or photo.jpg.xmp as written by digiKam,
+// or else from the XMP embedded in the image. A rating of -1, or the
+// rejected pick label of digiKam, marks a rejected image.
+func (i *Icon) readXMP() {
+	i.mu.Lock()
+	read, path := i.xmpRead, i.path
+	i.xmpRead = true
+	i.mu.Unlock()
+	if read {
+		return
+	}
+	if _, remote := remoteSourceOf(path); remote {
+		return
+	}
+	packet, ok := xmpPacket(path)
+	if !ok {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if m := xmpRatingRe.FindSubmatch(packet); m != nil {
+		i.rating, _ = strconv.Atoi(string(m[1]))
+	}
+	if m := xmpLabelRe.FindSubmatch(packet); m != nil {
+		i.label = strings.TrimSpace(string(m[1]))
+	}
+	if m := xmpPickRe.FindSubmatch(packet); m != nil && i.rating == 0 {
+		if pick, _ := strconv.Atoi(string(m[1])); pick == digiKamRejected {
+			i.rating = -1
+		}
+	}
+}
+
+// Rating returns the stars of the XMP rating, -1 if rejected, and the label.
+func (i *Icon) Rating() (rating int, label string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rating, i.label
+}
+
+// setRating sets the stars of the rating, like when replaying the journal.
+func (i *Icon) setRating(rating int) {
+	i.mu.Lock()
+	i.rating = rating
+	i.mu.Unlock()
+}
+
+// xmpPacket returns the XMP of the image at path, from a sidecar or from the file.
+func xmpPacket(path string) ([]byte, bool) {
+	for _, name := range []string{rawKey(path) + ".xmp", rawKey(path) + ".XMP", path + ".xmp"} {
+		if data, err := os.ReadFile(name); err == nil {
+			return data, true
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	head, err := io.ReadAll(io.LimitReader(f, xmpHeadSize))
+	if err != nil {
+		return nil, false
+	}
+	start := bytes.Index(head, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return nil, false
+	}
+	end := bytes.Index(head[start:], []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return nil, false
+	}
+	return head[start : start+end], true
+}
+
+// readXMPs reads the ratings and labels of the icons, in parallel.
+func readXMPs(icons []*Icon) {
+	work := make(chan *Icon)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for icon := range work {
+				icon.readXMP()
+			}
+		}()
+	}
+	for _, icon := range icons {
+		work <- icon
+	}
+	close(work)
+	wg.Wait()
+}
+
+// ratingInfo returns the rating and the label of the icon for the info.
+func (i *Icon) ratingInfo() string {
+	rating, label := i.Rating()
+	var s string
+	switch {
+	case rating < 0:
+		s = "Rejected"
+	case rating > 0:
+		s = "Rating: " + strings.Repeat("*", min(rating, 5))
+	}
+	if label != "" {
+		if s != "" {
+			s += " "
+		}
+		s += "Label: " + label
+	}
+	return s
+}